@@ -8,6 +8,8 @@ import (
 	"context"
 	"crypto/sha256"
 	"flag"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -20,6 +22,7 @@ import (
 	"github.com/saferwall/saferwall-api/internal/archive"
 	"github.com/saferwall/saferwall-api/internal/config"
 	"github.com/saferwall/saferwall-api/internal/db"
+	"github.com/saferwall/saferwall-api/internal/event"
 	"github.com/saferwall/saferwall-api/internal/mailer"
 	"github.com/saferwall/saferwall-api/internal/queue"
 	"github.com/saferwall/saferwall-api/internal/secure/password"
@@ -27,6 +30,8 @@ import (
 	"github.com/saferwall/saferwall-api/internal/server"
 	"github.com/saferwall/saferwall-api/internal/storage"
 	tpl "github.com/saferwall/saferwall-api/internal/template"
+	"github.com/saferwall/saferwall-api/internal/watch"
+	"github.com/saferwall/saferwall-api/internal/webhook"
 	"github.com/saferwall/saferwall-api/pkg/log"
 	"github.com/yeka/zip"
 )
@@ -121,11 +126,34 @@ func run(logger log.Logger) error {
 		return err
 	}
 
+	// Consuming events is only supported with NSQ, refuse an events topic
+	// which would be silently ignored otherwise.
+	if cfg.Broker.EventsTopic != "" && queue.Kind(cfg.Broker) != queue.NSQ {
+		return fmt.Errorf("events topic requires the %s broker, got %s",
+			queue.NSQ, queue.Kind(cfg.Broker))
+	}
+
 	// Create a producer to write messages to stream processing framework.
-	producer, err := queue.New(cfg.Broker.Address, cfg.Broker.Topic)
+	producer, err := queue.New(cfg.Broker)
 	if err != nil {
 		return err
 	}
+	defer producer.Close()
+
+	// Create a broker to push real-time events to the clients. When an
+	// events topic is configured, events go through the queue so that every
+	// API instance receives them. Consuming events is only supported with NSQ.
+	broker := event.NewMemoryBroker()
+	var events event.Publisher = broker
+	if cfg.Broker.EventsTopic != "" {
+		consumer, err := event.NewConsumer(cfg.Broker.Address,
+			cfg.Broker.EventsTopic, broker, logger)
+		if err != nil {
+			return err
+		}
+		defer consumer.Stop()
+		events = event.NewQueuePublisher(producer, cfg.Broker.EventsTopic)
+	}
 
 	// Create an archiver to zip files with a password in file download.
 	archiver := archive.New(zip.AES256Encryption)
@@ -142,10 +170,38 @@ func run(logger log.Logger) error {
 		}
 	}
 
+	// Create the watchlist service, it is shared by the handlers and the
+	// digester.
+	watchSvc := watch.NewService(watch.NewRepository(dbx, logger), logger,
+		smtpMailer, emailTemplates, cfg.UI.Address)
+
+	// Long-lived requests like event streams are canceled when the server
+	// shuts down, otherwise the shutdown would wait for them.
+	baseCtx, cancelBaseCtx := context.WithCancel(context.Background())
+	defer cancelBaseCtx()
+
+	handler, sched := server.BuildHandler(logger, dbx, sec, cfg, Version,
+		trans, updown, producer, smtpMailer, archiver, tokenGen,
+		emailTemplates, broker, events, watchSvc)
 	hs := &http.Server{
-		Addr: cfg.Address,
-		Handler: server.BuildHandler(logger, dbx, sec, cfg, Version, trans,
-			updown, producer, smtpMailer, archiver, tokenGen, emailTemplates),
+		Addr:        cfg.Address,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+		Handler:     handler,
+	}
+
+	hs.RegisterOnShutdown(cancelBaseCtx)
+
+	// Deliver the webhooks in the background.
+	dispatcher := webhook.NewDispatcher(webhook.NewRepository(dbx, logger),
+		logger)
+	go dispatcher.Run(baseCtx)
+
+	// Email the watchlist notification digests in the background.
+	go watch.NewDigester(watchSvc, logger).Run(baseCtx)
+
+	// Periodically rescan the stale files in the background.
+	if cfg.Scheduler.Enabled {
+		go sched.Run(baseCtx)
 	}
 
 	// Start server.
@@ -72,7 +72,8 @@ func (r repository) Create(ctx context.Context,
 // Update saves the changes to an activity in the database.
 func (r repository) Update(ctx context.Context, id string,
 	activity entity.Activity) error {
-	return r.db.Update(ctx, id, &activity)
+	_, err := r.db.Update(ctx, id, &activity, 0)
+	return err
 }
 
 // Patch performs a sub doc update to an activity in the database.
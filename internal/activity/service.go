@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/saferwall/saferwall-api/internal/event"
 	"github.com/saferwall/saferwall-api/pkg/log"
 )
 
@@ -32,6 +33,7 @@ type Activity struct {
 type service struct {
 	repo   Repository
 	logger log.Logger
+	events event.Publisher
 }
 
 // CreateActivityRequest represents a user creation request.
@@ -48,8 +50,9 @@ type UpdateActivityRequest struct {
 }
 
 // NewService creates a new user service.
-func NewService(repo Repository, logger log.Logger) Service {
-	return service{repo, logger}
+func NewService(repo Repository, logger log.Logger,
+	events event.Publisher) Service {
+	return service{repo, logger, events}
 }
 
 // Get returns the user with the specified user ID.
@@ -79,6 +82,14 @@ func (s service) Create(ctx context.Context, req CreateActivityRequest) (
 	if err != nil {
 		return Activity{}, err
 	}
+
+	// Notify the followers of the user, this is best effort.
+	ev := event.New(event.Activity, "", req.Username, map[string]string{
+		"id": id, "kind": req.Kind, "target": req.Target})
+	if err = s.events.Publish(ctx, ev); err != nil {
+		s.logger.With(ctx).Error(err)
+	}
+
 	return s.Get(ctx, id, nil)
 }
 
@@ -29,21 +29,27 @@ func (s Archiver) Archive(zipFilePath, password string, r io.Reader) error {
 	if err != nil {
 		return err
 	}
-
-	zipw := zip.NewWriter(fzip)
-	defer zipw.Close()
+	defer fzip.Close()
 
 	filename := trimExt(filepath.Base(zipFilePath))
-	w, err := zipw.Encrypt(filename, password, s.enc)
+	return s.ArchiveTo(fzip, filename, password, r)
+}
+
+// ArchiveTo streams a zip holding the binary data as filename, encrypted
+// using a password, to w.
+func (s Archiver) ArchiveTo(w io.Writer, filename, password string,
+	r io.Reader) error {
+
+	zipw := zip.NewWriter(w)
+	fw, err := zipw.Encrypt(filename, password, s.enc)
 	if err != nil {
 		return err
 	}
-	_, err = io.Copy(w, r)
+	_, err = io.Copy(fw, r)
 	if err != nil {
 		return err
 	}
-	zipw.Flush()
-	return nil
+	return zipw.Close()
 }
 
 // trimExt delete the extention from the file name.
@@ -0,0 +1,49 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package archive
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yeka/zip"
+)
+
+// unzip returns the name and the content of the single file of a zip.
+func unzip(t *testing.T, data []byte, password string) (string, string) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	assert.Nil(t, err)
+	assert.Len(t, r.File, 1)
+	f := r.File[0]
+	f.SetPassword(password)
+	rc, err := f.Open()
+	assert.Nil(t, err)
+	defer rc.Close()
+	content, err := io.ReadAll(rc)
+	assert.Nil(t, err)
+	return f.Name, string(content)
+}
+
+func TestArchiveTo(t *testing.T) {
+	var buf bytes.Buffer
+	a := New(zip.AES256Encryption)
+	err := a.ArchiveTo(&buf, "sample", "infected",
+		strings.NewReader("MZ\x90\x00"))
+	assert.Nil(t, err)
+
+	name, content := unzip(t, buf.Bytes(), "infected")
+	assert.Equal(t, "sample", name)
+	assert.Equal(t, "MZ\x90\x00", content)
+}
+
+func TestArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sample.zip")
+	a := New(zip.AES256Encryption)
+	assert.Nil(t, a.Archive(path, "infected", strings.NewReader("MZ")))
+}
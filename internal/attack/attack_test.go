@@ -0,0 +1,66 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package attack
+
+import (
+	"testing"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		id    string
+		name  string
+		known bool
+	}{
+		{"T1055", "Process Injection", true},
+		{" t1055.012", "Process Hollowing", true},
+		{"T1055.999", "Process Injection", true},
+		{"T9999", "T9999", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			technique, known := Lookup(tt.id)
+			assert.Equal(t, tt.known, known)
+			assert.Equal(t, tt.name, technique.Name)
+		})
+	}
+
+	sub, _ := Lookup("T1547.001")
+	assert.Equal(t, []string{"persistence", "privilege-escalation"},
+		sub.Tactics)
+	assert.True(t, IsValidID(NormalizeID("t1547.001")))
+	assert.False(t, IsValidID("T15470"))
+}
+
+func TestNewMatrix(t *testing.T) {
+	m := NewMatrix([]entity.Capability{
+		{Description: "Injects code", Techniques: []string{"T1055"}},
+		{Description: "Hollows a process", Techniques: []string{"T1055"}},
+		{Description: "Unknown", Techniques: []string{"T9999"}},
+	})
+
+	assert.Len(t, m.Tactics, len(Tactics()))
+	assert.Equal(t, "reconnaissance", m.Tactics[0].ShortName)
+	assert.Equal(t, 2, m.TechniquesCount)
+	assert.Equal(t, []Cell{{ID: "T9999", Name: "T9999",
+		Capabilities: []string{"Unknown"}}}, m.Unmapped)
+
+	cell := Cell{ID: "T1055", Name: "Process Injection",
+		Capabilities: []string{"Injects code", "Hollows a process"}}
+	placed := 0
+	for _, column := range m.Tactics {
+		switch column.ShortName {
+		case "defense-evasion", "privilege-escalation":
+			assert.Equal(t, []Cell{cell}, column.Techniques)
+			placed++
+		default:
+			assert.Empty(t, column.Techniques)
+		}
+	}
+	assert.Equal(t, 2, placed)
+}
@@ -0,0 +1,100 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+// Package attack maps the capabilities of behavior scans to the MITRE
+// ATT&CK enterprise matrix.
+package attack
+
+import (
+	_ "embed"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// catalogJSON lists the tactics of the matrix in order, along with the
+// techniques most commonly observed in sandboxes.
+//
+//go:embed catalog.json
+var catalogJSON []byte
+
+var regTechniqueID = regexp.MustCompile(`^T[0-9]{4}(\.[0-9]{3})?$`)
+
+// Tactic represents a column of the ATT&CK matrix.
+type Tactic struct {
+	// ID of the tactic, i.e: `TA0003`.
+	ID string `json:"id"`
+	// ShortName of the tactic, i.e: `persistence`.
+	ShortName string `json:"short_name"`
+	Name      string `json:"name"`
+}
+
+// Technique represents an ATT&CK technique or sub-technique.
+type Technique struct {
+	// ID of the technique, i.e: `T1055` or `T1055.012`.
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Tactics lists the short names of the tactics the technique belongs
+	// to. Sub-techniques belong to the tactics of their parent.
+	Tactics []string `json:"tactics,omitempty"`
+}
+
+type catalog struct {
+	Tactics    []Tactic    `json:"tactics"`
+	Techniques []Technique `json:"techniques"`
+}
+
+var (
+	tactics    []Tactic
+	techniques = make(map[string]Technique)
+)
+
+func init() {
+	var c catalog
+	if err := json.Unmarshal(catalogJSON, &c); err != nil {
+		panic(err)
+	}
+	tactics = c.Tactics
+	for _, t := range c.Techniques {
+		if parent, ok := techniques[parentID(t.ID)]; ok && len(t.Tactics) == 0 {
+			t.Tactics = parent.Tactics
+		}
+		techniques[t.ID] = t
+	}
+}
+
+// Tactics returns the tactics of the matrix in order.
+func Tactics() []Tactic {
+	return tactics
+}
+
+// Lookup returns a technique given its ID. Sub-techniques missing from the
+// catalog are named after their parent.
+func Lookup(id string) (Technique, bool) {
+	id = NormalizeID(id)
+	if t, ok := techniques[id]; ok {
+		return t, true
+	}
+	if parent, ok := techniques[parentID(id)]; ok {
+		return Technique{ID: id, Name: parent.Name, Tactics: parent.Tactics},
+			true
+	}
+	return Technique{ID: id, Name: id}, false
+}
+
+// NormalizeID returns the canonical form of a technique ID.
+func NormalizeID(id string) string {
+	return strings.ToUpper(strings.TrimSpace(id))
+}
+
+// IsValidID checks whether a normalized technique ID is well formed.
+func IsValidID(id string) bool {
+	return regTechniqueID.MatchString(id)
+}
+
+// parentID returns the ID of the parent of a sub-technique.
+func parentID(id string) string {
+	parent, _, _ := strings.Cut(id, ".")
+	return parent
+}
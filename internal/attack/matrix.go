@@ -0,0 +1,87 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package attack
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+)
+
+// Matrix represents capabilities laid out on the ATT&CK matrix.
+type Matrix struct {
+	// Tactics holds a column per tactic, in the order of the matrix, even
+	// when no technique of the tactic was observed.
+	Tactics []Column `json:"tactics"`
+	// Unmapped lists the techniques missing from the catalog, whose
+	// tactics are unknown.
+	Unmapped []Cell `json:"unmapped"`
+	// TechniquesCount is the number of distinct techniques observed.
+	TechniquesCount int `json:"techniques_count"`
+}
+
+// Column represents the techniques of a tactic.
+type Column struct {
+	Tactic
+	Techniques []Cell `json:"techniques"`
+}
+
+// Cell represents a technique observed along with the capabilities
+// mapping to it.
+type Cell struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// NewMatrix lays capabilities out on the matrix. A technique belonging to
+// several tactics appears in each of their columns.
+func NewMatrix(capabilities []entity.Capability) Matrix {
+	cells := make(map[string]*Cell)
+	for _, c := range capabilities {
+		for _, id := range c.Techniques {
+			cell, ok := cells[id]
+			if !ok {
+				t, _ := Lookup(id)
+				cell = &Cell{ID: t.ID, Name: t.Name, Capabilities: []string{}}
+				cells[id] = cell
+			}
+			if c.Description != "" &&
+				!slices.Contains(cell.Capabilities, c.Description) {
+				cell.Capabilities = append(cell.Capabilities, c.Description)
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(cells))
+	for id := range cells {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	m := Matrix{Tactics: make([]Column, 0, len(tactics)), Unmapped: []Cell{},
+		TechniquesCount: len(ids)}
+	columns := make(map[string]int, len(tactics))
+	for i, tactic := range tactics {
+		columns[tactic.ShortName] = i
+		m.Tactics = append(m.Tactics, Column{Tactic: tactic,
+			Techniques: []Cell{}})
+	}
+	for _, id := range ids {
+		t, known := Lookup(id)
+		if !known {
+			m.Unmapped = append(m.Unmapped, *cells[id])
+			continue
+		}
+		for _, tactic := range t.Tactics {
+			if i, ok := columns[tactic]; ok {
+				m.Tactics[i].Techniques = append(m.Tactics[i].Techniques,
+					*cells[id])
+			}
+		}
+	}
+	return m
+}
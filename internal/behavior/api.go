@@ -5,8 +5,11 @@
 package behavior
 
 import (
+	"bytes"
 	"context"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/labstack/echo/v4"
@@ -24,7 +27,7 @@ const (
 )
 
 func RegisterHandlers(g *echo.Group, service Service,
-	requireLogin, verifyID echo.MiddlewareFunc, logger log.Logger) {
+	requireLogin, verifyID, verifyHash echo.MiddlewareFunc, logger log.Logger) {
 
 	res := resource{service, logger}
 
@@ -32,6 +35,15 @@ func RegisterHandlers(g *echo.Group, service Service,
 	g.GET("/behaviors/:id/api-trace/", res.apis, verifyID)
 	g.GET("/behaviors/:id/sys-events/", res.events, verifyID)
 	g.GET("/behaviors/:id/artifacts/", res.artifacts, verifyID)
+	g.GET("/behaviors/:id/diff/:other/", res.diff, verifyID)
+	g.GET("/behaviors/:id/processes/", res.processes, verifyID)
+	g.GET("/behaviors/:id/processes/:pid/", res.process, verifyID)
+	g.GET("/behaviors/:id/iocs/", res.iocs, verifyID)
+	g.GET("/behaviors/:id/attack/", res.attack, verifyID)
+	g.GET("/behaviors/:id/screenshots/:n/", res.screenshot, verifyID)
+	g.GET("/behaviors/:id/artifacts/:sha256/download/", res.downloadArtifact,
+		verifyID, requireLogin)
+	g.GET("/files/:sha256/behaviors/", res.fileScans, verifyHash)
 
 }
 
@@ -73,20 +85,16 @@ func (r resource) get(c echo.Context) error {
 // @Description Paginates over the list of APIs
 // @Tags Behavior
 // @Param id path string true "Behavior report GUID"
+// @Param filter query string false "Conditions on pid, tid, name, ret, ts, like name=CreateFileW|name~=^Reg,ts>=10"
+// @Param sort query string false "Fields to sort on, prefixed by - for descending order"
 // @Success 200 {object} pagination.Pages
 // @Failure 400 {object} errors.ErrorResponse
 // @Failure 500 {object} errors.ErrorResponse
 // @Router /behaviors/{id}/api-trace/ [get]
 func (r resource) apis(c echo.Context) error {
-	ctx := c.Request().Context()
-
-	if len(c.QueryParams()) > 0 {
-		queryParams := c.QueryParams()
-		delete(queryParams, pagination.PageSizeVar)
-		delete(queryParams, pagination.PageVar)
-		if len(queryParams) > 0 {
-			ctx = WithFilters(ctx, queryParams)
-		}
+	ctx, err := withFilter(c, apisCollection)
+	if err != nil {
+		return err
 	}
 
 	count, err := r.service.CountAPIs(ctx, c.Param("id"))
@@ -108,20 +116,16 @@ func (r resource) apis(c echo.Context) error {
 // @Description Paginates over the list of system events.
 // @Tags Behavior
 // @Param id path string true "Behavior report GUID"
+// @Param filter query string false "Conditions on pid, type, path, op, ts, like name=CreateFileW|name~=^Reg,ts>=10"
+// @Param sort query string false "Fields to sort on, prefixed by - for descending order"
 // @Success 200 {object} pagination.Pages
 // @Failure 400 {object} errors.ErrorResponse
 // @Failure 500 {object} errors.ErrorResponse
 // @Router /behaviors/{id}/sys-events/ [get]
 func (r resource) events(c echo.Context) error {
-	ctx := c.Request().Context()
-
-	if len(c.QueryParams()) > 0 {
-		queryParams := c.QueryParams()
-		delete(queryParams, pagination.PageSizeVar)
-		delete(queryParams, pagination.PageVar)
-		if len(queryParams) > 0 {
-			ctx = WithFilters(ctx, queryParams)
-		}
+	ctx, err := withFilter(c, eventsCollection)
+	if err != nil {
+		return err
 	}
 
 	count, err := r.service.CountEvents(ctx, c.Param("id"))
@@ -143,20 +147,16 @@ func (r resource) events(c echo.Context) error {
 // @Description Returns a paginated list of artifacts' metadata such as memdumps, created files, etc ..
 // @Tags Behavior
 // @Param id path string true "Behavior report GUID"
+// @Param filter query string false "Conditions on kind, name, sha256, size, detection, like name=CreateFileW|name~=^Reg,ts>=10"
+// @Param sort query string false "Fields to sort on, prefixed by - for descending order"
 // @Success 200 {object} object{}
 // @Failure 400 {object} errors.ErrorResponse
 // @Failure 500 {object} errors.ErrorResponse
 // @Router /behaviors/{id}/artifacts/ [get]
 func (r resource) artifacts(c echo.Context) error {
-	ctx := c.Request().Context()
-
-	if len(c.QueryParams()) > 0 {
-		queryParams := c.QueryParams()
-		delete(queryParams, pagination.PageSizeVar)
-		delete(queryParams, pagination.PageVar)
-		if len(queryParams) > 0 {
-			ctx = WithFilters(ctx, queryParams)
-		}
+	ctx, err := withFilter(c, artifactsCollection)
+	if err != nil {
+		return err
 	}
 
 	count, err := r.service.CountArtifacts(ctx, c.Param("id"))
@@ -174,7 +174,240 @@ func (r resource) artifacts(c echo.Context) error {
 	return c.JSON(http.StatusOK, pages)
 }
 
+// @Summary List the behavior scans of a file.
+// @Description Paginates over the sandbox runs of a file with their OS,
+// @Description timeout and status, newest first.
+// @Tags Behavior
+// @Param sha256 path string true "SHA256"
+// @Success 200 {object} pagination.Pages{items=[]entity.BehaviorScan}
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /files/{sha256}/behaviors/ [get]
+func (r resource) fileScans(c echo.Context) error {
+	ctx := c.Request().Context()
+	count, err := r.service.CountFileScans(ctx, c.Param("sha256"))
+	if err != nil {
+		return err
+	}
+
+	pages := pagination.NewFromRequest(c.Request(), count)
+	scans, err := r.service.FileScans(ctx, c.Param("sha256"), pages.Offset(),
+		pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = scans
+	return c.JSON(http.StatusOK, pages)
+}
+
+// @Summary Compare two behavior scans.
+// @Description Returns the APIs called a different number of times, and the
+// @Description system events, artifacts and capabilities found in only one
+// @Description of the two scans. Process IDs and timestamps are ignored.
+// @Tags Behavior
+// @Param id path string true "Behavior report GUID"
+// @Param other path string true "GUID of the behavior report to compare with"
+// @Success 200 {object} Diff
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /behaviors/{id}/diff/{other}/ [get]
+func (r resource) diff(c echo.Context) error {
+	diff, err := r.service.Diff(c.Request().Context(), c.Param("id"),
+		c.Param("other"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, diff)
+}
+
+// @Summary Process tree of a behavior scan.
+// @Description Returns the processes created during a behavior scan as a
+// @Description tree.
+// @Tags Behavior
+// @Param id path string true "Behavior report GUID"
+// @Success 200 {array} Process
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /behaviors/{id}/processes/ [get]
+func (r resource) processes(c echo.Context) error {
+	tree, err := r.service.Processes(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, tree)
+}
+
+// @Summary Activity of a process of a behavior scan.
+// @Description Returns the API calls, system events, network activity and
+// @Description dumped artifacts of a process, in chronological order.
+// @Tags Behavior
+// @Param id path string true "Behavior report GUID"
+// @Param pid path string true "Process ID, decimal or 0x prefixed hex"
+// @Success 200 {object} ProcessActivity
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /behaviors/{id}/processes/{pid}/ [get]
+func (r resource) process(c echo.Context) error {
+	activity, err := r.service.Process(c.Request().Context(), c.Param("id"),
+		c.Param("pid"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, activity)
+}
+
+// @Summary Indicators of compromise of a behavior scan.
+// @Description Returns the deduplicated domains, IPs, URLs, mutexes, registry
+// @Description keys and dropped files hashes observed during a behavior scan,
+// @Description as JSON, CSV, plain text (one value per line) or OpenIOC 1.0.
+// @Tags Behavior
+// @Produce json,plain,xml
+// @Param id path string true "Behavior report GUID"
+// @Param format query string false "Export format" Enums(json, csv, txt, openioc) default(json)
+// @Success 200 {object} IOCs
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /behaviors/{id}/iocs/ [get]
+func (r resource) iocs(c echo.Context) error {
+	format := strings.ToLower(c.QueryParam("format"))
+	var contentType string
+	var write func(IOCs, io.Writer) error
+	switch format {
+	case "", IOCFormatJSON:
+	case IOCFormatCSV:
+		contentType, write = "text/csv; charset=utf-8", IOCs.writeCSV
+	case IOCFormatText:
+		contentType, write = echo.MIMETextPlainCharsetUTF8, IOCs.writeText
+	case IOCFormatOpenIOC:
+		contentType, write = echo.MIMEApplicationXMLCharsetUTF8,
+			IOCs.writeOpenIOC
+	default:
+		return errors.BadRequest(
+			"format must be one of: json, csv, txt, openioc")
+	}
+
+	iocs, err := r.service.IOCs(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	if write == nil {
+		return c.JSON(http.StatusOK, iocs)
+	}
+
+	var buf bytes.Buffer
+	if err = write(iocs, &buf); err != nil {
+		return err
+	}
+	return c.Blob(http.StatusOK, contentType, buf.Bytes())
+}
+
+// @Summary MITRE ATT&CK matrix of a behavior scan.
+// @Description Returns the capabilities of a behavior scan along with the
+// @Description ATT&CK techniques they map to, grouped by tactic in the order
+// @Description of the enterprise matrix.
+// @Tags Behavior
+// @Param id path string true "Behavior report GUID"
+// @Success 200 {object} AttackMatrix
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /behaviors/{id}/attack/ [get]
+func (r resource) attack(c echo.Context) error {
+	matrix, err := r.service.Attack(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, matrix)
+}
+
+// @Summary Download a screenshot of a behavior scan.
+// @Description Streams a screenshot taken during a behavior scan, either in
+// @Description full size or as a thumbnail. Screenshots are numbered from 0.
+// @Tags Behavior
+// @Produce jpeg
+// @Param id path string true "Behavior report GUID"
+// @Param n path int true "Screenshot number"
+// @Param size query string false "Either full (default) or thumbnail"
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /behaviors/{id}/screenshots/{n}/ [get]
+func (r resource) screenshot(c echo.Context) error {
+	ctx := c.Request().Context()
+	n, err := strconv.Atoi(c.Param("n"))
+	if err != nil {
+		return errors.BadRequest("invalid screenshot number")
+	}
+	size := c.QueryParam("size")
+	if size != "" && size != "full" && size != "thumbnail" {
+		return errors.BadRequest("size must be either full or thumbnail")
+	}
+
+	key, err := r.service.ScreenshotKey(ctx, c.Param("id"), n,
+		size == "thumbnail")
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "image/jpeg")
+	c.Response().WriteHeader(http.StatusOK)
+	if err = r.service.Screenshot(ctx, key, c.Response()); err != nil {
+		// The response is already on its way, the error can only be logged.
+		r.logger.With(ctx).Error(err)
+	}
+	return nil
+}
+
+// @Summary Download an artifact of a behavior scan.
+// @Description Streams a memory dump or a dropped file. Artifacts are in zip
+// @Description format and password protected like samples.
+// @Tags Behavior
+// @Produce mpfd
+// @Param id path string true "Behavior report GUID"
+// @Param sha256 path string true "Artifact SHA256"
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 401 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /behaviors/{id}/artifacts/{sha256}/download/ [get]
+// @Security Bearer
+func (r resource) downloadArtifact(c echo.Context) error {
+	ctx := c.Request().Context()
+	sha256 := strings.ToLower(c.Param("sha256"))
+	key, err := r.service.ArtifactKey(ctx, c.Param("id"), sha256)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "application/zip")
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+		`attachment; filename="`+sha256+`.zip"`)
+	c.Response().WriteHeader(http.StatusOK)
+	err = r.service.DownloadArtifact(ctx, key, sha256, c.Response())
+	if err != nil {
+		// The response is already on its way, the error can only be logged.
+		r.logger.With(ctx).Error(err)
+	}
+	return nil
+}
+
 // WithFilters returns a context that contains the API filters.
-func WithFilters(ctx context.Context, value map[string][]string) context.Context {
+func WithFilters(ctx context.Context, value Filter) context.Context {
 	return context.WithValue(ctx, filtersKey, value)
 }
+
+// withFilter returns the request context along with the filter of a
+// collection parsed from the query parameters.
+func withFilter(c echo.Context, coll collection) (context.Context, error) {
+	ctx := c.Request().Context()
+	filter, err := parseFilter(coll, c.QueryParams())
+	if err != nil {
+		return ctx, err
+	}
+	return WithFilters(ctx, filter), nil
+}
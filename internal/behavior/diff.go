@@ -0,0 +1,185 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package behavior
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+)
+
+// Maximum number of added or removed items reported per collection.
+const maxDiffItems = 1000
+
+// Fields which differ between runs without the behavior being different,
+// like process IDs and timestamps. They are ignored when comparing items.
+var volatileFields = map[string]bool{
+	"id":        true,
+	"pid":       true,
+	"ppid":      true,
+	"proc_id":   true,
+	"tid":       true,
+	"thread_id": true,
+	"time":      true,
+	"timestamp": true,
+	"ts":        true,
+}
+
+// Diff represents the differences between two behavior scans.
+type Diff struct {
+	Base         entity.BehaviorScan `json:"base"`
+	Other        entity.BehaviorScan `json:"other"`
+	APIs         []APIChange         `json:"apis"`
+	Events       Changes             `json:"events"`
+	Artifacts    Changes             `json:"artifacts"`
+	Capabilities Changes             `json:"capabilities"`
+}
+
+// APIChange represents an API called a different number of times in two
+// behavior scans.
+type APIChange struct {
+	Name  string `json:"name"`
+	Base  int    `json:"base"`
+	Other int    `json:"other"`
+}
+
+// Changes represents the items found in only one of two behavior scans.
+// Truncated is true when there were more than maxDiffItems changes.
+type Changes struct {
+	Added     []interface{} `json:"added"`
+	Removed   []interface{} `json:"removed"`
+	Common    int           `json:"common"`
+	Truncated bool          `json:"truncated,omitempty"`
+}
+
+// summary returns the summary of a behavior scan.
+func summary(id string, b entity.Behavior) entity.BehaviorScan {
+	scan := entity.BehaviorScan{
+		ID:               id,
+		SHA256:           b.SHA256,
+		Timestamp:        b.Timestamp,
+		Status:           b.Status,
+		ScreenshotsCount: b.ScreenshotsCount,
+	}
+	if cfg := b.ScanConfig; cfg != nil {
+		scan.OS = cfg.OS
+		scan.Country = cfg.Country
+		scan.Timeout = cfg.Timeout
+	}
+	return scan
+}
+
+// diff compares two behavior scans.
+func diff(baseID string, base entity.Behavior, baseAPIs map[string]int,
+	otherID string, other entity.Behavior, otherAPIs map[string]int) Diff {
+
+	return Diff{
+		Base:         summary(baseID, base),
+		Other:        summary(otherID, other),
+		APIs:         diffAPIs(baseAPIs, otherAPIs),
+		Events:       diffItems(base.SystemEvents, other.SystemEvents),
+		Artifacts:    diffItems(base.Artifacts, other.Artifacts),
+		Capabilities: diffItems(base.Capabilities, other.Capabilities),
+	}
+}
+
+// diffAPIs returns the APIs whose number of calls changed, sorted by name.
+func diffAPIs(base, other map[string]int) []APIChange {
+	changes := []APIChange{}
+	for name, count := range base {
+		if other[name] != count {
+			changes = append(changes, APIChange{name, count, other[name]})
+		}
+	}
+	for name, count := range other {
+		if _, ok := base[name]; !ok {
+			changes = append(changes, APIChange{name, 0, count})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// diffItems returns the distinct items found in only one of two
+// collections, in the order they appear. Items are compared on their JSON
+// representation.
+func diffItems(base, other interface{}) Changes {
+	baseItems, otherItems := genericItems(base), genericItems(other)
+
+	baseKeys := make(map[string]bool, len(baseItems))
+	for _, item := range baseItems {
+		baseKeys[itemKey(item)] = true
+	}
+	otherKeys := make(map[string]bool, len(otherItems))
+	for _, item := range otherItems {
+		otherKeys[itemKey(item)] = true
+	}
+
+	added, addedTruncated := onlyIn(otherItems, baseKeys)
+	removed, removedTruncated := onlyIn(baseItems, otherKeys)
+	changes := Changes{
+		Added:     added,
+		Removed:   removed,
+		Truncated: addedTruncated || removedTruncated,
+	}
+	for key := range baseKeys {
+		if otherKeys[key] {
+			changes.Common++
+		}
+	}
+	return changes
+}
+
+// genericItems converts a collection of typed items to JSON values.
+func genericItems(collection interface{}) []interface{} {
+	var items []interface{}
+	if data, err := json.Marshal(collection); err == nil {
+		_ = json.Unmarshal(data, &items)
+	}
+	return items
+}
+
+// onlyIn returns the distinct items whose key is not in keys.
+func onlyIn(items []interface{}, keys map[string]bool) ([]interface{}, bool) {
+	found := []interface{}{}
+	seen := make(map[string]bool)
+	for _, item := range items {
+		key := itemKey(item)
+		if keys[key] || seen[key] {
+			continue
+		}
+		if len(found) == maxDiffItems {
+			return found, true
+		}
+		seen[key] = true
+		found = append(found, item)
+	}
+	return found, false
+}
+
+// itemKey identifies an item across runs. Artifacts are identified by
+// their hash, other items by their fields except the volatile ones.
+func itemKey(item interface{}) string {
+	m, ok := item.(map[string]interface{})
+	if !ok {
+		b, _ := json.Marshal(item)
+		return string(b)
+	}
+	if sha256, ok := m["sha256"].(string); ok && sha256 != "" {
+		return "sha256:" + sha256
+	}
+	stable := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if !volatileFields[k] {
+			stable[k] = v
+		}
+	}
+	// Maps are marshaled with sorted keys.
+	b, _ := json.Marshal(stable)
+	return string(b)
+}
@@ -0,0 +1,95 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package behavior
+
+import (
+	"context"
+	"testing"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	win7 := entity.Behavior{
+		SHA256:     "abc",
+		Timestamp:  10,
+		ScanConfig: &entity.BehaviorConfig{OS: "win-7", Timeout: 30},
+		SystemEvents: []entity.SystemEvent{
+			{PID: "0x10", Type: "file", Path: `C:\a.txt`},
+			{PID: "0x10", Type: "registry", Path: `HKCU\Run`},
+		},
+		Artifacts: []entity.Artifact{{SHA256: "1", Name: "dump.bin"}},
+	}
+	win10 := entity.Behavior{
+		SHA256:    "abc",
+		Timestamp: 20,
+		ScanConfig: &entity.BehaviorConfig{OS: "win-10", Timeout: 60,
+			Country: "fr"},
+		SystemEvents: []entity.SystemEvent{
+			// Same event from another process.
+			{PID: "0x20", Type: "file", Path: `C:\a.txt`},
+			{PID: "0x20", Type: "network", Path: "1.2.3.4:443"},
+			{PID: "0x24", Type: "network", Path: "1.2.3.4:443"},
+		},
+		Artifacts:    []entity.Artifact{{SHA256: "1", Name: "memdump.bin"}},
+		Capabilities: []entity.Capability{{Description: "persistence"}},
+	}
+
+	d := diff("a", win7, map[string]int{"CreateFileW": 2, "RegSetValueW": 1},
+		"b", win10, map[string]int{"CreateFileW": 2, "connect": 4})
+
+	assert.Equal(t, entity.BehaviorScan{ID: "a", SHA256: "abc",
+		Timestamp: 10, OS: "win-7", Timeout: 30}, d.Base)
+	assert.Equal(t, "fr", d.Other.Country)
+	assert.Equal(t, []APIChange{
+		{Name: "RegSetValueW", Base: 1, Other: 0},
+		{Name: "connect", Base: 0, Other: 4},
+	}, d.APIs)
+
+	assert.Equal(t, 1, d.Events.Common)
+	assert.Equal(t, []interface{}{map[string]interface{}{"pid": "0x20",
+		"type": "network", "path": "1.2.3.4:443", "ts": float64(0)}},
+		d.Events.Added)
+	assert.Equal(t, []interface{}{map[string]interface{}{"pid": "0x10",
+		"type": "registry", "path": `HKCU\Run`, "ts": float64(0)}},
+		d.Events.Removed)
+
+	// Artifacts are compared by hash.
+	assert.Equal(t, Changes{Added: []interface{}{}, Removed: []interface{}{},
+		Common: 1}, d.Artifacts)
+	assert.Len(t, d.Capabilities.Added, 1)
+	assert.Empty(t, d.Capabilities.Removed)
+}
+
+// mockTracer keeps the documents by ID.
+type mockTracer struct {
+	Repository
+	docs map[string]entity.Behavior
+}
+
+func (m mockTracer) Trace(ctx context.Context, id string) (entity.Behavior,
+	error) {
+	return m.docs[id], nil
+}
+
+func (m mockTracer) APICounts(ctx context.Context, id string) (
+	map[string]int, error) {
+	return map[string]int{}, nil
+}
+
+func TestDiffOtherDocument(t *testing.T) {
+	base, other := entity.ID(), entity.ID()
+	s := service{repo: mockTracer{docs: map[string]entity.Behavior{
+		base:  {Type: "behavior"},
+		other: {Type: "file"},
+	}}}
+	_, err := s.Diff(context.Background(), base, other)
+	assert.Equal(t, errBehaviorNotFound, err)
+
+	s.repo.(mockTracer).docs[other] = entity.Behavior{Type: "behavior"}
+	_, err = s.Diff(context.Background(), base, other)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,72 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package behavior
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/saferwall/saferwall-api/internal/archive"
+	"github.com/saferwall/saferwall-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/yeka/zip"
+)
+
+type mockDownloader struct {
+	objects map[string]string
+}
+
+func (m mockDownloader) Download(ctx context.Context, bucket, key string,
+	file io.Writer) error {
+	_, err := io.WriteString(file, m.objects[bucket+"/"+key])
+	return err
+}
+
+func (m mockDownloader) Exists(ctx context.Context, bucket, key string) (
+	bool, error) {
+	_, ok := m.objects[bucket+"/"+key]
+	return ok, nil
+}
+
+func TestDownloads(t *testing.T) {
+	id := "6f1d6d6a-3c8a-4a54-9e3b-8ad1b5c5ef52"
+	sha256 := "131f95c51cc819465fa1797f6ccacf9d494aaaff46fa3eac73ae63ffbdfd8267"
+	objSto := mockDownloader{objects: map[string]string{
+		"artifacts/" + screenshotKey(id, 0, true): "thumbnail",
+		"artifacts/" + artifactKey(id, sha256):    "memdump",
+	}}
+	s := service{logger: log.New(), objSto: objSto, bucket: "artifacts",
+		archiver: archive.New(zip.AES256Encryption), zipPwd: "infected"}
+	ctx := context.Background()
+
+	assert.Equal(t, id+"/screenshots/0.min.jpeg", screenshotKey(id, 0, true))
+	assert.Equal(t, id+"/screenshots/3.jpeg", screenshotKey(id, 3, false))
+
+	var buf bytes.Buffer
+	assert.Nil(t, s.Screenshot(ctx, screenshotKey(id, 0, true), &buf))
+	assert.Equal(t, "thumbnail", buf.String())
+
+	assert.Nil(t, s.exists(ctx, artifactKey(id, sha256)))
+	assert.Equal(t, errObjectNotFound, s.exists(ctx, screenshotKey(id, 0,
+		false)))
+
+	buf.Reset()
+	err := s.DownloadArtifact(ctx, artifactKey(id, sha256), sha256, &buf)
+	assert.Nil(t, err)
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Nil(t, err)
+	assert.Equal(t, sha256, r.File[0].Name)
+	r.File[0].SetPassword("infected")
+	rc, err := r.File[0].Open()
+	assert.Nil(t, err)
+	content, _ := io.ReadAll(rc)
+	assert.Equal(t, "memdump", string(content))
+
+	// The artifacts container is optional.
+	s.bucket = ""
+	assert.Equal(t, errObjectNotFound, s.exists(ctx, artifactKey(id, sha256)))
+}
@@ -0,0 +1,443 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package behavior
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	e "github.com/saferwall/saferwall-api/internal/errors"
+	"github.com/saferwall/saferwall-api/pkg/pagination"
+)
+
+// Query parameters holding the filter expressions and the sort order.
+const (
+	filterVar = "filter"
+	sortVar   = "sort"
+)
+
+// Limits on the size of a filter.
+const (
+	maxConditions = 20
+	maxValueLen   = 256
+)
+
+// Filter operators.
+const (
+	opEq       = "="
+	opNe       = "!="
+	opContains = "*="
+	opRegex    = "~="
+	opGt       = ">"
+	opGe       = ">="
+	opLt       = "<"
+	opLe       = "<="
+)
+
+// Operators ordered so that the longest ones are matched first.
+var operators = []string{opNe, opContains, opRegex, opGe, opLe, opEq, opGt,
+	opLt}
+
+// fieldKind tells how the values of a field are compared.
+type fieldKind int
+
+const (
+	// stringField values support equality, contains and regex.
+	stringField fieldKind = iota
+	// numberField values support equality and ranges.
+	numberField
+	// hexField values are the process and thread IDs reported by the
+	// sandbox as numbers or as decimal or hex strings. They compare by their
+	// numeric value and support equality and ranges.
+	hexField
+)
+
+// collection describes an array of a behavior report which can be
+// filtered.
+type collection struct {
+	// Alias the items are unnested as.
+	alias string
+	// Path of the array in the document.
+	path string
+	// Suffix appended to the behavior ID to get the document key.
+	keySuffix string
+	// Fields which can be filtered and sorted on.
+	fields map[string]fieldKind
+}
+
+var (
+	apisCollection = collection{
+		alias:     "api",
+		path:      "api_trace",
+		keySuffix: "::apis",
+		fields: map[string]fieldKind{
+			"pid":  hexField,
+			"tid":  hexField,
+			"name": stringField,
+			"ret":  stringField,
+			"ts":   numberField,
+		},
+	}
+	eventsCollection = collection{
+		alias:     "event",
+		path:      "sys_events",
+		keySuffix: "::events",
+		fields: map[string]fieldKind{
+			"pid":  hexField,
+			"type": stringField,
+			"path": stringField,
+			"op":   stringField,
+			"ts":   numberField,
+		},
+	}
+	artifactsCollection = collection{
+		alias: "artifact",
+		path:  "artifacts",
+		fields: map[string]fieldKind{
+			"pid":       hexField,
+			"kind":      stringField,
+			"name":      stringField,
+			"sha256":    stringField,
+			"size":      numberField,
+			"detection": stringField,
+		},
+	}
+)
+
+var regFieldName = regexp.MustCompile(`^[a-z_]+`)
+
+// Filter represents the conditions the items of a collection must match,
+// and the order they are returned in.
+type Filter struct {
+	// Groups are AND-ed together, the conditions of a group are OR-ed.
+	Groups [][]Condition
+	// Sort lists the fields to sort on, by priority.
+	Sort []SortField
+}
+
+// Condition represents a comparison between a field and a value.
+type Condition struct {
+	Field string
+	Op    string
+	Value string
+}
+
+// SortField represents a field to sort on.
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// parseFilter builds the filter of a collection from the query parameters
+// of a request.
+//
+// Every `filter` parameter holds conditions separated by commas which must
+// all match. A condition is made of alternatives separated by pipes, any of
+// which must match, like `name=CreateFileW|name=CreateFileA`. Values may be
+// double quoted to contain commas or pipes. The operators are `=`, `!=`,
+// `*=` (contains), `~=` (regex), `>`, `>=`, `<` and `<=`.
+//
+// The `sort` parameter lists the fields to sort on separated by commas,
+// prefixed by `-` to sort in descending order.
+//
+// For backward compatibility, any other parameter named after a field
+// matches items whose field equals one of its values.
+func parseFilter(coll collection, params url.Values) (Filter, error) {
+	var f Filter
+	count := 0
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		values := params[name]
+		switch name {
+		case pagination.PageVar, pagination.PageSizeVar:
+		case filterVar:
+			for _, value := range values {
+				groups, err := parseExpr(coll, value)
+				if err != nil {
+					return Filter{}, err
+				}
+				f.Groups = append(f.Groups, groups...)
+			}
+		case sortVar:
+			for _, value := range values {
+				fields, err := parseSort(coll, value)
+				if err != nil {
+					return Filter{}, err
+				}
+				f.Sort = append(f.Sort, fields...)
+			}
+		default:
+			if _, ok := coll.fields[name]; !ok {
+				return Filter{}, e.BadRequest(
+					fmt.Sprintf("unknown filter field %q", name))
+			}
+			group := []Condition{}
+			for _, value := range values {
+				cond := Condition{Field: name, Op: opEq, Value: value}
+				if err := checkCondition(coll, cond); err != nil {
+					return Filter{}, err
+				}
+				group = append(group, cond)
+			}
+			f.Groups = append(f.Groups, group)
+		}
+	}
+
+	for _, group := range f.Groups {
+		count += len(group)
+	}
+	if count > maxConditions {
+		return Filter{}, e.BadRequest(
+			fmt.Sprintf("too many filter conditions, maximum is %d",
+				maxConditions))
+	}
+	return f, nil
+}
+
+// parseExpr parses a list of comma separated groups of conditions.
+func parseExpr(coll collection, expr string) ([][]Condition, error) {
+	var groups [][]Condition
+	group := []Condition{}
+	rest := expr
+
+	for {
+		name := regFieldName.FindString(rest)
+		if name == "" {
+			return nil, errSyntax(expr, "field name expected")
+		}
+		rest = rest[len(name):]
+
+		op := ""
+		for _, candidate := range operators {
+			if strings.HasPrefix(rest, candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return nil, errSyntax(expr, "operator expected after "+name)
+		}
+		rest = rest[len(op):]
+
+		value, remaining, err := parseValue(rest)
+		if err != nil {
+			return nil, errSyntax(expr, err.Error())
+		}
+		rest = remaining
+
+		cond := Condition{Field: name, Op: op, Value: value}
+		if err := checkCondition(coll, cond); err != nil {
+			return nil, err
+		}
+		group = append(group, cond)
+
+		if rest == "" {
+			return append(groups, group), nil
+		}
+		switch rest[0] {
+		case '|':
+		case ',':
+			groups = append(groups, group)
+			group = []Condition{}
+		default:
+			return nil, errSyntax(expr, "unexpected "+strconv.Quote(rest[:1]))
+		}
+		rest = rest[1:]
+	}
+}
+
+// parseValue parses a value, optionally double quoted, up to the next
+// separator.
+func parseValue(s string) (string, string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		end := strings.IndexAny(s, ",|")
+		if end < 0 {
+			end = len(s)
+		}
+		return s[:end], s[end:], nil
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 == len(s) {
+				return "", "", fmt.Errorf("unterminated escape sequence")
+			}
+			i++
+			b.WriteByte(s[i])
+		case '"':
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", fmt.Errorf("unterminated quoted value")
+}
+
+// checkCondition checks that a condition applies to the field it compares.
+func checkCondition(coll collection, cond Condition) error {
+	kind, ok := coll.fields[cond.Field]
+	if !ok {
+		return e.BadRequest(fmt.Sprintf("unknown filter field %q",
+			cond.Field))
+	}
+	if len(cond.Value) > maxValueLen {
+		return e.BadRequest(fmt.Sprintf(
+			"filter values are limited to %d characters", maxValueLen))
+	}
+
+	switch cond.Op {
+	case opContains, opRegex:
+		if kind != stringField {
+			return errOperator(cond)
+		}
+	case opGt, opGe, opLt, opLe:
+		if kind == stringField {
+			return errOperator(cond)
+		}
+	}
+
+	switch {
+	case cond.Op == opRegex:
+		if _, err := regexp.Compile(cond.Value); err != nil {
+			return e.BadRequest(fmt.Sprintf("invalid regex for %s: %v",
+				cond.Field, err))
+		}
+	case kind == numberField:
+		if _, err := strconv.ParseFloat(cond.Value, 64); err != nil {
+			return e.BadRequest(fmt.Sprintf("%s expects a number", cond.Field))
+		}
+	case kind == hexField:
+		if _, err := parseHex(cond.Value); err != nil {
+			return e.BadRequest(fmt.Sprintf(
+				"%s expects a decimal or 0x prefixed hex number", cond.Field))
+		}
+	}
+	return nil
+}
+
+// parseSort parses a list of comma separated fields to sort on.
+func parseSort(coll collection, value string) ([]SortField, error) {
+	var fields []SortField
+	for _, name := range strings.Split(value, ",") {
+		field := SortField{Field: strings.TrimPrefix(name, "-")}
+		field.Desc = field.Field != name
+		if _, ok := coll.fields[field.Field]; !ok {
+			return nil, e.BadRequest(
+				fmt.Sprintf("unknown sort field %q", field.Field))
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// parseHex parses a decimal or a 0x prefixed hex number.
+func parseHex(value string) (uint64, error) {
+	lower := strings.ToLower(value)
+	if strings.HasPrefix(lower, "0x") {
+		return strconv.ParseUint(lower[2:], 16, 64)
+	}
+	return strconv.ParseUint(lower, 10, 64)
+}
+
+// where returns the WHERE clause of the filter, the values are bound to
+// named parameters added to params. Field names come from the whitelist of
+// the collection, never from the request.
+func (f Filter) where(coll collection, params map[string]interface{}) string {
+	if len(f.Groups) == 0 {
+		return ""
+	}
+
+	n := 0
+	and := make([]string, 0, len(f.Groups))
+	for _, group := range f.Groups {
+		or := make([]string, 0, len(group))
+		for _, cond := range group {
+			param := fmt.Sprintf("f%d", n)
+			n++
+			or = append(or, cond.clause(coll, param, params))
+		}
+		and = append(and, "("+strings.Join(or, " OR ")+")")
+	}
+	return " WHERE " + strings.Join(and, " AND ")
+}
+
+// clause returns the N1QL expression of a condition bound to param.
+func (cond Condition) clause(coll collection, param string,
+	params map[string]interface{}) string {
+
+	field := coll.alias + ".`" + cond.Field + "`"
+	switch coll.fields[cond.Field] {
+	case numberField:
+		params[param], _ = strconv.ParseFloat(cond.Value, 64)
+		return fmt.Sprintf("%s %s $%s", field, cond.Op, param)
+	case hexField:
+		params[param], _ = parseHex(cond.Value)
+		return fmt.Sprintf("%s %s $%s", hexExpr(field), cond.Op, param)
+	}
+
+	switch cond.Op {
+	case opContains:
+		params[param] = strings.ToLower(cond.Value)
+		return fmt.Sprintf("CONTAINS(LOWER(%s), $%s)", field, param)
+	case opRegex:
+		params[param] = cond.Value
+		return fmt.Sprintf("REGEXP_CONTAINS(%s, $%s)", field, param)
+	}
+	params[param] = cond.Value
+	return fmt.Sprintf("%s %s $%s", field, cond.Op, param)
+}
+
+// hexExpr returns the N1QL expression of the numeric value of a hex field.
+// The sandbox reports the IDs as numbers or as decimal or 0x prefixed hex
+// strings, and N1QL has no function to parse the latter.
+func hexExpr(field string) string {
+	return fmt.Sprintf("(CASE WHEN ISNUMBER(%[1]s) THEN %[1]s"+
+		" WHEN LOWER(%[1]s) LIKE \"0x%%\" THEN ARRAY_SUM(ARRAY"+
+		" POSITION(\"0123456789abcdef\", SUBSTR(LOWER(%[1]s), hexpos, 1))"+
+		" * POWER(16, LENGTH(%[1]s) - 1 - hexpos)"+
+		" FOR hexpos IN ARRAY_RANGE(2, LENGTH(%[1]s)) END)"+
+		" ELSE TO_NUMBER(%[1]s) END)", field)
+}
+
+// orderBy returns the ORDER BY clause of the filter.
+func (f Filter) orderBy(coll collection) string {
+	if len(f.Sort) == 0 {
+		return ""
+	}
+	terms := make([]string, 0, len(f.Sort))
+	for _, s := range f.Sort {
+		dir := " ASC"
+		if s.Desc {
+			dir = " DESC"
+		}
+		field := coll.alias + ".`" + s.Field + "`"
+		if coll.fields[s.Field] == hexField {
+			field = hexExpr(field)
+		}
+		terms = append(terms, field+dir)
+	}
+	return " ORDER BY " + strings.Join(terms, ", ")
+}
+
+func errSyntax(expr, msg string) error {
+	return e.BadRequest(fmt.Sprintf("invalid filter %q: %s", expr, msg))
+}
+
+func errOperator(cond Condition) error {
+	return e.BadRequest(fmt.Sprintf("operator %s does not apply to %s",
+		cond.Op, cond.Field))
+}
@@ -0,0 +1,118 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package behavior
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFilter(t *testing.T) {
+	params := url.Values{
+		"filter": {`name=CreateFileW|name~=^Reg,pid>=0x10`,
+			`ret!="0x0,1"`},
+		"sort":     {"-ts,name"},
+		"tid":      {"0x20", "32"},
+		"page":     {"2"},
+		"per_page": {"10"},
+	}
+	f, err := parseFilter(apisCollection, params)
+	assert.Nil(t, err)
+	assert.Equal(t, Filter{
+		Groups: [][]Condition{
+			{{"name", opEq, "CreateFileW"}, {"name", opRegex, "^Reg"}},
+			{{"pid", opGe, "0x10"}},
+			{{"ret", opNe, "0x0,1"}},
+			{{"tid", opEq, "0x20"}, {"tid", opEq, "32"}},
+		},
+		Sort: []SortField{{"ts", true}, {"name", false}},
+	}, f)
+
+	bound := map[string]interface{}{}
+	pid, tid := hexExpr("api.`pid`"), hexExpr("api.`tid`")
+	assert.Equal(t, " WHERE (api.`name` = $f0 OR REGEXP_CONTAINS(api.`name`, $f1))"+
+		" AND ("+pid+" >= $f2)"+
+		" AND (api.`ret` != $f3)"+
+		" AND ("+tid+" = $f4 OR "+tid+" = $f5)",
+		f.where(apisCollection, bound))
+	assert.Equal(t, map[string]interface{}{
+		"f0": "CreateFileW",
+		"f1": "^Reg",
+		"f2": uint64(16),
+		"f3": "0x0,1",
+		"f4": uint64(32),
+		"f5": uint64(32),
+	}, bound)
+	assert.Equal(t, " ORDER BY api.`ts` DESC, api.`name` ASC",
+		f.orderBy(apisCollection))
+
+	f, err = parseFilter(eventsCollection, url.Values{
+		"filter": {`path*=AppData,ts<12.5`}})
+	assert.Nil(t, err)
+	bound = map[string]interface{}{}
+	assert.Equal(t, " WHERE (CONTAINS(LOWER(event.`path`), $f0))"+
+		" AND (event.`ts` < $f1)", f.where(eventsCollection, bound))
+	assert.Equal(t, map[string]interface{}{"f0": "appdata", "f1": 12.5},
+		bound)
+
+	// No filter at all.
+	f, err = parseFilter(artifactsCollection, url.Values{})
+	assert.Nil(t, err)
+	assert.Empty(t, f.where(artifactsCollection, bound))
+	assert.Empty(t, f.orderBy(artifactsCollection))
+}
+
+func TestHexFilter(t *testing.T) {
+	// The sandbox reports the same PID as a number, or as a decimal or a
+	// hex string. Every form of the filter value binds the same number,
+	// compared to the numeric value of the stored one.
+	field := "event.`pid`"
+	expr := hexExpr(field)
+	assert.Contains(t, expr, "WHEN ISNUMBER("+field+") THEN "+field)
+	assert.Contains(t, expr, "ELSE TO_NUMBER("+field+")")
+	assert.Contains(t, expr, "LIKE \"0x%\"")
+	for _, value := range []string{"16", "0x10", "0X10"} {
+		f, err := parseFilter(eventsCollection, url.Values{
+			"filter": {"pid=" + value}, "sort": {"-pid"}})
+		assert.Nil(t, err)
+		bound := map[string]interface{}{}
+		assert.Equal(t, " WHERE ("+expr+" = $f0)",
+			f.where(eventsCollection, bound))
+		assert.Equal(t, map[string]interface{}{"f0": uint64(16)}, bound)
+		assert.Equal(t, " ORDER BY "+expr+" DESC",
+			f.orderBy(eventsCollection))
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	invalid := []url.Values{
+		// Fields must be whitelisted, even with the legacy syntax.
+		{"name) OR 1=1 --": {"x"}},
+		{"filter": {"args=x"}},
+		{"filter": {"=x"}},
+		{"filter": {"name"}},
+		{"filter": {`name="unterminated`}},
+		{"filter": {`name="x"y`}},
+		{"filter": {"name>x"}},
+		{"filter": {"ts*=1"}},
+		{"filter": {"ts=abc"}},
+		{"filter": {"pid>=0xzz"}},
+		{"filter": {"name~=("}},
+		{"sort": {"args"}},
+	}
+	for _, params := range invalid {
+		_, err := parseFilter(apisCollection, params)
+		assert.NotNil(t, err, "%v", params)
+	}
+
+	tooMany := url.Values{}
+	for i := 0; i <= maxConditions; i++ {
+		tooMany.Add("name", "x")
+	}
+	_, err := parseFilter(apisCollection, tooMany)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,335 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package behavior
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/saferwall/saferwall-api/pkg/netutil"
+)
+
+// Maximum number of events and artifacts the IOCs are extracted from.
+const maxIOCItems = 10000
+
+// IOC types.
+const (
+	IOCDomain   = "domain"
+	IOCIP       = "ip"
+	IOCURL      = "url"
+	IOCMutex    = "mutex"
+	IOCRegistry = "registry"
+	IOCSHA256   = "sha256"
+)
+
+// IOC export formats, JSON is the default.
+const (
+	IOCFormatJSON    = "json"
+	IOCFormatCSV     = "csv"
+	IOCFormatText    = "txt"
+	IOCFormatOpenIOC = "openioc"
+)
+
+// System events types IOCs are extracted from.
+const (
+	eventNetwork  = "network"
+	eventDNS      = "dns"
+	eventMutex    = "mutex"
+	eventRegistry = "registry"
+)
+
+// Artifacts kinds which are not files dropped by the sample.
+var notDropped = map[string]bool{
+	"memdump": true,
+}
+
+var regDomain = regexp.MustCompile(
+	`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// openIOCNamespace is the namespace of the identifiers of the OpenIOC
+// documents and indicators, so that exporting twice gives the same IDs.
+var openIOCNamespace = uuid.NewSHA1(uuid.NameSpaceURL,
+	[]byte("https://saferwall.com/openioc"))
+
+// IOC represents an indicator of compromise observed during a behavior
+// scan.
+type IOC struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	// Count is the number of events the indicator was observed in.
+	Count int `json:"count"`
+	// PIDs lists the processes the indicator was observed in.
+	PIDs []string `json:"pids,omitempty"`
+}
+
+// IOCs represents the indicators of compromise of a behavior scan.
+type IOCs struct {
+	ID        string `json:"id"`
+	SHA256    string `json:"sha256"`
+	Timestamp int64  `json:"timestamp"`
+	IOCs      []IOC  `json:"iocs"`
+	// Truncated is true when the scan holds more than maxIOCItems events
+	// or artifacts, the IOCs are then extracted from the first ones.
+	Truncated bool `json:"truncated"`
+}
+
+// iocSet deduplicates indicators.
+type iocSet struct {
+	iocs  []IOC
+	index map[string]int
+}
+
+func newIOCSet() *iocSet {
+	return &iocSet{iocs: []IOC{}, index: make(map[string]int)}
+}
+
+// add records an indicator, key identifies it among the indicators of the
+// same type.
+func (s *iocSet) add(kind, value, key string, pid interface{}) {
+	if value == "" {
+		return
+	}
+	k := kind + "\x00" + key
+	i, ok := s.index[k]
+	if !ok {
+		i = len(s.iocs)
+		s.index[k] = i
+		s.iocs = append(s.iocs, IOC{Type: kind, Value: value})
+	}
+	ioc := &s.iocs[i]
+	ioc.Count++
+	if pid := normalizePID(pid); pid != "" && !slices.Contains(ioc.PIDs, pid) {
+		ioc.PIDs = append(ioc.PIDs, pid)
+	}
+}
+
+// sorted returns the indicators sorted by type and value.
+func (s *iocSet) sorted() []IOC {
+	sort.SliceStable(s.iocs, func(i, j int) bool {
+		if s.iocs[i].Type != s.iocs[j].Type {
+			return s.iocs[i].Type < s.iocs[j].Type
+		}
+		return s.iocs[i].Value < s.iocs[j].Value
+	})
+	return s.iocs
+}
+
+// extractIOCs returns the deduplicated indicators found in system events
+// and artifacts. Hosts and registry keys are case insensitive, mutexes are
+// not.
+func extractIOCs(events, artifacts []interface{}) []IOC {
+	set := newIOCSet()
+	for _, ev := range events {
+		event, ok := ev.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		kind, _ := event["type"].(string)
+		path, _ := event["path"].(string)
+		path = strings.TrimSpace(path)
+		pid := event["pid"]
+
+		switch kind {
+		case eventNetwork, eventDNS:
+			if strings.Contains(path, "://") {
+				set.add(IOCURL, path, path, pid)
+			}
+			if kind, host := NetworkIOC(path); kind != "" {
+				set.add(kind, host, host, pid)
+			}
+		case eventMutex:
+			set.add(IOCMutex, path, path, pid)
+		case eventRegistry:
+			set.add(IOCRegistry, path, strings.ToLower(path), pid)
+		}
+	}
+
+	for _, a := range artifacts {
+		artifact, ok := a.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		kind, _ := artifact["kind"].(string)
+		sha256, _ := artifact["sha256"].(string)
+		if !IsDropped(kind, sha256) {
+			continue
+		}
+		sha256 = strings.ToLower(sha256)
+		set.add(IOCSHA256, sha256, sha256, artifact["pid"])
+	}
+	return set.sorted()
+}
+
+// IsNetworkEvent returns true when a system event type describes network
+// activity.
+func IsNetworkEvent(kind string) bool {
+	return kind == eventNetwork || kind == eventDNS
+}
+
+// NetworkIOC returns the indicator a network event path refers to: either
+// the IP address or the domain of its host. The type is empty when the host
+// is neither a public IP address nor a domain.
+func NetworkIOC(path string) (kind, value string) {
+	host := hostOf(path)
+	if ip := net.ParseIP(host); ip != nil {
+		// The sandbox network uses private addresses, every detonation
+		// would otherwise share its indicators.
+		if !netutil.IsPublicIP(ip) {
+			return "", ""
+		}
+		return IOCIP, ip.String()
+	}
+	if !regDomain.MatchString(host) {
+		return "", ""
+	}
+	return IOCDomain, host
+}
+
+// IsDropped returns true when an artifact is a file dropped by the sample,
+// memory dumps excluded.
+func IsDropped(kind, sha256 string) bool {
+	return !notDropped[kind] && regSHA256.MatchString(strings.ToLower(sha256))
+}
+
+// hostOf returns the lower cased host of a network event path, which is
+// either an URL, a host and port pair or a bare host.
+func hostOf(path string) string {
+	path = strings.TrimSpace(path)
+	if strings.Contains(path, "://") {
+		u, err := url.Parse(path)
+		if err != nil {
+			return ""
+		}
+		return strings.ToLower(u.Hostname())
+	}
+	if host, _, err := net.SplitHostPort(path); err == nil {
+		return strings.ToLower(host)
+	}
+	return strings.ToLower(strings.Trim(path, "[]"))
+}
+
+// writeCSV writes the indicators as CSV with a header line.
+func (iocs IOCs) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"type", "value", "count", "pids"})
+	for _, ioc := range iocs.IOCs {
+		_ = cw.Write([]string{ioc.Type, ioc.Value, strconv.Itoa(ioc.Count),
+			strings.Join(ioc.PIDs, " ")})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeText writes the indicators values, one per line.
+func (iocs IOCs) writeText(w io.Writer) error {
+	for _, ioc := range iocs.IOCs {
+		if _, err := fmt.Fprintln(w, ioc.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openIOCContext tells where an indicator type is searched for by OpenIOC
+// tools.
+var openIOCContext = map[string]struct {
+	document, search, contentType string
+}{
+	IOCDomain:   {"DnsEntryItem", "DnsEntryItem/Host", "string"},
+	IOCIP:       {"PortItem", "PortItem/remoteIP", "IP"},
+	IOCURL:      {"UrlHistoryItem", "UrlHistoryItem/URL", "string"},
+	IOCMutex:    {"ProcessItem", "ProcessItem/HandleList/Handle/Name", "string"},
+	IOCRegistry: {"RegistryItem", "RegistryItem/KeyPath", "string"},
+	IOCSHA256:   {"FileItem", "FileItem/Sha256sum", "sha256"},
+}
+
+type openIOC struct {
+	XMLName          xml.Name         `xml:"ioc"`
+	Xmlns            string           `xml:"xmlns,attr"`
+	ID               string           `xml:"id,attr"`
+	LastModified     string           `xml:"last-modified,attr"`
+	ShortDescription string           `xml:"short_description"`
+	Description      string           `xml:"description"`
+	AuthoredBy       string           `xml:"authored_by"`
+	AuthoredDate     string           `xml:"authored_date"`
+	Links            struct{}         `xml:"links"`
+	Definition       openIOCIndicator `xml:"definition>Indicator"`
+}
+
+type openIOCIndicator struct {
+	Operator string                 `xml:"operator,attr"`
+	ID       string                 `xml:"id,attr"`
+	Items    []openIOCIndicatorItem `xml:"IndicatorItem"`
+}
+
+type openIOCIndicatorItem struct {
+	ID        string `xml:"id,attr"`
+	Condition string `xml:"condition,attr"`
+	Context   struct {
+		Document string `xml:"document,attr"`
+		Search   string `xml:"search,attr"`
+		Type     string `xml:"type,attr"`
+	} `xml:"Context"`
+	Content struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"Content"`
+}
+
+// writeOpenIOC writes the indicators as an OpenIOC 1.0 document matching
+// any of them.
+func (iocs IOCs) writeOpenIOC(w io.Writer) error {
+	id := uuid.NewSHA1(openIOCNamespace, []byte(iocs.ID)).String()
+	ts := time.Unix(iocs.Timestamp, 0).UTC().Format("2006-01-02T15:04:05")
+	doc := openIOC{
+		Xmlns:            "http://schemas.mandiant.com/2010/ioc",
+		ID:               id,
+		LastModified:     ts,
+		ShortDescription: "Saferwall behavior scan " + iocs.ID,
+		Description: "Indicators observed during the detonation of " +
+			iocs.SHA256,
+		AuthoredBy:   "Saferwall",
+		AuthoredDate: ts,
+		Definition: openIOCIndicator{
+			Operator: "OR",
+			ID:       uuid.NewSHA1(openIOCNamespace, []byte(id)).String(),
+		},
+	}
+	for _, ioc := range iocs.IOCs {
+		context, ok := openIOCContext[ioc.Type]
+		if !ok {
+			continue
+		}
+		item := openIOCIndicatorItem{
+			ID: uuid.NewSHA1(openIOCNamespace,
+				[]byte(id+ioc.Type+ioc.Value)).String(),
+			Condition: "is",
+		}
+		item.Context.Document = context.document
+		item.Context.Search = context.search
+		item.Context.Type = "mir"
+		item.Content.Type = context.contentType
+		item.Content.Value = ioc.Value
+		doc.Definition.Items = append(doc.Definition.Items, item)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package behavior
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractIOCs(t *testing.T) {
+	dropped := strings.Repeat("ab", 32)
+	events := []interface{}{
+		map[string]interface{}{"pid": "0x10", "type": "network",
+			"path": "93.184.216.34:443"},
+		map[string]interface{}{"pid": "0x14", "type": "network",
+			"path": "93.184.216.34:80"},
+		map[string]interface{}{"pid": "0x10", "type": "network",
+			"path": "127.0.0.1:80"},
+		map[string]interface{}{"pid": "0x10", "type": "dns",
+			"path": "Evil.Example.com"},
+		map[string]interface{}{"pid": "0x10", "type": "network",
+			"path": "http://evil.example.com/gate.php"},
+		map[string]interface{}{"pid": "0x10", "type": "mutex",
+			"path": "Global\\M1"},
+		map[string]interface{}{"pid": "0x10", "type": "mutex",
+			"path": "Global\\m1"},
+		map[string]interface{}{"pid": "0x10", "type": "registry",
+			"path": `HKLM\Software\Run`},
+		map[string]interface{}{"pid": "0x10", "type": "registry",
+			"path": `HKLM\SOFTWARE\RUN`},
+		map[string]interface{}{"pid": "0x10", "type": "file",
+			"path": `C:\a.txt`},
+		"malformed",
+	}
+	artifacts := []interface{}{
+		map[string]interface{}{"kind": "memdump",
+			"sha256": strings.Repeat("1", 64)},
+		map[string]interface{}{"kind": "file", "sha256": strings.ToUpper(dropped),
+			"pid": "0x10"},
+		map[string]interface{}{"kind": "file", "sha256": "not a hash"},
+	}
+
+	iocs := extractIOCs(events, artifacts)
+	assert.Equal(t, []IOC{
+		{Type: IOCDomain, Value: "evil.example.com", Count: 2,
+			PIDs: []string{"0x10"}},
+		{Type: IOCIP, Value: "93.184.216.34", Count: 2,
+			PIDs: []string{"0x10", "0x14"}},
+		{Type: IOCMutex, Value: "Global\\M1", Count: 1, PIDs: []string{"0x10"}},
+		{Type: IOCMutex, Value: "Global\\m1", Count: 1, PIDs: []string{"0x10"}},
+		{Type: IOCRegistry, Value: `HKLM\Software\Run`, Count: 2,
+			PIDs: []string{"0x10"}},
+		{Type: IOCSHA256, Value: dropped, Count: 1, PIDs: []string{"0x10"}},
+		{Type: IOCURL, Value: "http://evil.example.com/gate.php", Count: 1,
+			PIDs: []string{"0x10"}},
+	}, iocs)
+
+	assert.Equal(t, []IOC{}, extractIOCs(nil, nil))
+}
+
+func TestWriteIOCs(t *testing.T) {
+	iocs := IOCs{ID: "6f1d6d6a-3c8a-4a54-9e3b-8ad1b5c5ef52", SHA256: "abc",
+		Timestamp: 1650000000, IOCs: []IOC{
+			{Type: IOCDomain, Value: "evil.example.com", Count: 2,
+				PIDs: []string{"0x10", "0x14"}},
+			{Type: IOCURL, Value: "http://evil.example.com/a,b", Count: 1},
+		}}
+
+	var buf bytes.Buffer
+	assert.Nil(t, iocs.writeCSV(&buf))
+	assert.Equal(t, "type,value,count,pids\n"+
+		"domain,evil.example.com,2,0x10 0x14\n"+
+		"url,\"http://evil.example.com/a,b\",1,\n", buf.String())
+
+	buf.Reset()
+	assert.Nil(t, iocs.writeText(&buf))
+	assert.Equal(t, "evil.example.com\nhttp://evil.example.com/a,b\n",
+		buf.String())
+
+	buf.Reset()
+	assert.Nil(t, iocs.writeOpenIOC(&buf))
+	assert.True(t, strings.HasPrefix(buf.String(), xml.Header))
+	var doc openIOC
+	assert.Nil(t, xml.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, "http://schemas.mandiant.com/2010/ioc", doc.XMLName.Space)
+	assert.Equal(t, "2022-04-15T05:20:00", doc.LastModified)
+	assert.Equal(t, "OR", doc.Definition.Operator)
+	assert.Len(t, doc.Definition.Items, 2)
+	item := doc.Definition.Items[0]
+	assert.Equal(t, "DnsEntryItem/Host", item.Context.Search)
+	assert.Equal(t, "evil.example.com", item.Content.Value)
+
+	// Exports are deterministic.
+	var again bytes.Buffer
+	assert.Nil(t, iocs.writeOpenIOC(&again))
+	assert.Equal(t, buf.String(), again.String())
+}
+
+func TestNetworkIOC(t *testing.T) {
+	kind, value := NetworkIOC("93.184.216.34:443")
+	assert.Equal(t, IOCIP, kind)
+	assert.Equal(t, "93.184.216.34", value)
+	kind, value = NetworkIOC("http://Evil.Example.com/payload.bin")
+	assert.Equal(t, IOCDomain, kind)
+	assert.Equal(t, "evil.example.com", value)
+
+	// Addresses which are not routable on the internet.
+	for _, path := range []string{
+		// Private and unique local.
+		"10.0.2.15:80", "172.16.0.1", "192.168.56.101:8080", "[fd00::1]:53",
+		// Loopback.
+		"127.0.0.1:80", "[::1]:443",
+		// Link-local.
+		"169.254.169.254", "[fe80::1]:80",
+		// Carrier-grade NAT.
+		"100.64.0.1", "100.127.255.254",
+		// Unspecified and multicast.
+		"0.0.0.0:53", "[::]:80", "224.0.0.251:5353",
+	} {
+		kind, _ := NetworkIOC(path)
+		assert.Empty(t, kind, path)
+	}
+	kind, _ = NetworkIOC("100.128.0.1")
+	assert.Equal(t, IOCIP, kind)
+}
@@ -0,0 +1,175 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package behavior
+
+import (
+	"strconv"
+)
+
+// Maximum number of API calls, events and artifacts returned for a
+// process.
+const maxProcessItems = 1000
+
+// eventTypes lists the types of the system events reported by the sandbox.
+var eventTypes = []string{"file", eventRegistry, eventNetwork, eventDNS,
+	eventMutex}
+
+// Process represents a process of the process tree of a behavior scan.
+type Process struct {
+	PID         string    `json:"pid"`
+	ParentPID   string    `json:"ppid,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Path        string    `json:"path,omitempty"`
+	CommandLine string    `json:"cmdline,omitempty"`
+	Children    []Process `json:"children"`
+}
+
+// ProcessActivity represents what a process did during a behavior scan.
+// The lists hold at most maxProcessItems items, the counts are the totals.
+type ProcessActivity struct {
+	Process
+	APIs           []interface{} `json:"apis"`
+	APIsCount      int           `json:"apis_count"`
+	Events         []interface{} `json:"events"`
+	EventsCount    int           `json:"events_count"`
+	Network        []interface{} `json:"network"`
+	NetworkCount   int           `json:"network_count"`
+	Artifacts      []interface{} `json:"artifacts"`
+	ArtifactsCount int           `json:"artifacts_count"`
+}
+
+// processTree decodes the process tree of a behavior report. The sandbox
+// reports either nested processes or a flat list linked by parent PIDs,
+// both are returned as a tree.
+func processTree(raw interface{}) []Process {
+	var nodes []interface{}
+	switch v := raw.(type) {
+	case []interface{}:
+		nodes = v
+	case map[string]interface{}:
+		nodes = []interface{}{v}
+	}
+
+	nested := false
+	procs := make([]Process, 0, len(nodes))
+	for _, node := range nodes {
+		proc, hasChildren := decodeProcess(node)
+		nested = nested || hasChildren
+		procs = append(procs, proc)
+	}
+	if nested {
+		return procs
+	}
+	return link(procs)
+}
+
+// decodeProcess decodes a process along with its children, it returns
+// true when the process has children.
+func decodeProcess(node interface{}) (Process, bool) {
+	m, _ := node.(map[string]interface{})
+	proc := Process{
+		PID:       normalizePID(m["pid"]),
+		ParentPID: normalizePID(m["ppid"]),
+		Children:  []Process{},
+	}
+	proc.Name, _ = m["name"].(string)
+	proc.Path, _ = m["path"].(string)
+	proc.CommandLine, _ = m["cmdline"].(string)
+
+	children, _ := m["children"].([]interface{})
+	for _, child := range children {
+		c, _ := decodeProcess(child)
+		if c.ParentPID == "" {
+			c.ParentPID = proc.PID
+		}
+		proc.Children = append(proc.Children, c)
+	}
+	return proc, len(children) > 0
+}
+
+// link builds a tree out of a flat list of processes. Processes whose parent
+// is not in the list are roots.
+func link(procs []Process) []Process {
+	children := make(map[string][]int)
+	known := make(map[string]bool, len(procs))
+	for _, proc := range procs {
+		known[proc.PID] = true
+	}
+	roots := []int{}
+	for i, proc := range procs {
+		if proc.ParentPID != "" && proc.ParentPID != proc.PID &&
+			known[proc.ParentPID] {
+			children[proc.ParentPID] = append(children[proc.ParentPID], i)
+		} else {
+			roots = append(roots, i)
+		}
+	}
+
+	// Guard against cycles in bogus reports.
+	visited := make(map[int]bool, len(procs))
+	var build func(i int) Process
+	build = func(i int) Process {
+		visited[i] = true
+		proc := procs[i]
+		proc.Children = []Process{}
+		for _, child := range children[proc.PID] {
+			if !visited[child] {
+				proc.Children = append(proc.Children, build(child))
+			}
+		}
+		return proc
+	}
+
+	tree := []Process{}
+	for _, i := range roots {
+		tree = append(tree, build(i))
+	}
+	return tree
+}
+
+// findProcess returns the process of the tree with the given PID.
+func findProcess(tree []Process, pid string) (Process, bool) {
+	for _, proc := range tree {
+		if proc.PID == pid {
+			return proc, true
+		}
+		if found, ok := findProcess(proc.Children, pid); ok {
+			return found, true
+		}
+	}
+	return Process{}, false
+}
+
+// networkConditions returns the condition matching the network events of
+// a process, and the conditions matching its other events. The network
+// events are the ones IsNetworkEvent accepts.
+func networkConditions() (isNetwork []Condition, notNetwork [][]Condition) {
+	for _, kind := range eventTypes {
+		if !IsNetworkEvent(kind) {
+			continue
+		}
+		isNetwork = append(isNetwork,
+			Condition{Field: "type", Op: opEq, Value: kind})
+		notNetwork = append(notNetwork,
+			[]Condition{{Field: "type", Op: opNe, Value: kind}})
+	}
+	return isNetwork, notNetwork
+}
+
+// normalizePID formats a PID reported as a number or as a decimal or hex
+// string as a lower case 0x prefixed hex string.
+func normalizePID(v interface{}) string {
+	switch pid := v.(type) {
+	case float64:
+		if pid >= 0 {
+			return "0x" + strconv.FormatUint(uint64(pid), 16)
+		}
+	case string:
+		if n, err := parseHex(pid); err == nil {
+			return "0x" + strconv.FormatUint(n, 16)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package behavior
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessTree(t *testing.T) {
+	// A flat list linked by parent PIDs.
+	flat := []interface{}{
+		map[string]interface{}{"pid": "0x10", "ppid": "0x4",
+			"name": "sample.exe"},
+		map[string]interface{}{"pid": float64(32), "ppid": "16",
+			"name": "cmd.exe", "cmdline": "cmd /c del sample.exe"},
+		map[string]interface{}{"pid": "0x30", "ppid": "0x20",
+			"name": "conhost.exe"},
+	}
+	tree := processTree(flat)
+	assert.Equal(t, []Process{{
+		PID: "0x10", ParentPID: "0x4", Name: "sample.exe",
+		Children: []Process{{
+			PID: "0x20", ParentPID: "0x10", Name: "cmd.exe",
+			CommandLine: "cmd /c del sample.exe",
+			Children: []Process{{PID: "0x30", ParentPID: "0x20",
+				Name: "conhost.exe", Children: []Process{}}},
+		}},
+	}}, tree)
+
+	// Nested processes.
+	nested := map[string]interface{}{
+		"pid": "0x10", "name": "sample.exe",
+		"children": []interface{}{
+			map[string]interface{}{"pid": "0x20", "name": "cmd.exe"},
+		},
+	}
+	assert.Equal(t, []Process{{
+		PID: "0x10", Name: "sample.exe",
+		Children: []Process{{PID: "0x20", ParentPID: "0x10",
+			Name: "cmd.exe", Children: []Process{}}},
+	}}, processTree(nested))
+
+	proc, ok := findProcess(tree, "0x30")
+	assert.True(t, ok)
+	assert.Equal(t, "conhost.exe", proc.Name)
+	_, ok = findProcess(tree, "0x40")
+	assert.False(t, ok)
+
+	// Cycles in bogus reports do not hang.
+	cycle := []interface{}{
+		map[string]interface{}{"pid": "0x1", "ppid": "0x2"},
+		map[string]interface{}{"pid": "0x2", "ppid": "0x1"},
+	}
+	assert.Empty(t, processTree(cycle))
+	assert.Empty(t, processTree(nil))
+}
+
+func TestNormalizePID(t *testing.T) {
+	assert.Equal(t, "0x1b4c", normalizePID("0x1B4C"))
+	assert.Equal(t, "0x1b4c", normalizePID("6988"))
+	assert.Equal(t, "0x1b4c", normalizePID(float64(6988)))
+	assert.Equal(t, "", normalizePID("explorer"))
+	assert.Equal(t, "", normalizePID(nil))
+}
+
+func TestNetworkConditions(t *testing.T) {
+	isNetwork, notNetwork := networkConditions()
+	assert.Equal(t, []Condition{
+		{Field: "type", Op: opEq, Value: "network"},
+		{Field: "type", Op: opEq, Value: "dns"},
+	}, isNetwork)
+	assert.Equal(t, [][]Condition{
+		{{Field: "type", Op: opNe, Value: "network"}},
+		{{Field: "type", Op: opNe, Value: "dns"}},
+	}, notNetwork)
+}
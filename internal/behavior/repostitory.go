@@ -7,7 +7,6 @@ package behavior
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 
 	dbcontext "github.com/saferwall/saferwall-api/internal/db"
 	"github.com/saferwall/saferwall-api/internal/entity"
@@ -33,6 +32,25 @@ type Repository interface {
 	Events(ctx context.Context, id string, offset, limit int) (
 		interface{}, error)
 	Artifacts(ctx context.Context, id string, offset, limit int) (interface{}, error)
+	// FileScans returns the behavior scans of a file with the given offset
+	// and limit, newest first.
+	FileScans(ctx context.Context, sha256 string, offset, limit int) (
+		[]entity.BehaviorScan, error)
+	// CountFileScans returns the number of behavior scans of a file.
+	CountFileScans(ctx context.Context, sha256 string) (int, error)
+	// Trace returns the scan config, system events, artifacts and
+	// capabilities of a behavior scan.
+	Trace(ctx context.Context, id string) (entity.Behavior, error)
+	// APICounts returns the number of calls of every API in a behavior scan.
+	APICounts(ctx context.Context, id string) (map[string]int, error)
+	// ProcessTree returns the process tree of a behavior scan, nil when the
+	// report has none.
+	ProcessTree(ctx context.Context, id string) (interface{}, error)
+	// ScreenshotsCount returns the number of screenshots of a behavior scan.
+	ScreenshotsCount(ctx context.Context, id string) (int, error)
+	// Capabilities returns the SHA256, timestamp and capabilities of a
+	// behavior scan.
+	Capabilities(ctx context.Context, id string) (entity.Behavior, error)
 }
 
 // repository persists file scan behaviors in database.
@@ -118,7 +136,7 @@ func (r repository) Query(ctx context.Context, offset, limit int) (
 	for _, u := range res.([]interface{}) {
 		behavior := entity.Behavior{}
 		b, _ := json.Marshal(u)
-		 _ = json.Unmarshal(b, &behavior)
+		_ = json.Unmarshal(b, &behavior)
 		behaviors = append(behaviors, behavior)
 	}
 	return behaviors, nil
@@ -126,134 +144,86 @@ func (r repository) Query(ctx context.Context, offset, limit int) (
 
 // CountAPIs returns the number of API calls for a behavior doc in the database.
 func (r repository) CountAPIs(ctx context.Context, id string) (int, error) {
-	var count int
-	var statement string
-	params := make(map[string]interface{}, 1)
-	params["id"] = id + "::apis"
-
-	filters, ok := ctx.Value(filtersKey).(map[string][]string)
-	if ok {
-		statement =
-			"SELECT RAW COUNT(api) AS count FROM `" + r.db.Bucket.Name() + "` d" +
-				" USE KEYS $id UNNEST d.api_trace as api"
-		i := 0
-		for k, v := range filters {
-			if i == 0 {
-				statement += " WHERE"
-			} else {
-				statement += " AND"
-			}
-			i++
-			statement += fmt.Sprintf(" api.%s IN $%s", k, k)
-			params[k] = v
-		}
-	} else {
-		statement =
-			"SELECT RAW ARRAY_LENGTH(d.api_trace) AS count FROM `" + r.db.Bucket.Name() + "` d" +
-				" USE KEYS $id"
-	}
-
-	err := r.db.Count(ctx, statement, params, &count)
-	return count, err
+	return r.count(ctx, apisCollection, id)
 }
 
 // CountArtifacts returns the number of artifacts.
 func (r repository) CountArtifacts(ctx context.Context, id string) (int, error) {
-	var count int
-	var statement string
-	params := make(map[string]interface{}, 1)
-	params["id"] = id
-
-	filters, ok := ctx.Value(filtersKey).(map[string][]string)
-	if ok {
-		statement =
-			"SELECT RAW COUNT(artifacts) AS count FROM `" + r.db.Bucket.Name() + "` d" +
-				" USE KEYS $id UNNEST d.artifacts as artifacts"
-		i := 0
-		for k, v := range filters {
-			if i == 0 {
-				statement += " WHERE"
-			} else {
-				statement += " AND"
-			}
-			i++
-			statement += fmt.Sprintf(" artifacts.%s IN $%s", k, k)
-			params[k] = v
-		}
-	} else {
-		statement =
-			"SELECT RAW ARRAY_LENGTH(d.artifacts) AS count FROM `" + r.db.Bucket.Name() + "` d" +
-				" USE KEYS $id"
-	}
-
-	err := r.db.Count(ctx, statement, params, &count)
-	return count, err
+	return r.count(ctx, artifactsCollection, id)
 }
 
-// CountEvents returns the number of strings in a file doc in the database.
+// CountEvents returns the number of system events for a behavior doc in the
+// database.
 func (r repository) CountEvents(ctx context.Context, id string) (int, error) {
+	return r.count(ctx, eventsCollection, id)
+}
+
+// APIs retrieves the API calls of a behavior doc from the database.
+func (r repository) APIs(ctx context.Context, id string, offset,
+	limit int) (interface{}, error) {
+	return r.items(ctx, apisCollection, id, offset, limit)
+}
+
+// Events retrieves the system events of a behavior doc from the database.
+func (r repository) Events(ctx context.Context, id string, offset,
+	limit int) (interface{}, error) {
+	return r.items(ctx, eventsCollection, id, offset, limit)
+}
+
+// Artifacts retrieves the artifacts of a behavior doc from the database.
+func (r repository) Artifacts(ctx context.Context, id string, offset,
+	limit int) (interface{}, error) {
+	return r.items(ctx, artifactsCollection, id, offset, limit)
+}
+
+// from returns the FROM and WHERE clauses selecting the items of a
+// collection which match the filter in the context. Counts and pages share
+// them so that they always agree.
+func (r repository) from(ctx context.Context, coll collection, id string,
+	params map[string]interface{}) string {
+
+	params["id"] = id + coll.keySuffix
+	filter, _ := ctx.Value(filtersKey).(Filter)
+	return " FROM `" + r.db.Bucket.Name() + "` d USE KEYS $id UNNEST d." +
+		coll.path + " AS " + coll.alias + filter.where(coll, params)
+}
+
+// count returns the number of items of a collection which match the filter
+// in the context.
+func (r repository) count(ctx context.Context, coll collection, id string) (
+	int, error) {
+
 	var count int
 	var statement string
 	params := make(map[string]interface{}, 1)
-	params["id"] = id + "::events"
-
-	filters, ok := ctx.Value(filtersKey).(map[string][]string)
-	if ok {
-		statement =
-			"SELECT RAW COUNT(event) AS count FROM `" + r.db.Bucket.Name() + "` d" +
-				" USE KEYS $id UNNEST d.sys_events as event"
-		i := 0
-		for k, v := range filters {
-			if i == 0 {
-				statement += " WHERE"
-			} else {
-				statement += " AND"
-			}
-			i++
-			statement += fmt.Sprintf(" event.%s IN $%s", k, k)
-			params[k] = v
-		}
+
+	filter, _ := ctx.Value(filtersKey).(Filter)
+	if len(filter.Groups) == 0 {
+		params["id"] = id + coll.keySuffix
+		statement = "SELECT RAW ARRAY_LENGTH(d." + coll.path + ") AS count" +
+			" FROM `" + r.db.Bucket.Name() + "` d USE KEYS $id"
 	} else {
-		statement =
-			"SELECT RAW ARRAY_LENGTH(d.sys_events) AS count FROM `" + r.db.Bucket.Name() + "` d" +
-				" USE KEYS $id"
+		statement = "SELECT RAW COUNT(*) AS count" +
+			r.from(ctx, coll, id, params)
 	}
 
 	err := r.db.Count(ctx, statement, params, &count)
 	return count, err
 }
 
-func (r repository) APIs(ctx context.Context, id string, offset,
-	limit int) (interface{}, error) {
+// items retrieves the items of a collection which match the filter in the
+// context, in the requested order.
+func (r repository) items(ctx context.Context, coll collection, id string,
+	offset, limit int) (interface{}, error) {
 
 	var results interface{}
-	var statement string
-
 	params := make(map[string]interface{}, 1)
 	params["offset"] = offset
 	params["limit"] = limit
-	params["id"] = id + "::apis"
 
-	statement =
-		"SELECT RAW api FROM `" + r.db.Bucket.Name() + "` d" +
-			" USE KEYS $id UNNEST d.api_trace as api"
-	filters, ok := ctx.Value(filtersKey).(map[string][]string)
-	if ok {
-
-		i := 0
-		for k, v := range filters {
-			if i == 0 {
-				statement += " WHERE"
-			} else {
-				statement += " AND"
-			}
-			i++
-			statement += fmt.Sprintf(" api.%s IN $%s", k, k)
-			params[k] = v
-		}
-	}
-
-	statement += " OFFSET $offset LIMIT $limit"
+	filter, _ := ctx.Value(filtersKey).(Filter)
+	statement := "SELECT RAW " + coll.alias + r.from(ctx, coll, id, params) +
+		filter.orderBy(coll) + " OFFSET $offset LIMIT $limit"
 
 	err := r.db.Query(ctx, statement, params, &results)
 	if err != nil {
@@ -265,84 +235,119 @@ func (r repository) APIs(ctx context.Context, id string, offset,
 	return results.([]interface{}), nil
 }
 
-func (r repository) Events(ctx context.Context, id string, offset,
-	limit int) (interface{}, error) {
+// FileScans retrieves the behavior scans of a file from the database.
+func (r repository) FileScans(ctx context.Context, sha256 string, offset,
+	limit int) ([]entity.BehaviorScan, error) {
 
 	var results interface{}
-	var statement string
-
 	params := make(map[string]interface{}, 1)
+	params["sha256"] = sha256
 	params["offset"] = offset
 	params["limit"] = limit
-	params["id"] = id + "::events"
-	statement =
-		"SELECT RAW event FROM `" + r.db.Bucket.Name() + "` d" +
-			" USE KEYS $id UNNEST d.sys_events as event"
-
-	filters, ok := ctx.Value(filtersKey).(map[string][]string)
-	if ok {
-
-		i := 0
-		for k, v := range filters {
-			if i == 0 {
-				statement += " WHERE"
-			} else {
-				statement += " AND"
-			}
-			i++
-			statement += fmt.Sprintf(" event.%s IN $%s", k, k)
-			params[k] = v
-		}
-	}
 
-	statement += " OFFSET $offset LIMIT $limit"
-	err := r.db.Query(ctx, statement, params, &results)
+	query := r.db.N1QLQuery[dbcontext.FileBehaviors]
+	err := r.db.Query(ctx, query, params, &results)
 	if err != nil {
 		return nil, err
 	}
-	if len(results.([]interface{})) == 0 {
-		return []interface{}{}, nil
+
+	scans := []entity.BehaviorScan{}
+	err = dbcontext.Decode(results, &scans)
+	return scans, err
+}
+
+// CountFileScans returns the number of behavior scans of a file in the
+// database.
+func (r repository) CountFileScans(ctx context.Context, sha256 string) (
+	int, error) {
+
+	var count int
+	params := make(map[string]interface{}, 1)
+	params["sha256"] = sha256
+
+	query := r.db.N1QLQuery[dbcontext.CountFileBehaviors]
+	err := r.db.Count(ctx, query, params, &count)
+	return count, err
+}
+
+// Trace reads the parts of a behavior scan which are compared between runs
+// from the database. Missing parts are left empty.
+func (r repository) Trace(ctx context.Context, id string) (
+	entity.Behavior, error) {
+
+	var behavior entity.Behavior
+	_, err := r.db.LookupWithCAS(ctx, id, []string{"type", "sha256",
+		"timestamp", "scan_cfg", "status", "screenshots_count", "artifacts",
+		"capabilities"}, &behavior)
+	if err != nil {
+		return entity.Behavior{}, err
 	}
-	return results.([]interface{}), nil
+
+	var events entity.Behavior
+	_, err = r.db.LookupWithCAS(ctx, id+"::events", []string{"sys_events"},
+		&events)
+	if err != nil && err != dbcontext.ErrDocumentNotFound {
+		return entity.Behavior{}, err
+	}
+	behavior.SystemEvents = events.SystemEvents
+	return behavior, nil
 }
 
-func (r repository) Artifacts(ctx context.Context, id string, offset,
-	limit int) (interface{}, error) {
+// APICounts retrieves the number of calls of every API in a behavior scan
+// from the database.
+func (r repository) APICounts(ctx context.Context, id string) (
+	map[string]int, error) {
 
 	var results interface{}
-	var statement string
-
 	params := make(map[string]interface{}, 1)
-	params["offset"] = offset
-	params["limit"] = limit
-	params["id"] = id
-	statement =
-		"SELECT RAW artifacts FROM `" + r.db.Bucket.Name() + "` d" +
-			" USE KEYS $id UNNEST d.artifacts as artifacts"
-
-	filters, ok := ctx.Value(filtersKey).(map[string][]string)
-	if ok {
-
-		i := 0
-		for k, v := range filters {
-			if i == 0 {
-				statement += " WHERE"
-			} else {
-				statement += " AND"
-			}
-			i++
-			statement += fmt.Sprintf(" artifacts.%s IN $%s", k, k)
-			params[k] = v
-		}
-	}
+	params["id"] = id + "::apis"
 
-	statement += " OFFSET $offset LIMIT $limit"
-	err := r.db.Query(ctx, statement, params, &results)
+	query := r.db.N1QLQuery[dbcontext.BehaviorAPICounts]
+	err := r.db.Query(ctx, query, params, &results)
 	if err != nil {
 		return nil, err
 	}
-	if len(results.([]interface{})) == 0 {
-		return []interface{}{}, nil
+
+	var rows []struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
 	}
-	return results.([]interface{}), nil
+	if err = dbcontext.Decode(results, &rows); err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Name] = row.Count
+	}
+	return counts, nil
+}
+
+// ProcessTree reads the process tree of a behavior scan from the database.
+func (r repository) ProcessTree(ctx context.Context, id string) (
+	interface{}, error) {
+
+	var behavior entity.Behavior
+	_, err := r.db.LookupWithCAS(ctx, id, []string{"proc_tree"}, &behavior)
+	return behavior.ProcessTree, err
+}
+
+// ScreenshotsCount reads the number of screenshots of a behavior scan from
+// the database.
+func (r repository) ScreenshotsCount(ctx context.Context, id string) (
+	int, error) {
+
+	var behavior entity.Behavior
+	_, err := r.db.LookupWithCAS(ctx, id, []string{"screenshots_count"},
+		&behavior)
+	return behavior.ScreenshotsCount, err
+}
+
+// Capabilities reads the capabilities of a behavior scan from the database.
+func (r repository) Capabilities(ctx context.Context, id string) (
+	entity.Behavior, error) {
+
+	var behavior entity.Behavior
+	_, err := r.db.LookupWithCAS(ctx, id, []string{"sha256", "timestamp",
+		"capabilities"}, &behavior)
+	return behavior, err
 }
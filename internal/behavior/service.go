@@ -6,8 +6,14 @@ package behavior
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
 
+	"github.com/saferwall/saferwall-api/internal/attack"
 	"github.com/saferwall/saferwall-api/internal/entity"
+	e "github.com/saferwall/saferwall-api/internal/errors"
 	"github.com/saferwall/saferwall-api/pkg/log"
 )
 
@@ -22,6 +28,72 @@ type Service interface {
 	Artifacts(ctx context.Context, id string, offset, limit int) (interface{}, error)
 	APIs(ctx context.Context, id string, offset, limit int) (interface{}, error)
 	Events(ctx context.Context, id string, offset, limit int) (interface{}, error)
+	FileScans(ctx context.Context, sha256 string, offset, limit int) (
+		[]entity.BehaviorScan, error)
+	CountFileScans(ctx context.Context, sha256 string) (int, error)
+	// Diff compares the API traces, system events, artifacts and
+	// capabilities of two behavior scans.
+	Diff(ctx context.Context, id, other string) (Diff, error)
+	// Trace returns the scan config, system events, artifacts and
+	// capabilities of a behavior scan.
+	Trace(ctx context.Context, id string) (entity.Behavior, error)
+	// Processes returns the tree of the processes run during a behavior
+	// scan.
+	Processes(ctx context.Context, id string) ([]Process, error)
+	// Process returns the API calls, system events, network activity and
+	// artifacts of a process of a behavior scan.
+	Process(ctx context.Context, id, pid string) (ProcessActivity, error)
+	// IOCs returns the domains, IPs, URLs, mutexes, registry keys and
+	// dropped files hashes observed during a behavior scan.
+	IOCs(ctx context.Context, id string) (IOCs, error)
+	// Attack returns the capabilities of a behavior scan laid out on the
+	// MITRE ATT&CK matrix.
+	Attack(ctx context.Context, id string) (AttackMatrix, error)
+	// ScreenshotKey returns the object storage key of a screenshot, it
+	// fails when the screenshot does not exist.
+	ScreenshotKey(ctx context.Context, id string, n int, thumbnail bool) (
+		string, error)
+	// ArtifactKey returns the object storage key of an artifact, it fails
+	// when the artifact does not exist.
+	ArtifactKey(ctx context.Context, id, sha256 string) (string, error)
+	// Screenshot streams a screenshot to w.
+	Screenshot(ctx context.Context, key string, w io.Writer) error
+	// DownloadArtifact streams an artifact zipped with a password to w.
+	DownloadArtifact(ctx context.Context, key, sha256 string,
+		w io.Writer) error
+}
+
+// Downloader represents the object storage holding the screenshots and
+// artifacts of the behavior scans.
+type Downloader interface {
+	Download(ctx context.Context, bucket, key string, file io.Writer) error
+	Exists(ctx context.Context, bucket, key string) (bool, error)
+}
+
+// Archiver streams password protected zips.
+type Archiver interface {
+	ArchiveTo(w io.Writer, filename, password string, r io.Reader) error
+}
+
+var (
+	regSHA256 = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+	errBehaviorNotFound   = e.NotFound("behavior scan not found")
+	errScreenshotNotFound = e.NotFound("screenshot not found")
+	errArtifactNotFound   = e.NotFound("artifact not found")
+	// errObjectNotFound is returned when an object is missing from the
+	// object storage.
+	errObjectNotFound = e.NotFound("")
+)
+
+// AttackMatrix represents the capabilities of a behavior scan mapped to
+// ATT&CK techniques.
+type AttackMatrix struct {
+	ID           string              `json:"id"`
+	SHA256       string              `json:"sha256"`
+	Timestamp    int64               `json:"timestamp"`
+	Capabilities []entity.Capability `json:"capabilities"`
+	attack.Matrix
 }
 
 // Behavior represents the data about a behavior scan.
@@ -30,13 +102,19 @@ type Behavior struct {
 }
 
 type service struct {
-	repo   Repository
-	logger log.Logger
+	repo     Repository
+	logger   log.Logger
+	objSto   Downloader
+	bucket   string
+	archiver Archiver
+	zipPwd   string
 }
 
-// NewService creates a new user service.
-func NewService(repo Repository, logger log.Logger) Service {
-	return service{repo, logger}
+// NewService creates a new behavior service. Screenshots and artifacts are
+// downloaded from the given bucket, artifacts are zipped with zipPwd.
+func NewService(repo Repository, logger log.Logger, objSto Downloader,
+	bucket string, archiver Archiver, zipPwd string) Service {
+	return service{repo, logger, objSto, bucket, archiver, zipPwd}
 }
 
 // Get returns the file behavior scan given its ID.
@@ -111,3 +189,303 @@ func (s service) Artifacts(ctx context.Context, id string, offset, limit int) (
 	}
 	return result, nil
 }
+
+// FileScans returns the behavior scans of a file, newest first.
+func (s service) FileScans(ctx context.Context, sha256 string, offset,
+	limit int) ([]entity.BehaviorScan, error) {
+	return s.repo.FileScans(ctx, strings.ToLower(sha256), offset, limit)
+}
+
+// CountFileScans returns the number of behavior scans of a file.
+func (s service) CountFileScans(ctx context.Context, sha256 string) (
+	int, error) {
+	return s.repo.CountFileScans(ctx, strings.ToLower(sha256))
+}
+
+// Diff compares two behavior scans, typically two detonations of the same
+// file in different environments.
+func (s service) Diff(ctx context.Context, id, other string) (Diff, error) {
+	id, other = strings.ToLower(id), strings.ToLower(other)
+	if !entity.IsValidID(other) {
+		return Diff{}, e.BadRequest("invalid behavior scan id")
+	}
+
+	base, err := s.repo.Trace(ctx, id)
+	if err != nil {
+		return Diff{}, err
+	}
+	baseAPIs, err := s.repo.APICounts(ctx, id)
+	if err != nil {
+		return Diff{}, err
+	}
+	otherBehavior, err := s.repo.Trace(ctx, other)
+	if err != nil {
+		return Diff{}, err
+	}
+	// The other ID may reference any kind of document.
+	if otherBehavior.Type != "behavior" {
+		return Diff{}, errBehaviorNotFound
+	}
+	otherAPIs, err := s.repo.APICounts(ctx, other)
+	if err != nil {
+		return Diff{}, err
+	}
+	return diff(id, base, baseAPIs, other, otherBehavior, otherAPIs), nil
+}
+
+// Trace returns the parts of a behavior scan which describe what the file
+// did during the detonation.
+func (s service) Trace(ctx context.Context, id string) (entity.Behavior,
+	error) {
+	return s.repo.Trace(ctx, strings.ToLower(id))
+}
+
+// Processes returns the process tree of a behavior scan.
+func (s service) Processes(ctx context.Context, id string) ([]Process, error) {
+	tree, err := s.repo.ProcessTree(ctx, strings.ToLower(id))
+	if err != nil {
+		return nil, err
+	}
+	return processTree(tree), nil
+}
+
+// Process returns what a process did during a behavior scan. The PID is
+// either decimal or 0x prefixed hex.
+func (s service) Process(ctx context.Context, id, pid string) (
+	ProcessActivity, error) {
+
+	id, pid = strings.ToLower(id), normalizePID(pid)
+	if pid == "" {
+		return ProcessActivity{}, e.BadRequest("invalid process id")
+	}
+	tree, err := s.Processes(ctx, id)
+	if err != nil {
+		return ProcessActivity{}, err
+	}
+	proc, ok := findProcess(tree, pid)
+	if !ok {
+		return ProcessActivity{}, e.NotFound("process not found")
+	}
+
+	activity := ProcessActivity{Process: proc}
+	byPID := []Condition{{Field: "pid", Op: opEq, Value: pid}}
+	chronological := []SortField{{Field: "ts"}}
+	isNetwork, notNetwork := networkConditions()
+
+	apis := WithFilters(ctx, Filter{Groups: [][]Condition{byPID},
+		Sort: chronological})
+	if activity.APIsCount, err = s.repo.CountAPIs(apis, id); err != nil {
+		return ProcessActivity{}, err
+	}
+	if activity.APIs, err = s.list(s.repo.APIs(apis, id, 0,
+		maxProcessItems)); err != nil {
+		return ProcessActivity{}, err
+	}
+
+	// The network activity, DNS included, is listed apart from the other
+	// events.
+	events := WithFilters(ctx, Filter{Groups: append([][]Condition{byPID},
+		notNetwork...), Sort: chronological})
+	if activity.EventsCount, err = s.repo.CountEvents(events, id); err != nil {
+		return ProcessActivity{}, err
+	}
+	if activity.Events, err = s.list(s.repo.Events(events, id, 0,
+		maxProcessItems)); err != nil {
+		return ProcessActivity{}, err
+	}
+
+	network := WithFilters(ctx, Filter{Groups: [][]Condition{byPID,
+		isNetwork}, Sort: chronological})
+	if activity.NetworkCount, err = s.repo.CountEvents(network, id); err != nil {
+		return ProcessActivity{}, err
+	}
+	if activity.Network, err = s.list(s.repo.Events(network, id, 0,
+		maxProcessItems)); err != nil {
+		return ProcessActivity{}, err
+	}
+
+	artifacts := WithFilters(ctx, Filter{Groups: [][]Condition{byPID}})
+	if activity.ArtifactsCount, err = s.repo.CountArtifacts(artifacts,
+		id); err != nil {
+		return ProcessActivity{}, err
+	}
+	if activity.Artifacts, err = s.list(s.repo.Artifacts(artifacts, id, 0,
+		maxProcessItems)); err != nil {
+		return ProcessActivity{}, err
+	}
+	return activity, nil
+}
+
+// IOCs extracts the indicators of compromise of a behavior scan from its
+// system events and artifacts.
+func (s service) IOCs(ctx context.Context, id string) (IOCs, error) {
+	id = strings.ToLower(id)
+	behavior, err := s.repo.Get(ctx, id, []string{"sha256", "timestamp"})
+	if err != nil {
+		return IOCs{}, err
+	}
+	iocs := IOCs{ID: id, SHA256: behavior.SHA256,
+		Timestamp: behavior.Timestamp}
+
+	types := []Condition{}
+	for _, kind := range []string{eventNetwork, eventDNS, eventMutex,
+		eventRegistry} {
+		types = append(types, Condition{Field: "type", Op: opEq, Value: kind})
+	}
+	eventsCtx := WithFilters(ctx, Filter{Groups: [][]Condition{types},
+		Sort: []SortField{{Field: "ts"}}})
+	eventsCount, err := s.repo.CountEvents(eventsCtx, id)
+	if err != nil {
+		return IOCs{}, err
+	}
+	events, err := s.list(s.repo.Events(eventsCtx, id, 0, maxIOCItems))
+	if err != nil {
+		return IOCs{}, err
+	}
+
+	artifactsCount, err := s.repo.CountArtifacts(ctx, id)
+	if err != nil {
+		return IOCs{}, err
+	}
+	artifacts, err := s.list(s.repo.Artifacts(ctx, id, 0, maxIOCItems))
+	if err != nil {
+		return IOCs{}, err
+	}
+
+	iocs.IOCs = extractIOCs(events, artifacts)
+	iocs.Truncated = eventsCount > maxIOCItems || artifactsCount > maxIOCItems
+	return iocs, nil
+}
+
+// Attack maps the capabilities of a behavior scan to the ATT&CK matrix.
+func (s service) Attack(ctx context.Context, id string) (AttackMatrix, error) {
+	id = strings.ToLower(id)
+	behavior, err := s.repo.Capabilities(ctx, id)
+	if err != nil {
+		return AttackMatrix{}, err
+	}
+	capabilities := behavior.Capabilities
+	if capabilities == nil {
+		capabilities = []entity.Capability{}
+	}
+	return AttackMatrix{
+		ID:           id,
+		SHA256:       behavior.SHA256,
+		Timestamp:    behavior.Timestamp,
+		Capabilities: capabilities,
+		Matrix:       attack.NewMatrix(capabilities),
+	}, nil
+}
+
+// list converts the items returned by the repository to a list.
+func (s service) list(items interface{}, err error) ([]interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	list, _ := items.([]interface{})
+	if list == nil {
+		list = []interface{}{}
+	}
+	return list, nil
+}
+
+// screenshotKey returns the object storage key of a screenshot of a
+// behavior scan.
+func screenshotKey(id string, n int, thumbnail bool) string {
+	if thumbnail {
+		return fmt.Sprintf("%s/screenshots/%d.min.jpeg", id, n)
+	}
+	return fmt.Sprintf("%s/screenshots/%d.jpeg", id, n)
+}
+
+// artifactKey returns the object storage key of an artifact of a behavior
+// scan.
+func artifactKey(id, sha256 string) string {
+	return id + "/artifacts/" + sha256
+}
+
+// ScreenshotKey checks that a screenshot exists and returns its key.
+// Screenshots are numbered from zero.
+func (s service) ScreenshotKey(ctx context.Context, id string, n int,
+	thumbnail bool) (string, error) {
+
+	id = strings.ToLower(id)
+	count, err := s.repo.ScreenshotsCount(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if n < 0 || n >= count {
+		return "", errScreenshotNotFound
+	}
+
+	key := screenshotKey(id, n, thumbnail)
+	if err = s.exists(ctx, key); err == errObjectNotFound {
+		return "", errScreenshotNotFound
+	}
+	return key, err
+}
+
+// ArtifactKey checks that an artifact belongs to a behavior scan and
+// returns its key.
+func (s service) ArtifactKey(ctx context.Context, id, sha256 string) (
+	string, error) {
+
+	id, sha256 = strings.ToLower(id), strings.ToLower(sha256)
+	if !regSHA256.MatchString(sha256) {
+		return "", e.BadRequest("invalid sha256")
+	}
+	byHash := WithFilters(ctx, Filter{Groups: [][]Condition{
+		{{Field: "sha256", Op: opEq, Value: sha256}}}})
+	count, err := s.repo.CountArtifacts(byHash, id)
+	if err != nil {
+		return "", err
+	}
+	if count == 0 {
+		return "", errArtifactNotFound
+	}
+
+	key := artifactKey(id, sha256)
+	if err = s.exists(ctx, key); err == errObjectNotFound {
+		return "", errArtifactNotFound
+	}
+	return key, err
+}
+
+// Screenshot streams a screenshot from the object storage to w.
+func (s service) Screenshot(ctx context.Context, key string,
+	w io.Writer) error {
+	return s.objSto.Download(ctx, s.bucket, key, w)
+}
+
+// DownloadArtifact streams an artifact from the object storage to w, in a
+// zip encrypted like sample downloads.
+func (s service) DownloadArtifact(ctx context.Context, key, sha256 string,
+	w io.Writer) error {
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(s.objSto.Download(ctx, s.bucket, key, pw))
+	}()
+
+	err := s.archiver.ArchiveTo(w, sha256, s.zipPwd, pr)
+	// Unblock the download when the client went away.
+	pr.CloseWithError(err)
+	return err
+}
+
+// exists checks that an object exists in the object storage. Nothing
+// exists when no artifacts container is configured.
+func (s service) exists(ctx context.Context, key string) error {
+	if s.bucket == "" {
+		return errObjectNotFound
+	}
+	found, err := s.objSto.Exists(ctx, s.bucket, key)
+	if err != nil {
+		s.logger.With(ctx).Error(err)
+		return err
+	}
+	if !found {
+		return errObjectNotFound
+	}
+	return nil
+}
@@ -17,10 +17,14 @@ import (
 type Repository interface {
 	// Get returns the comment with the specified comment ID.
 	Get(ctx context.Context, id string) (entity.Comment, error)
+	// GetWithCAS returns the comment with the specified comment ID along
+	// with its CAS.
+	GetWithCAS(ctx context.Context, id string) (entity.Comment, uint64, error)
 	// Create saves a new comment in the storage.
 	Create(ctx context.Context, Comment entity.Comment) error
-	// Update updates the comment with given ID in the storage.
-	Update(ctx context.Context, User entity.Comment) error
+	// Update updates the comment with given ID in the storage provided its
+	// CAS did not change.
+	Update(ctx context.Context, comment entity.Comment, cas uint64) error
 	// Delete removes the comment with given ID from the storage.
 	Delete(ctx context.Context, id string) error
 	// Exists checks if a comment exists with a given ID.
@@ -46,6 +50,16 @@ func (r repository) Get(ctx context.Context, id string) (entity.Comment, error)
 	return com, err
 }
 
+// GetWithCAS reads the comment with the specified ID from the database
+// along with its CAS.
+func (r repository) GetWithCAS(ctx context.Context, id string) (
+	entity.Comment, uint64, error) {
+	var com entity.Comment
+	key := strings.ToLower(id)
+	cas, err := r.db.GetWithCAS(ctx, key, &com)
+	return com, cas, err
+}
+
 // Create saves a new comment record in the database.
 // It returns the ID of the newly inserted comment record.
 func (r repository) Create(ctx context.Context, comment entity.Comment) error {
@@ -53,8 +67,10 @@ func (r repository) Create(ctx context.Context, comment entity.Comment) error {
 }
 
 // Update updates the changes to a comment in the database.
-func (r repository) Update(ctx context.Context, comment entity.Comment) error {
-	return r.db.Update(ctx, comment.ID, &comment)
+func (r repository) Update(ctx context.Context, comment entity.Comment,
+	cas uint64) error {
+	_, err := r.db.Update(ctx, comment.ID, &comment, cas)
+	return err
 }
 
 // Delete deletes a comment with the specified ID from the database.
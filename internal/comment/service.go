@@ -10,10 +10,13 @@ import (
 	"time"
 
 	"github.com/saferwall/saferwall-api/internal/activity"
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
 	"github.com/saferwall/saferwall-api/internal/entity"
 	"github.com/saferwall/saferwall-api/internal/errors"
 	"github.com/saferwall/saferwall-api/internal/file"
 	"github.com/saferwall/saferwall-api/internal/user"
+	"github.com/saferwall/saferwall-api/internal/watch"
+	"github.com/saferwall/saferwall-api/internal/webhook"
 	"github.com/saferwall/saferwall-api/pkg/log"
 )
 
@@ -32,13 +35,18 @@ type Service interface {
 }
 
 type service struct {
-	repo    Repository
-	logger  log.Logger
-	actSvc  activity.Service
-	userSvc user.Service
-	fileSvc file.Service
+	repo     Repository
+	logger   log.Logger
+	actSvc   activity.Service
+	userSvc  user.Service
+	fileSvc  file.Service
+	hookSvc  webhook.Service
+	watchSvc watch.Service
 }
 
+// Length of the comment excerpts sent to the watchers.
+const maxExcerptLen = 280
+
 // CreateCommentRequest represents a comment creation request.
 type CreateCommentRequest struct {
 	Body     string `json:"body" validate:"required"`
@@ -53,8 +61,9 @@ type UpdateCommentRequest struct {
 
 // NewService creates a new user service.
 func NewService(repo Repository, logger log.Logger, actSvc activity.Service,
-	userSvc user.Service, fileSvc file.Service) Service {
-	return service{repo, logger, actSvc, userSvc, fileSvc}
+	userSvc user.Service, fileSvc file.Service,
+	hookSvc webhook.Service, watchSvc watch.Service) Service {
+	return service{repo, logger, actSvc, userSvc, fileSvc, hookSvc, watchSvc}
 }
 
 // Exists checks if a comment exists for the given id.
@@ -85,23 +94,14 @@ func (s service) Create(ctx context.Context, req CreateCommentRequest) (
 		return Comment{}, err
 	}
 
-	file, err := s.fileSvc.Get(ctx, req.SHA256, nil)
-	if err != nil {
-		return Comment{}, err
-	}
-
 	// Update comments count on user object.
-	err = s.userSvc.Patch(ctx, req.Username, "comments_count", user.CommentsCount+1)
+	err = s.userSvc.Increment(ctx, req.Username, "comments_count", 1)
 	if err != nil {
 		return Comment{}, err
 	}
 
 	// Update comments count on file object.
-	commentsCount := 0
-	if file.CommentsCount != nil {
-		commentsCount = *file.CommentsCount + 1
-	}
-	err = s.fileSvc.Patch(ctx, req.SHA256, "comments_count", commentsCount)
+	err = s.fileSvc.Increment(ctx, req.SHA256, "comments_count", 1)
 	if err != nil {
 		return Comment{}, err
 	}
@@ -118,7 +118,24 @@ func (s service) Create(ctx context.Context, req CreateCommentRequest) (
 	}); err != nil {
 		return Comment{}, err
 	}
-	return s.Get(ctx, id)
+
+	comment, err := s.Get(ctx, id)
+	if err != nil {
+		return Comment{}, err
+	}
+	s.hookSvc.Trigger(ctx, webhook.Event{
+		Name:   webhook.CommentCreated,
+		SHA256: req.SHA256,
+		Actor:  user.Username,
+		Data:   comment,
+	})
+	s.watchSvc.Notify(ctx, watch.Notice{
+		Kind:    watch.KindComment,
+		SHA256:  req.SHA256,
+		Actor:   user.Username,
+		Message: excerpt(req.Body, maxExcerptLen),
+	})
+	return comment, nil
 }
 
 // Get returns the comment with the specified comment ID.
@@ -135,35 +152,36 @@ func (s service) Update(ctx context.Context, id string, input UpdateCommentReque
 	Comment, error) {
 
 	var curUsername string
-
-	comment, err := s.Get(ctx, id)
-	if err != nil {
-		return comment, err
-	}
+	var comment Comment
 
 	if user, ok := ctx.Value(entity.UserKey).(entity.User); ok {
 		curUsername = user.ID()
 	}
 
-	if comment.Username != curUsername {
-		return comment, errors.Forbidden("")
-	}
-
 	data, err := json.Marshal(input)
 	if err != nil {
 		return comment, err
 	}
 
-	err = json.Unmarshal(data, &comment)
-	if err != nil {
-		return comment, err
-	}
+	err = dbcontext.RetryOnCASMismatch(ctx, func() error {
+		com, cas, err := s.repo.GetWithCAS(ctx, id)
+		if err != nil {
+			return err
+		}
+		comment = Comment{com}
 
-	if err := s.repo.Update(ctx, comment.Comment); err != nil {
-		return comment, err
-	}
+		if comment.Username != curUsername {
+			return errors.Forbidden("")
+		}
 
-	return comment, nil
+		err = json.Unmarshal(data, &comment)
+		if err != nil {
+			return err
+		}
+
+		return s.repo.Update(ctx, comment.Comment, cas)
+	})
+	return comment, err
 }
 
 // Delete deletes the comment with the specified ID.
@@ -183,3 +201,12 @@ func (s service) Delete(ctx context.Context, id string) (Comment, error) {
 
 	return com, nil
 }
+
+// excerpt shortens a text to at most n runes.
+func excerpt(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n]) + "…"
+}
@@ -25,10 +25,21 @@ type DatabaseCfg struct {
 
 // BrokerCfg represents the broker producer config.
 type BrokerCfg struct {
-	// the data source name (DSN) for connecting to the broker server.
+	// Kind of message broker, possible values: nsq, nats, kafka, memory, fs.
+	// Defaults to nsq.
+	Kind string `mapstructure:"kind"`
+	// the data source name (DSN) for connecting to the broker server. It
+	// is a comma separated list of brokers for kafka, and a directory for
+	// fs.
 	Address string `mapstructure:"address"`
 	// Topic name to write to.
 	Topic string `mapstructure:"topic"`
+	// Topic name used to broadcast real-time events across API instances.
+	// When empty, events are only dispatched within the local instance.
+	EventsTopic string `mapstructure:"events_topic"`
+	// Topics scan requests are routed to by priority, i.e: `high`. Scans
+	// with a priority missing from this list go to Topic.
+	PriorityTopics map[string]string `mapstructure:"priority_topics"`
 }
 
 // UICfg represents frontend config.
@@ -65,6 +76,9 @@ type StorageCfg struct {
 	FileContainerName string `mapstructure:"files_container_name"`
 	// AvatarsContainerName represents the name of the container for avatars.
 	AvatarsContainerName string `mapstructure:"avatars_container_name"`
+	// ArtifactsContainerName represents the name of the container for the
+	// screenshots and artifacts of the behavior scans.
+	ArtifactsContainerName string `mapstructure:"artifacts_container_name"`
 	// S3 represents AWS S3 object storage connection details.
 	S3 AWSS3Cfg `mapstructure:"s3"`
 	// S3 represents MinIO object storage connection details.
@@ -73,6 +87,43 @@ type StorageCfg struct {
 	Local LocalFsCfg `mapstructure:"local"`
 }
 
+// SchedulerCfg represents the periodic rescans config.
+type SchedulerCfg struct {
+	// Enabled is false when the files are never rescanned periodically.
+	Enabled bool `mapstructure:"enabled"`
+	// Maximum number of rescans enqueued per minute.
+	MaxRate int `mapstructure:"max_rate"`
+}
+
+// SandboxCfg represents the catalogue of dynamic analysis options.
+type SandboxCfg struct {
+	// OS images samples can be detonated in.
+	OSImages []OSImageCfg `mapstructure:"os_images"`
+	// Countries the VM traffic can be routed through, as lower case
+	// ISO 3166-1 alpha-2 codes.
+	Countries []string `mapstructure:"countries"`
+	// Timeout in seconds used when none is requested.
+	DefaultTimeout int `mapstructure:"default_timeout"`
+	// Minimum timeout in seconds.
+	MinTimeout int `mapstructure:"min_timeout"`
+	// Maximum timeout in seconds for regular users.
+	MaxTimeout int `mapstructure:"max_timeout"`
+	// Maximum timeout in seconds admins may grant to trusted users.
+	MaxTrustedTimeout int `mapstructure:"max_trusted_timeout"`
+}
+
+// OSImageCfg represents an OS image of the sandbox.
+type OSImageCfg struct {
+	// Name of the image, as requested in scan configs.
+	Name string `mapstructure:"name"`
+	// Human readable description of the image.
+	Description string `mapstructure:"description"`
+	// Default is true for the image used when none is requested.
+	Default bool `mapstructure:"default"`
+	// Restricted images are only available to users granted access.
+	Restricted bool `mapstructure:"restricted"`
+}
+
 type SMTPConfig struct {
 	Server   string `mapstructure:"server"`
 	Port     int    `mapstructure:"port"`
@@ -113,6 +164,10 @@ type Config struct {
 	ObjStorage StorageCfg `mapstructure:"storage"`
 	// SMTP server configuration.
 	SMTP SMTPConfig `mapstructure:"smtp"`
+	// Periodic rescans configuration.
+	Scheduler SchedulerCfg `mapstructure:"scheduler"`
+	// Dynamic analysis options catalogue.
+	Sandbox SandboxCfg `mapstructure:"sandbox"`
 }
 
 // Load returns an application configuration which is populated
@@ -8,6 +8,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -18,14 +19,52 @@ const (
 	// Duration to wait until memd connections have been established with
 	// the server and are ready.
 	timeout = 30 * time.Second
+
+	// Number of attempts made by RetryOnCASMismatch before giving up.
+	maxCASRetries = 5
 )
 
 var (
 	// ErrDocumentNotFound is returned when the doc does not exist in the DB.
 	ErrDocumentNotFound = errors.New("document not found")
-	ErrSubDocNotFound   = gocb.ErrPathNotFound
+	// ErrDocumentExists is returned when creating a doc whose key is taken.
+	ErrDocumentExists = gocb.ErrDocumentExists
+	ErrSubDocNotFound = gocb.ErrPathNotFound
+	// ErrSubDocExists is returned when a sub document insert targets a path
+	// that is already present.
+	ErrSubDocExists = gocb.ErrPathExists
+	// ErrCASMismatch is returned when a document has been modified since the
+	// CAS value supplied with a mutation was read.
+	ErrCASMismatch = gocb.ErrCasMismatch
 )
 
+// MutateOpKind describes the kind of a sub document mutation.
+type MutateOpKind int
+
+// Sub document mutations supported by MutateIn.
+const (
+	MutateUpsert MutateOpKind = iota
+	MutateInsert
+	MutateReplace
+	MutateRemove
+	MutateArrayAppend
+	MutateArrayInsert
+	// MutateIncrement adds the int64 Value (which can be negative) to the
+	// counter located at Path. The counter is created when missing.
+	MutateIncrement
+)
+
+// MaxMutateOps is the maximum number of sub document operations Couchbase
+// accepts in a single MutateIn call.
+const MaxMutateOps = 16
+
+// MutateOp represents a single sub document mutation.
+type MutateOp struct {
+	Kind  MutateOpKind
+	Path  string
+	Value interface{}
+}
+
 // DB represents the database connection.
 type DB struct {
 	Bucket     *gocb.Bucket
@@ -114,6 +153,24 @@ func (db *DB) Query(ctx context.Context, statement string,
 	return nil
 }
 
+// Decode converts the rows returned by Query into typed values, i.e. a
+// pointer to a slice of structs. It leaves val untouched when there are no
+// rows, and fails when rows is not a list of rows.
+func Decode(rows interface{}, val interface{}) error {
+	r, ok := rows.([]interface{})
+	if !ok {
+		return fmt.Errorf("decode: rows must be a list, got %T", rows)
+	}
+	if len(r) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(rows)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, val)
+}
+
 // Get retrieves the document using its key.
 func (db *DB) Get(ctx context.Context, key string, model interface{}) error {
 
@@ -135,28 +192,244 @@ func (db *DB) Get(ctx context.Context, key string, model interface{}) error {
 	return nil
 }
 
+// GetWithCAS retrieves the document using its key along with its CAS value.
+// The CAS changes every time the document is mutated, which makes it suitable
+// for optimistic concurrency control.
+func (db *DB) GetWithCAS(ctx context.Context, key string, model interface{}) (
+	uint64, error) {
+
+	getResult, err := db.Collection.Get(key, &gocb.GetOptions{})
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return 0, ErrDocumentNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	err = getResult.Content(&model)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(getResult.Cas()), nil
+}
+
 // Create saves a new document into the collection.
 func (db *DB) Create(ctx context.Context, key string, val interface{}) error {
 	_, err := db.Collection.Insert(key, val, &gocb.InsertOptions{})
 	return err
 }
 
-// Update updates a document in the collection.
-func (db *DB) Update(ctx context.Context, key string, val interface{}) error {
-	_, err := db.Collection.Replace(key, val, &gocb.ReplaceOptions{})
+// Upsert creates a document or replaces it when it already exists.
+func (db *DB) Upsert(ctx context.Context, key string, val interface{}) error {
+	_, err := db.Collection.Upsert(key, val, &gocb.UpsertOptions{})
 	return err
 }
 
+// UpsertMulti upserts many documents keyed by their keys in a single batch,
+// instead of a round trip per document. It returns the first error.
+func (db *DB) UpsertMulti(ctx context.Context,
+	docs map[string]interface{}) error {
+
+	if len(docs) == 0 {
+		return nil
+	}
+	ops := make([]gocb.BulkOp, 0, len(docs))
+	for key, val := range docs {
+		ops = append(ops, &gocb.UpsertOp{ID: key, Value: val})
+	}
+	if err := db.Collection.Do(ops, &gocb.BulkOpOptions{}); err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if err := op.(*gocb.UpsertOp).Err; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Update updates a document in the collection. When cas is not zero, the
+// document is only replaced if it has not changed since that CAS was read.
+// It returns the CAS of the document after the update.
+func (db *DB) Update(ctx context.Context, key string, val interface{},
+	cas uint64) (uint64, error) {
+
+	res, err := db.Collection.Replace(key, val, &gocb.ReplaceOptions{
+		Cas: gocb.Cas(cas)})
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return 0, ErrDocumentNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return uint64(res.Cas()), nil
+}
+
 // Patch performs a sub document in the collection. Sub documents operations
 // may be quicker and more network-efficient than full-document operations.
 func (db *DB) Patch(ctx context.Context, key string, path string,
 	val interface{}) error {
 
-	mops := []gocb.MutateInSpec{
-		gocb.UpsertSpec(path, val, &gocb.UpsertSpecOptions{}),
+	_, err := db.MutateIn(ctx, key, []MutateOp{
+		{Kind: MutateUpsert, Path: path, Value: val},
+	}, 0)
+	return err
+}
+
+// MutateIn applies a list of sub document mutations atomically: either all
+// of them succeed or none is applied. When cas is not zero, the mutations are
+// only applied if the document has not changed since that CAS was read. It
+// returns the CAS of the document after the mutation.
+func (db *DB) MutateIn(ctx context.Context, key string, ops []MutateOp,
+	cas uint64) (uint64, error) {
+
+	if len(ops) == 0 || len(ops) > MaxMutateOps {
+		return 0, fmt.Errorf("number of sub document operations must be between 1 and %d",
+			MaxMutateOps)
+	}
+
+	mops := make([]gocb.MutateInSpec, 0, len(ops))
+	for _, op := range ops {
+		switch op.Kind {
+		case MutateUpsert:
+			mops = append(mops, gocb.UpsertSpec(op.Path, op.Value,
+				&gocb.UpsertSpecOptions{CreatePath: true}))
+		case MutateInsert:
+			mops = append(mops, gocb.InsertSpec(op.Path, op.Value,
+				&gocb.InsertSpecOptions{CreatePath: true}))
+		case MutateReplace:
+			mops = append(mops, gocb.ReplaceSpec(op.Path, op.Value,
+				&gocb.ReplaceSpecOptions{}))
+		case MutateRemove:
+			mops = append(mops, gocb.RemoveSpec(op.Path,
+				&gocb.RemoveSpecOptions{}))
+		case MutateArrayAppend:
+			mops = append(mops, gocb.ArrayAppendSpec(op.Path, op.Value,
+				&gocb.ArrayAppendSpecOptions{CreatePath: true}))
+		case MutateArrayInsert:
+			mops = append(mops, gocb.ArrayInsertSpec(op.Path, op.Value,
+				&gocb.ArrayInsertSpecOptions{}))
+		case MutateIncrement:
+			delta, ok := op.Value.(int64)
+			if !ok {
+				return 0, fmt.Errorf("counter delta must be an int64, got %T", op.Value)
+			}
+			mops = append(mops, gocb.IncrementSpec(op.Path, delta,
+				&gocb.CounterSpecOptions{CreatePath: true}))
+		default:
+			return 0, fmt.Errorf("unknown sub document operation: %d", op.Kind)
+		}
+	}
+
+	res, err := db.Collection.MutateIn(key, mops, &gocb.MutateInOptions{
+		Cas: gocb.Cas(cas), Timeout: 10050 * time.Millisecond})
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return 0, ErrDocumentNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return uint64(res.Cas()), nil
+}
+
+// Increment atomically adds delta to the counter located at path in the
+// document. Unlike a read-modify-write, concurrent increments never lose
+// updates.
+func (db *DB) Increment(ctx context.Context, key, path string,
+	delta int64) error {
+
+	_, err := db.MutateIn(ctx, key, []MutateOp{
+		{Kind: MutateIncrement, Path: path, Value: delta},
+	}, 0)
+	return err
+}
+
+// Counter atomically adds delta to a standalone counter document and returns
+// its new value. The document is created on first use and expires after the
+// given duration, which makes it suitable for fixed window rate limits.
+func (db *DB) Counter(ctx context.Context, key string, delta uint64,
+	expiry time.Duration) (uint64, error) {
+
+	res, err := db.Collection.Binary().Increment(key, &gocb.IncrementOptions{
+		Delta: delta, Initial: int64(delta), Expiry: expiry})
+	if err != nil {
+		return 0, err
+	}
+	return res.Content(), nil
+}
+
+// Uncount atomically subtracts delta from a counter document created by
+// Counter. A missing counter, i.e. an expired one, is left missing.
+func (db *DB) Uncount(ctx context.Context, key string, delta uint64) error {
+	_, err := db.Collection.Binary().Decrement(key, &gocb.DecrementOptions{
+		Delta: delta, Initial: -1})
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return nil
+	}
+	return err
+}
+
+// lockDoc represents a lock document.
+type lockDoc struct {
+	Type  string `json:"type"`
+	Owner string `json:"owner"`
+}
+
+// Lock acquires the lock document with the given key on behalf of owner, or
+// renews it when owner already holds it. The lock is released when it is not
+// renewed within ttl. It returns false when another owner holds the lock.
+func (db *DB) Lock(ctx context.Context, key, owner string,
+	ttl time.Duration) (bool, error) {
+
+	lock := lockDoc{Type: "lock", Owner: owner}
+	res, err := db.Collection.Get(key, &gocb.GetOptions{})
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		_, err = db.Collection.Insert(key, lock,
+			&gocb.InsertOptions{Expiry: ttl})
+		if errors.Is(err, gocb.ErrDocumentExists) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var cur lockDoc
+	if err = res.Content(&cur); err != nil {
+		return false, err
+	}
+	if cur.Owner != owner {
+		return false, nil
+	}
+	_, err = db.Collection.Replace(key, lock, &gocb.ReplaceOptions{
+		Cas: res.Cas(), Expiry: ttl})
+	if errors.Is(err, gocb.ErrCasMismatch) ||
+		errors.Is(err, gocb.ErrDocumentNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// RetryOnCASMismatch runs fn, which is expected to perform a read-modify-write
+// guarded by a CAS, until it either succeeds or fails with an error other than
+// ErrCASMismatch. It gives up after a few attempts.
+func RetryOnCASMismatch(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 0; attempt < maxCASRetries; attempt++ {
+		err = fn()
+		if !errors.Is(err, ErrCASMismatch) {
+			return err
+		}
+
+		// Back off a little to let the concurrent writer finish.
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt+1) * 10 * time.Millisecond):
+		}
 	}
-	_, err := db.Collection.MutateIn(key, mops,
-		&gocb.MutateInOptions{Timeout: 10050 * time.Millisecond})
 	return err
 }
 
@@ -190,6 +463,19 @@ func (db *DB) Count(ctx context.Context, statement string,
 // Lookup query the document for certain path(s); these path(s) are then returned.
 func (db *DB) Lookup(ctx context.Context, key string, paths []string,
 	val interface{}) error {
+	_, err := db.lookup(ctx, key, paths, val, false)
+	return err
+}
+
+// LookupWithCAS is like Lookup but it also returns the CAS of the document.
+// Paths missing from the document are left untouched in `val`.
+func (db *DB) LookupWithCAS(ctx context.Context, key string, paths []string,
+	val interface{}) (uint64, error) {
+	return db.lookup(ctx, key, paths, val, true)
+}
+
+func (db *DB) lookup(ctx context.Context, key string, paths []string,
+	val interface{}, skipMissing bool) (uint64, error) {
 
 	ops := []gocb.LookupInSpec{}
 	getSpecOptions := gocb.GetSpecOptions{}
@@ -198,15 +484,21 @@ func (db *DB) Lookup(ctx context.Context, key string, paths []string,
 		ops = append(ops, gocb.GetSpec(path, &getSpecOptions))
 	}
 	getResult, err := db.Collection.LookupIn(key, ops, &gocb.LookupInOptions{})
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return 0, ErrDocumentNotFound
+	}
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	for i, path := range paths {
 		var content interface{}
 		err = getResult.ContentAt(uint(i), &content)
+		if skipMissing && errors.Is(err, ErrSubDocNotFound) {
+			continue
+		}
 		if err != nil {
-			return err
+			return 0, err
 		}
 
 		m := make(map[string]interface{})
@@ -224,12 +516,12 @@ func (db *DB) Lookup(ctx context.Context, key string, paths []string,
 
 		x, err := json.Marshal(m)
 		if err != nil {
-			return err
+			return 0, err
 		}
 		err = json.Unmarshal(x, &val)
 		if err != nil {
-			return err
+			return 0, err
 		}
 	}
-	return nil
+	return uint64(getResult.Cas()), nil
 }
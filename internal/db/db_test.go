@@ -0,0 +1,65 @@
+// Copyright 2021 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryOnCASMismatch(t *testing.T) {
+	ctx := context.Background()
+
+	// Succeeds once the concurrent writer is gone.
+	calls := 0
+	err := RetryOnCASMismatch(ctx, func() error {
+		calls++
+		if calls < 3 {
+			return ErrCASMismatch
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, calls)
+
+	// Other errors are returned right away.
+	calls = 0
+	errOther := errors.New("other")
+	err = RetryOnCASMismatch(ctx, func() error {
+		calls++
+		return errOther
+	})
+	assert.Equal(t, errOther, err)
+	assert.Equal(t, 1, calls)
+
+	// Gives up after a few attempts.
+	calls = 0
+	err = RetryOnCASMismatch(ctx, func() error {
+		calls++
+		return ErrCASMismatch
+	})
+	assert.True(t, errors.Is(err, ErrCASMismatch))
+	assert.Equal(t, maxCASRetries, calls)
+}
+
+func TestDecode(t *testing.T) {
+	var ids []string
+	assert.Nil(t, Decode([]interface{}{"a", "b"}, &ids))
+	assert.Equal(t, []string{"a", "b"}, ids)
+
+	// No rows leaves the value untouched.
+	var rows []interface{}
+	assert.Nil(t, Decode(rows, &ids))
+	assert.Equal(t, []string{"a", "b"}, ids)
+
+	// Anything but rows is rejected.
+	var results map[string]string
+	err := Decode(map[string]interface{}{"a": "b"}, &results)
+	assert.NotNil(t, err)
+	assert.Nil(t, results)
+}
@@ -14,26 +14,65 @@ type n1qlQuery int
 
 const (
 	AnoUserActivities n1qlQuery = iota
+	AVDetectionStats
+	AVEngineStats
+	AVFamilies
+	AVScans
 	AnoUserComments
 	AnoUserFollowers
 	AnoUserFollowing
 	AnoUserLikes
 	AnoUserSubmissions
+	BehaviorAPICounts
 	BehaviorReport
+	CountAVFamilies
+	CountAVScans
 	CountAnoUserActivities
+	CountFamilyFiles
+	CountFileBehaviors
+	CountIOCSamples
+	CountPEExports
+	CountPEImports
+	CountPESections
+	CountScanSchedules
+	CountStringFiles
 	CountStrings
+	CountTagFiles
+	CountTags
 	CountUserActivities
+	CountWebhookDeliveries
+	CountWebhooks
 	DeleteActivity
+	DeleteStaleIOCs
+	FamilyFiles
+	FileBehaviors
 	FileComments
 	FileStrings
 	FileSummary
 	GetAllDocType
+	IOCSamples
+	PEExports
+	PEImports
+	PESections
+	ScanSchedules
+	StaleFiles
+	StringFiles
+	TagFiles
+	Tags
 	UserActivities
 	UserComments
 	UserFollowers
 	UserFollowing
 	UserLikes
+	UserNotifications
 	UserSubmissions
+	WatchDigestsDue
+	Watchers
+	WebhookDeliveries
+	WebhookDueDeliveries
+	WebhookDueEvents
+	WebhookSubscribers
+	Webhooks
 )
 
 var fileQueryMap = map[string]n1qlQuery{
@@ -43,21 +82,60 @@ var fileQueryMap = map[string]n1qlQuery{
 	"ano-user-following.n1ql":        AnoUserFollowing,
 	"ano-user-likes.n1ql":            AnoUserLikes,
 	"ano-user-submissions.n1ql":      AnoUserSubmissions,
+	"av-detection-stats.n1ql":        AVDetectionStats,
+	"av-engine-stats.n1ql":           AVEngineStats,
+	"av-families.n1ql":               AVFamilies,
+	"av-scans.n1ql":                  AVScans,
+	"behavior-api-counts.n1ql":       BehaviorAPICounts,
 	"behavior-report.n1ql":           BehaviorReport,
 	"count-ano-user-activities.n1ql": CountAnoUserActivities,
+	"count-av-families.n1ql":         CountAVFamilies,
+	"count-av-scans.n1ql":            CountAVScans,
+	"count-family-files.n1ql":        CountFamilyFiles,
+	"count-file-behaviors.n1ql":      CountFileBehaviors,
+	"count-ioc-samples.n1ql":         CountIOCSamples,
+	"count-pe-exports.n1ql":          CountPEExports,
+	"count-pe-imports.n1ql":          CountPEImports,
+	"count-pe-sections.n1ql":         CountPESections,
+	"count-scan-schedules.n1ql":      CountScanSchedules,
+	"count-string-files.n1ql":        CountStringFiles,
 	"count-strings.n1ql":             CountStrings,
+	"count-tag-files.n1ql":           CountTagFiles,
+	"count-tags.n1ql":                CountTags,
 	"count-user-activities.n1ql":     CountUserActivities,
+	"count-webhook-deliveries.n1ql":  CountWebhookDeliveries,
+	"count-webhooks.n1ql":            CountWebhooks,
 	"delete-activity.n1ql":           DeleteActivity,
+	"delete-stale-iocs.n1ql":         DeleteStaleIOCs,
+	"family-files.n1ql":              FamilyFiles,
+	"file-behaviors.n1ql":            FileBehaviors,
 	"file-comments.n1ql":             FileComments,
 	"file-strings.n1ql":              FileStrings,
 	"file-summary.n1ql":              FileSummary,
 	"get-all-doc-type.n1ql":          GetAllDocType,
+	"ioc-samples.n1ql":               IOCSamples,
+	"pe-exports.n1ql":                PEExports,
+	"pe-imports.n1ql":                PEImports,
+	"pe-sections.n1ql":               PESections,
+	"scan-schedules.n1ql":            ScanSchedules,
+	"stale-files.n1ql":               StaleFiles,
+	"string-files.n1ql":              StringFiles,
+	"tag-files.n1ql":                 TagFiles,
+	"tags.n1ql":                      Tags,
 	"user-activities.n1ql":           UserActivities,
 	"user-comments.n1ql":             UserComments,
 	"user-followers.n1ql":            UserFollowers,
 	"user-following.n1ql":            UserFollowing,
 	"user-likes.n1ql":                UserLikes,
+	"user-notifications.n1ql":        UserNotifications,
 	"user-submissions.n1ql":          UserSubmissions,
+	"watch-digests-due.n1ql":         WatchDigestsDue,
+	"watchers.n1ql":                  Watchers,
+	"webhook-deliveries.n1ql":        WebhookDeliveries,
+	"webhook-due-deliveries.n1ql":    WebhookDueDeliveries,
+	"webhook-due-events.n1ql":        WebhookDueEvents,
+	"webhook-subscribers.n1ql":       WebhookSubscribers,
+	"webhooks.n1ql":                  Webhooks,
 }
 
 // walk returns list of files in directory.
@@ -0,0 +1,73 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	gocb "github.com/couchbase/gocb/v2"
+)
+
+// Tx represents a transaction over the documents of the collection.
+type Tx struct {
+	attempt    *gocb.TransactionAttemptContext
+	collection *gocb.Collection
+	// Documents read within the transaction, they are needed to replace
+	// them.
+	docs map[string]*gocb.TransactionGetResult
+}
+
+// Get reads a document within the transaction.
+func (tx *Tx) Get(key string, val interface{}) error {
+	doc, err := tx.attempt.Get(tx.collection, key)
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return ErrDocumentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	tx.docs[key] = doc
+	return doc.Content(val)
+}
+
+// Replace replaces a document previously read within the transaction.
+func (tx *Tx) Replace(key string, val interface{}) error {
+	doc, ok := tx.docs[key]
+	if !ok {
+		return fmt.Errorf("replace: %s was not read in the transaction", key)
+	}
+	doc, err := tx.attempt.Replace(doc, val)
+	if err != nil {
+		return err
+	}
+	tx.docs[key] = doc
+	return nil
+}
+
+// Insert creates a new document within the transaction.
+func (tx *Tx) Insert(key string, val interface{}) error {
+	_, err := tx.attempt.Insert(tx.collection, key, val)
+	return err
+}
+
+// Transaction runs fn in a transaction: either all the writes of fn are
+// applied or none is. fn runs again when it conflicts with a concurrent
+// write, so it must not have side effects besides its writes. The error fn
+// fails with is returned as is.
+func (db *DB) Transaction(ctx context.Context, fn func(tx *Tx) error) error {
+	var fnErr error
+	_, err := db.Cluster.Transactions().Run(
+		func(attempt *gocb.TransactionAttemptContext) error {
+			fnErr = fn(&Tx{attempt, db.Collection,
+				make(map[string]*gocb.TransactionGetResult)})
+			return fnErr
+		}, nil)
+	if err != nil && fnErr != nil {
+		return fnErr
+	}
+	return err
+}
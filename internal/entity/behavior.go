@@ -4,20 +4,270 @@
 
 package entity
 
-// Behavior represents a dynamic file scan report.
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Behavior represents a dynamic file scan report. The API trace and the
+// system events are stored in their own documents, see BehaviorScan.
 type Behavior struct {
-	Type             string      `json:"type,omitempty"`
-	SHA256           string      `json:"sha256,omitempty"`
-	Timestamp        int64       `json:"timestamp,omitempty"`
-	Environment      interface{} `json:"env,omitempty"`
-	APITrace         interface{} `json:"api_trace,omitempty"`
-	Artifacts        interface{} `json:"artifacts,omitempty"`
-	SystemEvents     interface{} `json:"sys_events,omitempty"`
-	ProcessTree      interface{} `json:"proc_tree,omitempty"`
-	Capabilities     interface{} `json:"capabilities,omitempty"`
-	ScreenshotsCount int         `json:"screenshots_count,omitempty"`
-	ScanConfig       interface{} `json:"scan_cfg,omitempty"`
-	SandboxLog       interface{} `json:"sandbox_log,omitempty"`
-	AgentLog         interface{} `json:"agent_log,omitempty"`
-	Status           int         `json:"status,omitempty"`
+	Type             string          `json:"type,omitempty"`
+	SHA256           string          `json:"sha256,omitempty"`
+	Timestamp        int64           `json:"timestamp,omitempty"`
+	Environment      interface{}     `json:"env,omitempty"`
+	APITrace         []APICall       `json:"api_trace,omitempty"`
+	Artifacts        []Artifact      `json:"artifacts,omitempty"`
+	SystemEvents     []SystemEvent   `json:"sys_events,omitempty"`
+	ProcessTree      interface{}     `json:"proc_tree,omitempty"`
+	Capabilities     []Capability    `json:"capabilities,omitempty"`
+	ScreenshotsCount int             `json:"screenshots_count,omitempty"`
+	ScanConfig       *BehaviorConfig `json:"scan_cfg,omitempty"`
+	SandboxLog       interface{}     `json:"sandbox_log,omitempty"`
+	AgentLog         interface{}     `json:"agent_log,omitempty"`
+	Status           int             `json:"status,omitempty"`
+}
+
+// BehaviorConfig represents the configuration a file was detonated with.
+type BehaviorConfig struct {
+	DestPath string `json:"dest_path,omitempty"`
+	Args     string `json:"args,omitempty"`
+	Timeout  int    `json:"timeout,omitempty"`
+	Country  string `json:"country,omitempty"`
+	OS       string `json:"os,omitempty"`
+	Extra    Extra  `json:"-"`
+}
+
+// APICall represents a Windows API called by a process.
+type APICall struct {
+	PID  HexID    `json:"pid"`
+	TID  HexID    `json:"tid"`
+	Name string   `json:"name"`
+	Args []APIArg `json:"args,omitempty"`
+	Ret  string   `json:"ret,omitempty"`
+	// TS is the time of the call relative to the start of the detonation.
+	TS    int64 `json:"ts"`
+	Extra Extra `json:"-"`
+}
+
+// APIArg represents an argument of an API call.
+type APIArg struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// SystemEvent represents a file, registry, network, DNS or mutex operation
+// of a process.
+type SystemEvent struct {
+	PID HexID `json:"pid"`
+	// Type is one of: "file", "registry", "network", "dns", "mutex".
+	Type string `json:"type"`
+	// Path is the file path, registry key, mutex name, host or URL the
+	// operation applies to.
+	Path  string `json:"path"`
+	Op    string `json:"op,omitempty"`
+	TS    int64  `json:"ts"`
+	Extra Extra  `json:"-"`
+}
+
+// Artifact represents a file collected during a detonation, either dropped
+// by the sample or dumped from memory.
+type Artifact struct {
+	PID       HexID  `json:"pid,omitempty"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name,omitempty"`
+	SHA256    string `json:"sha256"`
+	Size      int64  `json:"size,omitempty"`
+	Detection string `json:"detection,omitempty"`
+	Extra     Extra  `json:"-"`
+}
+
+// BehaviorScan represents the summary of a sandbox run of a file.
+type BehaviorScan struct {
+	ID               string `json:"id"`
+	SHA256           string `json:"sha256"`
+	Timestamp        int64  `json:"timestamp"`
+	OS               string `json:"os,omitempty"`
+	Timeout          int    `json:"timeout,omitempty"`
+	Country          string `json:"country,omitempty"`
+	Status           int    `json:"status"`
+	ScreenshotsCount int    `json:"screenshots_count"`
+	Extra            Extra  `json:"-"`
+	// ref is set when the scan was referenced by ID only, and key to the
+	// key the scan was held under by the older documents which hold the
+	// scans as an object, so that they are encoded back the same way.
+	ref bool
+	key string
+}
+
+// BehaviorScans represents the behavior scans referenced by a file.
+type BehaviorScans []BehaviorScan
+
+// HexID represents a process or thread ID as a lower case 0x prefixed hex
+// string. The sandbox reports them as numbers or as decimal or hex strings.
+type HexID string
+
+// UnmarshalJSON decodes the configuration leniently.
+func (c *BehaviorConfig) UnmarshalJSON(data []byte) error {
+	type plain BehaviorConfig
+	extra, err := decodeLenient(data, (*plain)(c), c.Extra)
+	c.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes the configuration along with its extra attributes.
+func (c BehaviorConfig) MarshalJSON() ([]byte, error) {
+	type plain BehaviorConfig
+	return encodeLenient(plain(c), c.Extra)
+}
+
+// UnmarshalJSON decodes an API call leniently.
+func (a *APICall) UnmarshalJSON(data []byte) error {
+	type plain APICall
+	extra, err := decodeLenient(data, (*plain)(a), a.Extra)
+	a.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes an API call along with its extra attributes.
+func (a APICall) MarshalJSON() ([]byte, error) {
+	type plain APICall
+	return encodeLenient(plain(a), a.Extra)
+}
+
+// UnmarshalJSON decodes a system event leniently.
+func (e *SystemEvent) UnmarshalJSON(data []byte) error {
+	type plain SystemEvent
+	extra, err := decodeLenient(data, (*plain)(e), e.Extra)
+	e.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes a system event along with its extra attributes.
+func (e SystemEvent) MarshalJSON() ([]byte, error) {
+	type plain SystemEvent
+	return encodeLenient(plain(e), e.Extra)
+}
+
+// UnmarshalJSON decodes an artifact leniently.
+func (a *Artifact) UnmarshalJSON(data []byte) error {
+	type plain Artifact
+	extra, err := decodeLenient(data, (*plain)(a), a.Extra)
+	a.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes an artifact along with its extra attributes.
+func (a Artifact) MarshalJSON() ([]byte, error) {
+	type plain Artifact
+	return encodeLenient(plain(a), a.Extra)
+}
+
+// UnmarshalJSON decodes a behavior scan, which older documents reference
+// by ID only.
+func (s *BehaviorScan) UnmarshalJSON(data []byte) error {
+	type plain BehaviorScan
+	var id string
+	if err := json.Unmarshal(data, &id); err == nil {
+		*s = BehaviorScan{ID: id, ref: true}
+		return nil
+	}
+	extra, err := decodeLenient(data, (*plain)(s), s.Extra)
+	s.Extra = extra
+	s.ref = false
+	return err
+}
+
+// MarshalJSON encodes a behavior scan in the shape it was decoded from.
+func (s BehaviorScan) MarshalJSON() ([]byte, error) {
+	type plain BehaviorScan
+	if s.ref {
+		return json.Marshal(s.ID)
+	}
+	return encodeLenient(plain(s), s.Extra)
+}
+
+// UnmarshalJSON decodes the behavior scans of a file, which older
+// documents hold as an object keyed by scan ID.
+func (s *BehaviorScans) UnmarshalJSON(data []byte) error {
+	var scans []BehaviorScan
+	if err := json.Unmarshal(data, &scans); err == nil {
+		*s = scans
+		return nil
+	}
+
+	var byID map[string]BehaviorScan
+	if err := json.Unmarshal(data, &byID); err != nil {
+		return err
+	}
+	scans = make([]BehaviorScan, 0, len(byID))
+	for id, scan := range byID {
+		if scan.ID == "" {
+			scan.ID = id
+		}
+		scan.key = id
+		scans = append(scans, scan)
+	}
+	sort.Slice(scans, func(i, j int) bool {
+		if scans[i].Timestamp != scans[j].Timestamp {
+			return scans[i].Timestamp > scans[j].Timestamp
+		}
+		return scans[i].ID < scans[j].ID
+	})
+	*s = scans
+	return nil
+}
+
+// MarshalJSON encodes the behavior scans of a file as an object keyed by
+// scan ID when they were decoded from one.
+func (s BehaviorScans) MarshalJSON() ([]byte, error) {
+	if len(s) == 0 || s[0].key == "" {
+		return json.Marshal([]BehaviorScan(s))
+	}
+	byID := make(map[string]BehaviorScan, len(s))
+	for _, scan := range s {
+		key := scan.key
+		if key == "" {
+			key = scan.ID
+		}
+		byID[key] = scan
+	}
+	return json.Marshal(byID)
+}
+
+// UnmarshalJSON decodes and normalizes a process or thread ID.
+func (id *HexID) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	var n uint64
+	var err error
+	switch v := v.(type) {
+	case nil:
+		*id = ""
+		return nil
+	case float64:
+		if v < 0 {
+			return fmt.Errorf("invalid process or thread ID %v", v)
+		}
+		n = uint64(v)
+	case string:
+		s := strings.ToLower(v)
+		if strings.HasPrefix(s, "0x") {
+			n, err = strconv.ParseUint(s[2:], 16, 64)
+		} else {
+			n, err = strconv.ParseUint(s, 10, 64)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid process or thread ID %q", v)
+		}
+	default:
+		return fmt.Errorf("invalid process or thread ID %v", v)
+	}
+	*id = HexID("0x" + strconv.FormatUint(n, 16))
+	return nil
 }
@@ -0,0 +1,115 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBehavior(t *testing.T) {
+	doc := `{
+		"sha256": "abc",
+		"scan_cfg": {"os": "win-10", "timeout": 60, "vm": "win10-1"},
+		"artifacts": [
+			{"pid": 6988, "kind": "file", "sha256": "1", "size": 4096},
+			{"pid": "explorer", "kind": "memdump", "sha256": "2"}
+		],
+		"capabilities": [
+			{"description": "Injects code (T1055)", "pid": 6988,
+				"attack": ["T1055.012"]},
+			{"description": "Persists", "category": "persistence (T1547.001)"}
+		]
+	}`
+
+	var b Behavior
+	assert.Nil(t, json.Unmarshal([]byte(doc), &b))
+	assert.Equal(t, "win-10", b.ScanConfig.OS)
+	assert.Equal(t, 60, b.ScanConfig.Timeout)
+	assert.Equal(t, json.RawMessage(`"win10-1"`), b.ScanConfig.Extra["vm"])
+
+	assert.Equal(t, HexID("0x1b4c"), b.Artifacts[0].PID)
+	assert.Equal(t, int64(4096), b.Artifacts[0].Size)
+	assert.Empty(t, b.Artifacts[1].PID)
+	assert.Equal(t, json.RawMessage(`"explorer"`), b.Artifacts[1].Extra["pid"])
+
+	assert.Equal(t, []Capability{
+		{Description: "Injects code (T1055)", PID: "0x1b4c",
+			Techniques: []string{"T1055", "T1055.012"}},
+		{Description: "Persists", Category: "persistence (T1547.001)",
+			Techniques: []string{"T1547.001"}},
+	}, b.Capabilities)
+
+	// Encoded capabilities decode to the same techniques.
+	data, err := json.Marshal(b.Capabilities)
+	assert.Nil(t, err)
+	var capabilities []Capability
+	assert.Nil(t, json.Unmarshal(data, &capabilities))
+	assert.Equal(t, b.Capabilities, capabilities)
+}
+
+func TestBehaviorScans(t *testing.T) {
+	doc := `{
+		"default_behavior_report": "id-2",
+		"behavior_scans": {
+			"id-1": {"timestamp": 10, "status": 2, "vm": "win10-1"},
+			"id-2": {"id": "id-2", "timestamp": 20, "status": 2}
+		}}`
+	var f File
+	assert.Nil(t, json.Unmarshal([]byte(doc), &f))
+	assert.Equal(t, &BehaviorScan{ID: "id-2", ref: true}, f.DefaultBhvReport)
+	assert.Equal(t, BehaviorScans{
+		{ID: "id-2", Timestamp: 20, Status: 2, key: "id-2"},
+		{ID: "id-1", Timestamp: 10, Status: 2, key: "id-1",
+			Extra: Extra{"vm": json.RawMessage(`"win10-1"`)}},
+	}, f.BhvScans)
+
+	// Older documents are encoded back in the same shape.
+	data, err := json.Marshal(struct {
+		DefaultBhvReport *BehaviorScan `json:"default_behavior_report"`
+		BhvScans         BehaviorScans `json:"behavior_scans"`
+	}{f.DefaultBhvReport, f.BhvScans})
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{
+		"default_behavior_report": "id-2",
+		"behavior_scans": {
+			"id-1": {"id": "id-1", "sha256": "", "timestamp": 10, "status": 2,
+				"screenshots_count": 0, "vm": "win10-1"},
+			"id-2": {"id": "id-2", "sha256": "", "timestamp": 20, "status": 2,
+				"screenshots_count": 0}
+		}}`, string(data))
+
+	assert.Nil(t, json.Unmarshal([]byte(`{"behavior_scans": [
+		{"id": "id-3", "timestamp": 30}, "id-4"]}`), &f))
+	assert.Equal(t, BehaviorScans{{ID: "id-3", Timestamp: 30},
+		{ID: "id-4", ref: true}}, f.BhvScans)
+	data, err = json.Marshal(f.BhvScans)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `[{"id": "id-3", "sha256": "", "timestamp": 30,
+		"status": 0, "screenshots_count": 0}, "id-4"]`, string(data))
+}
+
+func TestHexID(t *testing.T) {
+	tests := []struct {
+		in   string
+		want HexID
+		err  bool
+	}{
+		{`"0x1B4C"`, "0x1b4c", false},
+		{`"6988"`, "0x1b4c", false},
+		{`6988`, "0x1b4c", false},
+		{`null`, "", false},
+		{`"explorer"`, "", true},
+		{`-1`, "", true},
+	}
+	for _, tt := range tests {
+		var id HexID
+		err := json.Unmarshal([]byte(tt.in), &id)
+		assert.Equal(t, tt.err, err != nil, tt.in)
+		assert.Equal(t, tt.want, id, tt.in)
+	}
+}
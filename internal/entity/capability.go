@@ -0,0 +1,91 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+)
+
+var regTechnique = regexp.MustCompile(`\bT[0-9]{4}(?:\.[0-9]{3})?\b`)
+
+// Capability represents something a file did during a detonation, like
+// injecting code or persisting across reboots.
+type Capability struct {
+	Description string `json:"description"`
+	Category    string `json:"category,omitempty"`
+	Severity    string `json:"severity,omitempty"`
+	// PID of the process which exhibited the capability.
+	PID HexID `json:"pid,omitempty"`
+	// Techniques lists the IDs of the MITRE ATT&CK techniques the
+	// capability maps to, i.e: `T1055`, `T1547.001`.
+	Techniques []string `json:"attack,omitempty"`
+	Extra      Extra    `json:"-"`
+}
+
+// UnmarshalJSON decodes a capability reported by the sandbox, which does not
+// use a fixed schema. Technique IDs are looked for in every string of the
+// capability, so that `{"attack": ["T1055"]}` as well as
+// `{"description": "Injects code (T1055)"}` map to process injection.
+func (c *Capability) UnmarshalJSON(data []byte) error {
+	type plain Capability
+	extra, err := decodeLenient(data, (*plain)(c), c.Extra)
+	c.Extra = extra
+	if err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	c.Techniques = techniqueIDs(fields)
+	return nil
+}
+
+// MarshalJSON encodes a capability along with its extra attributes. The
+// techniques are left out when the sandbox reported them in another shape,
+// as they are found again in the extra attributes.
+func (c Capability) MarshalJSON() ([]byte, error) {
+	type plain Capability
+	if _, ok := c.Extra["attack"]; ok {
+		c.Techniques = nil
+	}
+	return encodeLenient(plain(c), c.Extra)
+}
+
+// techniqueIDs returns the sorted and deduplicated technique IDs found in
+// the strings of a value.
+func techniqueIDs(v interface{}) []string {
+	seen := make(map[string]bool)
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case string:
+			for _, id := range regTechnique.FindAllString(v, -1) {
+				seen[id] = true
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		case map[string]interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+	walk(v)
+
+	if len(seen) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,43 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapability(t *testing.T) {
+	var capabilities []Capability
+	err := json.Unmarshal([]byte(`[
+		{"description": "Injects code into a remote process (T1055)",
+			"category": "injection", "pid": 1234,
+			"attack": ["T1055.012", "T1055"]},
+		{"description": "Enumerates files"}
+	]`), &capabilities)
+	assert.Nil(t, err)
+	assert.Equal(t, []Capability{
+		{
+			Description: "Injects code into a remote process (T1055)",
+			Category:    "injection",
+			PID:         "0x4d2",
+			Techniques:  []string{"T1055", "T1055.012"},
+		},
+		{Description: "Enumerates files"},
+	}, capabilities)
+
+	// Unknown attributes and techniques reported in another shape are
+	// encoded back as they were decoded.
+	doc := `{"description":"Hollows a process","rule":"hollowing",` +
+		`"attack":[{"id":"T1055.012"}]}`
+	var c Capability
+	assert.Nil(t, json.Unmarshal([]byte(doc), &c))
+	assert.Equal(t, []string{"T1055.012"}, c.Techniques)
+	data, err := json.Marshal(c)
+	assert.Nil(t, err)
+	assert.JSONEq(t, doc, string(data))
+}
@@ -0,0 +1,96 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Extra holds the attributes of a document which are not part of its typed
+// model, or whose value does not fit it, like the ones written by older
+// versions of the scanners. They are encoded back as they were decoded so
+// that reading and saving a document never loses data.
+type Extra map[string]json.RawMessage
+
+// jsonFields caches the index of the struct fields by JSON name.
+var jsonFields sync.Map
+
+// fieldsOf returns the index of the fields of a struct type by JSON name.
+func fieldsOf(t reflect.Type) map[string]int {
+	if fields, ok := jsonFields.Load(t); ok {
+		return fields.(map[string]int)
+	}
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = i
+	}
+	jsonFields.Store(t, fields)
+	return fields
+}
+
+// decodeLenient decodes a JSON object into the struct v points to, one
+// attribute at a time, and returns the extra attributes: the ones which
+// are unknown or fail to decode. Like encoding/json does for structs, the
+// attributes missing from the object are left untouched, including the
+// extra ones, so that sub-documents looked up separately add up.
+func decodeLenient(data []byte, v interface{}, extra Extra) (Extra, error) {
+	var attrs map[string]json.RawMessage
+	if err := json.Unmarshal(data, &attrs); err != nil {
+		return extra, err
+	}
+
+	s := reflect.ValueOf(v).Elem()
+	fields := fieldsOf(s.Type())
+	for name, value := range attrs {
+		if i, ok := fields[name]; ok {
+			field := s.Field(i)
+			if json.Unmarshal(value, field.Addr().Interface()) == nil {
+				delete(extra, name)
+				continue
+			}
+			field.Set(reflect.Zero(field.Type()))
+		}
+		if extra == nil {
+			extra = make(Extra)
+		}
+		extra[name] = value
+	}
+	return extra, nil
+}
+
+// encodeLenient encodes v along with the extra attributes it was decoded
+// with. The typed attributes take precedence, unless they are still unset
+// after failing to decode.
+func encodeLenient(v interface{}, extra Extra) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+	var attrs map[string]json.RawMessage
+	if err = json.Unmarshal(data, &attrs); err != nil {
+		return nil, err
+	}
+
+	s := reflect.ValueOf(v)
+	fields := fieldsOf(s.Type())
+	for name, value := range extra {
+		i, known := fields[name]
+		if _, ok := attrs[name]; !ok || known && s.Field(i).IsZero() {
+			attrs[name] = value
+		}
+	}
+	return json.Marshal(attrs)
+}
@@ -26,18 +26,23 @@ type File struct {
 	FirstSeen        int64                  `json:"first_seen,omitempty"`
 	LastScanned      int64                  `json:"last_scanned,omitempty"`
 	Submissions      []Submission           `json:"submissions,omitempty"`
-	Strings          interface{}            `json:"strings,omitempty"`
+	Strings          *Strings               `json:"strings,omitempty"`
 	MultiAV          map[string]interface{} `json:"multiav,omitempty"`
-	PE               interface{}            `json:"pe,omitempty"`
+	PE               *PE                    `json:"pe,omitempty"`
 	Histogram        []int                  `json:"histogram,omitempty"`
 	ByteEntropy      []int                  `json:"byte_entropy,omitempty"`
 	Ml               map[string]interface{} `json:"ml,omitempty"`
 	CommentsCount    *int                   `json:"comments_count,omitempty"`
 	Format           string                 `json:"file_format,omitempty"`
 	Extension        string                 `json:"file_extension,omitempty"`
-	DefaultBhvReport interface{}            `json:"default_behavior_report,omitempty"`
-	BhvScans         interface{}            `json:"behavior_scans,omitempty"`
+	DefaultBhvReport *BehaviorScan          `json:"default_behavior_report,omitempty"`
+	BhvScans         BehaviorScans          `json:"behavior_scans,omitempty"`
 	Status           int                    `json:"status,omitempty"`
+	UserTags         []UserTag              `json:"user_tags,omitempty"`
+	Verdicts         map[string]Verdict     `json:"verdicts,omitempty"`
+	ScanProgress     map[string]ScanStage   `json:"scan_progress,omitempty"`
+	ScanRequestedAt  int64                  `json:"scan_requested_at,omitempty"`
+	Classification   *AVClassification      `json:"classification,omitempty"`
 }
 
 // Submission represents a file submission.
@@ -48,6 +53,35 @@ type Submission struct {
 	Country   string `json:"country,omitempty"`
 }
 
+// UserTag represents a tag applied to a file by an analyst.
+type UserTag struct {
+	Tag       string `json:"tag"`
+	Username  string `json:"username"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// Verdict represents the opinion of an analyst about a file.
+type Verdict struct {
+	// Verdict is one of: "malicious", "suspicious", "benign".
+	Verdict string `json:"verdict"`
+	// Confidence of the analyst in its verdict, from 0 to 100.
+	Confidence int    `json:"confidence"`
+	Username   string `json:"username"`
+	Timestamp  int64  `json:"timestamp"`
+}
+
+// ScanStage represents the progress of a stage of the scan pipeline.
+type ScanStage struct {
+	// Status is one of: "queued", "running", "completed", "failed", "skipped".
+	Status     string `json:"status"`
+	StartedAt  int64  `json:"started_at,omitempty"`
+	FinishedAt int64  `json:"finished_at,omitempty"`
+	// Error reported by the worker when the stage failed.
+	Error string `json:"error,omitempty"`
+	// Engines tracks individual AV engines within the multiav stage.
+	Engines map[string]ScanStage `json:"engines,omitempty"`
+}
+
 // ID returns a unique ID to identify a File object.
 func (f File) ID(key string) string {
 	return strings.ToLower(key)
@@ -0,0 +1,36 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+// IOCRef represents a reference from an indicator of compromise to a file
+// or one of its behavior scans. It is the lookup document used to pivot
+// from an IOC to the samples exhibiting it.
+type IOCRef struct {
+	// Type represents the document type.
+	Type string `json:"type"`
+	// Kind of the IOC, one of: "domain", "ip", "url", "mutex", "registry",
+	// "sha256", "imphash".
+	Kind string `json:"kind"`
+	// Value of the IOC, lower cased unless the IOC is case sensitive.
+	Value string `json:"value"`
+	// SHA256 of the file referencing the IOC.
+	SHA256 string `json:"sha256"`
+	// BehaviorID is the behavior scan the IOC was observed in, it is empty
+	// when the IOC comes from the file itself.
+	BehaviorID string `json:"behavior_id,omitempty"`
+	// Timestamp when the reference was indexed.
+	Timestamp int64 `json:"timestamp"`
+}
+
+// IOCSample represents a file referencing an IOC.
+type IOCSample struct {
+	SHA256 string `json:"sha256"`
+	// Kinds of the references, an IOC value may be of several kinds.
+	Kinds []string `json:"kinds"`
+	// BehaviorIDs lists the behavior scans the IOC was observed in.
+	BehaviorIDs []string `json:"behavior_ids"`
+	// LastSeen is the last time the file was indexed with the IOC.
+	LastSeen int64 `json:"last_seen"`
+}
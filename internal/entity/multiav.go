@@ -0,0 +1,53 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+// EngineResult represents the result of an AV engine scanning a file.
+type EngineResult struct {
+	// Infected is true when the engine flagged the file.
+	Infected bool `json:"infected"`
+	// Output is the detection name reported by the engine.
+	Output string `json:"output"`
+	// Update is the unix time of the engine signatures update.
+	Update int64 `json:"update,omitempty"`
+}
+
+// AVScan represents an entry of the multiav scan history of a file. History
+// entries are never modified once created.
+type AVScan struct {
+	// Type represents the document type.
+	Type string `json:"type,omitempty"`
+	// ID represents the scan identifier.
+	ID string `json:"id"`
+	// SHA256 of the scanned file.
+	SHA256 string `json:"sha256"`
+	// Timestamp when the scan results were received.
+	Timestamp int64 `json:"timestamp"`
+	// Results of the scan keyed by engine name.
+	Results map[string]EngineResult `json:"results"`
+	// Classification of the file according to this scan.
+	Classification *AVClassification `json:"classification,omitempty"`
+}
+
+// AVClassification represents the consensus family and type of a file out of
+// the detection names of the AV engines.
+type AVClassification struct {
+	// Family is the malware family most engines agree on, i.e: `emotet`.
+	Family string `json:"family,omitempty"`
+	// Category is the kind of malware most engines agree on, i.e: `trojan`.
+	Category string `json:"type,omitempty"`
+	// Votes is the number of engines naming the family.
+	Votes int `json:"votes"`
+	// Engines is the number of engines which flagged the file.
+	Engines int `json:"engines"`
+	// Candidates lists the runner-up families along with their votes.
+	Candidates []LabelVote `json:"candidates,omitempty"`
+}
+
+// LabelVote represents the number of engines agreeing on a label.
+type LabelVote struct {
+	Label string `json:"label"`
+	Votes int    `json:"votes"`
+}
@@ -0,0 +1,517 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// dansMarker is the first dword of the decoded rich header, `DanS`.
+const dansMarker = 0x536e6144
+
+// PE represents the output of the PE parser for a Portable Executable file.
+// The attributes of the parser which are not modeled are kept in Extra.
+type PE struct {
+	Meta       *PEMeta            `json:"meta,omitempty"`
+	DOSHeader  *DOSHeader         `json:"dos_header,omitempty"`
+	RichHeader *RichHeader        `json:"rich_header,omitempty"`
+	NtHeader   *NtHeader          `json:"nt_header,omitempty"`
+	Sections   []Section          `json:"sections,omitempty"`
+	Imports    []Import           `json:"imports,omitempty"`
+	Export     *Export            `json:"export,omitempty"`
+	Resources  *ResourceDirectory `json:"resources,omitempty"`
+	Signature  *Signature         `json:"signature,omitempty"`
+	Extra      Extra              `json:"-"`
+}
+
+// PEMeta represents the values computed out of the parsed structures.
+type PEMeta struct {
+	// Imphash is the MD5 of the lower cased imported functions.
+	Imphash string `json:"imphash,omitempty"`
+	Extra   Extra  `json:"-"`
+}
+
+// DOSHeader represents the MS-DOS header.
+type DOSHeader struct {
+	Magic uint16 `json:"magic"`
+	// AddressOfNewEXEHeader is the file offset of the NT header.
+	AddressOfNewEXEHeader uint32 `json:"address_of_new_exe_header"`
+	Extra                 Extra  `json:"-"`
+}
+
+// RichHeader represents the undocumented header written by the Microsoft
+// linkers, which lists the tools the file was built with.
+type RichHeader struct {
+	XORKey     uint32   `json:"xor_key"`
+	CompIDs    []CompID `json:"comp_ids"`
+	DansOffset int      `json:"dans_offset"`
+	// Raw holds the header bytes as found in the file, XOR-ed with the
+	// key, from the `DanS` marker to the `Rich` one excluded.
+	Raw   []byte `json:"raw,omitempty"`
+	Extra Extra  `json:"-"`
+}
+
+// CompID represents a tool of the rich header.
+type CompID struct {
+	// MinorCV is the build number of the tool.
+	MinorCV uint16 `json:"minor_cv"`
+	// ProdID identifies the tool.
+	ProdID uint16 `json:"prod_id"`
+	// Count is the number of objects built with the tool.
+	Count uint32 `json:"count"`
+	// Unmasked is the raw value, `ProdID << 16 | MinorCV`.
+	Unmasked uint32 `json:"unmasked_value"`
+	Extra    Extra  `json:"-"`
+}
+
+// Hash returns the MD5 of the decoded rich header, from the `DanS` marker
+// to the `Rich` one excluded, like pefile computes it. When the raw bytes
+// were not saved, the header is rebuilt out of the tools, which gives the
+// same hash unless the linker wrote garbage in the padding. It is empty
+// when the header lists no tools.
+func (h RichHeader) Hash() string {
+	var decoded []byte
+	if len(h.Raw) >= 16 && len(h.Raw)%4 == 0 {
+		decoded = make([]byte, len(h.Raw))
+		for i := 0; i < len(h.Raw); i += 4 {
+			dword := binary.LittleEndian.Uint32(h.Raw[i:]) ^ h.XORKey
+			binary.LittleEndian.PutUint32(decoded[i:], dword)
+		}
+	} else if len(h.CompIDs) > 0 {
+		decoded = make([]byte, 16, 16+8*len(h.CompIDs))
+		binary.LittleEndian.PutUint32(decoded, dansMarker)
+		for _, id := range h.CompIDs {
+			unmasked := id.Unmasked
+			if unmasked == 0 {
+				unmasked = uint32(id.ProdID)<<16 | uint32(id.MinorCV)
+			}
+			decoded = binary.LittleEndian.AppendUint32(decoded, unmasked)
+			decoded = binary.LittleEndian.AppendUint32(decoded, id.Count)
+		}
+	} else {
+		return ""
+	}
+	sum := md5.Sum(decoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// NtHeader represents the NT headers.
+type NtHeader struct {
+	Signature      uint32          `json:"signature"`
+	FileHeader     *FileHeader     `json:"file_header,omitempty"`
+	OptionalHeader *OptionalHeader `json:"optional_header,omitempty"`
+	Extra          Extra           `json:"-"`
+}
+
+// FileHeader represents the COFF file header.
+type FileHeader struct {
+	Machine              uint16 `json:"machine"`
+	NumberOfSections     uint16 `json:"number_of_sections"`
+	TimeDateStamp        uint32 `json:"time_date_stamp"`
+	PointerToSymbolTable uint32 `json:"pointer_to_symbol_table"`
+	NumberOfSymbols      uint32 `json:"number_of_symbols"`
+	SizeOfOptionalHeader uint16 `json:"size_of_optional_header"`
+	Characteristics      uint16 `json:"characteristics"`
+	Extra                Extra  `json:"-"`
+}
+
+// OptionalHeader represents the optional header of a PE32 or PE32+ file,
+// ImageBase and the sizes of the stack and the heap are 64 bits wide in
+// the latter.
+type OptionalHeader struct {
+	Magic                       uint16 `json:"magic"`
+	MajorLinkerVersion          uint8  `json:"major_linker_version"`
+	MinorLinkerVersion          uint8  `json:"minor_linker_version"`
+	SizeOfCode                  uint32 `json:"size_of_code"`
+	AddressOfEntryPoint         uint32 `json:"address_of_entrypoint"`
+	ImageBase                   uint64 `json:"image_base"`
+	SectionAlignment            uint32 `json:"section_alignment"`
+	FileAlignment               uint32 `json:"file_alignment"`
+	MajorOperatingSystemVersion uint16 `json:"major_os_version"`
+	MinorOperatingSystemVersion uint16 `json:"minor_os_version"`
+	SizeOfImage                 uint32 `json:"size_of_image"`
+	SizeOfHeaders               uint32 `json:"size_of_headers"`
+	CheckSum                    uint32 `json:"checksum"`
+	Subsystem                   uint16 `json:"subsystem"`
+	DllCharacteristics          uint16 `json:"dll_characteristics"`
+	SizeOfStackReserve          uint64 `json:"size_of_stack_reserve"`
+	SizeOfHeapReserve           uint64 `json:"size_of_heap_reserve"`
+	NumberOfRvaAndSizes         uint32 `json:"number_of_rva_and_sizes"`
+	Extra                       Extra  `json:"-"`
+}
+
+// Section represents a section header along with the entropy of the
+// section data.
+type Section struct {
+	Name             string   `json:"name"`
+	VirtualSize      uint32   `json:"virtual_size"`
+	VirtualAddress   uint32   `json:"virtual_address"`
+	SizeOfRawData    uint32   `json:"size_of_raw_data"`
+	PointerToRawData uint32   `json:"pointer_to_raw_data"`
+	Characteristics  uint32   `json:"characteristics"`
+	Entropy          *float64 `json:"entropy,omitempty"`
+	Extra            Extra    `json:"-"`
+}
+
+// Import represents the functions imported from a DLL.
+type Import struct {
+	// Name of the DLL, i.e: `KERNEL32.dll`.
+	Name      string           `json:"name"`
+	Functions []ImportFunction `json:"functions"`
+	Extra     Extra            `json:"-"`
+}
+
+// ImportFunction represents a function imported by name or by ordinal.
+type ImportFunction struct {
+	Name      string `json:"name,omitempty"`
+	Hint      uint16 `json:"hint"`
+	ByOrdinal bool   `json:"by_ordinal"`
+	Ordinal   uint32 `json:"ordinal"`
+	// ThunkRVA is the address of the entry of the import address table.
+	ThunkRVA           uint32 `json:"thunk_rva"`
+	ThunkValue         uint64 `json:"thunk_value"`
+	OriginalThunkRVA   uint32 `json:"original_thunk_rva"`
+	OriginalThunkValue uint64 `json:"original_thunk_value"`
+	Extra              Extra  `json:"-"`
+}
+
+// Export represents the export directory.
+type Export struct {
+	// Name of the module, i.e: `mydll.dll`.
+	Name          string           `json:"name"`
+	TimeDateStamp uint32           `json:"time_date_stamp,omitempty"`
+	Functions     []ExportFunction `json:"functions"`
+	Extra         Extra            `json:"-"`
+}
+
+// ExportFunction represents an exported function. Forwarded functions are
+// implemented by another DLL.
+type ExportFunction struct {
+	Ordinal      uint32 `json:"ordinal"`
+	FunctionRVA  uint32 `json:"function_rva"`
+	NameOrdinal  uint32 `json:"name_ordinal"`
+	NameRVA      uint32 `json:"name_rva"`
+	Name         string `json:"name,omitempty"`
+	Forwarder    string `json:"forwarder,omitempty"`
+	ForwarderRVA uint32 `json:"forwarder_rva,omitempty"`
+	Extra        Extra  `json:"-"`
+}
+
+// ResourceDirectory represents a level of the resources tree: types, then
+// names, then languages.
+type ResourceDirectory struct {
+	Entries []ResourceEntry `json:"entries"`
+	Extra   Extra           `json:"-"`
+}
+
+// ResourceEntry represents an entry of a resource directory, identified by
+// either a name or an ID. Entries of the last level hold data, the other
+// ones a directory.
+type ResourceEntry struct {
+	Name      string             `json:"name,omitempty"`
+	ID        uint32             `json:"id"`
+	Directory *ResourceDirectory `json:"directory,omitempty"`
+	Data      *ResourceData      `json:"data,omitempty"`
+	Extra     Extra              `json:"-"`
+}
+
+// ResourceData represents the location of a resource in the file.
+type ResourceData struct {
+	OffsetToData uint32 `json:"offset_to_data"`
+	Size         uint32 `json:"size"`
+	CodePage     uint32 `json:"code_page"`
+	Lang         uint32 `json:"lang"`
+	SubLang      uint32 `json:"sub_lang"`
+	Extra        Extra  `json:"-"`
+}
+
+// Signature represents the Authenticode signature of a file.
+type Signature struct {
+	Signed   bool `json:"signed"`
+	Verified bool `json:"verified"`
+	// Certificates lists the certificates of the signer chain, the signer
+	// first.
+	Certificates []Certificate `json:"certificates,omitempty"`
+	Extra        Extra         `json:"-"`
+}
+
+// Certificate represents a X.509 certificate of a signature.
+type Certificate struct {
+	Subject      string `json:"subject"`
+	Issuer       string `json:"issuer"`
+	SerialNumber string `json:"serial_number"`
+	// NotBefore and NotAfter are RFC 3339 times.
+	NotBefore          string `json:"not_before"`
+	NotAfter           string `json:"not_after"`
+	SignatureAlgorithm string `json:"signature_algorithm,omitempty"`
+	PubKeyAlgorithm    string `json:"pubkey_algorithm,omitempty"`
+	// Thumbprint is the SHA1 of the DER encoded certificate.
+	Thumbprint string `json:"thumbprint,omitempty"`
+	Extra      Extra  `json:"-"`
+}
+
+// UnmarshalJSON decodes the parser output without failing on the
+// attributes of older parsers.
+func (pe *PE) UnmarshalJSON(data []byte) error {
+	type plain PE
+	extra, err := decodeLenient(data, (*plain)(pe), pe.Extra)
+	pe.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes the parser output along with its extra attributes.
+func (pe PE) MarshalJSON() ([]byte, error) {
+	type plain PE
+	return encodeLenient(plain(pe), pe.Extra)
+}
+
+// UnmarshalJSON decodes the computed values leniently.
+func (m *PEMeta) UnmarshalJSON(data []byte) error {
+	type plain PEMeta
+	extra, err := decodeLenient(data, (*plain)(m), m.Extra)
+	m.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes the computed values along with the extra ones.
+func (m PEMeta) MarshalJSON() ([]byte, error) {
+	type plain PEMeta
+	return encodeLenient(plain(m), m.Extra)
+}
+
+// UnmarshalJSON decodes the DOS header leniently.
+func (h *DOSHeader) UnmarshalJSON(data []byte) error {
+	type plain DOSHeader
+	extra, err := decodeLenient(data, (*plain)(h), h.Extra)
+	h.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes all the fields of the DOS header.
+func (h DOSHeader) MarshalJSON() ([]byte, error) {
+	type plain DOSHeader
+	return encodeLenient(plain(h), h.Extra)
+}
+
+// UnmarshalJSON decodes the rich header leniently.
+func (h *RichHeader) UnmarshalJSON(data []byte) error {
+	type plain RichHeader
+	extra, err := decodeLenient(data, (*plain)(h), h.Extra)
+	h.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes the rich header along with its extra attributes.
+func (h RichHeader) MarshalJSON() ([]byte, error) {
+	type plain RichHeader
+	return encodeLenient(plain(h), h.Extra)
+}
+
+// UnmarshalJSON decodes a tool of the rich header leniently.
+func (id *CompID) UnmarshalJSON(data []byte) error {
+	type plain CompID
+	extra, err := decodeLenient(data, (*plain)(id), id.Extra)
+	id.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes a tool of the rich header along with its extra
+// attributes.
+func (id CompID) MarshalJSON() ([]byte, error) {
+	type plain CompID
+	return encodeLenient(plain(id), id.Extra)
+}
+
+// UnmarshalJSON decodes the NT headers leniently.
+func (h *NtHeader) UnmarshalJSON(data []byte) error {
+	type plain NtHeader
+	extra, err := decodeLenient(data, (*plain)(h), h.Extra)
+	h.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes the NT headers along with their extra attributes.
+func (h NtHeader) MarshalJSON() ([]byte, error) {
+	type plain NtHeader
+	return encodeLenient(plain(h), h.Extra)
+}
+
+// UnmarshalJSON decodes the file header leniently.
+func (h *FileHeader) UnmarshalJSON(data []byte) error {
+	type plain FileHeader
+	extra, err := decodeLenient(data, (*plain)(h), h.Extra)
+	h.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes the file header along with its extra attributes.
+func (h FileHeader) MarshalJSON() ([]byte, error) {
+	type plain FileHeader
+	return encodeLenient(plain(h), h.Extra)
+}
+
+// UnmarshalJSON decodes the optional header, including the data
+// directories and the other fields which are not modeled.
+func (h *OptionalHeader) UnmarshalJSON(data []byte) error {
+	type plain OptionalHeader
+	extra, err := decodeLenient(data, (*plain)(h), h.Extra)
+	h.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes the optional header along with its extra attributes.
+func (h OptionalHeader) MarshalJSON() ([]byte, error) {
+	type plain OptionalHeader
+	return encodeLenient(plain(h), h.Extra)
+}
+
+// UnmarshalJSON decodes a section header leniently.
+func (s *Section) UnmarshalJSON(data []byte) error {
+	type plain Section
+	extra, err := decodeLenient(data, (*plain)(s), s.Extra)
+	s.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes a section header along with its extra attributes.
+func (s Section) MarshalJSON() ([]byte, error) {
+	type plain Section
+	return encodeLenient(plain(s), s.Extra)
+}
+
+// UnmarshalJSON decodes the imports of a DLL leniently.
+func (i *Import) UnmarshalJSON(data []byte) error {
+	type plain Import
+	extra, err := decodeLenient(data, (*plain)(i), i.Extra)
+	i.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes the imports of a DLL along with the extra
+// attributes.
+func (i Import) MarshalJSON() ([]byte, error) {
+	type plain Import
+	return encodeLenient(plain(i), i.Extra)
+}
+
+// UnmarshalJSON decodes an imported function leniently.
+func (f *ImportFunction) UnmarshalJSON(data []byte) error {
+	type plain ImportFunction
+	extra, err := decodeLenient(data, (*plain)(f), f.Extra)
+	f.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes an imported function along with its extra
+// attributes.
+func (f ImportFunction) MarshalJSON() ([]byte, error) {
+	type plain ImportFunction
+	return encodeLenient(plain(f), f.Extra)
+}
+
+// UnmarshalJSON decodes the export directory leniently.
+func (e *Export) UnmarshalJSON(data []byte) error {
+	type plain Export
+	extra, err := decodeLenient(data, (*plain)(e), e.Extra)
+	e.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes the export directory along with its extra
+// attributes.
+func (e Export) MarshalJSON() ([]byte, error) {
+	type plain Export
+	return encodeLenient(plain(e), e.Extra)
+}
+
+// UnmarshalJSON decodes an exported function leniently.
+func (f *ExportFunction) UnmarshalJSON(data []byte) error {
+	type plain ExportFunction
+	extra, err := decodeLenient(data, (*plain)(f), f.Extra)
+	f.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes an exported function along with its extra
+// attributes.
+func (f ExportFunction) MarshalJSON() ([]byte, error) {
+	type plain ExportFunction
+	return encodeLenient(plain(f), f.Extra)
+}
+
+// UnmarshalJSON decodes a resource directory leniently.
+func (d *ResourceDirectory) UnmarshalJSON(data []byte) error {
+	type plain ResourceDirectory
+	extra, err := decodeLenient(data, (*plain)(d), d.Extra)
+	d.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes a resource directory along with its extra
+// attributes.
+func (d ResourceDirectory) MarshalJSON() ([]byte, error) {
+	type plain ResourceDirectory
+	return encodeLenient(plain(d), d.Extra)
+}
+
+// UnmarshalJSON decodes a resource directory entry leniently.
+func (e *ResourceEntry) UnmarshalJSON(data []byte) error {
+	type plain ResourceEntry
+	extra, err := decodeLenient(data, (*plain)(e), e.Extra)
+	e.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes a resource directory entry along with its extra
+// attributes.
+func (e ResourceEntry) MarshalJSON() ([]byte, error) {
+	type plain ResourceEntry
+	return encodeLenient(plain(e), e.Extra)
+}
+
+// UnmarshalJSON decodes the location of a resource leniently.
+func (d *ResourceData) UnmarshalJSON(data []byte) error {
+	type plain ResourceData
+	extra, err := decodeLenient(data, (*plain)(d), d.Extra)
+	d.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes the location of a resource along with its extra
+// attributes.
+func (d ResourceData) MarshalJSON() ([]byte, error) {
+	type plain ResourceData
+	return encodeLenient(plain(d), d.Extra)
+}
+
+// UnmarshalJSON decodes a signature leniently.
+func (s *Signature) UnmarshalJSON(data []byte) error {
+	type plain Signature
+	extra, err := decodeLenient(data, (*plain)(s), s.Extra)
+	s.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes a signature along with its extra attributes.
+func (s Signature) MarshalJSON() ([]byte, error) {
+	type plain Signature
+	return encodeLenient(plain(s), s.Extra)
+}
+
+// UnmarshalJSON decodes a certificate leniently.
+func (c *Certificate) UnmarshalJSON(data []byte) error {
+	type plain Certificate
+	extra, err := decodeLenient(data, (*plain)(c), c.Extra)
+	c.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes a certificate along with its extra attributes.
+func (c Certificate) MarshalJSON() ([]byte, error) {
+	type plain Certificate
+	return encodeLenient(plain(c), c.Extra)
+}
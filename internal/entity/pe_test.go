@@ -0,0 +1,164 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPE(t *testing.T) {
+	doc := `{
+		"meta": {"imphash": "f34d5f2d4577ed6d9ceec516c1f5a744", "is_dll": false},
+		"nt_header": {
+			"signature": 17744,
+			"file_header": {"machine": 332, "number_of_sections": 2},
+			"optional_header": {"magic": 267, "image_base": 4194304,
+				"data_directories": [{"size": 40}]}
+		},
+		"sections": [
+			{"name": ".text", "virtual_address": 4096, "entropy": 6.2},
+			{"name": ".rsrc", "virtual_address": "0x3000"}
+		],
+		"imports": [{"name": "KERNEL32.dll",
+			"functions": [{"name": "CreateFileW", "hint": 203}]}],
+		"signature": {"signed": true, "certificates": [
+			{"subject": "CN=Saferwall", "not_before": "2022-01-01T00:00:00Z"}]},
+		"load_config": {"security_cookie": 4210688},
+		"rich_header": "bogus"
+	}`
+
+	var pe PE
+	assert.Nil(t, json.Unmarshal([]byte(doc), &pe))
+	assert.Equal(t, "f34d5f2d4577ed6d9ceec516c1f5a744", pe.Meta.Imphash)
+	assert.Equal(t, uint16(332), pe.NtHeader.FileHeader.Machine)
+	assert.Equal(t, uint64(4194304), pe.NtHeader.OptionalHeader.ImageBase)
+	assert.Len(t, pe.Sections, 2)
+	assert.Equal(t, 6.2, *pe.Sections[0].Entropy)
+	assert.Equal(t, "CreateFileW", pe.Imports[0].Functions[0].Name)
+	assert.Equal(t, "CN=Saferwall", pe.Signature.Certificates[0].Subject)
+	assert.True(t, pe.Signature.Signed)
+
+	// Values which do not fit the model are kept as they are.
+	assert.Nil(t, pe.RichHeader)
+	assert.Zero(t, pe.Sections[1].VirtualAddress)
+	assert.Equal(t, json.RawMessage(`"0x3000"`),
+		pe.Sections[1].Extra["virtual_address"])
+	assert.Contains(t, pe.Extra, "load_config")
+
+	// Decoding and encoding back loses nothing.
+	data, err := json.Marshal(pe)
+	assert.Nil(t, err)
+	var want, got interface{}
+	assert.Nil(t, json.Unmarshal([]byte(doc), &want))
+	assert.Nil(t, json.Unmarshal(data, &got))
+	assert.Equal(t, want.(map[string]interface{})["load_config"],
+		got.(map[string]interface{})["load_config"])
+	assert.Equal(t, want.(map[string]interface{})["rich_header"],
+		got.(map[string]interface{})["rich_header"])
+	sections := got.(map[string]interface{})["sections"].([]interface{})
+	assert.Equal(t, "0x3000",
+		sections[1].(map[string]interface{})["virtual_address"])
+	header := got.(map[string]interface{})["nt_header"].(map[string]interface{})
+	assert.Equal(t, []interface{}{map[string]interface{}{"size": float64(40)}},
+		header["optional_header"].(map[string]interface{})["data_directories"])
+
+	// Sub-documents decoded one after the other add up.
+	var file File
+	assert.Nil(t, json.Unmarshal([]byte(`{"pe": {"meta": {"imphash": "x"}}}`),
+		&file))
+	assert.Nil(t, json.Unmarshal([]byte(`{"pe": {"sections": [{"name": ".text"}],
+		"rich_header": "bogus"}}`), &file))
+	assert.Equal(t, "x", file.PE.Meta.Imphash)
+	assert.Equal(t, ".text", file.PE.Sections[0].Name)
+	assert.Contains(t, file.PE.Extra, "rich_header")
+	assert.Nil(t, json.Unmarshal([]byte(`{"pe": {"rich_header": {"xor_key": 1}}}`),
+		&file))
+	assert.Equal(t, uint32(1), file.PE.RichHeader.XORKey)
+	assert.Empty(t, file.PE.Extra)
+}
+
+func TestPERoundTrip(t *testing.T) {
+	// Every level of the parser output holds an attribute the model does not
+	// know about.
+	doc := `{"sha256": "abc", "pe": {
+		"rich_header": {"xor_key": 1, "comp_ids": [
+			{"minor_cv": 30729, "prod_id": 260, "count": 5,
+				"unmasked_value": 17070089, "tool": "masm"}],
+			"dans_offset": 128, "checksum_valid": true},
+		"imports": [{"name": "KERNEL32.dll", "delay": false, "functions": [
+			{"name": "CreateFileW", "hint": 203, "by_ordinal": false,
+				"ordinal": 0, "thunk_rva": 8192, "thunk_value": 0,
+				"original_thunk_rva": 0, "original_thunk_value": 0,
+				"api_set": "api-ms-win-core-file"}]}],
+		"export": {"name": "a.dll", "flags": 0, "functions": [
+			{"ordinal": 1, "function_rva": 4096, "name_ordinal": 0,
+				"name_rva": 8192, "name": "Run", "mangled": false}]},
+		"resources": {"characteristics": 0, "entries": [
+			{"id": 3, "is_dir": true, "directory": {"entries": [
+				{"id": 1, "data": {"offset_to_data": 4096, "size": 744,
+					"code_page": 0, "lang": 9, "sub_lang": 1,
+					"reserved": 0}}]}}]}
+	}}`
+
+	var file File
+	assert.Nil(t, json.Unmarshal([]byte(doc), &file))
+	assert.Equal(t, uint16(260), file.PE.RichHeader.CompIDs[0].ProdID)
+	assert.Equal(t, "CreateFileW", file.PE.Imports[0].Functions[0].Name)
+	assert.Equal(t, "Run", file.PE.Export.Functions[0].Name)
+	assert.Equal(t, uint32(744),
+		file.PE.Resources.Entries[0].Directory.Entries[0].Data.Size)
+
+	// Decoding and encoding back loses nothing, at any level.
+	data, err := json.Marshal(file.PE)
+	assert.Nil(t, err)
+	var pe struct {
+		PE json.RawMessage `json:"pe"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(doc), &pe))
+	assert.JSONEq(t, string(pe.PE), string(data))
+}
+
+func TestRichHeaderHash(t *testing.T) {
+	compIDs := []CompID{
+		{ProdID: 0x104, MinorCV: 30729, Count: 5},
+		{ProdID: 0x93, MinorCV: 30729, Count: 12, Unmasked: 9664521},
+	}
+	want := "a6be9acdf2e22974889b7c72407260ad"
+
+	// From the bytes found in the file.
+	var h RichHeader
+	assert.Nil(t, json.Unmarshal([]byte(`{"xor_key": 305441741,
+		"raw": "icpaQc2rNBLNqzQSzas0EsTTMBPIqzQSxNOnEsGrNBI="}`), &h))
+	assert.Equal(t, want, h.Hash())
+
+	// Rebuilt out of the tools.
+	assert.Equal(t, want, RichHeader{CompIDs: compIDs}.Hash())
+	assert.Empty(t, RichHeader{}.Hash())
+}
+
+func TestStrings(t *testing.T) {
+	var s Strings
+	assert.Nil(t, json.Unmarshal([]byte(`{"ascii": ["kernel32"],
+		"wide": ["C:\\a.txt"], "asm": ["cmd"]}`), &s))
+	assert.Equal(t, Strings{ASCII: []string{"kernel32"},
+		Wide: []string{`C:\a.txt`}, Asm: []string{"cmd"}}, s)
+
+	// Lists of older scanners.
+	assert.Nil(t, json.Unmarshal([]byte(`[
+		{"encoding": "ascii", "value": "kernel32"},
+		{"encoding": "utf-16", "value": "C:\\a.txt"},
+		{"encoding": "asm", "value": "cmd"},
+		"http://example.com"]`), &s))
+	assert.Equal(t, Strings{ASCII: []string{"kernel32", "http://example.com"},
+		Wide: []string{`C:\a.txt`}, Asm: []string{"cmd"}}, s)
+
+	data, err := json.Marshal(s)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"ascii": ["kernel32", "http://example.com"],
+		"wide": ["C:\\a.txt"], "asm": ["cmd"]}`, string(data))
+}
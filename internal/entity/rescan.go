@@ -0,0 +1,27 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+// RescanPolicy represents the rules regular users must follow to rescan
+// files. Admins are not subject to it.
+type RescanPolicy struct {
+	// Type represents the document type.
+	Type string `json:"type,omitempty"`
+	// Enabled is false when only admins may rescan files.
+	Enabled bool `json:"enabled"`
+	// MaxPerHour is the number of rescans a user may request per hour,
+	// zero means unlimited.
+	MaxPerHour int `json:"max_per_hour"`
+	// HighPriority tells who may request high priority rescans, one of:
+	// "everyone", "admins".
+	HighPriority string `json:"high_priority"`
+	// PendingTimeout is the number of seconds after which a scan which did
+	// not finish no longer prevents the file from being rescanned.
+	PendingTimeout int64 `json:"pending_timeout"`
+	// Username of the admin who last updated the policy.
+	UpdatedBy string `json:"updated_by,omitempty"`
+	// Timestamp when the policy was last updated.
+	UpdatedAt int64 `json:"updated_at,omitempty"`
+}
@@ -0,0 +1,23 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+// SandboxLimits represents the dynamic analysis options an admin granted
+// to a user on top of the ones every user has.
+type SandboxLimits struct {
+	// Type represents the document type.
+	Type string `json:"type,omitempty"`
+	// Username of the user the limits apply to.
+	Username string `json:"username"`
+	// Maximum timeout in seconds the user may detonate samples with, zero
+	// means the default maximum.
+	MaxTimeout int `json:"max_timeout"`
+	// Restricted OS images the user may detonate samples in.
+	OSImages []string `json:"os_images"`
+	// Username of the admin who last updated the limits.
+	UpdatedBy string `json:"updated_by,omitempty"`
+	// Timestamp when the limits were last updated.
+	UpdatedAt int64 `json:"updated_at,omitempty"`
+}
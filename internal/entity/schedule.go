@@ -0,0 +1,42 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+// ScanSchedule represents a policy periodically rescanning the files
+// matching a rule.
+type ScanSchedule struct {
+	// Type represents the document type.
+	Type string `json:"type,omitempty"`
+	// ID represents the schedule identifier.
+	ID string `json:"id"`
+	// Name describes the schedule.
+	Name string `json:"name"`
+	// Rule selects the files to rescan, one of: "stale", "tag", "popular".
+	Rule string `json:"rule"`
+	// MaxAge is the number of seconds after which a scan is stale. Only
+	// files last scanned earlier are rescanned, whatever the rule.
+	MaxAge int64 `json:"max_age"`
+	// Tag analysts applied to the files, used by the "tag" rule.
+	Tag string `json:"tag,omitempty"`
+	// MinSubmissions is the number of times the files were submitted, used
+	// by the "popular" rule.
+	MinSubmissions int `json:"min_submissions,omitempty"`
+	// Interval is the number of seconds between two runs.
+	Interval int64 `json:"interval"`
+	// BatchSize is the maximum number of files rescanned per run.
+	BatchSize int `json:"batch_size"`
+	// Priority of the rescans, one of: "low", "normal", "high".
+	Priority string `json:"priority"`
+	// Enabled is false when the schedule is paused.
+	Enabled bool `json:"enabled"`
+	// Username of the admin who created the schedule.
+	CreatedBy string `json:"created_by"`
+	// Timestamp when the schedule was created.
+	CreatedAt int64 `json:"created_at"`
+	// Timestamp of the last run.
+	LastRun int64 `json:"last_run,omitempty"`
+	// Number of files rescanned during the last run.
+	LastEnqueued int `json:"last_enqueued,omitempty"`
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// String encodings.
+const (
+	EncodingASCII = "ascii"
+	EncodingWide  = "wide"
+	EncodingAsm   = "asm"
+)
+
+// Strings represents the strings extracted from a file, by encoding. Asm
+// strings are the ones built on the stack by the code.
+type Strings struct {
+	ASCII []string `json:"ascii,omitempty"`
+	Wide  []string `json:"wide,omitempty"`
+	Asm   []string `json:"asm,omitempty"`
+	Extra Extra    `json:"-"`
+}
+
+// UnmarshalJSON decodes the strings of a file. Older scanners report a
+// list of `{"encoding": "...", "value": "..."}` objects, or of bare ASCII
+// strings, which is decoded as well.
+func (s *Strings) UnmarshalJSON(data []byte) error {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		type plain Strings
+		extra, err := decodeLenient(data, (*plain)(s), s.Extra)
+		s.Extra = extra
+		return err
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+	*s = Strings{}
+	for _, item := range items {
+		var str struct {
+			Encoding string `json:"encoding"`
+			Value    string `json:"value"`
+		}
+		if err := json.Unmarshal(item, &str.Value); err != nil {
+			if err = json.Unmarshal(item, &str); err != nil {
+				return err
+			}
+		}
+		s.Add(str.Encoding, str.Value)
+	}
+	return nil
+}
+
+// MarshalJSON encodes the strings along with their extra attributes.
+func (s Strings) MarshalJSON() ([]byte, error) {
+	type plain Strings
+	return encodeLenient(plain(s), s.Extra)
+}
+
+// Add appends a string given its encoding, unknown encodings are considered
+// to be ASCII.
+func (s *Strings) Add(encoding, value string) {
+	encoding, _ = StringEncoding(encoding)
+	switch encoding {
+	case EncodingWide:
+		s.Wide = append(s.Wide, value)
+	case EncodingAsm:
+		s.Asm = append(s.Asm, value)
+	default:
+		s.ASCII = append(s.ASCII, value)
+	}
+}
+
+// StringEncoding returns the canonical name of a string encoding, UTF-16
+// strings are wide ones. It is false when the encoding is unknown.
+func StringEncoding(encoding string) (string, bool) {
+	switch encoding = strings.ToLower(strings.TrimSpace(encoding)); encoding {
+	case EncodingASCII, EncodingWide, EncodingAsm:
+		return encoding, true
+	case "utf-16", "utf16", "unicode":
+		return EncodingWide, true
+	}
+	return EncodingASCII, false
+}
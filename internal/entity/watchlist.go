@@ -0,0 +1,55 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+// Watchlist represents the files, tags and users a user keeps an eye on.
+type Watchlist struct {
+	// Type represents the document type.
+	Type string `json:"type"`
+	// Username represents the owner of the watchlist.
+	Username string `json:"username"`
+	// Files lists the SHA256 of the watched files.
+	Files []string `json:"files"`
+	// Tags lists the watched analyst tags.
+	Tags []string `json:"tags"`
+	// Users lists the watched usernames.
+	Users []string `json:"users"`
+	// Preferences controls how the user gets notified.
+	Preferences NotificationPreferences `json:"preferences"`
+	// LastDigest is the time the last email digest was sent.
+	LastDigest int64 `json:"last_digest,omitempty"`
+}
+
+// NotificationPreferences represents how a user wants to be notified.
+type NotificationPreferences struct {
+	// Frequency is one of: "immediate", "daily", "weekly", "off".
+	Frequency string `json:"frequency"`
+	// Events the user wants to be notified of, possible values:
+	// "detection", "comment", "behavior", "tag".
+	Events []string `json:"events"`
+}
+
+// Notification represents a notification about a watched item waiting to
+// be sent in the next email digest.
+type Notification struct {
+	// Type represents the document type.
+	Type string `json:"type"`
+	// ID represents the notification identifier.
+	ID string `json:"id"`
+	// Username represents the recipient of the notification.
+	Username string `json:"username"`
+	// Kind is one of: "detection", "comment", "behavior", "tag".
+	Kind string `json:"kind"`
+	// SHA256 references the file the notification is about.
+	SHA256 string `json:"sha256"`
+	// Actor represents the user who triggered the notification, if any.
+	Actor string `json:"actor,omitempty"`
+	// Tag is set when the notification comes from a watched tag.
+	Tag string `json:"tag,omitempty"`
+	// Message describes what happened.
+	Message string `json:"message"`
+	// Timestamp when this notification happened.
+	Timestamp int64 `json:"timestamp"`
+}
@@ -0,0 +1,80 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package entity
+
+// Webhook represents an endpoint registered by a user to be notified of
+// events.
+type Webhook struct {
+	// Type represents the document type.
+	Type string `json:"type,omitempty"`
+	// ID represents the webhook identifier.
+	ID string `json:"id,omitempty"`
+	// Username represents the owner of the webhook.
+	Username string `json:"username"`
+	// URL where the events are delivered.
+	URL string `json:"url"`
+	// Events the webhook is subscribed to, i.e: `file.scanned`.
+	Events []string `json:"events"`
+	// Secret used to sign the deliveries.
+	Secret string `json:"secret,omitempty"`
+	// Active is false when deliveries are paused.
+	Active bool `json:"active"`
+	// Timestamp when this webhook was created.
+	CreatedAt int64 `json:"created_at"`
+}
+
+// WebhookDelivery represents the delivery of an event to a webhook.
+type WebhookDelivery struct {
+	// Type represents the document type.
+	Type string `json:"type,omitempty"`
+	// ID represents the delivery identifier.
+	ID string `json:"id,omitempty"`
+	// WebhookID references the webhook the event is delivered to.
+	WebhookID string `json:"webhook_id"`
+	// Username represents the owner of the webhook.
+	Username string `json:"username"`
+	// Event type, i.e: `comment.created`.
+	Event string `json:"event"`
+	// Payload is the JSON body posted to the webhook URL.
+	Payload string `json:"payload"`
+	// Status is one of: "pending", "succeeded", "dead".
+	Status string `json:"status"`
+	// Attempts counts the delivery attempts made so far.
+	Attempts int `json:"attempts"`
+	// NextAttempt is the time of the next delivery attempt.
+	NextAttempt int64 `json:"next_attempt,omitempty"`
+	// ResponseCode is the HTTP status code of the last attempt.
+	ResponseCode int `json:"response_code,omitempty"`
+	// LastError describes why the last attempt failed.
+	LastError string `json:"last_error,omitempty"`
+	// Timestamp when this delivery was created.
+	CreatedAt int64 `json:"created_at"`
+	// Timestamp of the last attempt.
+	UpdatedAt int64 `json:"updated_at,omitempty"`
+}
+
+// WebhookEvent represents an event waiting to be fanned out to the webhooks
+// subscribed to it.
+type WebhookEvent struct {
+	// Type represents the document type.
+	Type string `json:"type,omitempty"`
+	// ID represents the event identifier.
+	ID string `json:"id,omitempty"`
+	// Event type, i.e: `file.scanned`.
+	Event string `json:"event"`
+	// SHA256 of the file the event is about.
+	SHA256 string `json:"sha256,omitempty"`
+	// Actor is the user who caused the event, if any.
+	Actor string `json:"actor,omitempty"`
+	// Tag applied to the file, only set for `file.tagged` events.
+	Tag string `json:"tag,omitempty"`
+	// Payload is the JSON body posted to the webhook URLs.
+	Payload string `json:"payload"`
+	// ClaimedUntil is the time until which a dispatcher fans out the event,
+	// other API instances skip it meanwhile.
+	ClaimedUntil int64 `json:"claimed_until"`
+	// Timestamp when this event was created.
+	CreatedAt int64 `json:"created_at"`
+}
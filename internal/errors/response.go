@@ -92,6 +92,30 @@ func BadRequest(msg string) ErrorResponse {
 	}
 }
 
+// Conflict creates a new error response representing a request that conflicts
+// with the current state of the resource (HTTP 409).
+func Conflict(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "Your request conflicts with the current state of the resource."
+	}
+	return ErrorResponse{
+		Status:  http.StatusConflict,
+		Message: msg,
+	}
+}
+
+// PreconditionFailed creates a new error response representing a failed
+// conditional request (HTTP 412).
+func PreconditionFailed(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The resource has been modified since you last retrieved it."
+	}
+	return ErrorResponse{
+		Status:  http.StatusPreconditionFailed,
+		Message: msg,
+	}
+}
+
 // TooLargeEntity creates a new error response representing a an entity larger
 // than limits defined by server (HTTP 413).
 func TooLargeEntity(msg string) ErrorResponse {
@@ -116,6 +140,18 @@ func UnsupportedMediaType(msg string) ErrorResponse {
 	}
 }
 
+// TooManyRequests creates a new error response representing a client which
+// exceeded its rate limit (HTTP 429).
+func TooManyRequests(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "You have sent too many requests, please try again later."
+	}
+	return ErrorResponse{
+		Status:  http.StatusTooManyRequests,
+		Message: msg,
+	}
+}
+
 // BuildErrorResponse builds an error response from an error.
 func BuildErrorResponse(err error, trans ut.Translator) ErrorResponse {
 	switch err := err.(type) {
@@ -141,6 +177,8 @@ func BuildErrorResponse(err error, trans ut.Translator) ErrorResponse {
 		return NotFound("")
 	} else if errors.Is(err, db.ErrSubDocNotFound) {
 		return BadRequest("field not found")
+	} else if errors.Is(err, db.ErrCASMismatch) {
+		return PreconditionFailed("")
 	}
 	return InternalServerError("")
 }
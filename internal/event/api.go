@@ -0,0 +1,125 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+// Interval at which a comment is sent to keep idle connections open.
+const heartbeatInterval = 15 * time.Second
+
+// Watcher returns the users and the files a user keeps an eye on.
+type Watcher interface {
+	Watched(ctx context.Context, username string) (users, files []string,
+		err error)
+}
+
+type resource struct {
+	broker  Broker
+	watcher Watcher
+	logger  log.Logger
+}
+
+func RegisterHandlers(g *echo.Group, broker Broker, watcher Watcher,
+	logger log.Logger, requireLogin, verifyHash echo.MiddlewareFunc) {
+
+	res := resource{broker, watcher, logger}
+
+	g.GET("/files/:sha256/events/", res.file, verifyHash)
+	g.GET("/events/", res.user, requireLogin)
+}
+
+// @Summary Stream of file events
+// @Description Server-Sent Events stream notifying scan status changes and
+// @Description new AV results of a file.
+// @Tags Event
+// @Produce text/event-stream
+// @Param sha256 path string true "File SHA256"
+// @Success 200 {object} Event
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Router /files/{sha256}/events/ [get]
+func (r resource) file(c echo.Context) error {
+	return r.stream(c, ForFile(c.Param("sha256")))
+}
+
+// @Summary Stream of the logged-in user events
+// @Description Server-Sent Events stream notifying the activities of the watched
+// @Description users and the events of the files in the watchlist.
+// @Tags Event
+// @Produce text/event-stream
+// @Success 200 {object} Event
+// @Failure 401 {object} errors.ErrorResponse
+// @Router /events/ [get]
+// @Security Bearer
+func (r resource) user(c echo.Context) error {
+	ctx := c.Request().Context()
+	user, _ := ctx.Value(entity.UserKey).(entity.User)
+	users, files, err := r.watcher.Watched(ctx, user.ID())
+	if err != nil {
+		return err
+	}
+	return r.stream(c, ForWatcher(users, files))
+}
+
+// stream writes the events matching the filter until the client goes away.
+func (r resource) stream(c echo.Context, filter Filter) error {
+	sub := r.broker.Subscribe(filter)
+	defer sub.Close()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	// Disable response buffering in nginx.
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	ctx := c.Request().Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat.C:
+			if _, err := io.WriteString(res, ": ping\n\n"); err != nil {
+				return nil
+			}
+		case ev, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+			if err := writeEvent(res, ev); err != nil {
+				r.logger.With(ctx).Info(err)
+				return nil
+			}
+		}
+		res.Flush()
+	}
+}
+
+// writeEvent writes an event in the Server-Sent Events wire format.
+func writeEvent(w io.Writer, ev Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n",
+		ev.ID, ev.Type, data)
+	return err
+}
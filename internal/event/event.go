@@ -0,0 +1,89 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+// Package event implements real-time notifications pushed to the clients
+// over Server-Sent Events.
+package event
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+)
+
+// Event types.
+const (
+	// FileStatus is emitted when a scan stage of a file changes.
+	FileStatus = "file.status"
+	// FileMultiAV is emitted when new AV results land for a file.
+	FileMultiAV = "file.multiav"
+	// Activity is emitted when a user creates a new activity, i.e. likes
+	// a file or follows someone.
+	Activity = "activity"
+)
+
+// Event represents a notification about a file or a user.
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	SHA256    string      `json:"sha256,omitempty"`
+	Username  string      `json:"username,omitempty"`
+	Timestamp int64       `json:"timestamp"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// New creates a new event.
+func New(kind, sha256, username string, data interface{}) Event {
+	return Event{
+		ID:        entity.ID(),
+		Type:      kind,
+		SHA256:    strings.ToLower(sha256),
+		Username:  strings.ToLower(username),
+		Timestamp: time.Now().Unix(),
+		Data:      data,
+	}
+}
+
+// Publisher represents the interface to publish events.
+type Publisher interface {
+	Publish(ctx context.Context, ev Event) error
+}
+
+// Filter selects the events a subscriber is interested in.
+type Filter func(ev Event) bool
+
+// Broker dispatches published events to the subscribers.
+type Broker interface {
+	Publisher
+	// Subscribe returns a subscription receiving the events matching the
+	// filter. The subscription must be closed once done with it.
+	Subscribe(filter Filter) *Subscription
+}
+
+// ForFile returns a filter matching the events of the file with the given
+// SHA256.
+func ForFile(sha256 string) Filter {
+	sha256 = strings.ToLower(sha256)
+	return func(ev Event) bool {
+		return ev.SHA256 == sha256 && strings.HasPrefix(ev.Type, "file.")
+	}
+}
+
+// ForWatcher returns a filter matching the events of the given users and
+// files.
+func ForWatcher(users, files []string) Filter {
+	watched := make(map[string]bool, len(users)+len(files))
+	for _, u := range users {
+		watched["u:"+strings.ToLower(u)] = true
+	}
+	for _, f := range files {
+		watched["f:"+strings.ToLower(f)] = true
+	}
+	return func(ev Event) bool {
+		return (ev.Username != "" && watched["u:"+ev.Username]) ||
+			(ev.SHA256 != "" && watched["f:"+ev.SHA256])
+	}
+}
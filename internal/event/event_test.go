@@ -0,0 +1,62 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBroker(t *testing.T) {
+	ctx := context.Background()
+	broker := NewMemoryBroker()
+
+	file := broker.Subscribe(ForFile("ABC"))
+	defer file.Close()
+	watcher := broker.Subscribe(ForWatcher([]string{"Bob"}, []string{"def"}))
+	defer watcher.Close()
+
+	assert.Nil(t, broker.Publish(ctx, New(FileStatus, "abc", "", nil)))
+	assert.Nil(t, broker.Publish(ctx, New(Activity, "", "bob", nil)))
+	assert.Nil(t, broker.Publish(ctx, New(FileMultiAV, "def", "", nil)))
+
+	ev := <-file.C
+	assert.Equal(t, FileStatus, ev.Type)
+	assert.Len(t, file.C, 0)
+
+	ev = <-watcher.C
+	assert.Equal(t, Activity, ev.Type)
+	ev = <-watcher.C
+	assert.Equal(t, FileMultiAV, ev.Type)
+
+	// Closed subscriptions no longer receive events.
+	file.Close()
+	assert.Nil(t, broker.Publish(ctx, New(FileStatus, "abc", "", nil)))
+	_, ok := <-file.C
+	assert.False(t, ok)
+}
+
+func TestMemoryBrokerSlowSubscriber(t *testing.T) {
+	broker := NewMemoryBroker()
+	sub := broker.Subscribe(nil)
+	defer sub.Close()
+
+	for i := 0; i < subscriptionBufferSize+1; i++ {
+		assert.Nil(t, broker.Publish(context.Background(), New(Activity, "", "bob", nil)))
+	}
+	assert.Len(t, sub.C, subscriptionBufferSize)
+}
+
+func TestWriteEvent(t *testing.T) {
+	var buf bytes.Buffer
+	ev := Event{ID: "1", Type: FileStatus, SHA256: "abc", Timestamp: 2}
+	assert.Nil(t, writeEvent(&buf, ev))
+	assert.Equal(t, "id: 1\nevent: file.status\n"+
+		`data: {"id":"1","type":"file.status","sha256":"abc","timestamp":2}`+
+		"\n\n", buf.String())
+}
@@ -0,0 +1,76 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"context"
+	"sync"
+)
+
+// Number of events buffered per subscriber before new events are dropped.
+const subscriptionBufferSize = 32
+
+// Subscription represents a stream of events delivered to a subscriber.
+type Subscription struct {
+	// C receives the events matching the subscription filter.
+	C <-chan Event
+
+	ch     chan Event
+	filter Filter
+	broker *MemoryBroker
+	once   sync.Once
+}
+
+// Close stops the delivery of events and releases the subscription.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.broker.mu.Lock()
+		delete(s.broker.subs, s)
+		s.broker.mu.Unlock()
+		close(s.ch)
+	})
+}
+
+// MemoryBroker is a broker which dispatches events to the subscribers of
+// the local process. It is used as is for tests and single instance
+// deployments, and fed by a Consumer otherwise.
+type MemoryBroker struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+// NewMemoryBroker creates a new in-memory broker.
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{subs: make(map[*Subscription]struct{})}
+}
+
+// Publish delivers an event to the matching subscribers. Slow subscribers
+// whose buffer is full miss the event rather than blocking the publisher.
+func (b *MemoryBroker) Publish(ctx context.Context, ev Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subs {
+		if sub.filter != nil && !sub.filter(ev) {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+		}
+	}
+	return nil
+}
+
+// Subscribe registers a new subscriber.
+func (b *MemoryBroker) Subscribe(filter Filter) *Subscription {
+	ch := make(chan Event, subscriptionBufferSize)
+	sub := &Subscription{C: ch, ch: ch, filter: filter, broker: b}
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
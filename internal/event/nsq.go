@@ -0,0 +1,81 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/nsqio/go-nsq"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+// Producer represents event stream message producer interface.
+type Producer interface {
+	Produce(string, []byte) error
+}
+
+// queuePublisher publishes events to a message queue topic so that every
+// API instance consuming the topic gets notified.
+type queuePublisher struct {
+	producer Producer
+	topic    string
+}
+
+// NewQueuePublisher creates a publisher writing events to the given topic.
+func NewQueuePublisher(producer Producer, topic string) Publisher {
+	return queuePublisher{producer, topic}
+}
+
+// Publish serializes the event and writes it to the topic.
+func (p queuePublisher) Publish(ctx context.Context, ev Event) error {
+	msg, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return p.producer.Produce(p.topic, msg)
+}
+
+// Consumer reads events from an NSQ topic and dispatches them to a local
+// broker. Events are produced by this API as well as the orchestrator
+// workers.
+type Consumer struct {
+	consumer *nsq.Consumer
+}
+
+// NewConsumer creates a new NSQ consumer connected to the given nsqd. Each
+// API instance reads from its own ephemeral channel, so every instance
+// gets a copy of every event.
+func NewConsumer(address, topic string, broker Broker,
+	logger log.Logger) (*Consumer, error) {
+
+	channel := "api-" + entity.ID()[:8] + "#ephemeral"
+	c, err := nsq.NewConsumer(topic, channel, nsq.NewConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	c.AddHandler(nsq.HandlerFunc(func(m *nsq.Message) error {
+		var ev Event
+		if err := json.Unmarshal(m.Body, &ev); err != nil {
+			// Malformed events are not retried.
+			logger.Errorf("failed to decode event: %v", err)
+			return nil
+		}
+		return broker.Publish(context.Background(), ev)
+	}))
+
+	if err = c.ConnectToNSQD(address); err != nil {
+		return nil, err
+	}
+	return &Consumer{c}, nil
+}
+
+// Stop gracefully stops the consumer.
+func (c *Consumer) Stop() {
+	c.consumer.Stop()
+	<-c.consumer.StopChan
+}
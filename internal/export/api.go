@@ -0,0 +1,55 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func RegisterHandlers(g *echo.Group, service Service, logger log.Logger,
+	verifyHash echo.MiddlewareFunc) {
+
+	res := resource{service, logger}
+
+	g.GET("/files/:sha256/export/", res.export, verifyHash)
+}
+
+// @Summary Export a file to threat intel platforms
+// @Description Converts the hashes, AV labels, dropped files, contacted
+// @Description hosts and ATT&CK techniques of a file and its last detonation
+// @Description to a STIX 2.1 bundle or a MISP event.
+// @Tags File
+// @Produce json
+// @Param sha256 path string true "File SHA256"
+// @Param format query string false "Export format" Enums(stix, misp) default(stix)
+// @Success 200 {object} StixBundle
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /files/{sha256}/export/ [get]
+func (r resource) export(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = FormatSTIX
+	}
+
+	ctx := c.Request().Context()
+	sha256 := c.Param("sha256")
+	doc, err := r.service.Export(ctx, sha256, format)
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+		`attachment; filename="`+sha256+"."+format+`.json"`)
+	return c.JSON(http.StatusOK, doc)
+}
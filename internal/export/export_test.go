@@ -0,0 +1,173 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testSHA256  = "131f95c51cc819465fa1797f6ccacf9d494aaaff46fa3eac73ae63ffbdfd8267"
+	testDropped = "5e3e4bca2fd9c4cb8d3c2bb8b7c1a8b6ab6e2b01f3fcd3c8e5cf1ad0c3e2a1f0"
+)
+
+func testReport() report {
+	return report{
+		File: entity.File{
+			MD5:         "7e3e4bca2fd9c4cb8d3c2bb8b7c1a8b6",
+			SHA1:        "3d3e4bca2fd9c4cb8d3c2bb8b7c1a8b6ab6e2b01",
+			SHA256:      testSHA256,
+			SHA512:      strings.Repeat("ab", 64),
+			SSDeep:      "3072:Zw1sXzqJx2:Zw1sXzqJx2",
+			Size:        73802,
+			FirstSeen:   1650000000,
+			LastScanned: 1650003600,
+			Submissions: []entity.Submission{{Filename: "invoice.exe"}},
+			MultiAV: map[string]interface{}{
+				"last_scan": map[string]interface{}{
+					"eset": map[string]interface{}{"infected": true,
+						"output": "Win32/Emotet.A"},
+					"avira": map[string]interface{}{"infected": true,
+						"output": "TR/Emotet.abc"},
+					"clamav": map[string]interface{}{"infected": false,
+						"output": ""},
+				},
+			},
+			Classification: &entity.AVClassification{Family: "emotet",
+				Category: "Trojan"},
+		},
+		BehaviorID: "6f1d6d6a-3c8a-4a54-9e3b-8ad1b5c5ef52",
+		Behavior: entity.Behavior{
+			Timestamp: 1650001800,
+			SystemEvents: []entity.SystemEvent{
+				{Type: "network", Path: "93.184.216.34:443"},
+				{Type: "network", Path: "93.184.216.34:8080"},
+				{Type: "network", Path: "[2606:2800:220:1::248]:443"},
+				{Type: "network", Path: "127.0.0.1:80"},
+				{Type: "dns", Path: "Evil.Example.com"},
+				{Type: "network", Path: "http://cdn.example.org/payload.bin"},
+				{Type: "file", Path: `C:\a.txt`},
+			},
+			Artifacts: []entity.Artifact{
+				{Kind: "memdump", Name: "mem.bin",
+					SHA256: strings.Repeat("1", 64)},
+				{Kind: "file", Name: "payload.dll", SHA256: testDropped,
+					Size: 4096},
+				{Kind: "file", Name: "copy.dll", SHA256: testDropped},
+			},
+			Capabilities: []entity.Capability{
+				{Description: "Process Injection",
+					Techniques: []string{"T1055", "T1055.001"}},
+				{Description: "Persists via Run key",
+					Techniques: []string{"T1547.001"}},
+				{Description: "Injects code (T1055)",
+					Techniques: []string{"T1055"}},
+			},
+		},
+	}
+}
+
+// validate checks a document against a JSON schema of the testdata folder.
+func validate(t *testing.T, schema string, doc interface{}) {
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat = true
+	s, err := compiler.Compile("testdata/" + schema)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	data, err := json.Marshal(doc)
+	assert.Nil(t, err)
+	var v interface{}
+	assert.Nil(t, json.Unmarshal(data, &v))
+	assert.Nil(t, s.Validate(v))
+}
+
+func TestReport(t *testing.T) {
+	r := testReport()
+	assert.Equal(t, "invoice.exe", r.name())
+	assert.Equal(t, []avLabel{{"avira", "TR/Emotet.abc"},
+		{"eset", "Win32/Emotet.A"}}, r.avLabels())
+	assert.Equal(t, []droppedFile{{testDropped, "payload.dll", 4096}},
+		r.droppedFiles())
+
+	ips, domains := r.network()
+	assert.Equal(t, []string{"2606:2800:220:1::248", "93.184.216.34"}, ips)
+	assert.Equal(t, []string{"cdn.example.org", "evil.example.com"}, domains)
+
+	assert.Equal(t, []technique{
+		{"T1055", "Process Injection"},
+		{"T1055.001", "Dynamic-link Library Injection"},
+		{"T1547.001", "Registry Run Keys / Startup Folder"},
+	}, r.techniques())
+
+	assert.Empty(t, report{}.techniques())
+	assert.Empty(t, report{}.droppedFiles())
+}
+
+func TestStixBundle(t *testing.T) {
+	bundle := stixBundle(testReport(), time.Now())
+	validate(t, "stix-2.1.schema.json", bundle)
+
+	kinds := map[string]int{}
+	for _, obj := range bundle.Objects {
+		data, _ := json.Marshal(obj)
+		var o struct{ Type string }
+		_ = json.Unmarshal(data, &o)
+		kinds[o.Type]++
+	}
+	assert.Equal(t, map[string]int{"identity": 1, "malware": 1, "file": 2,
+		"malware-analysis": 2, "ipv4-addr": 1, "ipv6-addr": 1,
+		"domain-name": 2, "attack-pattern": 3, "relationship": 8}, kinds)
+
+	// Exports are deterministic.
+	assert.Equal(t, bundle, stixBundle(testReport(), time.Now()))
+
+	malware := bundle.Objects[2].(stixMalware)
+	assert.Equal(t, "emotet", malware.Name)
+	assert.True(t, malware.IsFamily)
+
+	// A file which was never scanned nor detonated.
+	bare := stixBundle(report{File: entity.File{SHA256: testSHA256}},
+		time.Unix(1650000000, 0))
+	validate(t, "stix-2.1.schema.json", bare)
+	assert.Len(t, bare.Objects, 3)
+	assert.False(t, bare.Objects[2].(stixMalware).IsFamily)
+}
+
+func TestScoID(t *testing.T) {
+	// UUIDv5 of `{"value":"198.51.100.3"}` in the STIX namespace.
+	assert.Equal(t, "ipv4-addr--28bb3599-77cd-5a82-a950-b5bc3caf07c4",
+		newStixAddress("ipv4-addr", "198.51.100.3").ID)
+	assert.NotEqual(t, newStixFile(testSHA256, "a.exe", 0).ID,
+		newStixFile(testSHA256, "", 0).ID)
+}
+
+func TestMispEvent(t *testing.T) {
+	event := newMispEvent(testReport(), time.Now())
+	validate(t, "misp-event.schema.json", event)
+
+	assert.Equal(t, "2022-04-15", event.Event.Date)
+	assert.Equal(t, "1650003600", event.Event.Timestamp)
+	assert.Equal(t, mispThreatLevelHigh, event.Event.ThreatLevelID)
+	assert.Len(t, event.Event.Attribute, 4)
+	// The sample, two AV signatures and the dropped file.
+	assert.Len(t, event.Event.Object, 4)
+	assert.Len(t, event.Event.Object[0].ObjectReference, 3)
+	assert.Equal(t, `misp-galaxy:mitre-attack-pattern="Process Injection - T1055"`,
+		event.Event.Tag[0].Name)
+
+	bare := newMispEvent(report{File: entity.File{SHA256: testSHA256}},
+		time.Unix(1650000000, 0))
+	validate(t, "misp-event.schema.json", bare)
+	assert.Equal(t, mispThreatLevelUndefined, bare.Event.ThreatLevelID)
+}
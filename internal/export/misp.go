@@ -0,0 +1,220 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"strconv"
+	"time"
+)
+
+// MISP enumerations, written as strings like MISP does.
+const (
+	// Distribution to the organisation only, it is up to the importer to
+	// share the event further.
+	mispYourOrganisationOnly = "0"
+	// Threat level of events about files flagged by AV engines.
+	mispThreatLevelHigh = "1"
+	// Threat level of events about files nobody flagged.
+	mispThreatLevelUndefined = "4"
+	// The analysis of the file is completed.
+	mispAnalysisCompleted = "2"
+)
+
+// MispEvent represents a MISP event in the MISP core format.
+type MispEvent struct {
+	Event mispEvent `json:"Event"`
+}
+
+type mispEvent struct {
+	UUID          string          `json:"uuid"`
+	Info          string          `json:"info"`
+	Date          string          `json:"date"`
+	Timestamp     string          `json:"timestamp"`
+	Published     bool            `json:"published"`
+	Analysis      string          `json:"analysis"`
+	ThreatLevelID string          `json:"threat_level_id"`
+	Distribution  string          `json:"distribution"`
+	Orgc          mispOrg         `json:"Orgc"`
+	Attribute     []mispAttribute `json:"Attribute"`
+	Object        []mispObject    `json:"Object"`
+	Tag           []mispTag       `json:"Tag"`
+}
+
+type mispOrg struct {
+	Name string `json:"name"`
+}
+
+type mispAttribute struct {
+	UUID           string `json:"uuid"`
+	Type           string `json:"type"`
+	Category       string `json:"category"`
+	Value          string `json:"value"`
+	ToIDS          bool   `json:"to_ids"`
+	ObjectRelation string `json:"object_relation,omitempty"`
+	Comment        string `json:"comment,omitempty"`
+	Timestamp      string `json:"timestamp"`
+}
+
+type mispObject struct {
+	UUID            string                `json:"uuid"`
+	Name            string                `json:"name"`
+	MetaCategory    string                `json:"meta-category"`
+	Comment         string                `json:"comment,omitempty"`
+	Timestamp       string                `json:"timestamp"`
+	Attribute       []mispAttribute       `json:"Attribute"`
+	ObjectReference []mispObjectReference `json:"ObjectReference,omitempty"`
+}
+
+type mispObjectReference struct {
+	UUID             string `json:"uuid"`
+	ReferencedUUID   string `json:"referenced_uuid"`
+	RelationshipType string `json:"relationship_type"`
+}
+
+type mispTag struct {
+	Name string `json:"name"`
+}
+
+// newMispEvent converts a report to a MISP event. The sample and the files it
+// dropped are file objects, AV detections are av-signature objects, the
+// contacted hosts are attributes and the ATT&CK techniques are galaxy tags.
+func newMispEvent(r report, now time.Time) MispEvent {
+	_, modified := timestamps(r, now)
+	timestamp := strconv.FormatInt(modified, 10)
+	f := r.File
+
+	attribute := func(name, kind, category, value string, toIDS bool) (
+		mispAttribute, bool) {
+		return mispAttribute{
+			UUID:      objectUUID("misp-attribute:" + f.SHA256 + name + value),
+			Type:      kind,
+			Category:  category,
+			Value:     value,
+			ToIDS:     toIDS,
+			Timestamp: timestamp,
+		}, value != ""
+	}
+	fileObject := func(sha256, name string, size int64, category,
+		comment string) mispObject {
+		obj := mispObject{
+			UUID:         objectUUID("misp-object:file:" + sha256),
+			Name:         "file",
+			MetaCategory: "file",
+			Comment:      comment,
+			Timestamp:    timestamp,
+		}
+		hashes := []struct{ relation, value string }{
+			{"sha256", sha256},
+		}
+		if sha256 == f.SHA256 {
+			hashes = []struct{ relation, value string }{
+				{"md5", f.MD5}, {"sha1", f.SHA1}, {"sha256", f.SHA256},
+				{"sha512", f.SHA512}, {"ssdeep", f.SSDeep},
+			}
+		}
+		for _, h := range hashes {
+			if attr, ok := attribute(sha256+h.relation, h.relation, category,
+				h.value, true); ok {
+				attr.ObjectRelation = h.relation
+				obj.Attribute = append(obj.Attribute, attr)
+			}
+		}
+		if attr, ok := attribute(sha256+"filename", "filename", category,
+			name, false); ok {
+			attr.ObjectRelation = "filename"
+			obj.Attribute = append(obj.Attribute, attr)
+		}
+		if size > 0 {
+			attr, _ := attribute(sha256+"size-in-bytes", "size-in-bytes",
+				"Other", strconv.FormatInt(size, 10), false)
+			attr.ObjectRelation = "size-in-bytes"
+			obj.Attribute = append(obj.Attribute, attr)
+		}
+		return obj
+	}
+
+	sample := fileObject(f.SHA256, r.name(), f.Size, "Payload delivery", "")
+	event := mispEvent{
+		UUID:          objectUUID("misp-event:" + f.SHA256),
+		Info:          "Saferwall analysis of " + f.SHA256,
+		Date:          time.Unix(modified, 0).UTC().Format("2006-01-02"),
+		Timestamp:     timestamp,
+		Analysis:      mispAnalysisCompleted,
+		ThreatLevelID: mispThreatLevelUndefined,
+		Distribution:  mispYourOrganisationOnly,
+		Orgc:          mispOrg{Name: "Saferwall"},
+		Attribute:     []mispAttribute{},
+		Tag:           []mispTag{},
+	}
+	if c := f.Classification; c != nil && c.Family != "" {
+		event.Info = "Saferwall analysis of " + c.Family + " " + f.SHA256
+	}
+
+	labels := r.avLabels()
+	if len(labels) > 0 {
+		event.ThreatLevelID = mispThreatLevelHigh
+	}
+	var signatures []mispObject
+	for _, label := range labels {
+		obj := mispObject{
+			UUID: objectUUID("misp-object:av-signature:" + f.SHA256 +
+				label.Engine),
+			Name:         "av-signature",
+			MetaCategory: "misc",
+			Timestamp:    timestamp,
+		}
+		software, _ := attribute(label.Engine+"software", "text",
+			"Antivirus detection", label.Engine, false)
+		software.ObjectRelation = "software"
+		signature, _ := attribute(label.Engine+"signature", "text",
+			"Antivirus detection", label.Output, false)
+		signature.ObjectRelation = "signature"
+		obj.Attribute = []mispAttribute{software, signature}
+		signatures = append(signatures, obj)
+		sample.ObjectReference = append(sample.ObjectReference,
+			mispReference(sample.UUID, obj.UUID, "analysed-with"))
+	}
+
+	var dropped []mispObject
+	for _, d := range r.droppedFiles() {
+		obj := fileObject(d.SHA256, d.Name, d.Size, "Artifacts dropped",
+			"Dropped during the detonation")
+		dropped = append(dropped, obj)
+		sample.ObjectReference = append(sample.ObjectReference,
+			mispReference(sample.UUID, obj.UUID, "drops"))
+	}
+	event.Object = append([]mispObject{sample}, signatures...)
+	event.Object = append(event.Object, dropped...)
+
+	ips, domains := r.network()
+	for _, ip := range ips {
+		attr, _ := attribute("ip-dst", "ip-dst", "Network activity", ip, true)
+		event.Attribute = append(event.Attribute, attr)
+	}
+	for _, domain := range domains {
+		attr, _ := attribute("domain", "domain", "Network activity", domain,
+			true)
+		event.Attribute = append(event.Attribute, attr)
+	}
+
+	for _, t := range r.techniques() {
+		cluster := t.ID
+		if t.Name != t.ID {
+			cluster = t.Name + " - " + t.ID
+		}
+		event.Tag = append(event.Tag, mispTag{
+			Name: `misp-galaxy:mitre-attack-pattern="` + cluster + `"`,
+		})
+	}
+	return MispEvent{Event: event}
+}
+
+func mispReference(source, target, relationship string) mispObjectReference {
+	return mispObjectReference{
+		UUID:             objectUUID("misp-reference:" + source + target),
+		ReferencedUUID:   target,
+		RelationshipType: relationship,
+	}
+}
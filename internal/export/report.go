@@ -0,0 +1,154 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/saferwall/saferwall-api/internal/attack"
+	"github.com/saferwall/saferwall-api/internal/behavior"
+	"github.com/saferwall/saferwall-api/internal/entity"
+)
+
+// namespace of the identifiers of the exported objects, so that exporting
+// a file twice produces the same objects.
+var namespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("https://saferwall.com"))
+
+// report gathers what is exported about a file.
+type report struct {
+	File entity.File
+	// BehaviorID is the ID of the behavior scan the behavior comes from, it
+	// is empty when the file was not detonated.
+	BehaviorID string
+	Behavior   entity.Behavior
+}
+
+// avLabel represents the detection of an AV engine.
+type avLabel struct {
+	Engine string
+	Output string
+}
+
+// droppedFile represents a file written by the sample during a detonation.
+type droppedFile struct {
+	SHA256 string
+	Name   string
+	Size   int64
+}
+
+// technique represents a MITRE ATT&CK technique.
+type technique struct {
+	ID   string
+	Name string
+}
+
+// objectUUID returns the identifier of an exported object given a name
+// unique to it.
+func objectUUID(name string) string {
+	return uuid.NewSHA1(namespace, []byte(name)).String()
+}
+
+// name returns the name the file was first submitted as.
+func (r report) name() string {
+	for _, s := range r.File.Submissions {
+		if s.Filename != "" {
+			return s.Filename
+		}
+	}
+	return ""
+}
+
+// avLabels returns the detections of the last multiav scan sorted by engine.
+func (r report) avLabels() []avLabel {
+	lastScan, _ := r.File.MultiAV["last_scan"].(map[string]interface{})
+	labels := []avLabel{}
+	for engine, res := range lastScan {
+		result, ok := res.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		infected, _ := result["infected"].(bool)
+		output, _ := result["output"].(string)
+		if infected && output != "" {
+			labels = append(labels, avLabel{Engine: engine, Output: output})
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Engine < labels[j].Engine
+	})
+	return labels
+}
+
+// droppedFiles returns the files written during the detonation, memory
+// dumps excluded.
+func (r report) droppedFiles() []droppedFile {
+	seen := make(map[string]bool, len(r.Behavior.Artifacts))
+	files := []droppedFile{}
+	for _, artifact := range r.Behavior.Artifacts {
+		sha256 := strings.ToLower(artifact.SHA256)
+		if !behavior.IsDropped(artifact.Kind, sha256) || seen[sha256] {
+			continue
+		}
+		seen[sha256] = true
+		files = append(files, droppedFile{SHA256: sha256, Name: artifact.Name,
+			Size: artifact.Size})
+	}
+	return files
+}
+
+// network returns the IP addresses and domains contacted during the
+// detonation, sorted and without duplicates.
+func (r report) network() (ips []string, domains []string) {
+	seen := make(map[string]bool)
+	ips, domains = []string{}, []string{}
+	for _, event := range r.Behavior.SystemEvents {
+		if !behavior.IsNetworkEvent(event.Type) {
+			continue
+		}
+		kind, value := behavior.NetworkIOC(event.Path)
+		if kind == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		if kind == behavior.IOCIP {
+			ips = append(ips, value)
+		} else {
+			domains = append(domains, value)
+		}
+	}
+	sort.Strings(ips)
+	sort.Strings(domains)
+	return ips, domains
+}
+
+// techniques returns the ATT&CK techniques referenced by the capabilities
+// of the detonation, sorted by ID. Techniques missing from the catalog are
+// named after the first capability referencing them.
+func (r report) techniques() []technique {
+	names := make(map[string]string)
+	for _, c := range r.Behavior.Capabilities {
+		for _, id := range c.Techniques {
+			if name, ok := names[id]; ok && name != id {
+				continue
+			}
+			t, known := attack.Lookup(id)
+			names[id] = t.Name
+			if !known && c.Description != "" {
+				names[id] = c.Description
+			}
+		}
+	}
+
+	techniques := make([]technique, 0, len(names))
+	for id, name := range names {
+		techniques = append(techniques, technique{ID: id, Name: name})
+	}
+	sort.Slice(techniques, func(i, j int) bool {
+		return techniques[i].ID < techniques[j].ID
+	})
+	return techniques
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/saferwall/saferwall-api/internal/behavior"
+	e "github.com/saferwall/saferwall-api/internal/errors"
+	"github.com/saferwall/saferwall-api/internal/file"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+// Export formats.
+const (
+	// FormatSTIX is a STIX 2.1 bundle.
+	FormatSTIX = "stix"
+	// FormatMISP is a MISP event.
+	FormatMISP = "misp"
+)
+
+var errInvalidFormat = e.BadRequest("format must be one of: stix, misp")
+
+// Service encapsulates usecase logic for exporting files to threat intel
+// platforms.
+type Service interface {
+	// Export converts what is known about a file, its last detonation
+	// included, to the given format.
+	Export(ctx context.Context, sha256, format string) (interface{}, error)
+}
+
+type service struct {
+	fileSvc     file.Service
+	behaviorSvc behavior.Service
+	logger      log.Logger
+}
+
+// NewService creates a new export service.
+func NewService(fileSvc file.Service, behaviorSvc behavior.Service,
+	logger log.Logger) Service {
+	return service{fileSvc, behaviorSvc, logger}
+}
+
+// Export returns a STIX bundle or a MISP event describing a file.
+func (s service) Export(ctx context.Context, sha256, format string) (
+	interface{}, error) {
+
+	format = strings.ToLower(format)
+	if format != FormatSTIX && format != FormatMISP {
+		return nil, errInvalidFormat
+	}
+
+	r, err := s.report(ctx, strings.ToLower(sha256))
+	if err != nil {
+		return nil, err
+	}
+	if format == FormatMISP {
+		return newMispEvent(r, time.Now()), nil
+	}
+	return stixBundle(r, time.Now()), nil
+}
+
+// report gathers the file and its last behavior scan.
+func (s service) report(ctx context.Context, sha256 string) (report, error) {
+	f, err := s.fileSvc.Get(ctx, sha256, nil)
+	if err != nil {
+		return report{}, err
+	}
+	r := report{File: f.File}
+
+	scans, err := s.behaviorSvc.FileScans(ctx, sha256, 0, 1)
+	if err != nil {
+		return report{}, err
+	}
+	if len(scans) > 0 {
+		r.BehaviorID = scans[0].ID
+		r.Behavior, err = s.behaviorSvc.Trace(ctx, r.BehaviorID)
+		if err != nil {
+			return report{}, err
+		}
+	}
+	return r, nil
+}
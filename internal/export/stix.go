@@ -0,0 +1,299 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	stixSpecVersion = "2.1"
+	// stixTimeFormat is the RFC 3339 format with millisecond precision the
+	// STIX timestamps are written in.
+	stixTimeFormat = "2006-01-02T15:04:05.000Z"
+)
+
+var (
+	// stixSCONamespace is the namespace of the deterministic identifiers
+	// of the STIX cyber-observable objects, as defined by the spec.
+	stixSCONamespace = uuid.MustParse("00abedb4-aa42-466c-9c01-fed23315a9b7")
+)
+
+// StixBundle represents a STIX 2.1 bundle.
+type StixBundle struct {
+	Type    string        `json:"type"`
+	ID      string        `json:"id"`
+	Objects []interface{} `json:"objects"`
+}
+
+// stixCommon holds the properties shared by the STIX domain and
+// relationship objects.
+type stixCommon struct {
+	Type         string `json:"type"`
+	SpecVersion  string `json:"spec_version"`
+	ID           string `json:"id"`
+	CreatedByRef string `json:"created_by_ref,omitempty"`
+	Created      string `json:"created"`
+	Modified     string `json:"modified"`
+}
+
+type stixIdentity struct {
+	stixCommon
+	Name          string `json:"name"`
+	IdentityClass string `json:"identity_class"`
+}
+
+type stixMalware struct {
+	stixCommon
+	Name         string   `json:"name"`
+	IsFamily     bool     `json:"is_family"`
+	MalwareTypes []string `json:"malware_types,omitempty"`
+	SampleRefs   []string `json:"sample_refs"`
+}
+
+type stixMalwareAnalysis struct {
+	stixCommon
+	Product    string `json:"product"`
+	Result     string `json:"result"`
+	ResultName string `json:"result_name"`
+	SampleRef  string `json:"sample_ref"`
+}
+
+type stixExternalReference struct {
+	SourceName string `json:"source_name"`
+	ExternalID string `json:"external_id"`
+	URL        string `json:"url"`
+}
+
+type stixAttackPattern struct {
+	stixCommon
+	Name               string                  `json:"name"`
+	ExternalReferences []stixExternalReference `json:"external_references"`
+}
+
+type stixRelationship struct {
+	stixCommon
+	RelationshipType string `json:"relationship_type"`
+	SourceRef        string `json:"source_ref"`
+	TargetRef        string `json:"target_ref"`
+}
+
+type stixFile struct {
+	Type        string            `json:"type"`
+	SpecVersion string            `json:"spec_version"`
+	ID          string            `json:"id"`
+	Hashes      map[string]string `json:"hashes"`
+	Size        int64             `json:"size,omitempty"`
+	Name        string            `json:"name,omitempty"`
+}
+
+// stixAddress represents an IPv4, IPv6 address or a domain name.
+type stixAddress struct {
+	Type        string `json:"type"`
+	SpecVersion string `json:"spec_version"`
+	ID          string `json:"id"`
+	Value       string `json:"value"`
+}
+
+// stixBundle converts a report to a STIX bundle. The sample is represented
+// by a malware object whose relationships point to the files it dropped,
+// the hosts it contacted and the ATT&CK techniques it used.
+func stixBundle(r report, now time.Time) StixBundle {
+	firstSeen, lastScanned := timestamps(r, now)
+	created, modified := stixTime(firstSeen), stixTime(lastScanned)
+	identity := stixIdentity{
+		stixCommon: stixCommon{
+			Type:        "identity",
+			SpecVersion: stixSpecVersion,
+			ID:          sdoID("identity", "saferwall"),
+			Created:     stixTime(0),
+			Modified:    stixTime(0),
+		},
+		Name:          "Saferwall",
+		IdentityClass: "organization",
+	}
+	common := func(kind, name string) stixCommon {
+		return stixCommon{
+			Type:         kind,
+			SpecVersion:  stixSpecVersion,
+			ID:           sdoID(kind, name),
+			CreatedByRef: identity.ID,
+			Created:      created,
+			Modified:     modified,
+		}
+	}
+
+	f := r.File
+	hashes := map[string]string{
+		"MD5":     f.MD5,
+		"SHA-1":   f.SHA1,
+		"SHA-256": f.SHA256,
+		"SHA-512": f.SHA512,
+		"SSDEEP":  f.SSDeep,
+	}
+	for algo, hash := range hashes {
+		if hash == "" {
+			delete(hashes, algo)
+		}
+	}
+	sample := newStixFile(f.SHA256, r.name(), f.Size)
+	sample.Hashes = hashes
+
+	malware := stixMalware{
+		stixCommon: common("malware", f.SHA256),
+		Name:       f.SHA256,
+		SampleRefs: []string{sample.ID},
+	}
+	// The malware is a family once the engines agree on its name, and a
+	// single sample otherwise.
+	if c := f.Classification; c != nil && c.Family != "" {
+		malware.Name = c.Family
+		malware.IsFamily = true
+	}
+	if c := f.Classification; c != nil && c.Category != "" {
+		malware.MalwareTypes = []string{strings.ToLower(c.Category)}
+	}
+
+	objects := []interface{}{identity, sample, malware}
+	relate := func(kind, target string) {
+		objects = append(objects, stixRelationship{
+			stixCommon:       common("relationship", malware.ID+kind+target),
+			RelationshipType: kind,
+			SourceRef:        malware.ID,
+			TargetRef:        target,
+		})
+	}
+
+	for _, label := range r.avLabels() {
+		objects = append(objects, stixMalwareAnalysis{
+			stixCommon: common("malware-analysis",
+				f.SHA256+":"+label.Engine),
+			Product:    label.Engine,
+			Result:     "malicious",
+			ResultName: label.Output,
+			SampleRef:  sample.ID,
+		})
+	}
+
+	for _, dropped := range r.droppedFiles() {
+		file := newStixFile(dropped.SHA256, dropped.Name, dropped.Size)
+		objects = append(objects, file)
+		relate("drops", file.ID)
+	}
+
+	ips, domains := r.network()
+	for _, ip := range ips {
+		kind := "ipv4-addr"
+		if net.ParseIP(ip).To4() == nil {
+			kind = "ipv6-addr"
+		}
+		addr := newStixAddress(kind, ip)
+		objects = append(objects, addr)
+		relate("communicates-with", addr.ID)
+	}
+	for _, domain := range domains {
+		addr := newStixAddress("domain-name", domain)
+		objects = append(objects, addr)
+		relate("communicates-with", addr.ID)
+	}
+
+	for _, t := range r.techniques() {
+		pattern := stixAttackPattern{
+			stixCommon: common("attack-pattern", t.ID),
+			Name:       t.Name,
+			ExternalReferences: []stixExternalReference{{
+				SourceName: "mitre-attack",
+				ExternalID: t.ID,
+				URL:        attackURL(t.ID),
+			}},
+		}
+		objects = append(objects, pattern)
+		relate("uses", pattern.ID)
+	}
+
+	return StixBundle{
+		Type:    "bundle",
+		ID:      sdoID("bundle", f.SHA256+modified),
+		Objects: objects,
+	}
+}
+
+func newStixFile(sha256, name string, size int64) stixFile {
+	// The SHA-256 hash and the name are the ID contributing properties.
+	contributing := map[string]interface{}{
+		"hashes": map[string]string{"SHA-256": sha256},
+	}
+	if name != "" {
+		contributing["name"] = name
+	}
+	return stixFile{
+		Type:        "file",
+		SpecVersion: stixSpecVersion,
+		ID:          scoID("file", contributing),
+		Hashes:      map[string]string{"SHA-256": sha256},
+		Size:        size,
+		Name:        name,
+	}
+}
+
+func newStixAddress(kind, value string) stixAddress {
+	return stixAddress{
+		Type:        kind,
+		SpecVersion: stixSpecVersion,
+		ID:          scoID(kind, map[string]interface{}{"value": value}),
+		Value:       value,
+	}
+}
+
+// scoID returns the deterministic identifier of a cyber-observable object
+// given its ID contributing properties.
+func scoID(kind string, contributing map[string]interface{}) string {
+	// Maps are marshaled with sorted keys, which along with the disabled
+	// HTML escaping gives the canonical JSON representation.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(contributing)
+	name := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	return kind + "--" + uuid.NewSHA1(stixSCONamespace, name).String()
+}
+
+// sdoID returns the identifier of a domain object of saferwall.
+func sdoID(kind, name string) string {
+	return kind + "--" + objectUUID(kind+":"+name)
+}
+
+// timestamps returns the creation and modification times of the exported
+// objects: when the file was first seen and last scanned.
+func timestamps(r report, now time.Time) (int64, int64) {
+	created := r.File.FirstSeen
+	if created == 0 {
+		created = now.Unix()
+	}
+	modified := created
+	if r.File.LastScanned > modified {
+		modified = r.File.LastScanned
+	}
+	if r.Behavior.Timestamp > modified {
+		modified = r.Behavior.Timestamp
+	}
+	return created, modified
+}
+
+func stixTime(ts int64) string {
+	return time.Unix(ts, 0).UTC().Format(stixTimeFormat)
+}
+
+// attackURL returns the URL of an ATT&CK technique like T1055 or T1055.001.
+func attackURL(id string) string {
+	return "https://attack.mitre.org/techniques/" +
+		strings.ReplaceAll(id, ".", "/") + "/"
+}
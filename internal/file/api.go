@@ -5,7 +5,10 @@
 package file
 
 import (
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/labstack/echo/v4"
@@ -18,6 +21,9 @@ import (
 const (
 	KB = 1000
 	MB = 1000 * KB
+
+	// Maximum size of a patch document.
+	maxPatchSize = 1 * MB
 )
 
 type resource struct {
@@ -39,11 +45,16 @@ func RegisterHandlers(g *echo.Group, service Service, logger log.Logger,
 	g.PATCH("/files/:sha256/", res.patch, verifyHash, requireLogin)
 	g.DELETE("/files/:sha256/", res.delete, verifyHash, requireLogin)
 	g.GET("/files/:sha256/strings/", res.strings, verifyHash)
+	g.GET("/strings/files/", res.stringFiles)
 	g.GET("/files/:sha256/summary/", res.summary, verifyHash, optionalLogin)
 	g.GET("/files/:sha256/comments/", res.comments, verifyHash, optionalLogin)
 	g.POST("/files/:sha256/like/", res.like, verifyHash, requireLogin)
 	g.POST("/files/:sha256/unlike/", res.unlike, verifyHash, requireLogin)
 	g.POST("/files/:sha256/rescan/", res.rescan, verifyHash, requireLogin)
+	g.GET("/files/:sha256/status/", res.status, verifyHash)
+	g.PUT("/files/:sha256/status/", res.updateStatus, verifyHash, requireLogin)
+	g.PUT("/files/:sha256/verdict/", res.setVerdict, verifyHash, requireLogin)
+	g.DELETE("/files/:sha256/verdict/", res.deleteVerdict, verifyHash, requireLogin)
 	g.GET("/files/:sha256/download/", res.download, verifyHash, requireLogin)
 	g.GET("/files/:sha256/generate-presigned-url/", res.generatePresignedURL, verifyHash, requireLogin)
 }
@@ -78,6 +89,7 @@ func (r resource) exists(c echo.Context) error {
 // @Produce json
 // @Param sha256 path string true "File SHA256"
 // @Success 200 {object} entity.File
+// @Header 200 {string} ETag "File version, to be used with If-Match"
 // @Failure 400 {object} errors.ErrorResponse
 // @Failure 404 {object} errors.ErrorResponse
 // @Failure 500 {object} errors.ErrorResponse
@@ -96,6 +108,9 @@ func (r resource) get(c echo.Context) error {
 	if err != nil {
 		return err
 	}
+	if file.CAS != 0 {
+		c.Response().Header().Set("ETag", formatETag(file.CAS))
+	}
 	return c.JSON(http.StatusOK, file)
 }
 
@@ -191,14 +206,23 @@ func (r resource) update(c echo.Context) error {
 }
 
 // @Summary Update a file report (partial update)
-// @Description Patch a portion of a file report.
+// @Description Patch a portion of a file report using either a JSON Patch
+// @Description (RFC 6902) or a JSON Merge Patch (RFC 7396) document. Send the
+// @Description ETag of the file in the If-Match header to make sure the file
+// @Description was not modified in the meantime.
 // @Tags File
-// @Accept json
+// @Accept application/json-patch+json,application/merge-patch+json
 // @Produce json
 // @Param sha256 path string true "File SHA256"
+// @Param If-Match header string false "ETag of the file"
 // @Success 200 {object} entity.File
+// @Header 200 {string} ETag "New file version"
+// @Failure 400 {object} errors.ErrorResponse
 // @Failure 403 {object} errors.ErrorResponse
 // @Failure 404 {object} errors.ErrorResponse
+// @Failure 409 {object} errors.ErrorResponse
+// @Failure 412 {object} errors.ErrorResponse
+// @Failure 415 {object} errors.ErrorResponse
 // @Failure 500 {object} errors.ErrorResponse
 // @Router /files/{sha256} [patch]
 // @Security Bearer
@@ -211,7 +235,44 @@ func (r resource) patch(c echo.Context) error {
 	if !isAdmin {
 		return errors.Forbidden("")
 	}
-	return nil
+
+	contentType, _, err := mime.ParseMediaType(
+		c.Request().Header.Get(echo.HeaderContentType))
+	if err != nil || (contentType != JSONPatchContentType &&
+		contentType != MergePatchContentType) {
+		return errors.UnsupportedMediaType("")
+	}
+
+	var cas uint64
+	if ifMatch := c.Request().Header.Get("If-Match"); ifMatch != "" {
+		cas, err = parseETag(ifMatch)
+		if err == errWeakETag {
+			return errors.PreconditionFailed("")
+		}
+		if err != nil {
+			return errors.BadRequest("invalid If-Match header")
+		}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxPatchSize+1))
+	if err != nil {
+		r.logger.With(ctx).Info(err)
+		return errors.BadRequest("")
+	}
+	if len(body) > maxPatchSize {
+		return errors.TooLargeEntity("")
+	}
+
+	file, err := r.service.ApplyPatch(ctx, c.Param("sha256"), PatchFileRequest{
+		ContentType: contentType,
+		Body:        body,
+		CAS:         cas,
+	})
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Set("ETag", formatETag(file.CAS))
+	return c.JSON(http.StatusOK, file)
 }
 
 // @Summary Deletes a file
@@ -296,20 +357,46 @@ func (r resource) list(c echo.Context) error {
 }
 
 // @Summary Returns a paginated list of strings
-// @Description List strings of a file.
+// @Description List strings of a file. When any filter is given, the items
+// @Description are the strings matching all of them, each one along with its
+// @Description encoding and categories: `url`, `ip`, `path`, `registry`,
+// @Description `base64` or `crypto`.
 // @Tags File
 // @Accept json
 // @Produce json
 // @Param sha256 path string true "File SHA256"
+// @Param q query string false "Substring, matched case insensitively"
+// @Param regex query string false "Regular expression, RE2 syntax"
+// @Param encoding query string false "One of ascii, wide (utf-16) or asm"
+// @Param min_length query uint false "Minimum number of characters"
+// @Param category query string false "String category"
 // @Param per_page query uint false "Number of strings per page"
 // @Param page query uint false "Specify the page number"
 // @Success 200 {object} pagination.Pages
+// @Failure 400 {object} errors.ErrorResponse
 // @Failure 403 {object} errors.ErrorResponse
 // @Failure 404 {object} errors.ErrorResponse
 // @Failure 500 {object} errors.ErrorResponse
 // @Router /files/{sha256}/strings/ [get]
 func (r resource) strings(c echo.Context) error {
 	ctx := c.Request().Context()
+	filter := StringsFilter{
+		Query:    c.QueryParam("q"),
+		Regex:    c.QueryParam("regex"),
+		Encoding: c.QueryParam("encoding"),
+		Category: c.QueryParam("category"),
+	}
+	if minLength := c.QueryParam("min_length"); minLength != "" {
+		n, err := strconv.Atoi(minLength)
+		if err != nil {
+			return errors.BadRequest("invalid min_length")
+		}
+		filter.MinLength = n
+	}
+	if !filter.IsZero() {
+		return r.filterStrings(c, filter)
+	}
+
 	count, err := r.service.CountStrings(ctx, c.Param("sha256"))
 	if err != nil {
 		return err
@@ -324,6 +411,51 @@ func (r resource) strings(c echo.Context) error {
 	return c.JSON(http.StatusOK, pages)
 }
 
+// filterStrings responds with a page of the strings of a file matching a
+// filter, they are paginated in memory.
+func (r resource) filterStrings(c echo.Context, filter StringsFilter) error {
+	strs, err := r.service.FilterStrings(c.Request().Context(),
+		c.Param("sha256"), filter)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request(), len(strs))
+	start, end := pages.Bounds(len(strs))
+	pages.Items = strs[start:end]
+	return c.JSON(http.StatusOK, pages)
+}
+
+// @Summary Retrieves the files containing a string
+// @Description Paginated list of the files one of whose strings is exactly
+// @Description the given value, most recently seen first.
+// @Tags File
+// @Produce json
+// @Param value query string true "String value"
+// @Param encoding query string false "One of ascii, wide (utf-16) or asm"
+// @Param per_page query uint false "Number of files per page"
+// @Param page query uint false "Specify the page number"
+// @Success 200 {object} pagination.Pages
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /strings/files/ [get]
+func (r resource) stringFiles(c echo.Context) error {
+	ctx := c.Request().Context()
+	value, encoding := c.QueryParam("value"), c.QueryParam("encoding")
+	count, err := r.service.CountStringFiles(ctx, value, encoding)
+	if err != nil {
+		return err
+	}
+
+	pages := pagination.NewFromRequest(c.Request(), count)
+	files, err := r.service.StringFiles(ctx, value, encoding, pages.Offset(),
+		pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = files
+	return c.JSON(http.StatusOK, pages)
+}
+
 // @Summary File summary and metadata
 // @Description File metadata returned in the summary view of a file.
 // @Tags File
@@ -423,12 +555,17 @@ func (r resource) unlike(c echo.Context) error {
 }
 
 // @Summary Rescan an existing file
-// @Description Rescan an existing file.
+// @Description Rescan an existing file. Rescans are refused while a scan of
+// @Description the file is pending, and are subject to the rescan policy.
 // @Tags File
+// @Accept json
 // @Produce json
 // @Param sha256 path string true "File SHA256"
+// @Param data body FileScanRequest false "Scan config and priority"
 // @Failure 403 {object} errors.ErrorResponse
 // @Failure 404 {object} errors.ErrorResponse
+// @Failure 409 {object} errors.ErrorResponse
+// @Failure 429 {object} errors.ErrorResponse
 // @Failure 500 {object} errors.ErrorResponse
 // @Router /files/{sha256}/rescan/ [post]
 // @Security Bearer
@@ -453,6 +590,114 @@ func (r resource) rescan(c echo.Context) error {
 	}{"ok", http.StatusOK})
 }
 
+// @Summary Scan progress of a file
+// @Description Progress of each stage of a file scan (upload, static scan,
+// @Description multiav engines, sandbox) with timestamps.
+// @Tags File
+// @Produce json
+// @Param sha256 path string true "File SHA256"
+// @Success 200 {object} ScanStatus
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /files/{sha256}/status/ [get]
+func (r resource) status(c echo.Context) error {
+	ctx := c.Request().Context()
+	status, err := r.service.ScanStatus(ctx, c.Param("sha256"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+// @Summary Report a scan stage transition
+// @Description Used by the orchestrator workers to report the progress of
+// @Description a file scan. Requires admin privileges.
+// @Tags File
+// @Accept json
+// @Produce json
+// @Param sha256 path string true "File SHA256"
+// @Param data body StageTransitionRequest true "Stage transition"
+// @Success 200 {object} ScanStatus
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 403 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 409 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /files/{sha256}/status/ [put]
+// @Security Bearer
+func (r resource) updateStatus(c echo.Context) error {
+	var isAdmin bool
+	ctx := c.Request().Context()
+	if user, ok := ctx.Value(entity.UserKey).(entity.User); ok {
+		isAdmin = user.IsAdmin()
+	}
+	if !isAdmin {
+		return errors.Forbidden("")
+	}
+
+	var input StageTransitionRequest
+	if err := c.Bind(&input); err != nil {
+		r.logger.With(ctx).Info(err)
+		return err
+	}
+
+	status, err := r.service.UpdateScanStatus(ctx, c.Param("sha256"), input)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+// @Summary Set a verdict on a file
+// @Description Records the logged-in user verdict about a file.
+// @Tags File
+// @Accept json
+// @Produce json
+// @Param sha256 path string true "File SHA256"
+// @Param data body VerdictRequest true "Verdict body"
+// @Success 200 {object} entity.Verdict
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /files/{sha256}/verdict/ [put]
+// @Security Bearer
+func (r resource) setVerdict(c echo.Context) error {
+	var input VerdictRequest
+	ctx := c.Request().Context()
+	if err := c.Bind(&input); err != nil {
+		r.logger.With(ctx).Info(err)
+		return err
+	}
+
+	verdict, err := r.service.SetVerdict(ctx, c.Param("sha256"), input)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, verdict)
+}
+
+// @Summary Delete a verdict on a file
+// @Description Removes the logged-in user verdict about a file.
+// @Tags File
+// @Produce json
+// @Param sha256 path string true "File SHA256"
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /files/{sha256}/verdict/ [delete]
+// @Security Bearer
+func (r resource) deleteVerdict(c echo.Context) error {
+	ctx := c.Request().Context()
+	err := r.service.DeleteVerdict(ctx, c.Param("sha256"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, struct {
+		Message string `json:"message"`
+		Status  int    `json:"status"`
+	}{"ok", http.StatusOK})
+}
+
 // @Summary Download a file
 // @Description Download a binary file. Files are in zip format and password protected.
 // @Tags File
@@ -0,0 +1,134 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/saferwall/saferwall-api/pkg/log"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// ScanRequestVersion is the version of the scan request message format. It
+// is bumped along with a new JSON schema on every breaking change.
+const ScanRequestVersion = 1
+
+// Maximum length of a correlation ID, as set by the schema.
+const maxCorrelationIDLen = 128
+
+// ScanRequestSchema is the JSON schema scan request messages must conform
+// to. It is shared with the orchestrator.
+//
+//go:embed schema/scan-request.v1.json
+var ScanRequestSchema string
+
+var scanRequestSchema = compileSchema("scan-request.v1.json",
+	ScanRequestSchema)
+
+// ScanRequestMessage represents the message sent to the orchestrator to scan
+// a file. The scan config stays at the top level so that consumers of the
+// unversioned format keep working.
+type ScanRequestMessage struct {
+	// Version of the message format.
+	SchemaVersion int `json:"schema_version"`
+	// Unique ID of the message.
+	MessageID string `json:"message_id"`
+	// ID of the HTTP request or job that caused the scan.
+	CorrelationID string `json:"correlation_id"`
+	// Username of the user who requested the scan, empty when the scan is
+	// requested by the system.
+	Submitter string `json:"submitter,omitempty"`
+	// Unix time the scan was requested at.
+	SubmittedAt int64 `json:"submitted_at"`
+	// Unix time the message was produced at.
+	SentAt int64 `json:"sent_at"`
+	// SHA256 hash of the file.
+	SHA256 string `json:"sha256"`
+	// Represents the dynamic scan configuration plus some option fields.
+	FileScanRequest
+}
+
+// compileSchema compiles a JSON schema asserting the string formats.
+func compileSchema(url, schema string) *jsonschema.Schema {
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat = true
+	if err := compiler.AddResource(url, bytes.NewBufferString(schema)); err != nil {
+		panic(err)
+	}
+	return compiler.MustCompile(url)
+}
+
+// newScanRequest creates the message to scan a file. The correlation ID is
+// the one of the HTTP request when there is one, otherwise the message ID.
+func newScanRequest(ctx context.Context, sha256 string, req FileScanRequest,
+	now int64) ScanRequestMessage {
+
+	msg := ScanRequestMessage{
+		SchemaVersion:   ScanRequestVersion,
+		MessageID:       entity.ID(),
+		CorrelationID:   log.CorrelationID(ctx),
+		SubmittedAt:     now,
+		SHA256:          sha256,
+		FileScanRequest: req,
+	}
+	// Both IDs come from client headers, the ones the schema would reject
+	// are skipped.
+	if !isValidCorrelationID(msg.CorrelationID) {
+		msg.CorrelationID = log.RequestID(ctx)
+	}
+	if !isValidCorrelationID(msg.CorrelationID) {
+		msg.CorrelationID = msg.MessageID
+	}
+	if user, ok := ctx.Value(entity.UserKey).(entity.User); ok {
+		msg.Submitter = user.Username
+	}
+	return msg
+}
+
+// isValidCorrelationID checks whether an ID is a non empty string of at most
+// maxCorrelationIDLen printable ASCII characters.
+func isValidCorrelationID(id string) bool {
+	if id == "" || len(id) > maxCorrelationIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// encode stamps the message with the time it is sent at and serializes it.
+// The message is validated against its schema so that a malformed request
+// never reaches the orchestrator.
+func (msg ScanRequestMessage) encode(now int64) ([]byte, error) {
+	msg.SentAt = now
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	if err = validateMessage(scanRequestSchema, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// validateMessage validates a serialized message against a JSON schema.
+func validateMessage(schema *jsonschema.Schema, data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := schema.Validate(v); err != nil {
+		return fmt.Errorf("invalid message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/saferwall/saferwall-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+const testSHA256 = "131f95c51cc819465fa1797f6ccacf9d494aaaff46fa3eac73ae63ffbdfd8267"
+
+// assertGolden compares a serialized message with a golden file.
+func assertGolden(t *testing.T, name string, data []byte) {
+	var out bytes.Buffer
+	assert.Nil(t, json.Indent(&out, data, "", "  "))
+	out.WriteByte('\n')
+
+	golden := filepath.Join("testdata", name)
+	if *update {
+		assert.Nil(t, os.WriteFile(golden, out.Bytes(), 0o644))
+	}
+	want, err := os.ReadFile(golden)
+	assert.Nil(t, err)
+	assert.Equal(t, string(want), out.String())
+}
+
+func TestScanRequestWireFormat(t *testing.T) {
+	msg := ScanRequestMessage{
+		SchemaVersion: ScanRequestVersion,
+		MessageID:     "5f1c2a3e-8c52-4a6f-9d49-1c2f0b7d9e10",
+		CorrelationID: "req-42",
+		Submitter:     "mike",
+		SubmittedAt:   1700000000,
+		SHA256:        testSHA256,
+		FileScanRequest: FileScanRequest{
+			Priority: "high",
+			DynFileScanCfg: DynFileScanCfg{
+				DestPath: `%USERPROFILE%\Downloads\sample.exe`,
+				Timeout:  30,
+				Country:  "fr",
+				OS:       "win-10",
+			},
+		},
+	}
+	data, err := msg.encode(1700000005)
+	assert.Nil(t, err)
+	assertGolden(t, "scan-request.v1.golden.json", data)
+
+	// A system scan has no submitter.
+	msg = ScanRequestMessage{
+		SchemaVersion: ScanRequestVersion,
+		MessageID:     "5f1c2a3e-8c52-4a6f-9d49-1c2f0b7d9e10",
+		CorrelationID: "5f1c2a3e-8c52-4a6f-9d49-1c2f0b7d9e10",
+		SubmittedAt:   1700000000,
+		SHA256:        testSHA256,
+		FileScanRequest: FileScanRequest{
+			SkipDetonation: true, Priority: "low"},
+	}
+	data, err = msg.encode(1700000000)
+	assert.Nil(t, err)
+	assertGolden(t, "scan-request.v1.system.golden.json", data)
+
+	// The golden files decode back to the same message.
+	var decoded ScanRequestMessage
+	assert.Nil(t, json.Unmarshal(data, &decoded))
+	msg.SentAt = 1700000000
+	assert.Equal(t, msg, decoded)
+}
+
+func TestScanRequestValidation(t *testing.T) {
+	ctx := context.WithValue(context.Background(), entity.UserKey,
+		entity.User{Username: "mike"})
+	msg := newScanRequest(ctx, testSHA256, FileScanRequest{}, 100)
+	assert.Equal(t, ScanRequestVersion, msg.SchemaVersion)
+	assert.Equal(t, "mike", msg.Submitter)
+	assert.Equal(t, msg.MessageID, msg.CorrelationID)
+	assert.True(t, entity.IsValidID(msg.MessageID))
+
+	_, err := msg.encode(101)
+	assert.Nil(t, err)
+
+	bad := msg
+	bad.SHA256 = strings.ToUpper(testSHA256)
+	_, err = bad.encode(101)
+	assert.NotNil(t, err)
+
+	bad = msg
+	bad.SchemaVersion = 2
+	_, err = bad.encode(101)
+	assert.NotNil(t, err)
+
+	bad = msg
+	bad.MessageID = "not-a-uuid"
+	_, err = bad.encode(101)
+	assert.NotNil(t, err)
+
+	bad = msg
+	bad.Priority = "urgent"
+	_, err = bad.encode(101)
+	assert.NotNil(t, err)
+}
+
+func TestScanRequestCorrelationID(t *testing.T) {
+	for _, header := range []string{strings.Repeat("a", 129), "req\n42"} {
+		req := httptest.NewRequest(http.MethodPost, "/files/", nil)
+		req.Header.Set("X-Correlation-ID", header)
+		req.Header.Set("X-Request-ID", "req-42")
+		ctx := log.WithRequest(context.Background(), req)
+
+		// An invalid correlation ID falls back to the request ID.
+		msg := newScanRequest(ctx, testSHA256, FileScanRequest{}, 100)
+		assert.Equal(t, "req-42", msg.CorrelationID)
+		_, err := msg.encode(101)
+		assert.Nil(t, err)
+
+		// Then to the message ID when the request ID is invalid too.
+		req.Header.Set("X-Request-ID", header)
+		ctx = log.WithRequest(context.Background(), req)
+		msg = newScanRequest(ctx, testSHA256, FileScanRequest{}, 100)
+		assert.Equal(t, msg.MessageID, msg.CorrelationID)
+	}
+}
@@ -0,0 +1,499 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package file
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
+	e "github.com/saferwall/saferwall-api/internal/errors"
+)
+
+// Media types accepted by a partial file update.
+const (
+	// JSONPatchContentType identifies a RFC 6902 JSON Patch document.
+	JSONPatchContentType = "application/json-patch+json"
+	// MergePatchContentType identifies a RFC 7396 JSON Merge Patch document.
+	MergePatchContentType = "application/merge-patch+json"
+)
+
+var (
+	regSubDocKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	regArrayIdx  = regexp.MustCompile(`^(0|[1-9][0-9]*)$`)
+
+	errInvalidPatch     = e.BadRequest("invalid patch document")
+	errPatchPath        = e.BadRequest("patch path not allowed")
+	errPatchPathMissing = e.Conflict("patch path does not exist")
+	errPatchTestFailed  = e.Conflict("patch test operation failed")
+	errTooManyPatchOps  = e.BadRequest("too many patch operations")
+)
+
+// patchableFields lists the top level attributes of a file document that can
+// be modified by a partial update. Identity fields like the SHA256, the doc
+// type, the first seen date or the submissions are left out on purpose.
+var patchableFields = map[string]bool{
+	"md5":                     true,
+	"sha1":                    true,
+	"sha512":                  true,
+	"ssdeep":                  true,
+	"crc32":                   true,
+	"size":                    true,
+	"tags":                    true,
+	"magic":                   true,
+	"exif":                    true,
+	"trid":                    true,
+	"packer":                  true,
+	"last_scanned":            true,
+	"strings":                 true,
+	"multiav":                 true,
+	"pe":                      true,
+	"histogram":               true,
+	"byte_entropy":            true,
+	"ml":                      true,
+	"file_format":             true,
+	"file_extension":          true,
+	"default_behavior_report": true,
+	"behavior_scans":          true,
+	"status":                  true,
+}
+
+// patchOperation represents a single RFC 6902 JSON Patch operation.
+type patchOperation struct {
+	Op    string           `json:"op"`
+	Path  string           `json:"path"`
+	From  string           `json:"from,omitempty"`
+	Value *json.RawMessage `json:"value,omitempty"`
+}
+
+// jsonPointer represents a parsed RFC 6901 JSON Pointer.
+type jsonPointer []string
+
+// parsePointer parses a JSON Pointer and makes sure it references a field
+// which is allowed to be patched.
+func parsePointer(s string) (jsonPointer, error) {
+	if !strings.HasPrefix(s, "/") {
+		return nil, errInvalidPatch
+	}
+	p := jsonPointer(strings.Split(s[1:], "/"))
+	for i, token := range p {
+		token = strings.ReplaceAll(token, "~1", "/")
+		p[i] = strings.ReplaceAll(token, "~0", "~")
+	}
+	if !patchableFields[p[0]] {
+		return nil, errPatchPath
+	}
+	return p, nil
+}
+
+// parent returns the pointer to the container of the referenced value.
+func (p jsonPointer) parent() jsonPointer {
+	return p[:len(p)-1]
+}
+
+// last returns the last reference token of the pointer.
+func (p jsonPointer) last() string {
+	return p[len(p)-1]
+}
+
+// isPrefixOf returns true when p references an ancestor of o.
+func (p jsonPointer) isPrefixOf(o jsonPointer) bool {
+	if len(p) >= len(o) {
+		return false
+	}
+	for i := range p {
+		if p[i] != o[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup returns the value referenced by the pointer in doc.
+func (p jsonPointer) lookup(doc interface{}) (interface{}, bool) {
+	cur := doc
+	for _, token := range p {
+		switch node := cur.(type) {
+		case map[string]interface{}:
+			v, ok := node[token]
+			if !ok {
+				return nil, false
+			}
+			cur = v
+		case []interface{}:
+			idx, ok := arrayIndex(token, len(node))
+			if !ok {
+				return nil, false
+			}
+			cur = node[idx]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// subDocPath translates the pointer into a Couchbase sub document path. The
+// document is walked along the way to tell array indexes from object keys
+// that happen to be numeric.
+func (p jsonPointer) subDocPath(doc interface{}) string {
+	var b strings.Builder
+	cur := doc
+	for i, token := range p {
+		if arr, ok := cur.([]interface{}); ok {
+			b.WriteString("[" + token + "]")
+			cur = nil
+			if idx, ok := arrayIndex(token, len(arr)); ok {
+				cur = arr[idx]
+			}
+			continue
+		}
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		if regSubDocKey.MatchString(token) {
+			b.WriteString(token)
+		} else {
+			b.WriteString("`" + strings.ReplaceAll(token, "`", "``") + "`")
+		}
+		m, _ := cur.(map[string]interface{})
+		cur = m[token]
+	}
+	return b.String()
+}
+
+// arrayIndex parses an array index token and checks it is within bounds.
+func arrayIndex(token string, length int) (int, bool) {
+	if !regArrayIdx.MatchString(token) {
+		return 0, false
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx >= length {
+		return 0, false
+	}
+	return idx, true
+}
+
+// addValue inserts val at the location referenced by p following the `add`
+// semantics of RFC 6902, it returns the updated node.
+func addValue(node interface{}, p jsonPointer, val interface{}) (
+	interface{}, error) {
+
+	if len(p) == 0 {
+		return val, nil
+	}
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if len(p) == 1 {
+			n[p[0]] = val
+			return n, nil
+		}
+		child, ok := n[p[0]]
+		if !ok {
+			return nil, errPatchPathMissing
+		}
+		child, err := addValue(child, p[1:], val)
+		if err != nil {
+			return nil, err
+		}
+		n[p[0]] = child
+		return n, nil
+	case []interface{}:
+		if len(p) == 1 {
+			if p[0] == "-" {
+				return append(n, val), nil
+			}
+			idx, ok := arrayIndex(p[0], len(n)+1)
+			if !ok {
+				return nil, errPatchPathMissing
+			}
+			n = append(n, nil)
+			copy(n[idx+1:], n[idx:])
+			n[idx] = val
+			return n, nil
+		}
+		idx, ok := arrayIndex(p[0], len(n))
+		if !ok {
+			return nil, errPatchPathMissing
+		}
+		child, err := addValue(n[idx], p[1:], val)
+		if err != nil {
+			return nil, err
+		}
+		n[idx] = child
+		return n, nil
+	}
+	return nil, errPatchPathMissing
+}
+
+// removeValue deletes the value referenced by p, it returns the updated node.
+func removeValue(node interface{}, p jsonPointer) (interface{}, error) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[p[0]]
+		if !ok {
+			return nil, errPatchPathMissing
+		}
+		if len(p) == 1 {
+			delete(n, p[0])
+			return n, nil
+		}
+		child, err := removeValue(child, p[1:])
+		if err != nil {
+			return nil, err
+		}
+		n[p[0]] = child
+		return n, nil
+	case []interface{}:
+		idx, ok := arrayIndex(p[0], len(n))
+		if !ok {
+			return nil, errPatchPathMissing
+		}
+		if len(p) == 1 {
+			return append(n[:idx], n[idx+1:]...), nil
+		}
+		child, err := removeValue(n[idx], p[1:])
+		if err != nil {
+			return nil, err
+		}
+		n[idx] = child
+		return n, nil
+	}
+	return nil, errPatchPathMissing
+}
+
+// addOps returns the sub document mutations equivalent to adding val at p,
+// and applies the change to the in-memory document.
+func addOps(doc *interface{}, p jsonPointer, val interface{}) (
+	[]dbcontext.MutateOp, error) {
+
+	var op dbcontext.MutateOp
+	parent, ok := p.parent().lookup(*doc)
+	if !ok {
+		return nil, errPatchPathMissing
+	}
+	if _, isArray := parent.([]interface{}); isArray {
+		if p.last() == "-" {
+			op = dbcontext.MutateOp{Kind: dbcontext.MutateArrayAppend,
+				Path: p.parent().subDocPath(*doc), Value: val}
+		} else {
+			op = dbcontext.MutateOp{Kind: dbcontext.MutateArrayInsert,
+				Path: p.subDocPath(*doc), Value: val}
+		}
+	} else {
+		op = dbcontext.MutateOp{Kind: dbcontext.MutateUpsert,
+			Path: p.subDocPath(*doc), Value: val}
+	}
+
+	updated, err := addValue(*doc, p, val)
+	if err != nil {
+		return nil, err
+	}
+	*doc = updated
+	return []dbcontext.MutateOp{op}, nil
+}
+
+// removeOps returns the sub document mutations equivalent to removing the
+// value at p, and applies the change to the in-memory document.
+func removeOps(doc *interface{}, p jsonPointer) ([]dbcontext.MutateOp, error) {
+	op := dbcontext.MutateOp{Kind: dbcontext.MutateRemove,
+		Path: p.subDocPath(*doc)}
+	updated, err := removeValue(*doc, p)
+	if err != nil {
+		return nil, err
+	}
+	*doc = updated
+	return []dbcontext.MutateOp{op}, nil
+}
+
+// decodeValue decodes the value member of a patch operation.
+func decodeValue(raw *json.RawMessage) (interface{}, error) {
+	if raw == nil {
+		return nil, errInvalidPatch
+	}
+	var val interface{}
+	if err := json.Unmarshal(*raw, &val); err != nil {
+		return nil, errInvalidPatch
+	}
+	return val, nil
+}
+
+// jsonPatchOps converts a RFC 6902 JSON Patch document into a list of sub
+// document mutations. Operations are evaluated against the current document
+// so that `test`, `move` and `copy` can be honored and paths are validated
+// before anything is sent to the database.
+func jsonPatchOps(doc interface{}, body []byte) ([]dbcontext.MutateOp, error) {
+
+	var patch []patchOperation
+	if err := json.Unmarshal(body, &patch); err != nil || len(patch) == 0 {
+		return nil, errInvalidPatch
+	}
+
+	var ops []dbcontext.MutateOp
+	for _, po := range patch {
+		path, err := parsePointer(po.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		var newOps []dbcontext.MutateOp
+		switch po.Op {
+		case "add":
+			val, err := decodeValue(po.Value)
+			if err != nil {
+				return nil, err
+			}
+			newOps, err = addOps(&doc, path, val)
+			if err != nil {
+				return nil, err
+			}
+		case "remove":
+			newOps, err = removeOps(&doc, path)
+			if err != nil {
+				return nil, err
+			}
+		case "replace":
+			val, err := decodeValue(po.Value)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := path.lookup(doc); !ok {
+				return nil, errPatchPathMissing
+			}
+			newOps = []dbcontext.MutateOp{{Kind: dbcontext.MutateReplace,
+				Path: path.subDocPath(doc), Value: val}}
+			if doc, err = removeValue(doc, path); err != nil {
+				return nil, err
+			}
+			if doc, err = addValue(doc, path, val); err != nil {
+				return nil, err
+			}
+		case "move", "copy":
+			from, err := parsePointer(po.From)
+			if err != nil {
+				return nil, err
+			}
+			val, ok := from.lookup(doc)
+			if !ok {
+				return nil, errPatchPathMissing
+			}
+			if po.Op == "move" {
+				if from.isPrefixOf(path) {
+					return nil, errInvalidPatch
+				}
+				newOps, err = removeOps(&doc, from)
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				// Deep copy the value so later operations on the
+				// destination do not alter the source.
+				b, _ := json.Marshal(val)
+				_ = json.Unmarshal(b, &val)
+			}
+			addedOps, err := addOps(&doc, path, val)
+			if err != nil {
+				return nil, err
+			}
+			newOps = append(newOps, addedOps...)
+		case "test":
+			val, err := decodeValue(po.Value)
+			if err != nil {
+				return nil, err
+			}
+			cur, ok := path.lookup(doc)
+			if !ok || !reflect.DeepEqual(cur, val) {
+				return nil, errPatchTestFailed
+			}
+		default:
+			return nil, errInvalidPatch
+		}
+		ops = append(ops, newOps...)
+	}
+
+	if len(ops) > dbcontext.MaxMutateOps {
+		return nil, errTooManyPatchOps
+	}
+	return ops, nil
+}
+
+// mergePatchOps converts a RFC 7396 JSON Merge Patch document into a list of
+// sub document mutations.
+func mergePatchOps(doc interface{}, body []byte) ([]dbcontext.MutateOp, error) {
+
+	var patch map[string]interface{}
+	if err := json.Unmarshal(body, &patch); err != nil || len(patch) == 0 {
+		return nil, errInvalidPatch
+	}
+	for k := range patch {
+		if !patchableFields[k] {
+			return nil, errPatchPath
+		}
+	}
+
+	target, _ := doc.(map[string]interface{})
+	ops := mergeObject(doc, target, patch, jsonPointer{})
+	if len(ops) > dbcontext.MaxMutateOps {
+		return nil, errTooManyPatchOps
+	}
+	return ops, nil
+}
+
+// mergeObject recursively merges patch into target located at prefix.
+func mergeObject(doc interface{}, target, patch map[string]interface{},
+	prefix jsonPointer) []dbcontext.MutateOp {
+
+	// Sort the keys to produce the mutations in a deterministic order.
+	keys := make([]string, 0, len(patch))
+	for k := range patch {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var ops []dbcontext.MutateOp
+	for _, k := range keys {
+		p := append(prefix[:len(prefix):len(prefix)], k)
+		cur, exists := target[k]
+		switch v := patch[k].(type) {
+		case nil:
+			if exists {
+				ops = append(ops, dbcontext.MutateOp{
+					Kind: dbcontext.MutateRemove, Path: p.subDocPath(doc)})
+			}
+		case map[string]interface{}:
+			if curObj, ok := cur.(map[string]interface{}); ok {
+				ops = append(ops, mergeObject(doc, curObj, v, p)...)
+				continue
+			}
+			ops = append(ops, dbcontext.MutateOp{Kind: dbcontext.MutateUpsert,
+				Path: p.subDocPath(doc), Value: stripNulls(v)})
+		default:
+			ops = append(ops, dbcontext.MutateOp{Kind: dbcontext.MutateUpsert,
+				Path: p.subDocPath(doc), Value: v})
+		}
+	}
+	return ops
+}
+
+// stripNulls removes the null members of a merge patch object which is
+// applied to a non object target.
+func stripNulls(obj map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(obj))
+	for k, v := range obj {
+		switch val := v.(type) {
+		case nil:
+			continue
+		case map[string]interface{}:
+			res[k] = stripNulls(val)
+		default:
+			res[k] = v
+		}
+	}
+	return res
+}
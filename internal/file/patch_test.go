@@ -0,0 +1,116 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package file
+
+import (
+	"encoding/json"
+	"testing"
+
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func testDoc(t *testing.T) interface{} {
+	var doc interface{}
+	err := json.Unmarshal([]byte(`{
+		"type": "file",
+		"sha256": "abc",
+		"magic": "PE32",
+		"trid": ["a", "b"],
+		"tags": {"packer": ["upx"], "a/b": 1},
+		"pe": {"meta": {"imphash": "x"}}
+	}`), &doc)
+	assert.Nil(t, err)
+	return doc
+}
+
+func TestJSONPatchOps(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		ops   []dbcontext.MutateOp
+		err   error
+	}{
+		{"replace", `[{"op":"replace","path":"/magic","value":"ELF"}]`,
+			[]dbcontext.MutateOp{{Kind: dbcontext.MutateReplace, Path: "magic", Value: "ELF"}}, nil},
+		{"add object member", `[{"op":"add","path":"/tags/clamav","value":"x"}]`,
+			[]dbcontext.MutateOp{{Kind: dbcontext.MutateUpsert, Path: "tags.clamav", Value: "x"}}, nil},
+		{"append to array", `[{"op":"add","path":"/tags/packer/-","value":"aspack"}]`,
+			[]dbcontext.MutateOp{{Kind: dbcontext.MutateArrayAppend, Path: "tags.packer", Value: "aspack"}}, nil},
+		{"insert in array", `[{"op":"add","path":"/trid/1","value":"c"}]`,
+			[]dbcontext.MutateOp{{Kind: dbcontext.MutateArrayInsert, Path: "trid[1]", Value: "c"}}, nil},
+		{"remove escaped key", `[{"op":"remove","path":"/tags/a~1b"}]`,
+			[]dbcontext.MutateOp{{Kind: dbcontext.MutateRemove, Path: "tags.`a/b`"}}, nil},
+		{"move", `[{"op":"move","from":"/trid/0","path":"/packer"}]`,
+			[]dbcontext.MutateOp{
+				{Kind: dbcontext.MutateRemove, Path: "trid[0]"},
+				{Kind: dbcontext.MutateUpsert, Path: "packer", Value: "a"}}, nil},
+		{"test then replace", `[{"op":"test","path":"/pe/meta/imphash","value":"x"},
+			{"op":"replace","path":"/pe/meta/imphash","value":"y"}]`,
+			[]dbcontext.MutateOp{{Kind: dbcontext.MutateReplace, Path: "pe.meta.imphash", Value: "y"}}, nil},
+		{"test sees previous ops", `[{"op":"add","path":"/trid/-","value":"z"},
+			{"op":"test","path":"/trid/2","value":"z"}]`,
+			[]dbcontext.MutateOp{{Kind: dbcontext.MutateArrayAppend, Path: "trid", Value: "z"}}, nil},
+		{"failed test", `[{"op":"test","path":"/magic","value":"ELF"}]`, nil, errPatchTestFailed},
+		{"path not allowed", `[{"op":"replace","path":"/sha256","value":"x"}]`, nil, errPatchPath},
+		{"missing parent", `[{"op":"add","path":"/pe/x/y","value":1}]`, nil, errPatchPathMissing},
+		{"replace missing", `[{"op":"replace","path":"/exif","value":{}}]`, nil, errPatchPathMissing},
+		{"missing value", `[{"op":"add","path":"/magic"}]`, nil, errInvalidPatch},
+		{"unknown op", `[{"op":"frobnicate","path":"/magic"}]`, nil, errInvalidPatch},
+		{"not an array", `{"op":"add"}`, nil, errInvalidPatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := jsonPatchOps(testDoc(t), []byte(tt.patch))
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.ops, ops)
+		})
+	}
+}
+
+func TestMergePatchOps(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		ops   []dbcontext.MutateOp
+		err   error
+	}{
+		{"merge nested", `{"pe":{"meta":{"imphash":"y"}},"tags":{"packer":null}}`,
+			[]dbcontext.MutateOp{
+				{Kind: dbcontext.MutateUpsert, Path: "pe.meta.imphash", Value: "y"},
+				{Kind: dbcontext.MutateRemove, Path: "tags.packer"}}, nil},
+		{"object over scalar", `{"magic":{"a":1,"b":null}}`,
+			[]dbcontext.MutateOp{{Kind: dbcontext.MutateUpsert, Path: "magic",
+				Value: map[string]interface{}{"a": float64(1)}}}, nil},
+		{"remove absent member", `{"exif":null}`, nil, nil},
+		{"field not allowed", `{"submissions":[]}`, nil, errPatchPath},
+		{"not an object", `[1]`, nil, errInvalidPatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := mergePatchOps(testDoc(t), []byte(tt.patch))
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.ops, ops)
+		})
+	}
+}
+
+func TestParseETag(t *testing.T) {
+	cas, err := parseETag(formatETag(1234))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1234), cas)
+
+	_, err = parseETag(`W/"42"`)
+	assert.Equal(t, errWeakETag, err)
+
+	cas, err = parseETag("*")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), cas)
+
+	_, err = parseETag(`"abc"`)
+	assert.NotNil(t, err)
+}
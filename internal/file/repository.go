@@ -17,8 +17,15 @@ import (
 
 // Repository encapsulates the logic to access files from the data source.
 type Repository interface {
-	// Get returns the file with the specified file ID.
-	Get(ctx context.Context, id string, fields []string) (entity.File, error)
+	// Get returns the file with the specified file ID along with its CAS.
+	// The CAS is zero when only some fields of the file are requested.
+	Get(ctx context.Context, id string, fields []string) (entity.File, uint64, error)
+	// Progress returns the scan progress of the file with the specified
+	// file ID, it is a lightweight alternative to Get.
+	Progress(ctx context.Context, id string) (entity.File, uint64, error)
+	// Document returns the raw file document with the specified file ID
+	// along with its CAS.
+	Document(ctx context.Context, id string) (interface{}, uint64, error)
 	// Count returns the number of files.
 	Count(ctx context.Context) (int, error)
 	// Exists return true when the doc exists in the DB.
@@ -27,10 +34,21 @@ type Repository interface {
 	Query(ctx context.Context, offset, limit int, fields []string) ([]entity.File, error)
 	// Create saves a new file in the storage.
 	Create(ctx context.Context, id string, file entity.File) error
-	// Update updates the whole file with given ID in the storage.
-	Update(ctx context.Context, key string, file entity.File) error
+	// Update updates the whole file with given ID in the storage provided
+	// its CAS did not change.
+	Update(ctx context.Context, key string, file entity.File, cas uint64) error
+	// UpdateWithScan updates the file with given ID with merge and saves a
+	// multiav scan to its history, in a single transaction.
+	UpdateWithScan(ctx context.Context, key string, scan entity.AVScan,
+		merge func(file *entity.File) error) error
 	// Patch patches a sub entry in the file with given ID in the storage.
 	Patch(ctx context.Context, key, path string, val interface{}) error
+	// MutateIn applies a list of sub document mutations to the file with
+	// given ID, provided its CAS did not change. It returns the new CAS.
+	MutateIn(ctx context.Context, key string, ops []dbcontext.MutateOp,
+		cas uint64) (uint64, error)
+	// Increment atomically adds delta to a counter in the file with given ID.
+	Increment(ctx context.Context, key, path string, delta int64) error
 	// Delete removes the file with given ID from the storage.
 	Delete(ctx context.Context, id string) error
 	// Summary returns a summary of a file scan.
@@ -41,6 +59,14 @@ type Repository interface {
 	CountStrings(ctx context.Context, id string) (int, error)
 	Strings(ctx context.Context, id string, offset, limit int) (
 		interface{}, error)
+	// AllStrings returns all the strings of a file, they are empty when the
+	// file has none.
+	AllStrings(ctx context.Context, id string) (entity.Strings, error)
+	// StringFiles returns the files containing a string, optionally
+	// restricted to an encoding.
+	StringFiles(ctx context.Context, value, encoding string, offset,
+		limit int) ([]interface{}, error)
+	CountStringFiles(ctx context.Context, value, encoding string) (int, error)
 }
 
 // repository persists files in database.
@@ -56,9 +82,10 @@ func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
 
 // Get reads the file with the specified ID from the database.
 func (r repository) Get(ctx context.Context, id string, fields []string) (
-	entity.File, error) {
+	entity.File, uint64, error) {
 
 	var err error
+	var cas uint64
 	var file entity.File
 
 	key := file.ID(id)
@@ -67,10 +94,30 @@ func (r repository) Get(ctx context.Context, id string, fields []string) (
 	if len(fields) > 0 {
 		err = r.db.Lookup(ctx, key, fields, &file)
 	} else {
-		err = r.db.Get(ctx, key, &file)
+		cas, err = r.db.GetWithCAS(ctx, key, &file)
 	}
 
-	return file, err
+	return file, cas, err
+}
+
+// Progress reads the scan progress of a file from the database.
+func (r repository) Progress(ctx context.Context, id string) (
+	entity.File, uint64, error) {
+
+	var file entity.File
+	cas, err := r.db.LookupWithCAS(ctx, file.ID(id),
+		[]string{"status", "scan_progress", "scan_requested_at"}, &file)
+	return file, cas, err
+}
+
+// Document reads the raw file document with the specified ID from the
+// database.
+func (r repository) Document(ctx context.Context, id string) (
+	interface{}, uint64, error) {
+
+	var doc map[string]interface{}
+	cas, err := r.db.GetWithCAS(ctx, entity.File{}.ID(id), &doc)
+	return doc, cas, err
 }
 
 // Create saves a new file record in the database.
@@ -89,8 +136,29 @@ func (r repository) Exists(ctx context.Context, key string) (bool, error) {
 
 // Update saves the changes to a file in the database.
 func (r repository) Update(ctx context.Context, key string,
-	file entity.File) error {
-	return r.db.Update(ctx, file.ID(key), &file)
+	file entity.File, cas uint64) error {
+	_, err := r.db.Update(ctx, file.ID(key), &file, cas)
+	return err
+}
+
+// UpdateWithScan updates a file and creates a multiav scan in the database,
+// either both are saved or none is.
+func (r repository) UpdateWithScan(ctx context.Context, key string,
+	scan entity.AVScan, merge func(file *entity.File) error) error {
+
+	return r.db.Transaction(ctx, func(tx *dbcontext.Tx) error {
+		var file entity.File
+		if err := tx.Get(file.ID(key), &file); err != nil {
+			return err
+		}
+		if err := merge(&file); err != nil {
+			return err
+		}
+		if err := tx.Replace(file.ID(key), &file); err != nil {
+			return err
+		}
+		return tx.Insert(scan.ID, &scan)
+	})
 }
 
 // Patch performs a sub doc update to a file in the database.
@@ -99,6 +167,18 @@ func (r repository) Patch(ctx context.Context, key, path string,
 	return r.db.Patch(ctx, key, path, val)
 }
 
+// MutateIn performs a list of sub doc updates to a file in the database.
+func (r repository) MutateIn(ctx context.Context, key string,
+	ops []dbcontext.MutateOp, cas uint64) (uint64, error) {
+	return r.db.MutateIn(ctx, key, ops, cas)
+}
+
+// Increment atomically updates a counter of a file in the database.
+func (r repository) Increment(ctx context.Context, key, path string,
+	delta int64) error {
+	return r.db.Increment(ctx, entity.File{}.ID(key), path, delta)
+}
+
 // Delete deletes a file with the specified ID from the database.
 func (r repository) Delete(ctx context.Context, id string) error {
 	return r.db.Delete(ctx, id)
@@ -243,3 +323,49 @@ func (r repository) Strings(ctx context.Context, id string, offset,
 	}
 	return results.([]interface{})[0], nil
 }
+
+// AllStrings reads the strings of a file from the database.
+func (r repository) AllStrings(ctx context.Context, id string) (
+	entity.Strings, error) {
+
+	var file entity.File
+	_, err := r.db.LookupWithCAS(ctx, file.ID(id), []string{"strings"}, &file)
+	if err != nil || file.Strings == nil {
+		return entity.Strings{}, err
+	}
+	return *file.Strings, nil
+}
+
+// StringFiles retrieves the files containing a string from the database.
+func (r repository) StringFiles(ctx context.Context, value, encoding string,
+	offset, limit int) ([]interface{}, error) {
+
+	var results interface{}
+	params := make(map[string]interface{}, 4)
+	params["value"] = value
+	params["encoding"] = encoding
+	params["offset"] = offset
+	params["limit"] = limit
+
+	query := r.db.N1QLQuery[dbcontext.StringFiles]
+	err := r.db.Query(ctx, query, params, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results.([]interface{}), nil
+}
+
+// CountStringFiles returns the number of files containing a string in the
+// database.
+func (r repository) CountStringFiles(ctx context.Context, value,
+	encoding string) (int, error) {
+
+	var count int
+	params := make(map[string]interface{}, 2)
+	params["value"] = value
+	params["encoding"] = encoding
+
+	query := r.db.N1QLQuery[dbcontext.CountStringFiles]
+	err := r.db.Count(ctx, query, params, &count)
+	return count, err
+}
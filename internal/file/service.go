@@ -9,13 +9,23 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"path/filepath"
 	"time"
 
 	"github.com/saferwall/saferwall-api/internal/activity"
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
 	"github.com/saferwall/saferwall-api/internal/entity"
+	e "github.com/saferwall/saferwall-api/internal/errors"
+	"github.com/saferwall/saferwall-api/internal/event"
+	"github.com/saferwall/saferwall-api/internal/ioc"
+	"github.com/saferwall/saferwall-api/internal/multiav"
+	"github.com/saferwall/saferwall-api/internal/rescan"
+	"github.com/saferwall/saferwall-api/internal/sandbox"
 	"github.com/saferwall/saferwall-api/internal/user"
+	"github.com/saferwall/saferwall-api/internal/watch"
+	"github.com/saferwall/saferwall-api/internal/webhook"
 	"github.com/saferwall/saferwall-api/pkg/log"
 )
 
@@ -26,6 +36,8 @@ var (
 	ErrObjectNotFound = errors.New("object not found")
 	// file upload timeout in seconds.
 	fileUploadTimeout = time.Duration(time.Second * 30)
+	// timeout of the indexing of the IOCs of a behavior scan.
+	indexBehaviorTimeout = time.Duration(time.Minute * 5)
 )
 
 // Progress of a file scan.
@@ -45,14 +57,32 @@ type Service interface {
 	Delete(ctx context.Context, id string) (File, error)
 	Query(ctx context.Context, offset, limit int, fields []string) ([]File, error)
 	Patch(ctx context.Context, key, path string, val interface{}) error
+	ApplyPatch(ctx context.Context, id string, input PatchFileRequest) (File, error)
+	Increment(ctx context.Context, id, path string, delta int64) error
 	Summary(ctx context.Context, id string) (interface{}, error)
 	Like(ctx context.Context, id string) error
 	Unlike(ctx context.Context, id string) error
 	Rescan(ctx context.Context, id string, input FileScanRequest) error
+	Enqueue(ctx context.Context, id string, input FileScanRequest) error
+	ScanStatus(ctx context.Context, id string) (ScanStatus, error)
+	UpdateScanStatus(ctx context.Context, id string,
+		input StageTransitionRequest) (ScanStatus, error)
+	SetVerdict(ctx context.Context, id string, input VerdictRequest) (
+		entity.Verdict, error)
+	DeleteVerdict(ctx context.Context, id string) error
 	Comments(ctx context.Context, id string, offset, limit int) (
 		[]interface{}, error)
 	CountStrings(ctx context.Context, id string) (int, error)
 	Strings(ctx context.Context, id string, offset, limit int) (interface{}, error)
+	// FilterStrings returns the strings of a file matching a filter along
+	// with their categories.
+	FilterStrings(ctx context.Context, id string, filter StringsFilter) (
+		[]String, error)
+	// StringFiles returns the files containing a string, optionally
+	// restricted to an encoding.
+	StringFiles(ctx context.Context, value, encoding string, offset,
+		limit int) ([]interface{}, error)
+	CountStringFiles(ctx context.Context, value, encoding string) (int, error)
 	Download(ctx context.Context, id string, zipFile *string) error
 	GeneratePresignedURL(ctx context.Context, id string) (string, error)
 }
@@ -67,6 +97,8 @@ type UploadDownloader interface {
 // File represents the data about a File.
 type File struct {
 	entity.File
+	// CAS of the file document, it is used as the file ETag.
+	CAS uint64 `json:"-"`
 }
 
 // Producer represents event stream message producer interface.
@@ -82,15 +114,18 @@ type Archiver interface {
 // DynFileScanCfg represents the config used to detonate a file.
 type DynFileScanCfg struct {
 	// Destination path where the sample will be located in the VM.
-	DestPath string `json:"dest_path,omitempty" form:"dest_path"`
+	DestPath string `json:"dest_path,omitempty" form:"dest_path" validate:"omitempty,max=260,excludesall=<>0x7C?*"`
 	// Arguments used to run the sample.
-	Arguments string `json:"args,omitempty" form:"args"`
-	// Timeout in seconds for how long to keep the VM running.
-	Timeout int `json:"timeout,omitempty" form:"timeout"`
-	// Country to route traffic through.
-	Country string `json:"country,omitempty" form:"country"`
-	// Operating System used to run the sample.
-	OS string `json:"os,omitempty" form:"os"`
+	Arguments string `json:"args,omitempty" form:"args" validate:"omitempty,max=1024"`
+	// Timeout in seconds for how long to keep the VM running. The allowed
+	// range depends on the user, see the sandbox options.
+	Timeout int `json:"timeout,omitempty" form:"timeout" validate:"min=0,max=86400"`
+	// Country to route traffic through, as a lower case ISO 3166-1
+	// alpha-2 code.
+	Country string `json:"country,omitempty" form:"country" validate:"omitempty,len=2,lowercase,alpha"`
+	// Operating System used to run the sample, one of the OS images of the
+	// sandbox options.
+	OS string `json:"os,omitempty" form:"os" validate:"omitempty,max=32,printascii"`
 }
 
 // FileScanRequest represents a File scan request.
@@ -99,15 +134,9 @@ type FileScanRequest struct {
 	SkipDetonation bool `json:"skip_detonation,omitempty" form:"skip_detonation"`
 	// Dynamic scan config
 	DynFileScanCfg `json:"scan_cfg,omitempty"`
-}
-
-// FileScanCfg represents a file scanning config. This map to a 1:1 mapping between
-// the config stored in the main saferwall repo.
-type FileScanCfg struct {
-	// SHA256 hash of the file.
-	SHA256 string `json:"sha256,omitempty"`
-	// Represents the dynamic scan configuration plus some option fields.
-	FileScanRequest
+	// Priority of the scan, one of: "low", "normal", "high". Each priority
+	// is routed to its own topic.
+	Priority string `json:"priority,omitempty" form:"priority" validate:"omitempty,oneof=low normal high"`
 }
 
 // CreateFileRequest represents a file creation request.
@@ -118,6 +147,23 @@ type CreateFileRequest struct {
 	scanCfg  FileScanRequest
 }
 
+// PatchFileRequest represents a partial File update request.
+type PatchFileRequest struct {
+	// Media type of the patch document, either a JSON Patch or a JSON
+	// Merge Patch.
+	ContentType string
+	// The patch document.
+	Body []byte
+	// CAS the client expects the file to have, zero to skip the check.
+	CAS uint64
+}
+
+// VerdictRequest represents an analyst verdict request.
+type VerdictRequest struct {
+	Verdict    string `json:"verdict" validate:"required,oneof=malicious suspicious benign"`
+	Confidence int    `json:"confidence" validate:"min=0,max=100"`
+}
+
 // UpdateUserRequest represents a File update request.
 type UpdateFileRequest struct {
 	MD5         string                 `json:"md5,omitempty"`
@@ -132,9 +178,9 @@ type UpdateFileRequest struct {
 	Tags        map[string]interface{} `json:"tags,omitempty"`
 	TriD        []string               `json:"trid,omitempty"`
 	Packer      []string               `json:"packer,omitempty"`
-	Strings     []interface{}          `json:"strings,omitempty"`
+	Strings     *entity.Strings        `json:"strings,omitempty"`
 	MultiAV     map[string]interface{} `json:"multiav,omitempty"`
-	PE          interface{}            `json:"pe,omitempty"`
+	PE          *entity.PE             `json:"pe,omitempty"`
 	Histogram   []int                  `json:"histogram,omitempty"`
 	ByteEntropy []int                  `json:"byte_entropy,omitempty"`
 	Ml          map[string]interface{} `json:"ml,omitempty"`
@@ -152,29 +198,58 @@ type service struct {
 	userSvc       user.Service
 	actSvc        activity.Service
 	archiver      Archiver
+	events        event.Publisher
+	hookSvc       webhook.Service
+	watchSvc      watch.Service
+	avSvc         multiav.Service
+	rescanSvc     rescan.Service
+	sandboxSvc    sandbox.Service
+	iocSvc        ioc.Service
+	// Topics scan requests are routed to, by priority. Priorities without
+	// a topic use the default one.
+	priorityTopics map[string]string
 }
 
 // NewService creates a new File service.
 func NewService(repo Repository, logger log.Logger,
 	updown UploadDownloader, producer Producer, topic, bucket, samplesZipPwd string,
-	userSvc user.Service, actSvc activity.Service, arch Archiver) Service {
+	userSvc user.Service, actSvc activity.Service, arch Archiver,
+	events event.Publisher, hookSvc webhook.Service,
+	watchSvc watch.Service, avSvc multiav.Service, rescanSvc rescan.Service,
+	sandboxSvc sandbox.Service, iocSvc ioc.Service,
+	priorityTopics map[string]string) Service {
 	return service{repo, logger, updown, producer, topic, bucket, samplesZipPwd,
-		userSvc, actSvc, arch}
+		userSvc, actSvc, arch, events, hookSvc, watchSvc, avSvc, rescanSvc,
+		sandboxSvc, iocSvc, priorityTopics}
 }
 
 // Get returns the File with the specified File ID.
 func (s service) Get(ctx context.Context, id string, fields []string) (File, error) {
-	file, err := s.repo.Get(ctx, id, fields)
+	file, cas, err := s.repo.Get(ctx, id, fields)
 	if err != nil {
 		return File{}, err
 	}
-	return File{file}, nil
+	return File{File: file, CAS: cas}, nil
 }
 
 // Create creates a new File.
 func (s service) Create(ctx context.Context, req CreateFileRequest) (
 	File, error) {
 
+	scanCfg, err := s.resolveScanCfg(ctx, req.scanCfg)
+	if err != nil {
+		return File{}, err
+	}
+	req.scanCfg = scanCfg
+
+	// Only high priority scans are restricted by the rescan policy, the
+	// other priorities do not take precedence over anyone's scans.
+	if req.scanCfg.Priority == rescan.PriorityHigh {
+		if _, err = s.rescanSvc.Authorize(ctx, req.scanCfg.Priority); err != nil {
+			return File{}, err
+		}
+	}
+
 	fileContent, err := io.ReadAll(req.src)
 	if err != nil {
 		s.logger.With(ctx).Error(err)
@@ -192,55 +267,9 @@ func (s service) Create(ctx context.Context, req CreateFileRequest) (
 	// When a new file has been uploaded, we create a new doc in the db.
 	if err != nil && err.Error() == ErrDocumentNotFound {
 
-		go func() {
-			existsCtx, cancelExistsFn := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancelExistsFn()
-
-			if ok, _ := s.objSto.Exists(existsCtx, s.bucket, sha256); ok {
-				return
-			}
-
-			var err error
-
-			for attempt := 0; attempt < 3; attempt++ {
-				// Create a context with a timeout that will abort the upload if it takes
-				// more than the passed in timeout.
-				uploadCtx, cancelUploadFn := context.WithTimeout(context.Background(), fileUploadTimeout)
-
-				// Ensure the context is canceled to prevent leaking.
-				defer cancelUploadFn()
-
-				err = s.objSto.Upload(uploadCtx, s.bucket, sha256, bytes.NewReader(fileContent))
-				if err == nil {
-					break
-				}
-				s.logger.With(uploadCtx).Error(err)
-
-				// Give time to the system to recover
-				time.Sleep(10 * time.Second)
-			}
-
-			// Check if the upload failed.
-			if err != nil {
-				s.logger.Error(err)
-				return
-			}
-
-			// Serialize the msg to send to the orchestrator.
-			msg, err := json.Marshal(FileScanCfg{SHA256: sha256, FileScanRequest: req.scanCfg})
-			if err != nil {
-				s.logger.Error(err)
-				return
-			}
-
-			// Push a message to the queue to scan this file.
-			err = s.producer.Produce(s.topic, msg)
-			if err != nil {
-				s.logger.Error(err)
-				return
-			}
-
-		}()
+		// The message is created before the upload to keep track of who
+		// submitted the file.
+		scanRequest := newScanRequest(ctx, sha256, req.scanCfg, now)
 
 		// Get the source of the HTTP request from the ctx.
 		source, _ := ctx.Value(entity.SourceKey).(string)
@@ -260,12 +289,19 @@ func (s service) Create(ctx context.Context, req CreateFileRequest) (
 			FirstSeen:   now,
 			Submissions: append(file.Submissions, submission),
 			Status:      queued,
+			ScanProgress: startUpload(
+				newScanProgress(req.scanCfg.SkipDetonation), now),
+			ScanRequestedAt: now,
 		})
 		if err != nil {
 			s.logger.With(ctx).Error(err)
 			return File{}, err
 		}
 
+		// The upload reports its progress to the file document, so it
+		// starts once the document exists.
+		go s.upload(sha256, fileContent, scanRequest)
+
 		loggedInUser, _ := ctx.Value(entity.UserKey).(entity.User)
 		user, err := s.userSvc.Get(ctx, loggedInUser.ID())
 		if err != nil {
@@ -283,7 +319,7 @@ func (s service) Create(ctx context.Context, req CreateFileRequest) (
 		}
 
 		// Update submissions count on user object.
-		err = s.Patch(ctx, user.ID(), "submissions_count", user.SubmissionsCount+1)
+		err = s.userSvc.Increment(ctx, user.ID(), "submissions_count", 1)
 		if err != nil {
 			return File{}, err
 		}
@@ -301,26 +337,75 @@ func (s service) Create(ctx context.Context, req CreateFileRequest) (
 func (s service) Update(ctx context.Context, id string, req UpdateFileRequest) (
 	File, error) {
 
-	file, err := s.Get(ctx, id, nil)
+	var file File
+	var prevDetections int
+	data, err := json.Marshal(req)
 	if err != nil {
 		return file, err
 	}
 
-	// merge the structures.
-	data, err := json.Marshal(req)
-	if err != nil {
-		return file, err
+	// merge applies the update to the file as it is in the database.
+	var scan entity.AVScan
+	lastScan, scanned := req.MultiAV["last_scan"]
+	merge := func(f *entity.File) error {
+		prevDetections = detections(f.MultiAV)
+		if err := json.Unmarshal(data, f); err != nil {
+			return err
+		}
+		if scanned {
+			// Classify the file out of the detection names of its
+			// latest scan.
+			f.Classification = scan.Classification
+		}
+		return nil
 	}
-	err = json.Unmarshal(data, &file)
+
+	if scanned {
+		// Keep the results of every scan, `multiav.last_scan` only holds
+		// the latest ones. The history entry is saved along the file.
+		scan, err = multiav.NewScan(id, lastScan)
+		if err != nil {
+			return file, err
+		}
+		err = s.repo.UpdateWithScan(ctx, id, scan, merge)
+		if err != nil {
+			return file, err
+		}
+	} else {
+		// The file is replaced only if it was not modified since it was
+		// read, otherwise the update is retried.
+		err = dbcontext.RetryOnCASMismatch(ctx, func() error {
+			file, err = s.Get(ctx, id, nil)
+			if err != nil {
+				return err
+			}
+			if err = merge(&file.File); err != nil {
+				return err
+			}
+			return s.repo.Update(ctx, id, file.File, file.CAS)
+		})
+		if err != nil {
+			return file, err
+		}
+	}
+
+	file, err = s.Get(ctx, id, nil)
 	if err != nil {
 		return file, err
 	}
 
-	// check if File.Username == id
-	if err := s.repo.Update(ctx, id, file.File); err != nil {
-		return file, err
+	if req.MultiAV != nil {
+		s.publish(ctx, event.New(event.FileMultiAV, id, "", req.MultiAV))
+		if n := detections(file.MultiAV); n > prevDetections {
+			s.watchSvc.Notify(ctx, watch.Notice{
+				Kind:    watch.KindDetection,
+				SHA256:  id,
+				Message: fmt.Sprintf("%d engines now detect the file", n),
+			})
+		}
 	}
 
+	s.index(ctx, file.File)
 	return file, nil
 }
 
@@ -356,7 +441,7 @@ func (s service) Query(ctx context.Context, offset, limit int, fields []string)
 	}
 	result := []File{}
 	for _, item := range items {
-		result = append(result, File{item})
+		result = append(result, File{File: item})
 	}
 	return result, nil
 }
@@ -367,6 +452,71 @@ func (s service) Patch(ctx context.Context, id, path string,
 	return s.repo.Patch(ctx, id, path, input)
 }
 
+// Increment atomically adds delta to a file counter like `comments_count`.
+func (s service) Increment(ctx context.Context, id, path string,
+	delta int64) error {
+	return s.repo.Increment(ctx, id, path, delta)
+}
+
+// ApplyPatch performs a partial file update described by a JSON Patch or a
+// JSON Merge Patch document. The patch is translated into a set of sub
+// document mutations which are applied atomically.
+func (s service) ApplyPatch(ctx context.Context, id string,
+	req PatchFileRequest) (File, error) {
+
+	// The mutations are computed against the document as it was read, a
+	// concurrent write makes the CAS check fail and the patch is re-applied
+	// to the latest version, unless the client asked for a given version.
+	err := dbcontext.RetryOnCASMismatch(ctx, func() error {
+		doc, cas, err := s.repo.Document(ctx, id)
+		if err != nil {
+			return err
+		}
+		if req.CAS != 0 && req.CAS != cas {
+			return e.PreconditionFailed("")
+		}
+
+		var ops []dbcontext.MutateOp
+		switch req.ContentType {
+		case JSONPatchContentType:
+			ops, err = jsonPatchOps(doc, req.Body)
+		case MergePatchContentType:
+			ops, err = mergePatchOps(doc, req.Body)
+		default:
+			err = e.UnsupportedMediaType("")
+		}
+		if err != nil {
+			return err
+		}
+
+		// An empty list of mutations happens when the patch only holds
+		// `test` operations.
+		if len(ops) == 0 {
+			return nil
+		}
+		_, err = s.repo.MutateIn(ctx, id, ops, cas)
+		return err
+	})
+	if err != nil {
+		return File{}, err
+	}
+
+	file, err := s.Get(ctx, id, nil)
+	if err != nil {
+		return File{}, err
+	}
+	s.index(ctx, file.File)
+	return file, nil
+}
+
+// index refreshes the IOC lookup documents of a file. Indexing is best
+// effort, errors are only logged.
+func (s service) index(ctx context.Context, file entity.File) {
+	if err := s.iocSvc.IndexFile(ctx, file); err != nil {
+		s.logger.With(ctx).Error(err)
+	}
+}
+
 // Summary returns a summary of a file scan.
 func (s service) Summary(ctx context.Context, id string) (interface{}, error) {
 	res, err := s.repo.Summary(ctx, id)
@@ -388,14 +538,12 @@ func (s service) Like(ctx context.Context, sha256 string) error {
 	// Get the source of the HTTP request from the ctx.
 	source, _ := ctx.Value(entity.SourceKey).(string)
 
-	if !isStringInSlice(sha256, user.Likes) {
-		user.Likes = append(user.Likes, sha256)
-		user.LikesCount += 1
-		user, err = s.userSvc.Update(ctx, user.ID(), user)
-		if err != nil {
-			return err
-		}
+	liked, err := s.userSvc.AddLike(ctx, user.ID(), sha256)
+	if err != nil {
+		return err
+	}
 
+	if liked {
 		// add new `like` activity.
 		if _, err = s.actSvc.Create(ctx, activity.CreateActivityRequest{
 			Kind:     "like",
@@ -418,14 +566,12 @@ func (s service) Unlike(ctx context.Context, sha256 string) error {
 		return err
 	}
 
-	if isStringInSlice(sha256, user.Likes) {
-		user.Likes = removeStringFromSlice(user.Likes, sha256)
-		user.LikesCount -= 1
-		user, err = s.userSvc.Update(ctx, user.ID(), user)
-		if err != nil {
-			return err
-		}
+	unliked, err := s.userSvc.RemoveLike(ctx, user.ID(), sha256)
+	if err != nil {
+		return err
+	}
 
+	if unliked {
 		// delete corresponding activity.
 		if err = s.actSvc.DeleteWith(ctx, "like", user.ID(),
 			sha256); err != nil {
@@ -436,25 +582,384 @@ func (s service) Unlike(ctx context.Context, sha256 string) error {
 	return nil
 }
 
+// Rescan queues a new scan of an existing file on behalf of the logged-in
+// user, provided the rescan policy allows it.
 func (s service) Rescan(ctx context.Context, sha256 string, input FileScanRequest) error {
 
-	// Serialize the msg to send to the orchestrator.
-	msg, err := json.Marshal(FileScanCfg{SHA256: sha256, FileScanRequest: input})
+	if input.Priority == "" {
+		input.Priority = rescan.PriorityNormal
+	}
+	input, err := s.resolveScanCfg(ctx, input)
+	if err != nil {
+		return err
+	}
+	policy, err := s.rescanSvc.Authorize(ctx, input.Priority)
+	if err != nil {
+		return err
+	}
+
+	// Refuse to rescan a file whose scan is still pending, unless it has
+	// been pending for too long.
+	now := time.Now().Unix()
+	file, _, err := s.repo.Progress(ctx, sha256)
+	if err != nil {
+		return err
+	}
+	if scanPending(file, policy.PendingTimeout, now) {
+		return ErrScanPending
+	}
+	if err = s.rescanSvc.Consume(ctx, policy); err != nil {
+		return err
+	}
+
+	err = s.enqueue(ctx, sha256, input, policy.PendingTimeout, now)
+	if err != nil {
+		// The file was not rescanned, give the rescan back.
+		if err := s.rescanSvc.Release(ctx, policy); err != nil {
+			s.logger.With(ctx).Error(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// Enqueue queues a new scan of an existing file on behalf of the system. It
+// bypasses the rescan policy but still refuses to rescan a file whose scan
+// is pending.
+func (s service) Enqueue(ctx context.Context, sha256 string,
+	input FileScanRequest) error {
+
+	if input.Priority == "" {
+		input.Priority = rescan.PriorityNormal
+	}
+	input, err := s.resolveScanCfg(ctx, input)
+	if err != nil {
+		return err
+	}
+	policy, err := s.rescanSvc.Policy(ctx)
+	if err != nil {
+		return err
+	}
+	return s.enqueue(ctx, sha256, input, policy.PendingTimeout,
+		time.Now().Unix())
+}
+
+// enqueue resets the scan progress of a file and publishes a scan request.
+func (s service) enqueue(ctx context.Context, sha256 string,
+	input FileScanRequest, pendingTimeout, now int64) error {
+
+	// The pending check is done under CAS to guard against concurrent
+	// rescans.
+	var prev entity.File
+	var cas uint64
+	err := dbcontext.RetryOnCASMismatch(ctx, func() error {
+		var err error
+		prev, cas, err = s.repo.Progress(ctx, sha256)
+		if err != nil {
+			return err
+		}
+		if scanPending(prev, pendingTimeout, now) {
+			return ErrScanPending
+		}
+
+		// Reset the progress of the scan stages, the file is already
+		// uploaded.
+		progress := newScanProgress(input.SkipDetonation)
+		ops := []dbcontext.MutateOp{
+			{Kind: dbcontext.MutateUpsert, Path: "status", Value: queued},
+			{Kind: dbcontext.MutateUpsert, Path: "scan_requested_at", Value: now},
+		}
+		for _, stage := range scanStages {
+			if stage == StageUpload {
+				continue
+			}
+			ops = append(ops, dbcontext.MutateOp{Kind: dbcontext.MutateUpsert,
+				Path: "scan_progress." + stage, Value: progress[stage]})
+		}
+		cas, err = s.repo.MutateIn(ctx, sha256, ops, cas)
+		return err
+	})
 	if err != nil {
-		s.logger.With(ctx).Error(err)
 		return err
 	}
 
-	// Push a message to the queue to scan this file.
-	err = s.producer.Produce(s.topic, msg)
+	// Serialize the msg to send to the orchestrator and push it to the
+	// queue to scan this file.
+	msg, err := newScanRequest(ctx, sha256, input, now).encode(
+		time.Now().Unix())
+	if err == nil {
+		err = s.producer.Produce(s.topicFor(input.Priority), msg)
+	}
 	if err != nil {
 		s.logger.With(ctx).Error(err)
+		s.restoreProgress(ctx, sha256, prev, cas)
 		return err
 	}
 
 	return nil
 }
 
+// restoreProgress puts back the scan progress of a file as it was before a
+// scan that could not be queued, unless the file changed in the meantime.
+func (s service) restoreProgress(ctx context.Context, sha256 string,
+	prev entity.File, cas uint64) {
+
+	ops := []dbcontext.MutateOp{
+		{Kind: dbcontext.MutateUpsert, Path: "status", Value: prev.Status},
+		{Kind: dbcontext.MutateUpsert, Path: "scan_requested_at",
+			Value: prev.ScanRequestedAt},
+		{Kind: dbcontext.MutateUpsert, Path: "scan_progress",
+			Value: prev.ScanProgress},
+	}
+	if _, err := s.repo.MutateIn(ctx, sha256, ops, cas); err != nil {
+		s.logger.With(ctx).Error(err)
+	}
+}
+
+// resolveScanCfg fills the defaults of the detonation config and checks it
+// against the sandbox options available to the logged-in user.
+func (s service) resolveScanCfg(ctx context.Context, req FileScanRequest) (
+	FileScanRequest, error) {
+
+	if req.SkipDetonation {
+		return req, nil
+	}
+	resolved, err := s.sandboxSvc.Resolve(ctx, sandbox.Request{
+		OS:      req.OS,
+		Country: req.Country,
+		Timeout: req.Timeout,
+	})
+	if err != nil {
+		return FileScanRequest{}, err
+	}
+	req.OS = resolved.OS
+	req.Country = resolved.Country
+	req.Timeout = resolved.Timeout
+	return req, nil
+}
+
+// topicFor returns the topic scan requests of a given priority are routed
+// to.
+func (s service) topicFor(priority string) string {
+	if topic, ok := s.priorityTopics[priority]; ok && topic != "" {
+		return topic
+	}
+	return s.topic
+}
+
+// upload stores a new file in the object storage, unless it is already
+// there, then asks the orchestrator to scan it.
+func (s service) upload(sha256 string, content []byte,
+	scanRequest ScanRequestMessage) {
+
+	existsCtx, cancelExistsFn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelExistsFn()
+
+	// The file may be stored already, i.e: when its document was
+	// deleted, it is then scanned right away.
+	var err error
+	if ok, _ := s.objSto.Exists(existsCtx, s.bucket, sha256); !ok {
+		err = s.uploadWithRetries(sha256, content)
+	}
+
+	// Check if the upload failed.
+	if err != nil {
+		s.logger.Error(err)
+		s.reportUpload(sha256, StateFailed, err)
+		return
+	}
+
+	// Serialize the msg to send to the orchestrator.
+	msg, err := scanRequest.encode(time.Now().Unix())
+	if err != nil {
+		s.logger.Error(err)
+		s.reportUpload(sha256, StateFailed, err)
+		return
+	}
+
+	// Push a message to the queue of its priority to scan this file.
+	err = s.producer.Produce(s.topicFor(scanRequest.Priority), msg)
+	if err != nil {
+		s.logger.Error(err)
+		s.reportUpload(sha256, StateFailed, err)
+		return
+	}
+
+	s.reportUpload(sha256, StateCompleted, nil)
+}
+
+// uploadWithRetries uploads a file to the object storage, it is attempted
+// a few times before giving up.
+func (s service) uploadWithRetries(sha256 string, content []byte) error {
+	const attempts = 3
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		// Create a context with a timeout that will abort the upload if it takes
+		// more than the passed in timeout.
+		uploadCtx, cancelUploadFn := context.WithTimeout(context.Background(), fileUploadTimeout)
+
+		err = s.objSto.Upload(uploadCtx, s.bucket, sha256, bytes.NewReader(content))
+		if err != nil {
+			s.logger.With(uploadCtx).Error(err)
+		}
+
+		// Cancel the context of this attempt to prevent leaking it.
+		cancelUploadFn()
+		if err == nil || attempt == attempts {
+			break
+		}
+
+		// Give time to the system to recover
+		time.Sleep(10 * time.Second)
+	}
+	return err
+}
+
+// indexBehavior indexes the IOCs of the last behavior scan of a file. A scan
+// holds up to thousands of them, so it runs in the background and errors
+// are only logged.
+func (s service) indexBehavior(sha256 string) {
+	ctx, cancel := context.WithTimeout(context.Background(),
+		indexBehaviorTimeout)
+	defer cancel()
+	if err := s.iocSvc.IndexBehavior(ctx, sha256); err != nil {
+		s.logger.Error(err)
+	}
+}
+
+// reportUpload records the outcome of the upload of a newly submitted file.
+// It runs in the background, errors are only logged.
+func (s service) reportUpload(sha256, state string, uploadErr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req := StageTransitionRequest{Stage: StageUpload, Status: state}
+	if uploadErr != nil {
+		req.Error = uploadErr.Error()
+	}
+	if _, err := s.UpdateScanStatus(ctx, sha256, req); err != nil {
+		s.logger.Error(err)
+	}
+}
+
+// ScanStatus returns the progress of the scan of a file.
+func (s service) ScanStatus(ctx context.Context, id string) (ScanStatus, error) {
+	file, _, err := s.repo.Progress(ctx, id)
+	if err != nil {
+		return ScanStatus{}, err
+	}
+	return newScanStatus(file), nil
+}
+
+// UpdateScanStatus records a stage transition reported by the orchestrator
+// workers and recomputes the overall status of the file.
+func (s service) UpdateScanStatus(ctx context.Context, id string,
+	input StageTransitionRequest) (ScanStatus, error) {
+
+	ts := input.Timestamp
+	if ts == 0 {
+		ts = time.Now().Unix()
+	}
+
+	var file entity.File
+	var prevStatus int
+	var prevStage string
+	err := dbcontext.RetryOnCASMismatch(ctx, func() error {
+		var cas uint64
+		var err error
+		file, cas, err = s.repo.Progress(ctx, id)
+		if err != nil {
+			return err
+		}
+		prevStatus = file.Status
+		prevStage = file.ScanProgress[input.Stage].Status
+
+		if file.ScanProgress == nil {
+			file.ScanProgress = make(map[string]entity.ScanStage)
+		}
+		if err = applyTransition(file.ScanProgress, input, ts); err != nil {
+			return err
+		}
+		file.Status = overallStatus(file.ScanProgress)
+
+		ops := []dbcontext.MutateOp{
+			{Kind: dbcontext.MutateUpsert, Path: "scan_progress." + input.Stage,
+				Value: file.ScanProgress[input.Stage]},
+			{Kind: dbcontext.MutateUpsert, Path: "status", Value: file.Status},
+		}
+		if input.Stage != StageUpload && file.Status == finished {
+			ops = append(ops, dbcontext.MutateOp{
+				Kind: dbcontext.MutateUpsert, Path: "last_scanned", Value: ts})
+		}
+		_, err = s.repo.MutateIn(ctx, id, ops, cas)
+		return err
+	})
+	if err != nil {
+		return ScanStatus{}, err
+	}
+
+	status := newScanStatus(file)
+	s.publish(ctx, event.New(event.FileStatus, id, "", status))
+
+	// Notify the webhooks on the first transition to a final state.
+	data := map[string]interface{}{"sha256": id, "scan": status}
+	if file.Status == finished && prevStatus != finished {
+		s.hookSvc.Trigger(ctx, webhook.Event{Name: webhook.FileScanned,
+			SHA256: id, Data: data})
+	}
+	if input.Stage == StageSandbox && input.Engine == "" &&
+		input.Status == StateCompleted && prevStage != StateCompleted {
+		s.hookSvc.Trigger(ctx, webhook.Event{
+			Name: webhook.BehaviorCompleted, SHA256: id, Data: data})
+		go s.indexBehavior(id)
+		s.watchSvc.Notify(ctx, watch.Notice{
+			Kind:    watch.KindBehavior,
+			SHA256:  id,
+			Message: "The sandbox analysis of the file completed.",
+		})
+	}
+	return status, nil
+}
+
+// publish notifies the subscribers of a file event. Notifications are best
+// effort, errors are only logged.
+func (s service) publish(ctx context.Context, ev event.Event) {
+	if err := s.events.Publish(ctx, ev); err != nil {
+		s.logger.With(ctx).Error(err)
+	}
+}
+
+// SetVerdict records the verdict of the logged-in user about a file. Each
+// user has at most one verdict per file, a new one replaces the previous.
+func (s service) SetVerdict(ctx context.Context, sha256 string,
+	input VerdictRequest) (entity.Verdict, error) {
+
+	user, _ := ctx.Value(entity.UserKey).(entity.User)
+	verdict := entity.Verdict{
+		Verdict:    input.Verdict,
+		Confidence: input.Confidence,
+		Username:   user.ID(),
+		Timestamp:  time.Now().Unix(),
+	}
+	err := s.repo.Patch(ctx, sha256, "verdicts."+user.ID(), verdict)
+	if err != nil {
+		return entity.Verdict{}, err
+	}
+	return verdict, nil
+}
+
+// DeleteVerdict removes the verdict of the logged-in user about a file.
+func (s service) DeleteVerdict(ctx context.Context, sha256 string) error {
+	user, _ := ctx.Value(entity.UserKey).(entity.User)
+	_, err := s.repo.MutateIn(ctx, sha256, []dbcontext.MutateOp{
+		{Kind: dbcontext.MutateRemove, Path: "verdicts." + user.ID()},
+	}, 0)
+	if errors.Is(err, dbcontext.ErrSubDocNotFound) {
+		return e.NotFound("")
+	}
+	return err
+}
+
 func (s service) Download(ctx context.Context, sha256 string, zipFile *string) error {
 
 	// Create a context with a timeout that will abort the download if it takes
@@ -517,6 +1022,43 @@ func (s service) Strings(ctx context.Context, id string, offset, limit int) (
 	return result, nil
 }
 
+// FilterStrings returns the strings of a file matching a filter, they are
+// classified at query time so that the categories follow the classifier.
+func (s service) FilterStrings(ctx context.Context, id string,
+	filter StringsFilter) ([]String, error) {
+
+	m, err := filter.matcher()
+	if err != nil {
+		return nil, err
+	}
+	strs, err := s.repo.AllStrings(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return m.filter(strs), nil
+}
+
+// StringFiles returns the files containing exactly a string.
+func (s service) StringFiles(ctx context.Context, value, encoding string,
+	offset, limit int) ([]interface{}, error) {
+
+	encoding, err := checkSearchString(value, encoding)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.StringFiles(ctx, value, encoding, offset, limit)
+}
+
+func (s service) CountStringFiles(ctx context.Context, value,
+	encoding string) (int, error) {
+
+	encoding, err := checkSearchString(value, encoding)
+	if err != nil {
+		return 0, err
+	}
+	return s.repo.CountStringFiles(ctx, value, encoding)
+}
+
 func (s service) GeneratePresignedURL(ctx context.Context, id string) (string, error) {
 
 	found, err := s.objSto.Exists(ctx, s.bucket, id)
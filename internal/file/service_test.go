@@ -0,0 +1,282 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/saferwall/saferwall-api/internal/event"
+	"github.com/saferwall/saferwall-api/internal/ioc"
+	"github.com/saferwall/saferwall-api/internal/rescan"
+	"github.com/saferwall/saferwall-api/internal/watch"
+	"github.com/saferwall/saferwall-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockRepository keeps a single file document.
+type mockRepository struct {
+	Repository
+	file  *entity.File
+	scans map[string]entity.AVScan
+}
+
+func (m mockRepository) Progress(ctx context.Context, id string) (
+	entity.File, uint64, error) {
+	file := *m.file
+	file.ScanProgress = make(map[string]entity.ScanStage)
+	for stage, progress := range m.file.ScanProgress {
+		file.ScanProgress[stage] = progress
+	}
+	return file, 1, nil
+}
+
+func (m mockRepository) MutateIn(ctx context.Context, key string,
+	ops []dbcontext.MutateOp, cas uint64) (uint64, error) {
+	for _, op := range ops {
+		switch {
+		case op.Path == "status":
+			m.file.Status = op.Value.(int)
+		case op.Path == "scan_requested_at":
+			m.file.ScanRequestedAt = op.Value.(int64)
+		case op.Path == "scan_progress":
+			m.file.ScanProgress = op.Value.(map[string]entity.ScanStage)
+		case strings.HasPrefix(op.Path, "scan_progress."):
+			stage := strings.TrimPrefix(op.Path, "scan_progress.")
+			m.file.ScanProgress[stage] = op.Value.(entity.ScanStage)
+		}
+	}
+	return cas + 1, nil
+}
+
+func (m mockRepository) Get(ctx context.Context, id string, fields []string) (
+	entity.File, uint64, error) {
+	return *m.file, 1, nil
+}
+
+func (m mockRepository) UpdateWithScan(ctx context.Context, key string,
+	scan entity.AVScan, merge func(file *entity.File) error) error {
+	file := *m.file
+	if err := merge(&file); err != nil {
+		return err
+	}
+	*m.file = file
+	m.scans[scan.ID] = scan
+	return nil
+}
+
+// mockStorage records the uploaded objects.
+type mockStorage struct {
+	UploadDownloader
+	objects map[string]bool
+}
+
+func (m mockStorage) Exists(ctx context.Context, bucket, key string) (
+	bool, error) {
+	return m.objects[key], nil
+}
+
+func (m mockStorage) Upload(ctx context.Context, bucket, key string,
+	file io.Reader) error {
+	m.objects[key] = true
+	return nil
+}
+
+// mockProducer records the produced messages and their topics, or fails
+// with err.
+type mockProducer struct {
+	msgs   *[][]byte
+	topics *[]string
+	err    error
+}
+
+func (m mockProducer) Produce(topic string, msg []byte) error {
+	if m.err != nil {
+		return m.err
+	}
+	*m.msgs = append(*m.msgs, msg)
+	if m.topics != nil {
+		*m.topics = append(*m.topics, topic)
+	}
+	return nil
+}
+
+// mockRescan keeps the number of rescans counted against the quota.
+type mockRescan struct {
+	rescan.Service
+	count *int
+}
+
+func (m mockRescan) Authorize(ctx context.Context, priority string) (
+	entity.RescanPolicy, error) {
+	return rescan.DefaultPolicy, nil
+}
+
+func (m mockRescan) Consume(ctx context.Context,
+	policy entity.RescanPolicy) error {
+	*m.count++
+	return nil
+}
+
+func (m mockRescan) Release(ctx context.Context,
+	policy entity.RescanPolicy) error {
+	*m.count--
+	return nil
+}
+
+func TestUpload(t *testing.T) {
+	for _, stored := range []bool{false, true} {
+		file := &entity.File{SHA256: testSHA256,
+			ScanProgress: startUpload(newScanProgress(false), 1)}
+		objects := map[string]bool{testSHA256: stored}
+		var msgs [][]byte
+		var topics []string
+		s := service{
+			repo:     mockRepository{file: file},
+			logger:   log.New(),
+			objSto:   mockStorage{objects: objects},
+			producer: mockProducer{msgs: &msgs, topics: &topics},
+			events:   event.NewMemoryBroker(),
+			topic:    "scan",
+			priorityTopics: map[string]string{
+				rescan.PriorityHigh: "scan-high"},
+		}
+
+		// The scan request is routed by its priority.
+		s.upload(testSHA256, []byte("MZ"), newScanRequest(
+			context.Background(), testSHA256,
+			FileScanRequest{Priority: rescan.PriorityHigh}, 1))
+		assert.True(t, objects[testSHA256])
+		assert.Len(t, msgs, 1)
+		assert.Equal(t, []string{"scan-high"}, topics)
+		assert.Equal(t, StateCompleted, file.ScanProgress[StageUpload].Status)
+	}
+}
+
+func TestRescan(t *testing.T) {
+	progress := newScanProgress(false)
+	for stage := range progress {
+		progress[stage] = entity.ScanStage{Status: StateCompleted}
+	}
+	file := &entity.File{SHA256: testSHA256, Status: finished,
+		ScanProgress: progress, ScanRequestedAt: 1}
+	var msgs [][]byte
+	count := 0
+	s := service{
+		repo:      mockRepository{file: file},
+		logger:    log.New(),
+		producer:  mockProducer{msgs: &msgs, err: errors.New("unavailable")},
+		rescanSvc: mockRescan{count: &count},
+	}
+
+	// The file and the quota are left as they were when the scan request
+	// could not be queued.
+	err := s.Rescan(context.Background(), testSHA256,
+		FileScanRequest{SkipDetonation: true})
+	assert.NotNil(t, err)
+	assert.Zero(t, count)
+	assert.Equal(t, finished, file.Status)
+	assert.Equal(t, int64(1), file.ScanRequestedAt)
+	for stage := range progress {
+		assert.Equal(t, StateCompleted, file.ScanProgress[stage].Status)
+	}
+
+	s.producer = mockProducer{msgs: &msgs}
+	err = s.Rescan(context.Background(), testSHA256,
+		FileScanRequest{SkipDetonation: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, queued, file.Status)
+	assert.Len(t, msgs, 1)
+}
+
+// mockWatcher records the notices.
+type mockWatcher struct {
+	watch.Service
+	notices *[]watch.Notice
+}
+
+func (m mockWatcher) Notify(ctx context.Context, notice watch.Notice) {
+	*m.notices = append(*m.notices, notice)
+}
+
+// mockIndexer indexes nothing.
+type mockIndexer struct {
+	ioc.Service
+}
+
+func (m mockIndexer) IndexFile(ctx context.Context, file entity.File) error {
+	return nil
+}
+
+func TestUpdateMultiAV(t *testing.T) {
+	file := &entity.File{SHA256: testSHA256}
+	scans := make(map[string]entity.AVScan)
+	var notices []watch.Notice
+	s := service{
+		repo:     mockRepository{file: file, scans: scans},
+		logger:   log.New(),
+		events:   event.NewMemoryBroker(),
+		watchSvc: mockWatcher{notices: &notices},
+		iocSvc:   mockIndexer{},
+	}
+
+	// The request is decoded from JSON, as by the handler.
+	var req UpdateFileRequest
+	err := json.Unmarshal([]byte(`{"multiav": {"last_scan": {
+		"avast": {"infected": true, "output": "Win32:Emotet-A [Trj]"},
+		"eset": {"infected": true, "output": "Win32/Emotet.A"},
+		"sophos": {"infected": false, "output": ""}}}}`), &req)
+	assert.Nil(t, err)
+
+	updated, err := s.Update(context.Background(), testSHA256, req)
+	assert.Nil(t, err)
+	if assert.NotNil(t, updated.Classification) {
+		assert.Equal(t, "emotet", updated.Classification.Family)
+		assert.Equal(t, 2, updated.Classification.Engines)
+	}
+	assert.Equal(t, updated.Classification, file.Classification)
+	assert.Len(t, scans, 1)
+	for _, scan := range scans {
+		assert.Len(t, scan.Results, 3)
+		assert.Equal(t, file.Classification, scan.Classification)
+	}
+	assert.Len(t, notices, 1)
+}
+
+func TestFileScanRequestValidation(t *testing.T) {
+	validate := validator.New()
+
+	assert.Nil(t, validate.Struct(FileScanRequest{}))
+	assert.Nil(t, validate.Struct(FileScanRequest{
+		DynFileScanCfg: DynFileScanCfg{
+			DestPath:  `C:\Users\Public\sample.exe`,
+			Arguments: "-silent",
+			Timeout:   60,
+			Country:   "fr",
+			OS:        "win-10",
+		},
+	}))
+
+	invalid := []DynFileScanCfg{
+		{DestPath: `C:\sample|calc.exe`},
+		{DestPath: `C:\<sample>.exe`},
+		{Timeout: -1},
+		{Country: "FR"},
+		{Country: "fra"},
+		{OS: "win 10 ☃"},
+	}
+	for _, cfg := range invalid {
+		err := validate.Struct(FileScanRequest{DynFileScanCfg: cfg})
+		assert.NotNil(t, err, "%+v", cfg)
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package file
+
+import (
+	"github.com/saferwall/saferwall-api/internal/entity"
+	e "github.com/saferwall/saferwall-api/internal/errors"
+)
+
+// Stages of the scan pipeline.
+const (
+	StageUpload  = "upload"
+	StageStatic  = "static"
+	StageMultiAV = "multiav"
+	StageSandbox = "sandbox"
+)
+
+// States a scan stage goes through.
+const (
+	StateQueued    = "queued"
+	StateRunning   = "running"
+	StateCompleted = "completed"
+	StateFailed    = "failed"
+	StateSkipped   = "skipped"
+)
+
+var (
+	scanStages = []string{StageUpload, StageStatic, StageMultiAV, StageSandbox}
+
+	// stateTransitions lists the states reachable from a given state. A
+	// failed stage can be retried, completed and skipped ones are final
+	// until the file is rescanned.
+	stateTransitions = map[string][]string{
+		StateQueued:  {StateRunning, StateCompleted, StateFailed, StateSkipped},
+		StateRunning: {StateCompleted, StateFailed},
+		StateFailed:  {StateRunning},
+	}
+
+	// progressNames maps the file status to its display name.
+	progressNames = map[int]string{
+		queued:     "queued",
+		processing: "processing",
+		finished:   "finished",
+	}
+
+	errInvalidTransition = e.Conflict("invalid scan stage transition")
+	errEngineStage       = e.BadRequest("engine is only valid for the multiav stage")
+
+	// ErrScanPending is returned when rescanning a file whose scan did not
+	// finish yet.
+	ErrScanPending = e.Conflict("a scan of this file is already pending")
+)
+
+// ScanStatus represents the progress of a file scan.
+type ScanStatus struct {
+	// Overall status, one of: "queued", "processing", "finished".
+	Status string                      `json:"status"`
+	Stages map[string]entity.ScanStage `json:"stages"`
+}
+
+// StageTransitionRequest represents a scan stage transition reported by an
+// orchestrator worker.
+type StageTransitionRequest struct {
+	Stage  string `json:"stage" validate:"required,oneof=upload static multiav sandbox"`
+	Status string `json:"status" validate:"required,oneof=running completed failed skipped"`
+	// Engine reports the progress of a single AV engine of the multiav stage.
+	Engine string `json:"engine,omitempty" validate:"omitempty,alphanum,max=32"`
+	Error  string `json:"error,omitempty" validate:"max=512"`
+	// Unix time of the transition, defaults to the time it was received.
+	Timestamp int64 `json:"timestamp,omitempty" validate:"min=0"`
+}
+
+// newScanProgress returns the progress of a file freshly queued for scanning.
+func newScanProgress(skipDetonation bool) map[string]entity.ScanStage {
+	progress := make(map[string]entity.ScanStage, len(scanStages))
+	for _, stage := range scanStages {
+		progress[stage] = entity.ScanStage{Status: StateQueued}
+	}
+	if skipDetonation {
+		progress[StageSandbox] = entity.ScanStage{Status: StateSkipped}
+	}
+	return progress
+}
+
+// transition moves a stage to a new state and stamps it.
+func transition(cur entity.ScanStage, state, errMsg string,
+	ts int64) (entity.ScanStage, error) {
+
+	if cur.Status == "" {
+		cur.Status = StateQueued
+	}
+	if cur.Status == state {
+		// Workers may report the same transition more than once.
+		return cur, nil
+	}
+
+	allowed := false
+	for _, s := range stateTransitions[cur.Status] {
+		if s == state {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return cur, errInvalidTransition
+	}
+
+	switch state {
+	case StateRunning:
+		cur.StartedAt = ts
+		cur.FinishedAt = 0
+		cur.Error = ""
+	default:
+		if cur.StartedAt == 0 {
+			cur.StartedAt = ts
+		}
+		cur.FinishedAt = ts
+		cur.Error = errMsg
+	}
+	cur.Status = state
+	return cur, nil
+}
+
+// applyTransition applies a worker reported transition to the scan progress
+// of a file.
+func applyTransition(progress map[string]entity.ScanStage,
+	req StageTransitionRequest, ts int64) error {
+
+	stage := progress[req.Stage]
+	if req.Engine == "" {
+		next, err := transition(stage, req.Status, req.Error, ts)
+		if err != nil {
+			return err
+		}
+		progress[req.Stage] = next
+		return nil
+	}
+
+	if req.Stage != StageMultiAV {
+		return errEngineStage
+	}
+
+	engine, err := transition(stage.Engines[req.Engine], req.Status,
+		req.Error, ts)
+	if err != nil {
+		return err
+	}
+	if stage.Engines == nil {
+		stage.Engines = make(map[string]entity.ScanStage)
+	}
+	stage.Engines[req.Engine] = engine
+
+	// The first engine to start marks the whole stage as running.
+	if stage.Status == "" || stage.Status == StateQueued {
+		stage.Status = StateRunning
+		stage.StartedAt = ts
+	}
+	progress[req.Stage] = stage
+	return nil
+}
+
+// overallStatus computes the file status out of the progress of its stages.
+func overallStatus(progress map[string]entity.ScanStage) int {
+	started, done := false, true
+	for _, stage := range scanStages {
+		if stage == StageUpload {
+			continue
+		}
+		switch progress[stage].Status {
+		case StateSkipped:
+		case StateCompleted, StateFailed:
+			started = true
+		case StateRunning:
+			started, done = true, false
+		default:
+			done = false
+		}
+	}
+
+	switch {
+	case done:
+		return finished
+	case started:
+		return processing
+	default:
+		return queued
+	}
+}
+
+// newScanStatus builds the scan status out of a file.
+func newScanStatus(file entity.File) ScanStatus {
+	stages := file.ScanProgress
+	if stages == nil {
+		stages = map[string]entity.ScanStage{}
+	}
+	return ScanStatus{Status: progressNames[file.Status], Stages: stages}
+}
+
+// startUpload marks the upload stage as running.
+func startUpload(progress map[string]entity.ScanStage,
+	ts int64) map[string]entity.ScanStage {
+	progress[StageUpload] = entity.ScanStage{Status: StateRunning, StartedAt: ts}
+	return progress
+}
+
+// detections counts the engines which flagged the file in the last multiav
+// scan.
+func detections(multiav map[string]interface{}) int {
+	lastScan, _ := multiav["last_scan"].(map[string]interface{})
+	count := 0
+	for _, res := range lastScan {
+		if engine, ok := res.(map[string]interface{}); ok {
+			if infected, _ := engine["infected"].(bool); infected {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// scanPending returns true when the file is still being scanned. A scan
+// requested more than timeout seconds ago is considered stuck and no longer
+// pending.
+func scanPending(file entity.File, timeout, now int64) bool {
+	if file.Status == finished || file.ScanRequestedAt == 0 {
+		return false
+	}
+	return now-file.ScanRequestedAt < timeout
+}
@@ -0,0 +1,98 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package file
+
+import (
+	"testing"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyTransition(t *testing.T) {
+	progress := newScanProgress(false)
+
+	// The first engine to start marks the multiav stage as running.
+	err := applyTransition(progress, StageTransitionRequest{
+		Stage: StageMultiAV, Status: StateRunning, Engine: "avira"}, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, StateRunning, progress[StageMultiAV].Status)
+	assert.Equal(t, int64(10), progress[StageMultiAV].StartedAt)
+	assert.Equal(t, entity.ScanStage{Status: StateRunning, StartedAt: 10},
+		progress[StageMultiAV].Engines["avira"])
+	assert.Equal(t, processing, overallStatus(progress))
+
+	err = applyTransition(progress, StageTransitionRequest{
+		Stage: StageMultiAV, Status: StateCompleted}, 20)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(20), progress[StageMultiAV].FinishedAt)
+	assert.Len(t, progress[StageMultiAV].Engines, 1)
+
+	// Reporting the same transition twice is a no-op.
+	err = applyTransition(progress, StageTransitionRequest{
+		Stage: StageMultiAV, Status: StateCompleted}, 30)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(20), progress[StageMultiAV].FinishedAt)
+
+	err = applyTransition(progress, StageTransitionRequest{
+		Stage: StageMultiAV, Status: StateRunning}, 40)
+	assert.Equal(t, errInvalidTransition, err)
+
+	err = applyTransition(progress, StageTransitionRequest{
+		Stage: StageStatic, Status: StateRunning, Engine: "avira"}, 40)
+	assert.Equal(t, errEngineStage, err)
+
+	// A failed stage can be retried.
+	err = applyTransition(progress, StageTransitionRequest{
+		Stage: StageStatic, Status: StateFailed, Error: "timeout"}, 50)
+	assert.Nil(t, err)
+	err = applyTransition(progress, StageTransitionRequest{
+		Stage: StageStatic, Status: StateRunning}, 60)
+	assert.Nil(t, err)
+	assert.Equal(t, entity.ScanStage{Status: StateRunning, StartedAt: 60},
+		progress[StageStatic])
+
+	err = applyTransition(progress, StageTransitionRequest{
+		Stage: StageStatic, Status: StateCompleted}, 70)
+	assert.Nil(t, err)
+	err = applyTransition(progress, StageTransitionRequest{
+		Stage: StageSandbox, Status: StateSkipped}, 70)
+	assert.Nil(t, err)
+	assert.Equal(t, finished, overallStatus(progress))
+}
+
+func TestOverallStatus(t *testing.T) {
+	progress := startUpload(newScanProgress(true), 1)
+	assert.Equal(t, queued, overallStatus(progress))
+	assert.Equal(t, finished, overallStatus(map[string]entity.ScanStage{
+		StageStatic:  {Status: StateCompleted},
+		StageMultiAV: {Status: StateFailed},
+		StageSandbox: {Status: StateSkipped},
+	}))
+}
+
+func TestDetections(t *testing.T) {
+	assert.Equal(t, 0, detections(nil))
+	assert.Equal(t, 2, detections(map[string]interface{}{
+		"last_scan": map[string]interface{}{
+			"avira":     map[string]interface{}{"infected": true},
+			"eset":      map[string]interface{}{"infected": true},
+			"clamav":    map[string]interface{}{"infected": false},
+			"malformed": "n/a",
+		},
+	}))
+}
+
+func TestScanPending(t *testing.T) {
+	file := entity.File{Status: queued, ScanRequestedAt: 100}
+	assert.True(t, scanPending(file, 3600, 200))
+	assert.False(t, scanPending(file, 3600, 100+3600))
+
+	file.Status = finished
+	assert.False(t, scanPending(file, 3600, 200))
+
+	// Files submitted before scan requests were timestamped.
+	assert.False(t, scanPending(entity.File{Status: processing}, 3600, 200))
+}
@@ -0,0 +1,270 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package file
+
+import (
+	"encoding/base64"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+	e "github.com/saferwall/saferwall-api/internal/errors"
+)
+
+// String categories.
+const (
+	CategoryURL      = "url"
+	CategoryIP       = "ip"
+	CategoryPath     = "path"
+	CategoryRegistry = "registry"
+	CategoryBase64   = "base64"
+	CategoryCrypto   = "crypto"
+)
+
+const (
+	// Maximum length of the regular expression strings are filtered by.
+	maxStringsRegex = 256
+	// Maximum length of the string files are searched by.
+	maxSearchString = 1024
+	// Minimum length of a base64 blob.
+	minBase64Length = 16
+)
+
+var (
+	regURL = regexp.MustCompile(`(?i)\b(?:https?|ftps?)://[^\s"'<>]+`)
+	regIP  = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	// Windows drive, UNC and environment variable paths, and well known
+	// Unix directories.
+	regPath = regexp.MustCompile(`(?i)(?:\b[a-z]:\\|^\\\\[\w.$-]+\\|` +
+		`%[a-z_]+%\\|(?:^|\s)/(?:bin|boot|dev|etc|home|lib|opt|proc|root|` +
+		`sbin|tmp|usr|var)/)`)
+	regRegistry = regexp.MustCompile(`(?i)(?:\bHKEY_(?:LOCAL_MACHINE|` +
+		`CURRENT_USER|CLASSES_ROOT|USERS|CURRENT_CONFIG)\b|` +
+		`\bHK(?:LM|CU|CR|U|CC)\\|\\Registry\\(?:Machine|User)\\|` +
+		`^(?:Software|System)\\(?:Microsoft|Classes|Policies|Wow6432Node|` +
+		`CurrentControlSet)\\)`)
+	regBase64 = regexp.MustCompile(`^[A-Za-z0-9+/]+={0,2}$`)
+	// Windows cryptography APIs.
+	regCryptoAPI = regexp.MustCompile(`^[BN]?Crypt[A-Z][A-Za-z0-9]+$`)
+)
+
+// cryptoMarkers are lower cased strings found in the code or data of
+// cryptographic algorithms: alphabets, initial values, S-boxes and magic
+// constants.
+var cryptoMarkers = []string{
+	"abcdefghijklmnopqrstuvwxyz0123456789+/", // Base64 alphabet.
+	"abcdefghijklmnopqrstuvwxyz0123456789-_", // Base64 URL alphabet.
+	"67452301efcdab89",                       // MD5 and SHA-1 state.
+	"c3d2e1f0",                               // SHA-1 state.
+	"6a09e667",                               // SHA-256 and SHA-512 state.
+	"428a2f98",                               // SHA-256 round constants.
+	"637c777bf26b6fc5",                       // AES S-box.
+	"9e3779b9",                               // TEA and XTEA delta.
+	"edb88320",                               // CRC-32 polynomial.
+	"expand 32-byte k",                       // Salsa20 and ChaCha.
+	"expand 16-byte k",                       // Salsa20 and ChaCha.
+	"-----begin ",                            // PEM keys and certificates.
+	"cryptographic provider",                 // CryptoAPI providers.
+}
+
+// String represents a string extracted from a file along with its
+// categories.
+type String struct {
+	Value    string `json:"value"`
+	Encoding string `json:"encoding"`
+	// Categories tells what the string looks like, i.e: `url`.
+	Categories []string `json:"categories"`
+}
+
+// StringsFilter represents the criteria the strings of a file are
+// filtered by, the zero value keeps all of them.
+type StringsFilter struct {
+	// Query keeps the strings containing it, case insensitively.
+	Query string
+	// Regex keeps the strings matching a regular expression.
+	Regex string
+	// Encoding keeps the strings of an encoding, UTF-16 stands for wide.
+	Encoding string
+	// MinLength keeps the strings with at least as many characters.
+	MinLength int
+	// Category keeps the strings classified in a category.
+	Category string
+}
+
+// IsZero returns true when the filter keeps all strings.
+func (f StringsFilter) IsZero() bool {
+	return f == StringsFilter{}
+}
+
+// stringsMatcher is a validated strings filter.
+type stringsMatcher struct {
+	query     string
+	regex     *regexp.Regexp
+	encoding  string
+	minLength int
+	category  string
+}
+
+// matcher validates the filter.
+func (f StringsFilter) matcher() (stringsMatcher, error) {
+	m := stringsMatcher{
+		query:     strings.ToLower(f.Query),
+		minLength: f.MinLength,
+		category:  strings.ToLower(f.Category),
+	}
+	if f.Regex != "" {
+		if len(f.Regex) > maxStringsRegex {
+			return m, e.BadRequest("regex is too long")
+		}
+		regex, err := regexp.Compile(f.Regex)
+		if err != nil {
+			return m, e.BadRequest("invalid regex: " + err.Error())
+		}
+		m.regex = regex
+	}
+	if f.Encoding != "" {
+		encoding, ok := entity.StringEncoding(f.Encoding)
+		if !ok {
+			return m, e.BadRequest("invalid encoding, one of ascii, wide " +
+				"or asm is expected")
+		}
+		m.encoding = encoding
+	}
+	if f.MinLength < 0 {
+		return m, e.BadRequest("min_length must not be negative")
+	}
+	switch m.category {
+	case "", CategoryURL, CategoryIP, CategoryPath, CategoryRegistry,
+		CategoryBase64, CategoryCrypto:
+	default:
+		return m, e.BadRequest("invalid category: " + f.Category)
+	}
+	return m, nil
+}
+
+// filter returns the strings matching, classified, in the order of their
+// encodings.
+func (m stringsMatcher) filter(s entity.Strings) []String {
+	results := []String{}
+	for _, list := range []struct {
+		encoding string
+		values   []string
+	}{
+		{entity.EncodingASCII, s.ASCII},
+		{entity.EncodingWide, s.Wide},
+		{entity.EncodingAsm, s.Asm},
+	} {
+		if m.encoding != "" && m.encoding != list.encoding {
+			continue
+		}
+		for _, value := range list.values {
+			if utf8.RuneCountInString(value) < m.minLength ||
+				m.query != "" &&
+					!strings.Contains(strings.ToLower(value), m.query) ||
+				m.regex != nil && !m.regex.MatchString(value) {
+				continue
+			}
+			categories := classify(value)
+			if m.category != "" && !slices.Contains(categories, m.category) {
+				continue
+			}
+			results = append(results, String{value, list.encoding,
+				categories})
+		}
+	}
+	return results
+}
+
+// classify returns the categories of a string.
+func classify(value string) []string {
+	categories := []string{}
+	if regURL.MatchString(value) {
+		categories = append(categories, CategoryURL)
+	}
+	if hasIP(value) {
+		categories = append(categories, CategoryIP)
+	}
+	if regPath.MatchString(value) {
+		categories = append(categories, CategoryPath)
+	}
+	if regRegistry.MatchString(value) {
+		categories = append(categories, CategoryRegistry)
+	}
+	if isBase64(value) {
+		categories = append(categories, CategoryBase64)
+	}
+	if isCrypto(value) {
+		categories = append(categories, CategoryCrypto)
+	}
+	return categories
+}
+
+// hasIP returns true when a string contains a valid IPv4 address.
+func hasIP(value string) bool {
+	for _, match := range regIP.FindAllString(value, -1) {
+		if ip := net.ParseIP(match); ip != nil && !ip.IsUnspecified() {
+			return true
+		}
+	}
+	return false
+}
+
+// isBase64 returns true when a string is a base64 blob. Blobs mix lower
+// and upper case letters, which tells them from words and hex strings.
+func isBase64(value string) bool {
+	if len(value) < minBase64Length || len(value)%4 != 0 ||
+		!regBase64.MatchString(value) {
+		return false
+	}
+	var lower, upper bool
+	for _, r := range value {
+		lower = lower || unicode.IsLower(r)
+		upper = upper || unicode.IsUpper(r)
+	}
+	if !lower || !upper {
+		return false
+	}
+	_, err := base64.StdEncoding.DecodeString(value)
+	return err == nil
+}
+
+// isCrypto returns true when a string is a cryptographic constant or
+// refers to a cryptography API.
+func isCrypto(value string) bool {
+	if regCryptoAPI.MatchString(value) {
+		return true
+	}
+	lower := strings.ToLower(value)
+	for _, marker := range cryptoMarkers {
+		if strings.Contains(lower, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSearchString validates the string and encoding files are searched
+// by and returns the canonical encoding.
+func checkSearchString(value, encoding string) (string, error) {
+	if value == "" {
+		return "", e.BadRequest("value is required")
+	}
+	if len(value) > maxSearchString {
+		return "", e.BadRequest("value is too long")
+	}
+	if encoding == "" {
+		return "", nil
+	}
+	encoding, ok := entity.StringEncoding(encoding)
+	if !ok {
+		return "", e.BadRequest("invalid encoding, one of ascii, wide or " +
+			"asm is expected")
+	}
+	return encoding, nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package file
+
+import (
+	"testing"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+	e "github.com/saferwall/saferwall-api/internal/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		value      string
+		categories []string
+	}{
+		{"http://185.12.3.4/gate.php", []string{CategoryURL, CategoryIP}},
+		{"connecting to 10.0.0.1:443", []string{CategoryIP}},
+		{"0.0.0.0", []string{}},
+		{`C:\Windows\System32\cmd.exe`, []string{CategoryPath}},
+		{`%APPDATA%\svchost.exe`, []string{CategoryPath}},
+		{"/etc/passwd", []string{CategoryPath}},
+		{`Software\Microsoft\Windows\CurrentVersion\Run`,
+			[]string{CategoryRegistry}},
+		{`HKEY_LOCAL_MACHINE\SYSTEM`, []string{CategoryRegistry}},
+		{"TVqQAAMAAAAEAAAA//8AALgAAAAA", []string{CategoryBase64}},
+		{"GetProcAddressAAAAAAAAA", []string{}},
+		{"0123456789ABCDEF0123456789ABCDEF", []string{}},
+		{"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/",
+			[]string{CategoryBase64, CategoryCrypto}},
+		{"BCryptEncrypt", []string{CategoryCrypto}},
+		{"expand 32-byte k", []string{CategoryCrypto}},
+		{"kernel32.dll", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			assert.Equal(t, tt.categories, classify(tt.value))
+		})
+	}
+}
+
+func TestStringsFilter(t *testing.T) {
+	strs := entity.Strings{
+		ASCII: []string{"http://evil.com/a", "kernel32.dll", "abc"},
+		Wide:  []string{`C:\Users\Public\evil.exe`, "EVIL"},
+		Asm:   []string{"ntdll.dll"},
+	}
+	filter := func(f StringsFilter) []String {
+		m, err := f.matcher()
+		assert.Nil(t, err)
+		return m.filter(strs)
+	}
+
+	assert.True(t, StringsFilter{}.IsZero())
+	assert.Len(t, filter(StringsFilter{}), 6)
+	assert.Equal(t, []String{
+		{"http://evil.com/a", entity.EncodingASCII, []string{CategoryURL}},
+		{`C:\Users\Public\evil.exe`, entity.EncodingWide,
+			[]string{CategoryPath}},
+		{"EVIL", entity.EncodingWide, []string{}},
+	}, filter(StringsFilter{Query: "Evil"}))
+	assert.Equal(t, []String{
+		{"EVIL", entity.EncodingWide, []string{}},
+	}, filter(StringsFilter{Query: "evil", Encoding: "UTF-16", MinLength: 4,
+		Regex: "^[A-Z]+$"}))
+	assert.Equal(t, []String{
+		{"kernel32.dll", entity.EncodingASCII, []string{}},
+		{"ntdll.dll", entity.EncodingAsm, []string{}},
+	}, filter(StringsFilter{Regex: `\.dll$`}))
+	assert.Len(t, filter(StringsFilter{Category: "path"}), 1)
+	assert.Len(t, filter(StringsFilter{MinLength: 12}), 3)
+
+	for _, f := range []StringsFilter{
+		{Regex: "("},
+		{Encoding: "ebcdic"},
+		{MinLength: -1},
+		{Category: "secret"},
+	} {
+		_, err := f.matcher()
+		assert.IsType(t, e.ErrorResponse{}, err)
+	}
+}
+
+func TestCheckSearchString(t *testing.T) {
+	encoding, err := checkSearchString("evil.com", "Unicode")
+	assert.Nil(t, err)
+	assert.Equal(t, entity.EncodingWide, encoding)
+	encoding, err = checkSearchString("evil.com", "")
+	assert.Nil(t, err)
+	assert.Empty(t, encoding)
+
+	_, err = checkSearchString("", "")
+	assert.Equal(t, e.BadRequest("value is required"), err)
+	_, err = checkSearchString("evil.com", "ebcdic")
+	assert.NotNil(t, err)
+}
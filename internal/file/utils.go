@@ -7,11 +7,18 @@ package file
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"regexp"
+	"strconv"
+	"strings"
 )
 
 var (
 	regPathNotation = regexp.MustCompile(`^[\w.]+$`)
+
+	// errWeakETag is returned for weak entity tags, which never match as
+	// `If-Match` requires a strong comparison.
+	errWeakETag = errors.New("weak entity tag")
 )
 
 // areFieldsAllowed check if we are allowed to filter GET with fields
@@ -51,3 +58,22 @@ func hash(b []byte) string {
 	h.Write(b)
 	return hex.EncodeToString(h.Sum(nil))
 }
+
+// formatETag converts a document CAS into an entity tag.
+func formatETag(cas uint64) string {
+	return `"` + strconv.FormatUint(cas, 10) + `"`
+}
+
+// parseETag converts an entity tag as found in an `If-Match` header into a
+// document CAS. The wildcard `*` matches any version and yields zero.
+// Weak entity tags are rejected, see RFC 7232 section 3.1.
+func parseETag(etag string) (uint64, error) {
+	etag = strings.TrimSpace(etag)
+	if etag == "*" {
+		return 0, nil
+	}
+	if strings.HasPrefix(etag, "W/") {
+		return 0, errWeakETag
+	}
+	return strconv.ParseUint(strings.Trim(etag, `"`), 10, 64)
+}
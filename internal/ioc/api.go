@@ -0,0 +1,106 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package ioc
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/labstack/echo/v4"
+	"github.com/saferwall/saferwall-api/internal/attack"
+	"github.com/saferwall/saferwall-api/internal/errors"
+	"github.com/saferwall/saferwall-api/pkg/log"
+	"github.com/saferwall/saferwall-api/pkg/pagination"
+)
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func RegisterHandlers(g *echo.Group, service Service, logger log.Logger) {
+
+	res := resource{service, logger}
+
+	g.GET("/iocs/:value/", res.samples)
+	g.GET("/attack/techniques/:id/files/", res.techniqueFiles)
+}
+
+// @Summary Returns the files referencing an IOC
+// @Description Pivots from a domain, IP, URL, mutex, registry key, dropped
+// @Description file hash or imphash to the files exhibiting it, either
+// @Description directly or during their behavior scans. Values containing
+// @Description slashes must be URL encoded.
+// @Tags IOC
+// @Produce json
+// @Param value path string true "IOC value"
+// @Param kind query string false "Kind of IOC" Enums(domain, ip, url, mutex, registry, sha256, imphash)
+// @Param per_page query uint false "Number of files per page"
+// @Param page query uint false "Specify the page number"
+// @Success 200 {object} pagination.Pages{items=[]entity.IOCSample}
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /iocs/{value}/ [get]
+func (r resource) samples(c echo.Context) error {
+	ctx := c.Request().Context()
+	value := c.Param("value")
+	// Parameters are left escaped when the path holds encoded slashes.
+	if c.Request().URL.RawPath != "" {
+		unescaped, err := url.PathUnescape(value)
+		if err != nil {
+			return errors.BadRequest("invalid IOC value")
+		}
+		value = unescaped
+	}
+	kind := c.QueryParam("kind")
+
+	count, err := r.service.CountSamples(ctx, value, kind)
+	if err != nil {
+		return err
+	}
+
+	pages := pagination.NewFromRequest(c.Request(), count)
+	samples, err := r.service.Samples(ctx, value, kind, pages.Offset(),
+		pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = samples
+	return c.JSON(http.StatusOK, pages)
+}
+
+// @Summary Returns the files exhibiting an ATT&CK technique
+// @Description Lists the files whose behavior scans map to a MITRE ATT&CK
+// @Description technique or sub-technique, most recently seen first.
+// @Tags IOC
+// @Produce json
+// @Param id path string true "Technique ID, i.e: T1055 or T1547.001"
+// @Param per_page query uint false "Number of files per page"
+// @Param page query uint false "Specify the page number"
+// @Success 200 {object} pagination.Pages{items=[]entity.IOCSample}
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /attack/techniques/{id}/files/ [get]
+func (r resource) techniqueFiles(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := attack.NormalizeID(c.Param("id"))
+	if !attack.IsValidID(id) {
+		return errors.BadRequest("invalid ATT&CK technique ID")
+	}
+
+	count, err := r.service.CountSamples(ctx, id, KindTechnique)
+	if err != nil {
+		return err
+	}
+
+	pages := pagination.NewFromRequest(c.Request(), count)
+	samples, err := r.service.Samples(ctx, id, KindTechnique, pages.Offset(),
+		pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = samples
+	return c.JSON(http.StatusOK, pages)
+}
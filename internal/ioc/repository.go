@@ -0,0 +1,123 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package ioc
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+// Repository encapsulates the logic to access the IOC lookup documents
+// from the data source.
+type Repository interface {
+	// Replace saves the references of a file to the IOCs of either the
+	// file itself or its behavior scans, and deletes the other references
+	// of the same origin.
+	Replace(ctx context.Context, sha256 string, fromBehavior bool,
+		refs []entity.IOCRef) error
+	// Samples returns the files referencing an IOC, refs lists the kinds
+	// the IOC is looked up by along with its normalized values.
+	Samples(ctx context.Context, refs []entity.IOCRef, offset, limit int) (
+		[]entity.IOCSample, error)
+	// CountSamples returns the number of files referencing an IOC.
+	CountSamples(ctx context.Context, refs []entity.IOCRef) (int, error)
+}
+
+// repository persists the IOC references in database.
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new IOC repository.
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// key returns the document key of an IOC reference. Values are hashed as
+// they can be longer than what a key holds.
+func key(ref entity.IOCRef) string {
+	h := sha1.Sum([]byte(ref.Value))
+	source := ref.BehaviorID
+	if source == "" {
+		source = "file"
+	}
+	return strings.Join([]string{"ioc", ref.Kind, hex.EncodeToString(h[:]),
+		ref.SHA256, source}, "::")
+}
+
+// Replace upserts the IOC references of a file in a single batch, then
+// deletes the ones left from a previous indexing.
+func (r repository) Replace(ctx context.Context, sha256 string,
+	fromBehavior bool, refs []entity.IOCRef) error {
+
+	docs := make(map[string]interface{}, len(refs))
+	keys := make([]string, 0, len(refs))
+	for i := range refs {
+		k := key(refs[i])
+		docs[k] = &refs[i]
+		keys = append(keys, k)
+	}
+	if err := r.db.UpsertMulti(ctx, docs); err != nil {
+		return err
+	}
+
+	var result interface{}
+	params := make(map[string]interface{}, 3)
+	params["sha256"] = sha256
+	params["behavior"] = fromBehavior
+	params["keys"] = keys
+	query := r.db.N1QLQuery[dbcontext.DeleteStaleIOCs]
+	return r.db.Query(ctx, query, params, &result)
+}
+
+// lookupParam returns the kind and value pairs the IOC queries match.
+func lookupParam(refs []entity.IOCRef) [][]string {
+	pairs := make([][]string, 0, len(refs))
+	for _, ref := range refs {
+		pairs = append(pairs, []string{ref.Kind, ref.Value})
+	}
+	return pairs
+}
+
+// Samples retrieves the files referencing an IOC from the database.
+func (r repository) Samples(ctx context.Context, refs []entity.IOCRef,
+	offset, limit int) ([]entity.IOCSample, error) {
+
+	var results interface{}
+	params := make(map[string]interface{}, 1)
+	params["refs"] = lookupParam(refs)
+	params["offset"] = offset
+	params["limit"] = limit
+
+	query := r.db.N1QLQuery[dbcontext.IOCSamples]
+	err := r.db.Query(ctx, query, params, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := []entity.IOCSample{}
+	err = dbcontext.Decode(results, &samples)
+	return samples, err
+}
+
+// CountSamples counts the files referencing an IOC in the database.
+func (r repository) CountSamples(ctx context.Context,
+	refs []entity.IOCRef) (int, error) {
+
+	var count int
+	params := make(map[string]interface{}, 1)
+	params["refs"] = lookupParam(refs)
+
+	query := r.db.N1QLQuery[dbcontext.CountIOCSamples]
+	err := r.db.Count(ctx, query, params, &count)
+	return count, err
+}
@@ -0,0 +1,210 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package ioc
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/saferwall/saferwall-api/internal/behavior"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	e "github.com/saferwall/saferwall-api/internal/errors"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+// Kinds of IOCs besides the ones of the behavior scans.
+const (
+	// KindImphash is the kind of the import hashes of PE files.
+	KindImphash = "imphash"
+	// KindRichHeaderHash is the kind of the hashes of the rich headers of
+	// PE files.
+	KindRichHeaderHash = "rich_header_hash"
+	// KindTechnique is the kind of the MITRE ATT&CK techniques exhibited
+	// during behavior scans.
+	KindTechnique = "technique"
+)
+
+// Maximum length of an IOC value looked up.
+const maxValueLen = 2048
+
+var (
+	// kinds lists the kinds of the indexed IOCs.
+	kinds = map[string]bool{
+		behavior.IOCDomain:   true,
+		behavior.IOCIP:       true,
+		behavior.IOCURL:      true,
+		behavior.IOCMutex:    true,
+		behavior.IOCRegistry: true,
+		behavior.IOCSHA256:   true,
+		KindImphash:          true,
+		KindRichHeaderHash:   true,
+		KindTechnique:        true,
+	}
+	// caseSensitive lists the kinds of IOCs whose case matters.
+	caseSensitive = map[string]bool{
+		behavior.IOCMutex: true,
+		behavior.IOCURL:   true,
+	}
+
+	// RegMD5 matches lower cased MD5 hashes, like the imphash and the rich
+	// header hash.
+	RegMD5 = regexp.MustCompile(`^[a-f0-9]{32}$`)
+)
+
+// Service encapsulates usecase logic for pivoting on IOCs.
+type Service interface {
+	// IndexFile indexes the IOCs found in a file document, like its
+	// imphash and the hash of its rich header.
+	IndexFile(ctx context.Context, file entity.File) error
+	// IndexBehavior indexes the IOCs observed and the ATT&CK techniques
+	// exhibited during the last behavior scan of a file.
+	IndexBehavior(ctx context.Context, sha256 string) error
+	// Samples returns the files referencing an IOC, optionally restricted
+	// to a kind of IOC.
+	Samples(ctx context.Context, value, kind string, offset, limit int) (
+		[]entity.IOCSample, error)
+	CountSamples(ctx context.Context, value, kind string) (int, error)
+}
+
+type service struct {
+	repo        Repository
+	logger      log.Logger
+	behaviorSvc behavior.Service
+}
+
+// NewService creates a new IOC service.
+func NewService(repo Repository, logger log.Logger,
+	behaviorSvc behavior.Service) Service {
+	return service{repo, logger, behaviorSvc}
+}
+
+// IndexFile saves a reference for every IOC of a file document, the
+// references to the IOCs the file no longer has are removed.
+func (s service) IndexFile(ctx context.Context, file entity.File) error {
+	refs := fileRefs(file)
+	now := time.Now().Unix()
+	for i := range refs {
+		refs[i].Timestamp = now
+	}
+	return s.repo.Replace(ctx, strings.ToLower(file.SHA256), false, refs)
+}
+
+// IndexBehavior saves a reference for every IOC and technique of the last
+// behavior scan of a file, the references to the previous scans are
+// removed.
+func (s service) IndexBehavior(ctx context.Context, sha256 string) error {
+	sha256 = strings.ToLower(sha256)
+	scans, err := s.behaviorSvc.FileScans(ctx, sha256, 0, 1)
+	if err != nil || len(scans) == 0 {
+		return err
+	}
+	id := scans[0].ID
+	iocs, err := s.behaviorSvc.IOCs(ctx, id)
+	if err != nil {
+		return err
+	}
+	matrix, err := s.behaviorSvc.Attack(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	refs := make([]entity.IOCRef, 0, len(iocs.IOCs))
+	for _, ioc := range iocs.IOCs {
+		refs = append(refs, newRef(ioc.Type, ioc.Value, sha256))
+	}
+	for _, c := range matrix.Capabilities {
+		for _, technique := range c.Techniques {
+			refs = append(refs, newRef(KindTechnique, technique, sha256))
+		}
+	}
+
+	now := time.Now().Unix()
+	for i := range refs {
+		refs[i].BehaviorID = id
+		refs[i].Timestamp = now
+	}
+	return s.repo.Replace(ctx, sha256, true, refs)
+}
+
+// Samples returns the files referencing an IOC, most recently seen first.
+func (s service) Samples(ctx context.Context, value, kind string, offset,
+	limit int) ([]entity.IOCSample, error) {
+	if err := checkLookup(value, kind); err != nil {
+		return nil, err
+	}
+	return s.repo.Samples(ctx, lookupRefs(value, kind), offset, limit)
+}
+
+// CountSamples returns the number of files referencing an IOC.
+func (s service) CountSamples(ctx context.Context, value, kind string) (
+	int, error) {
+	if err := checkLookup(value, kind); err != nil {
+		return 0, err
+	}
+	return s.repo.CountSamples(ctx, lookupRefs(value, kind))
+}
+
+// checkLookup validates the IOC looked up.
+func checkLookup(value, kind string) error {
+	if value == "" || len(value) > maxValueLen {
+		return e.BadRequest(fmt.Sprintf(
+			"the IOC value must be between 1 and %d characters", maxValueLen))
+	}
+	if kind != "" && !kinds[kind] {
+		return e.BadRequest(fmt.Sprintf("unknown IOC kind %q", kind))
+	}
+	return nil
+}
+
+// lookupRefs returns the references an IOC is looked up by: one per kind,
+// or per known kind when kind is empty, with the value normalized the way
+// it is indexed for that kind.
+func lookupRefs(value, kind string) []entity.IOCRef {
+	if kind != "" {
+		return []entity.IOCRef{newRef(kind, value, "")}
+	}
+	refs := make([]entity.IOCRef, 0, len(kinds))
+	for k := range kinds {
+		refs = append(refs, newRef(k, value, ""))
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Kind < refs[j].Kind
+	})
+	return refs
+}
+
+// newRef creates the reference from an IOC to a file, the value is
+// normalized according to its kind.
+func newRef(kind, value, sha256 string) entity.IOCRef {
+	if !caseSensitive[kind] {
+		value = strings.ToLower(value)
+	}
+	return entity.IOCRef{Type: "ioc", Kind: kind, Value: value,
+		SHA256: sha256}
+}
+
+// fileRefs returns the references to the IOCs of a file document.
+func fileRefs(file entity.File) []entity.IOCRef {
+	var refs []entity.IOCRef
+	if file.PE == nil {
+		return refs
+	}
+	if meta := file.PE.Meta; meta != nil {
+		imphash := strings.ToLower(meta.Imphash)
+		if RegMD5.MatchString(imphash) {
+			refs = append(refs, newRef(KindImphash, imphash, file.SHA256))
+		}
+	}
+	if rich := file.PE.RichHeader; rich != nil {
+		if hash := rich.Hash(); hash != "" {
+			refs = append(refs, newRef(KindRichHeaderHash, hash, file.SHA256))
+		}
+	}
+	return refs
+}
@@ -0,0 +1,159 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package ioc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/saferwall/saferwall-api/internal/behavior"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/saferwall/saferwall-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSHA256 = "131f95c51cc819465fa1797f6ccacf9d494aaaff46fa3eac73ae63ffbdfd8267"
+
+type mockRepository struct {
+	refs map[string]entity.IOCRef
+}
+
+func (m mockRepository) Replace(ctx context.Context, sha256 string,
+	fromBehavior bool, refs []entity.IOCRef) error {
+	for k, ref := range m.refs {
+		if ref.SHA256 == sha256 && (ref.BehaviorID != "") == fromBehavior {
+			delete(m.refs, k)
+		}
+	}
+	for _, ref := range refs {
+		m.refs[key(ref)] = ref
+	}
+	return nil
+}
+
+func (m mockRepository) Samples(ctx context.Context, refs []entity.IOCRef,
+	offset, limit int) ([]entity.IOCSample, error) {
+	return []entity.IOCSample{}, nil
+}
+
+func (m mockRepository) CountSamples(ctx context.Context,
+	refs []entity.IOCRef) (int, error) {
+	return 0, nil
+}
+
+// mockBehaviorService implements the behavior scans lookups used when
+// indexing.
+type mockBehaviorService struct {
+	behavior.Service
+	scans  []entity.BehaviorScan
+	iocs   behavior.IOCs
+	matrix behavior.AttackMatrix
+}
+
+func (m mockBehaviorService) FileScans(ctx context.Context, sha256 string,
+	offset, limit int) ([]entity.BehaviorScan, error) {
+	return m.scans, nil
+}
+
+func (m mockBehaviorService) IOCs(ctx context.Context, id string) (
+	behavior.IOCs, error) {
+	return m.iocs, nil
+}
+
+func (m mockBehaviorService) Attack(ctx context.Context, id string) (
+	behavior.AttackMatrix, error) {
+	return m.matrix, nil
+}
+
+func TestIndex(t *testing.T) {
+	ctx := context.Background()
+	id := "6f1d6d6a-3c8a-4a54-9e3b-8ad1b5c5ef52"
+	repo := mockRepository{refs: map[string]entity.IOCRef{}}
+	behaviorSvc := mockBehaviorService{}
+	s := NewService(repo, log.New(), behaviorSvc)
+
+	// Files which were not detonated have nothing to index.
+	assert.Nil(t, s.IndexBehavior(ctx, testSHA256))
+	assert.Empty(t, repo.refs)
+
+	behaviorSvc.scans = []entity.BehaviorScan{{ID: id, SHA256: testSHA256}}
+	behaviorSvc.iocs = behavior.IOCs{ID: id, IOCs: []behavior.IOC{
+		{Type: behavior.IOCDomain, Value: "Evil.Example.com"},
+		{Type: behavior.IOCMutex, Value: `Global\M1`},
+	}}
+	behaviorSvc.matrix = behavior.AttackMatrix{ID: id,
+		Capabilities: []entity.Capability{
+			{Description: "Process Injection", Techniques: []string{"T1055"}}}}
+	s = NewService(repo, log.New(), behaviorSvc)
+	assert.Nil(t, s.IndexBehavior(ctx, testSHA256))
+	assert.Len(t, repo.refs, 3)
+	ref := repo.refs[key(entity.IOCRef{Kind: behavior.IOCDomain,
+		Value: "evil.example.com", SHA256: testSHA256, BehaviorID: id})]
+	assert.Equal(t, "ioc", ref.Type)
+	assert.Equal(t, id, ref.BehaviorID)
+	assert.NotZero(t, ref.Timestamp)
+	_, ok := repo.refs[key(entity.IOCRef{Kind: behavior.IOCMutex,
+		Value: `Global\M1`, SHA256: testSHA256, BehaviorID: id})]
+	assert.True(t, ok)
+	_, ok = repo.refs[key(entity.IOCRef{Kind: KindTechnique,
+		Value: "t1055", SHA256: testSHA256, BehaviorID: id})]
+	assert.True(t, ok)
+
+	file := entity.File{SHA256: testSHA256, PE: &entity.PE{
+		Meta: &entity.PEMeta{Imphash: "F34D5F2D4577ED6D9CEEC516C1F5A744"},
+		RichHeader: &entity.RichHeader{CompIDs: []entity.CompID{
+			{ProdID: 0x104, MinorCV: 30729, Count: 5}}}}}
+	assert.Nil(t, s.IndexFile(ctx, file))
+	ref = repo.refs[key(entity.IOCRef{Kind: KindImphash,
+		Value: "f34d5f2d4577ed6d9ceec516c1f5a744", SHA256: testSHA256})]
+	assert.Equal(t, testSHA256, ref.SHA256)
+	assert.Empty(t, ref.BehaviorID)
+	_, ok = repo.refs[key(entity.IOCRef{Kind: KindRichHeaderHash,
+		Value: file.PE.RichHeader.Hash(), SHA256: testSHA256})]
+	assert.True(t, ok)
+
+	// Files without a PE header.
+	assert.Empty(t, fileRefs(entity.File{SHA256: testSHA256}))
+
+	// The references to a previous behavior scan are replaced, the ones of
+	// the file itself are kept.
+	other := "0b6f2e4e-8f63-4a6f-a0a4-4e9c7f0f1a7e"
+	behaviorSvc.scans = []entity.BehaviorScan{{ID: other, SHA256: testSHA256}}
+	behaviorSvc.iocs = behavior.IOCs{ID: other, IOCs: []behavior.IOC{
+		{Type: behavior.IOCDomain, Value: "evil.example.com"}}}
+	behaviorSvc.matrix = behavior.AttackMatrix{ID: other}
+	s = NewService(repo, log.New(), behaviorSvc)
+	assert.Nil(t, s.IndexBehavior(ctx, testSHA256))
+	assert.Len(t, repo.refs, 3)
+	_, ok = repo.refs[key(entity.IOCRef{Kind: behavior.IOCDomain,
+		Value: "evil.example.com", SHA256: testSHA256, BehaviorID: other})]
+	assert.True(t, ok)
+}
+
+func TestLookupRefs(t *testing.T) {
+	assert.Equal(t, []entity.IOCRef{{Type: "ioc", Kind: behavior.IOCMutex,
+		Value: `Global\M1`}}, lookupRefs(`Global\M1`, behavior.IOCMutex))
+	assert.Equal(t, []entity.IOCRef{{Type: "ioc", Kind: behavior.IOCDomain,
+		Value: "evil.example.com"}},
+		lookupRefs("Evil.Example.com", behavior.IOCDomain))
+
+	// Without a kind, the value is normalized for each kind.
+	refs := lookupRefs("Evil", "")
+	assert.Len(t, refs, len(kinds))
+	for _, ref := range refs {
+		if caseSensitive[ref.Kind] {
+			assert.Equal(t, "Evil", ref.Value)
+		} else {
+			assert.Equal(t, "evil", ref.Value)
+		}
+	}
+}
+
+func TestCheckLookup(t *testing.T) {
+	assert.Nil(t, checkLookup("evil.example.com", ""))
+	assert.Nil(t, checkLookup("evil.example.com", behavior.IOCDomain))
+	assert.NotNil(t, checkLookup("evil.example.com", "email"))
+	assert.NotNil(t, checkLookup("", ""))
+}
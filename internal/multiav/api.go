@@ -0,0 +1,184 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package multiav
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/labstack/echo/v4"
+	"github.com/saferwall/saferwall-api/pkg/log"
+	"github.com/saferwall/saferwall-api/pkg/pagination"
+)
+
+// Family names are made of the lowercase tokens of detection names.
+var familyRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,31}$`)
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func RegisterHandlers(g *echo.Group, service Service, logger log.Logger,
+	requireLogin echo.MiddlewareFunc, verifyHash echo.MiddlewareFunc) {
+
+	res := resource{service, logger}
+
+	g.GET("/files/:sha256/multiav/history/", res.history, verifyHash)
+	g.GET("/files/:sha256/multiav/diff/", res.diff, verifyHash)
+	g.GET("/multiav/stats/", res.stats)
+	g.GET("/multiav/engines/", res.engines, requireLogin)
+	g.GET("/multiav/families/", res.families)
+	g.GET("/multiav/families/:family/files/", res.files)
+}
+
+// @Summary Returns the multiav scan history of a file
+// @Description Paginated list of the AV scans of a file, newest first.
+// @Tags MultiAV
+// @Produce json
+// @Param sha256 path string true "File SHA256"
+// @Param per_page query uint false "Number of scans per page"
+// @Param page query uint false "Specify the page number"
+// @Success 200 {object} pagination.Pages{items=[]entity.AVScan}
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /files/{sha256}/multiav/history/ [get]
+func (r resource) history(c echo.Context) error {
+	ctx := c.Request().Context()
+	sha256 := c.Param("sha256")
+	count, err := r.service.Count(ctx, sha256)
+	if err != nil {
+		return err
+	}
+
+	pages := pagination.NewFromRequest(c.Request(), count)
+	scans, err := r.service.History(ctx, sha256, pages.Offset(),
+		pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = scans
+	return c.JSON(http.StatusOK, pages)
+}
+
+// @Summary Compares two multiav scans of a file
+// @Description List the engines which flipped detection or renamed the
+// @Description detected family between two scans. The last two scans are
+// @Description compared when no scan IDs are given.
+// @Tags MultiAV
+// @Produce json
+// @Param sha256 path string true "File SHA256"
+// @Param from query string false "ID of the older scan"
+// @Param to query string false "ID of the newer scan"
+// @Success 200 {object} ScanDiff
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /files/{sha256}/multiav/diff/ [get]
+func (r resource) diff(c echo.Context) error {
+	ctx := c.Request().Context()
+	diff, err := r.service.Diff(ctx, c.Param("sha256"), c.QueryParam("from"),
+		c.QueryParam("to"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, diff)
+}
+
+// @Summary Returns the time-to-detection stats of the AV engines
+// @Description For every engine, how long it took to detect the files it
+// @Description flagged, counted from the time the files were first seen.
+// @Tags MultiAV
+// @Produce json
+// @Success 200 {object} []EngineStats
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /multiav/stats/ [get]
+func (r resource) stats(c echo.Context) error {
+	stats, err := r.service.DetectionStats(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, stats)
+}
+
+// @Summary Returns the detection rate of the AV engines
+// @Description For every engine, the number of files it scanned and flagged
+// @Description in their latest scan. Restricted to admins.
+// @Tags MultiAV
+// @Produce json
+// @Success 200 {object} []EngineRate
+// @Failure 401 {object} errors.ErrorResponse
+// @Failure 403 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /multiav/engines/ [get]
+// @Security Bearer
+func (r resource) engines(c echo.Context) error {
+	rates, err := r.service.EngineRates(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, rates)
+}
+
+// @Summary Retrieves a paginated list of malware families
+// @Description List the consensus families files were classified in, along
+// @Description with their number of files, most common first.
+// @Tags MultiAV
+// @Produce json
+// @Param per_page query uint false "Number of families per page"
+// @Param page query uint false "Specify the page number"
+// @Success 200 {object} pagination.Pages{items=[]FamilyCount}
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /multiav/families/ [get]
+func (r resource) families(c echo.Context) error {
+	ctx := c.Request().Context()
+	count, err := r.service.CountFamilies(ctx)
+	if err != nil {
+		return err
+	}
+
+	pages := pagination.NewFromRequest(c.Request(), count)
+	families, err := r.service.Families(ctx, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = families
+	return c.JSON(http.StatusOK, pages)
+}
+
+// @Summary Retrieves the files classified in a malware family
+// @Description Paginated list of the files whose consensus family matches,
+// @Description optionally filtered by type, i.e: `ransomware`.
+// @Tags MultiAV
+// @Produce json
+// @Param family path string true "Family name"
+// @Param type query string false "Malware type"
+// @Param per_page query uint false "Number of files per page"
+// @Param page query uint false "Specify the page number"
+// @Success 200 {object} pagination.Pages
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /multiav/families/{family}/files/ [get]
+func (r resource) files(c echo.Context) error {
+	ctx := c.Request().Context()
+	family, category := c.Param("family"), c.QueryParam("type")
+	if !familyRegex.MatchString(NormalizeFamily(family)) {
+		return errInvalidFamily
+	}
+	count, err := r.service.CountFiles(ctx, family, category)
+	if err != nil {
+		return err
+	}
+
+	pages := pagination.NewFromRequest(c.Request(), count)
+	files, err := r.service.Files(ctx, family, category, pages.Offset(),
+		pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = files
+	return c.JSON(http.StatusOK, pages)
+}
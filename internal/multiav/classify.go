@@ -0,0 +1,215 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package multiav
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+)
+
+const (
+	// Minimum number of engines which must agree on a family.
+	minFamilyVotes = 2
+	// Shorter tokens are too ambiguous to name a family.
+	minFamilyLen = 4
+	// Maximum number of runner-up families kept.
+	maxCandidates = 3
+)
+
+var (
+	tokenSep   = regexp.MustCompile(`[^A-Za-z0-9]+`)
+	hexToken   = regexp.MustCompile(`^[0-9a-f]*[0-9][0-9a-f]*$`)
+	digitToken = regexp.MustCompile(`[0-9]{3,}`)
+
+	// categories maps the tokens engines use to describe the kind of malware
+	// to a category.
+	categories = map[string]string{
+		"ransom":      "ransomware",
+		"ransomware":  "ransomware",
+		"filecoder":   "ransomware",
+		"filecryptor": "ransomware",
+		"worm":        "worm",
+		"backdoor":    "backdoor",
+		"bkdr":        "backdoor",
+		"rat":         "backdoor",
+		"downloader":  "downloader",
+		"dldr":        "downloader",
+		"dloader":     "downloader",
+		"dropper":     "dropper",
+		"drop":        "dropper",
+		"adware":      "adware",
+		"adw":         "adware",
+		"pua":         "pua",
+		"pup":         "pua",
+		"riskware":    "pua",
+		"unwanted":    "pua",
+		"spyware":     "spyware",
+		"spy":         "spyware",
+		"stealer":     "stealer",
+		"infostealer": "stealer",
+		"pws":         "stealer",
+		"psw":         "stealer",
+		"miner":       "miner",
+		"coinminer":   "miner",
+		"bitminer":    "miner",
+		"virus":       "virus",
+		"rootkit":     "rootkit",
+		"exploit":     "exploit",
+		"keylogger":   "keylogger",
+		"banker":      "banker",
+		"trojan":      "trojan",
+		"troj":        "trojan",
+		"trj":         "trojan",
+	}
+
+	// Categories win ties in this order, the most specific ones first.
+	categoryRank = []string{"ransomware", "banker", "stealer", "keylogger",
+		"miner", "rootkit", "backdoor", "worm", "virus", "exploit",
+		"downloader", "dropper", "spyware", "adware", "pua", "trojan"}
+
+	// genericTokens never name a family: platforms, file kinds, heuristics
+	// and the generic names vendors give to unrelated samples.
+	genericTokens = toSet("win32", "win64", "w32", "w64", "msil", "dotnet",
+		"android", "linux", "macos", "osx", "script", "html", "java", "js",
+		"vbs", "vba", "office", "docm", "xlsm", "pdf", "generic", "generik",
+		"genetic", "gen", "malware", "malicious", "malpe", "agent", "variant",
+		"heur", "heuristic", "suspicious", "susgen", "behaveslike", "lookslike",
+		"application", "program", "unsafe", "score", "static", "cloud",
+		"attribute", "highconfidence", "confidence", "kcloud", "detected",
+		"file", "packed", "packer", "crypt", "cryptor", "obfuscated",
+		"obfus", "kryptik", "krypt", "injector", "inject", "razy", "zusy",
+		"ursu", "bulz", "johnnie", "midie", "jaik", "fragtor", "tiggre",
+		"graftor", "barys", "strictor", "mikey", "symmetric", "trojanspy",
+		"trojandownloader", "trojandropper", "trojanpsw", "trojanransom",
+		"hacktool", "tool", "other", "unknown", "susp", "reputation",
+		"malpack", "malcert", "sabsik", "wacatac", "ulise", "lazy")
+
+	// aliases maps the alternative names of a family to its common name.
+	aliases = map[string]string{
+		"geodo":        "emotet",
+		"heodo":        "emotet",
+		"zbot":         "zeus",
+		"wanna":        "wannacry",
+		"wannacryptor": "wannacry",
+		"wcry":         "wannacry",
+		"trickster":    "trickbot",
+		"agensla":      "agenttesla",
+		"negasteal":    "agenttesla",
+		"loki":         "lokibot",
+		"lokipws":      "lokibot",
+		"qakbot":       "qbot",
+		"quakbot":      "qbot",
+		"pinkslipbot":  "qbot",
+	}
+)
+
+// Classify computes the consensus family and category of a file out of the
+// detection names of the AV engines, AVClass-style: detection names are
+// split into tokens, generic tokens and aliases are resolved, then every
+// engine votes once for each remaining token. It returns nil when no engine
+// flagged the file.
+func Classify(results map[string]entity.EngineResult) *entity.AVClassification {
+	families := make(map[string]int)
+	cats := make(map[string]int)
+	engines := 0
+
+	for _, res := range results {
+		if !res.Infected {
+			continue
+		}
+		engines++
+		fams, cat := tokenize(res.Output)
+		for family := range fams {
+			families[family]++
+		}
+		for c := range cat {
+			cats[c]++
+		}
+	}
+	if engines == 0 {
+		return nil
+	}
+
+	c := &entity.AVClassification{Engines: engines}
+	votes := rank(families)
+	if len(votes) > 0 && votes[0].Votes >= minFamilyVotes {
+		c.Family, c.Votes = votes[0].Label, votes[0].Votes
+		votes = votes[1:]
+	}
+	for _, v := range votes {
+		if len(c.Candidates) == maxCandidates {
+			break
+		}
+		c.Candidates = append(c.Candidates, v)
+	}
+
+	best := 0
+	for _, category := range categoryRank {
+		if cats[category] > best {
+			c.Category, best = category, cats[category]
+		}
+	}
+	return c
+}
+
+// NormalizeFamily returns the canonical name of a family.
+func NormalizeFamily(family string) string {
+	family = strings.ToLower(strings.TrimSpace(family))
+	if alias, ok := aliases[family]; ok {
+		return alias
+	}
+	return family
+}
+
+// tokenize splits a detection name into the family and category tokens it
+// holds.
+func tokenize(label string) (families, cats map[string]bool) {
+	families = make(map[string]bool)
+	cats = make(map[string]bool)
+	for _, raw := range tokenSep.Split(label, -1) {
+		token := strings.ToLower(raw)
+		if c, ok := categories[token]; ok {
+			cats[c] = true
+			continue
+		}
+		// Short upper case tokens are variant suffixes, i.e: `Kryptik.HBGT`.
+		if len(token) <= minFamilyLen && raw == strings.ToUpper(raw) {
+			continue
+		}
+		if len(token) < minFamilyLen || genericTokens[token] ||
+			hexToken.MatchString(token) || digitToken.MatchString(token) {
+			continue
+		}
+		families[NormalizeFamily(token)] = true
+	}
+	return families, cats
+}
+
+// rank sorts labels by decreasing number of votes, then alphabetically.
+func rank(counts map[string]int) []entity.LabelVote {
+	votes := make([]entity.LabelVote, 0, len(counts))
+	for label, n := range counts {
+		votes = append(votes, entity.LabelVote{Label: label, Votes: n})
+	}
+	sort.Slice(votes, func(i, j int) bool {
+		if votes[i].Votes != votes[j].Votes {
+			return votes[i].Votes > votes[j].Votes
+		}
+		return votes[i].Label < votes[j].Label
+	})
+	return votes
+}
+
+// toSet builds a set out of a list of strings.
+func toSet(items ...string) map[string]bool {
+	set := make(map[string]bool, len(items))
+	for _, item := range items {
+		set[item] = true
+	}
+	return set
+}
@@ -0,0 +1,56 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package multiav
+
+import (
+	"testing"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	assert.Nil(t, Classify(map[string]entity.EngineResult{
+		"avast": {Infected: false},
+	}))
+
+	c := Classify(map[string]entity.EngineResult{
+		"kaspersky": {Infected: true, Output: "Trojan.Win32.Emotet.abc"},
+		"mcafee":    {Infected: true, Output: "Emotet!gen"},
+		"eset":      {Infected: true, Output: "Win32/Kryptik.HBGT trojan"},
+		"sophos":    {Infected: true, Output: "Troj/Geodo-A"},
+		"avira":     {Infected: true, Output: "TR/Crypt.Agent.4f2a3b"},
+		"clamav":    {Infected: true, Output: "Win.Dropper.Tinba-1234"},
+		"drweb":     {Infected: false},
+	})
+	assert.Equal(t, "emotet", c.Family)
+	assert.Equal(t, 3, c.Votes)
+	assert.Equal(t, 6, c.Engines)
+	assert.Equal(t, "trojan", c.Category)
+	assert.Equal(t, []entity.LabelVote{{Label: "tinba", Votes: 1}},
+		c.Candidates)
+
+	// A single engine is not enough to name a family.
+	c = Classify(map[string]entity.EngineResult{
+		"kaspersky": {Infected: true, Output: "HEUR:Trojan-Ransom.Win32.Locky.gen"},
+		"eset":      {Infected: true, Output: "Win32/Filecoder.NSJ"},
+	})
+	assert.Equal(t, "", c.Family)
+	assert.Equal(t, "ransomware", c.Category)
+}
+
+func TestNormalizeFilter(t *testing.T) {
+	family, category, err := normalizeFilter(" Geodo", "Ransom")
+	assert.Nil(t, err)
+	assert.Equal(t, "emotet", family)
+	assert.Equal(t, "ransomware", category)
+
+	_, _, err = normalizeFilter("emotet", "banana")
+	assert.NotNil(t, err)
+
+	// The family is validated by the handler.
+	assert.True(t, familyRegex.MatchString(NormalizeFamily(" Geodo")))
+	assert.False(t, familyRegex.MatchString(NormalizeFamily("emo tet")))
+}
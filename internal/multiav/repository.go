@@ -0,0 +1,189 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package multiav
+
+import (
+	"context"
+	"strings"
+
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+// Repository encapsulates the logic to access the multiav scan history from
+// the data source.
+type Repository interface {
+	// Get returns the scan with the specified ID.
+	Get(ctx context.Context, id string) (entity.AVScan, error)
+	// Create saves a new scan in the storage.
+	Create(ctx context.Context, scan entity.AVScan) error
+	// Query returns the scans of a file, newest first.
+	Query(ctx context.Context, sha256 string, offset, limit int) (
+		[]entity.AVScan, error)
+	// Count returns the number of scans of a file.
+	Count(ctx context.Context, sha256 string) (int, error)
+	// DetectionStats returns the time-to-detection stats of every engine.
+	DetectionStats(ctx context.Context) ([]EngineStats, error)
+	// EngineRates returns the detection rate of every engine.
+	EngineRates(ctx context.Context) ([]EngineRate, error)
+	// Families returns the malware families along with their number of
+	// files.
+	Families(ctx context.Context, offset, limit int) ([]FamilyCount, error)
+	// CountFamilies returns the number of malware families.
+	CountFamilies(ctx context.Context) (int, error)
+	// Files returns the files classified in a family.
+	Files(ctx context.Context, family, category string, offset, limit int) (
+		[]interface{}, error)
+	// CountFiles returns the number of files classified in a family.
+	CountFiles(ctx context.Context, family, category string) (int, error)
+}
+
+// repository persists the multiav scan history in database.
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new multiav repository.
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the scan with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.AVScan, error) {
+	var scan entity.AVScan
+	err := r.db.Get(ctx, strings.ToLower(id), &scan)
+	return scan, err
+}
+
+// Create saves a new scan in the database.
+func (r repository) Create(ctx context.Context, scan entity.AVScan) error {
+	return r.db.Create(ctx, scan.ID, &scan)
+}
+
+// Query retrieves the scans of a file from the database.
+func (r repository) Query(ctx context.Context, sha256 string, offset,
+	limit int) ([]entity.AVScan, error) {
+
+	var results interface{}
+	params := make(map[string]interface{}, 1)
+	params["sha256"] = sha256
+	params["offset"] = offset
+	params["limit"] = limit
+
+	query := r.db.N1QLQuery[dbcontext.AVScans]
+	err := r.db.Query(ctx, query, params, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	scans := []entity.AVScan{}
+	err = dbcontext.Decode(results, &scans)
+	return scans, err
+}
+
+// Count returns the number of scans of a file in the database.
+func (r repository) Count(ctx context.Context, sha256 string) (int, error) {
+	var count int
+	params := make(map[string]interface{}, 1)
+	params["sha256"] = sha256
+
+	query := r.db.N1QLQuery[dbcontext.CountAVScans]
+	err := r.db.Count(ctx, query, params, &count)
+	return count, err
+}
+
+// DetectionStats computes the time-to-detection stats of every engine from
+// the scans in the database.
+func (r repository) DetectionStats(ctx context.Context) ([]EngineStats, error) {
+	var results interface{}
+	query := r.db.N1QLQuery[dbcontext.AVDetectionStats]
+	err := r.db.Query(ctx, query, nil, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := []EngineStats{}
+	err = dbcontext.Decode(results, &stats)
+	return stats, err
+}
+
+// EngineRates computes the detection rate of every engine from the files in
+// the database.
+func (r repository) EngineRates(ctx context.Context) ([]EngineRate, error) {
+	var results interface{}
+	query := r.db.N1QLQuery[dbcontext.AVEngineStats]
+	err := r.db.Query(ctx, query, nil, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	rates := []EngineRate{}
+	err = dbcontext.Decode(results, &rates)
+	return rates, err
+}
+
+// Families retrieves the malware families from the database.
+func (r repository) Families(ctx context.Context, offset, limit int) (
+	[]FamilyCount, error) {
+
+	var results interface{}
+	params := make(map[string]interface{}, 1)
+	params["offset"] = offset
+	params["limit"] = limit
+
+	query := r.db.N1QLQuery[dbcontext.AVFamilies]
+	err := r.db.Query(ctx, query, params, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	families := []FamilyCount{}
+	err = dbcontext.Decode(results, &families)
+	return families, err
+}
+
+// CountFamilies returns the number of malware families in the database.
+func (r repository) CountFamilies(ctx context.Context) (int, error) {
+	var count int
+	query := r.db.N1QLQuery[dbcontext.CountAVFamilies]
+	err := r.db.Count(ctx, query, nil, &count)
+	return count, err
+}
+
+// Files retrieves the files classified in a family from the database.
+func (r repository) Files(ctx context.Context, family, category string,
+	offset, limit int) ([]interface{}, error) {
+
+	var results interface{}
+	params := make(map[string]interface{}, 1)
+	params["family"] = family
+	params["category"] = category
+	params["offset"] = offset
+	params["limit"] = limit
+
+	query := r.db.N1QLQuery[dbcontext.FamilyFiles]
+	err := r.db.Query(ctx, query, params, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results.([]interface{}), nil
+}
+
+// CountFiles returns the number of files classified in a family in the
+// database.
+func (r repository) CountFiles(ctx context.Context, family,
+	category string) (int, error) {
+
+	var count int
+	params := make(map[string]interface{}, 1)
+	params["family"] = family
+	params["category"] = category
+
+	query := r.db.N1QLQuery[dbcontext.CountFamilyFiles]
+	err := r.db.Count(ctx, query, params, &count)
+	return count, err
+}
@@ -0,0 +1,313 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package multiav
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	e "github.com/saferwall/saferwall-api/internal/errors"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+// Kinds of changes of an engine result between two scans.
+const (
+	// The engine started flagging the file.
+	ChangeDetected = "detected"
+	// The engine stopped flagging the file.
+	ChangeCleaned = "cleaned"
+	// The engine still flags the file under a different name.
+	ChangeRenamed = "renamed"
+	// The engine did not take part in the older scan.
+	ChangeAdded = "added"
+	// The engine did not take part in the newer scan.
+	ChangeRemoved = "removed"
+)
+
+var (
+	errScanNotFound   = e.NotFound("scan not found")
+	errNotEnoughScans = e.NotFound("the file needs at least two scans to compare")
+	errDiffParams     = e.BadRequest("both `from` and `to` scan IDs are required")
+	errInvalidResults = e.BadRequest("invalid multiav scan results")
+	errInvalidFamily  = e.BadRequest("invalid family name")
+	errInvalidType    = e.BadRequest("invalid type")
+)
+
+// Service encapsulates usecase logic for the multiav scan history.
+type Service interface {
+	History(ctx context.Context, sha256 string, offset, limit int) (
+		[]entity.AVScan, error)
+	Count(ctx context.Context, sha256 string) (int, error)
+	// Diff compares two scans of a file. The last two scans are compared
+	// when no scan IDs are given.
+	Diff(ctx context.Context, sha256, from, to string) (ScanDiff, error)
+	DetectionStats(ctx context.Context) ([]EngineStats, error)
+	// EngineRates returns the detection rate of every engine, it is
+	// restricted to admins.
+	EngineRates(ctx context.Context) ([]EngineRate, error)
+	Families(ctx context.Context, offset, limit int) ([]FamilyCount, error)
+	CountFamilies(ctx context.Context) (int, error)
+	// Files returns the files classified in a family, optionally filtered
+	// by category.
+	Files(ctx context.Context, family, category string, offset, limit int) (
+		[]interface{}, error)
+	CountFiles(ctx context.Context, family, category string) (int, error)
+}
+
+type service struct {
+	repo   Repository
+	logger log.Logger
+}
+
+// ScanDiff represents the differences between two scans of a file.
+type ScanDiff struct {
+	From    entity.AVScan  `json:"from"`
+	To      entity.AVScan  `json:"to"`
+	Changes []EngineChange `json:"changes"`
+}
+
+// EngineChange represents how the result of an engine changed between two
+// scans.
+type EngineChange struct {
+	Engine string `json:"engine"`
+	// Change is one of: "detected", "cleaned", "renamed", "added", "removed".
+	Change string               `json:"change"`
+	Before *entity.EngineResult `json:"before,omitempty"`
+	After  *entity.EngineResult `json:"after,omitempty"`
+}
+
+// EngineStats represents how long an engine takes to detect the files it
+// flags, counted from the time the files were first seen.
+type EngineStats struct {
+	Engine string `json:"engine"`
+	// Number of files detected by the engine.
+	Files int `json:"files"`
+	// Number of files detected as soon as they were first seen.
+	FirstScan  int     `json:"first_scan"`
+	AvgSeconds float64 `json:"avg_seconds"`
+	MinSeconds int64   `json:"min_seconds"`
+	MaxSeconds int64   `json:"max_seconds"`
+}
+
+// EngineRate represents how often an engine flags the files it scans.
+type EngineRate struct {
+	Engine string `json:"engine"`
+	// Number of files the engine scanned in their latest scan.
+	Scanned int `json:"scanned"`
+	// Number of files the engine flagged in their latest scan.
+	Detected int     `json:"detected"`
+	Rate     float64 `json:"rate"`
+}
+
+// FamilyCount represents a malware family along with its number of files.
+type FamilyCount struct {
+	Family string `json:"family"`
+	Count  int    `json:"count"`
+}
+
+// NewService creates a new multiav service.
+func NewService(repo Repository, logger log.Logger) Service {
+	return service{repo, logger}
+}
+
+// NewScan creates the history entry of the results of a multiav scan, as
+// reported in `multiav.last_scan` of a file, keyed by engine name.
+func NewScan(sha256 string, results interface{}) (entity.AVScan, error) {
+	scan := entity.AVScan{
+		Type:      "av_scan",
+		ID:        entity.ID(),
+		SHA256:    strings.ToLower(sha256),
+		Timestamp: time.Now().Unix(),
+	}
+	data, err := json.Marshal(results)
+	if err != nil {
+		return entity.AVScan{}, errInvalidResults
+	}
+	if err = json.Unmarshal(data, &scan.Results); err != nil {
+		return entity.AVScan{}, errInvalidResults
+	}
+	scan.Classification = Classify(scan.Results)
+	return scan, nil
+}
+
+// History returns the scans of a file with the specified offset and limit.
+func (s service) History(ctx context.Context, sha256 string, offset,
+	limit int) ([]entity.AVScan, error) {
+	return s.repo.Query(ctx, sha256, offset, limit)
+}
+
+// Count returns the number of scans of a file.
+func (s service) Count(ctx context.Context, sha256 string) (int, error) {
+	return s.repo.Count(ctx, sha256)
+}
+
+// Diff compares two scans of a file.
+func (s service) Diff(ctx context.Context, sha256, from, to string) (
+	ScanDiff, error) {
+
+	var older, newer entity.AVScan
+	switch {
+	case from == "" && to == "":
+		scans, err := s.repo.Query(ctx, sha256, 0, 2)
+		if err != nil {
+			return ScanDiff{}, err
+		}
+		if len(scans) < 2 {
+			return ScanDiff{}, errNotEnoughScans
+		}
+		newer, older = scans[0], scans[1]
+	case from == "" || to == "":
+		return ScanDiff{}, errDiffParams
+	default:
+		var err error
+		if older, err = s.get(ctx, sha256, from); err != nil {
+			return ScanDiff{}, err
+		}
+		if newer, err = s.get(ctx, sha256, to); err != nil {
+			return ScanDiff{}, err
+		}
+	}
+
+	return ScanDiff{From: older, To: newer, Changes: diff(older, newer)}, nil
+}
+
+// DetectionStats returns the time-to-detection stats of every engine.
+func (s service) DetectionStats(ctx context.Context) ([]EngineStats, error) {
+	return s.repo.DetectionStats(ctx)
+}
+
+// EngineRates returns the detection rate of every engine.
+func (s service) EngineRates(ctx context.Context) ([]EngineRate, error) {
+	user, ok := ctx.Value(entity.UserKey).(entity.User)
+	if !ok || !user.IsAdmin() {
+		return nil, e.Forbidden("")
+	}
+
+	rates, err := s.repo.EngineRates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, rate := range rates {
+		if rate.Scanned > 0 {
+			rates[i].Rate = float64(rate.Detected) / float64(rate.Scanned)
+		}
+	}
+	return rates, nil
+}
+
+// Families returns the malware families with the specified offset and limit.
+func (s service) Families(ctx context.Context, offset, limit int) (
+	[]FamilyCount, error) {
+	return s.repo.Families(ctx, offset, limit)
+}
+
+// CountFamilies returns the number of malware families.
+func (s service) CountFamilies(ctx context.Context) (int, error) {
+	return s.repo.CountFamilies(ctx)
+}
+
+// Files returns the files classified in a family with the specified offset
+// and limit.
+func (s service) Files(ctx context.Context, family, category string,
+	offset, limit int) ([]interface{}, error) {
+
+	family, category, err := normalizeFilter(family, category)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.Files(ctx, family, category, offset, limit)
+}
+
+// CountFiles returns the number of files classified in a family.
+func (s service) CountFiles(ctx context.Context, family,
+	category string) (int, error) {
+
+	family, category, err := normalizeFilter(family, category)
+	if err != nil {
+		return 0, err
+	}
+	return s.repo.CountFiles(ctx, family, category)
+}
+
+// normalizeFilter returns the canonical family and category to search
+// files by. The family is validated by the handler.
+func normalizeFilter(family, category string) (string, string, error) {
+	family = NormalizeFamily(family)
+	category = strings.ToLower(strings.TrimSpace(category))
+	if category != "" {
+		if _, ok := categories[category]; !ok {
+			return "", "", errInvalidType
+		}
+		category = categories[category]
+	}
+	return family, category, nil
+}
+
+// get returns a scan of a file.
+func (s service) get(ctx context.Context, sha256, id string) (
+	entity.AVScan, error) {
+
+	if !entity.IsValidID(id) {
+		return entity.AVScan{}, errScanNotFound
+	}
+	scan, err := s.repo.Get(ctx, id)
+	if err == dbcontext.ErrDocumentNotFound {
+		return entity.AVScan{}, errScanNotFound
+	}
+	if err != nil {
+		return entity.AVScan{}, err
+	}
+	if scan.Type != "av_scan" || scan.SHA256 != strings.ToLower(sha256) {
+		return entity.AVScan{}, errScanNotFound
+	}
+	return scan, nil
+}
+
+// diff lists the engines whose result changed between two scans, sorted by
+// engine name.
+func diff(older, newer entity.AVScan) []EngineChange {
+	changes := []EngineChange{}
+	for engine, before := range older.Results {
+		before := before
+		after, ok := newer.Results[engine]
+		if !ok {
+			changes = append(changes, EngineChange{
+				Engine: engine, Change: ChangeRemoved, Before: &before})
+			continue
+		}
+
+		var change string
+		switch {
+		case !before.Infected && after.Infected:
+			change = ChangeDetected
+		case before.Infected && !after.Infected:
+			change = ChangeCleaned
+		case before.Infected && before.Output != after.Output:
+			change = ChangeRenamed
+		default:
+			continue
+		}
+		changes = append(changes, EngineChange{
+			Engine: engine, Change: change, Before: &before, After: &after})
+	}
+
+	for engine, after := range newer.Results {
+		after := after
+		if _, ok := older.Results[engine]; !ok {
+			changes = append(changes, EngineChange{
+				Engine: engine, Change: ChangeAdded, After: &after})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Engine < changes[j].Engine
+	})
+	return changes
+}
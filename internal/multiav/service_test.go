@@ -0,0 +1,75 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package multiav
+
+import (
+	"testing"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	older := entity.AVScan{Results: map[string]entity.EngineResult{
+		"avast":  {Infected: false},
+		"avira":  {Infected: true, Output: "TR/Agent.1"},
+		"clamav": {Infected: true, Output: "Win.Trojan.Agent"},
+		"eset":   {Infected: true, Output: "Win32/Emotet.A"},
+		"sophos": {Infected: false},
+	}}
+	newer := entity.AVScan{Results: map[string]entity.EngineResult{
+		"avast":     {Infected: true, Output: "Win32:Emotet"},
+		"avira":     {Infected: true, Output: "TR/Emotet.2"},
+		"clamav":    {Infected: false},
+		"eset":      {Infected: true, Output: "Win32/Emotet.A"},
+		"kaspersky": {Infected: true, Output: "Trojan.Win32.Emotet"},
+	}}
+
+	changes := diff(older, newer)
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.Engine+":"+c.Change)
+	}
+	assert.Equal(t, []string{
+		"avast:detected",
+		"avira:renamed",
+		"clamav:cleaned",
+		"kaspersky:added",
+		"sophos:removed",
+	}, got)
+
+	assert.Equal(t, "TR/Agent.1", changes[1].Before.Output)
+	assert.Equal(t, "TR/Emotet.2", changes[1].After.Output)
+	assert.Nil(t, changes[3].Before)
+	assert.Nil(t, changes[4].After)
+
+	assert.Empty(t, diff(newer, newer))
+}
+
+func TestNewScan(t *testing.T) {
+	// The results are decoded from the body of a file update request.
+	results := map[string]interface{}{
+		"avast": map[string]interface{}{
+			"infected": true, "output": "Win32:Emotet-A [Trj]"},
+		"eset": map[string]interface{}{
+			"infected": true, "output": "Win32/Emotet.A"},
+		"sophos": map[string]interface{}{"infected": false, "output": ""},
+	}
+	scan, err := NewScan("ABCDEF", results)
+	assert.Nil(t, err)
+	assert.Equal(t, "abcdef", scan.SHA256)
+	assert.Equal(t, map[string]entity.EngineResult{
+		"avast":  {Infected: true, Output: "Win32:Emotet-A [Trj]"},
+		"eset":   {Infected: true, Output: "Win32/Emotet.A"},
+		"sophos": {Infected: false},
+	}, scan.Results)
+	if assert.NotNil(t, scan.Classification) {
+		assert.Equal(t, "emotet", scan.Classification.Family)
+		assert.Equal(t, 2, scan.Classification.Engines)
+	}
+
+	_, err = NewScan("abcdef", []interface{}{"avast"})
+	assert.Equal(t, errInvalidResults, err)
+}
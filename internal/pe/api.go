@@ -0,0 +1,238 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/saferwall/saferwall-api/internal/ioc"
+	"github.com/saferwall/saferwall-api/pkg/log"
+	"github.com/saferwall/saferwall-api/pkg/pagination"
+)
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func RegisterHandlers(g *echo.Group, service Service, logger log.Logger,
+	verifyHash echo.MiddlewareFunc) {
+
+	res := resource{service, logger}
+
+	g.GET("/files/:sha256/pe/sections/", res.sections, verifyHash)
+	g.GET("/files/:sha256/pe/imports/", res.imports, verifyHash)
+	g.GET("/files/:sha256/pe/exports/", res.exports, verifyHash)
+	g.GET("/files/:sha256/pe/resources/", res.resources, verifyHash)
+	g.GET("/files/:sha256/pe/rich-header/", res.richHeader, verifyHash)
+	g.GET("/files/:sha256/pe/signature/", res.signature, verifyHash)
+	g.GET("/pe/imphash/:hash/files/", res.imphashFiles)
+	g.GET("/pe/rich-header-hash/:hash/files/", res.richHeaderHashFiles)
+}
+
+// @Summary Returns a paginated list of the sections of a PE file
+// @Description Section headers of a PE file, in the order of the section
+// @Description table, along with the entropy of the sections.
+// @Tags PE
+// @Produce json
+// @Param sha256 path string true "File SHA256"
+// @Param per_page query uint false "Number of sections per page"
+// @Param page query uint false "Specify the page number"
+// @Success 200 {object} pagination.Pages{items=[]entity.Section}
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /files/{sha256}/pe/sections/ [get]
+func (r resource) sections(c echo.Context) error {
+	ctx := c.Request().Context()
+	count, err := r.service.CountSections(ctx, c.Param("sha256"))
+	if err != nil {
+		return err
+	}
+
+	pages := pagination.NewFromRequest(c.Request(), count)
+	sections, err := r.service.Sections(ctx, c.Param("sha256"), pages.Offset(),
+		pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = sections
+	return c.JSON(http.StatusOK, pages)
+}
+
+// @Summary Returns a paginated list of the imports of a PE file
+// @Description Functions imported by a PE file, grouped by DLL.
+// @Tags PE
+// @Produce json
+// @Param sha256 path string true "File SHA256"
+// @Param per_page query uint false "Number of DLLs per page"
+// @Param page query uint false "Specify the page number"
+// @Success 200 {object} pagination.Pages{items=[]entity.Import}
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /files/{sha256}/pe/imports/ [get]
+func (r resource) imports(c echo.Context) error {
+	ctx := c.Request().Context()
+	count, err := r.service.CountImports(ctx, c.Param("sha256"))
+	if err != nil {
+		return err
+	}
+
+	pages := pagination.NewFromRequest(c.Request(), count)
+	imports, err := r.service.Imports(ctx, c.Param("sha256"), pages.Offset(),
+		pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = imports
+	return c.JSON(http.StatusOK, pages)
+}
+
+// @Summary Returns a paginated list of the exports of a PE file
+// @Description Functions exported by a PE file, including the forwarded
+// @Description ones.
+// @Tags PE
+// @Produce json
+// @Param sha256 path string true "File SHA256"
+// @Param per_page query uint false "Number of functions per page"
+// @Param page query uint false "Specify the page number"
+// @Success 200 {object} pagination.Pages{items=[]entity.ExportFunction}
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /files/{sha256}/pe/exports/ [get]
+func (r resource) exports(c echo.Context) error {
+	ctx := c.Request().Context()
+	count, err := r.service.CountExports(ctx, c.Param("sha256"))
+	if err != nil {
+		return err
+	}
+
+	pages := pagination.NewFromRequest(c.Request(), count)
+	exports, err := r.service.Exports(ctx, c.Param("sha256"), pages.Offset(),
+		pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = exports
+	return c.JSON(http.StatusOK, pages)
+}
+
+// @Summary Returns a paginated list of the resources of a PE file
+// @Description Resources of a PE file with their type, name and language.
+// @Tags PE
+// @Produce json
+// @Param sha256 path string true "File SHA256"
+// @Param per_page query uint false "Number of resources per page"
+// @Param page query uint false "Specify the page number"
+// @Success 200 {object} pagination.Pages{items=[]Resource}
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /files/{sha256}/pe/resources/ [get]
+func (r resource) resources(c echo.Context) error {
+	resources, err := r.service.Resources(c.Request().Context(),
+		c.Param("sha256"))
+	if err != nil {
+		return err
+	}
+	// Resources are stored as a tree, they are flattened then paginated in
+	// memory.
+	pages := pagination.NewFromRequest(c.Request(), len(resources))
+	start, end := pages.Bounds(len(resources))
+	pages.Items = resources[start:end]
+	return c.JSON(http.StatusOK, pages)
+}
+
+// @Summary Returns the rich header of a PE file
+// @Description Tools listed in the rich header of a PE file, along with the
+// @Description hash of the header which can be pivoted on.
+// @Tags PE
+// @Produce json
+// @Param sha256 path string true "File SHA256"
+// @Success 200 {object} RichHeader
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /files/{sha256}/pe/rich-header/ [get]
+func (r resource) richHeader(c echo.Context) error {
+	header, err := r.service.RichHeader(c.Request().Context(),
+		c.Param("sha256"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, header)
+}
+
+// @Summary Returns the Authenticode signature of a PE file
+// @Description Whether a PE file is signed, the signature verifies and the
+// @Description certificates of the signer chain.
+// @Tags PE
+// @Produce json
+// @Param sha256 path string true "File SHA256"
+// @Success 200 {object} entity.Signature
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /files/{sha256}/pe/signature/ [get]
+func (r resource) signature(c echo.Context) error {
+	signature, err := r.service.Signature(c.Request().Context(),
+		c.Param("sha256"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, signature)
+}
+
+// @Summary Returns the files sharing an imphash
+// @Description Lists the PE files whose imports hash to the same value,
+// @Description most recently seen first.
+// @Tags PE
+// @Produce json
+// @Param hash path string true "Imphash"
+// @Param per_page query uint false "Number of files per page"
+// @Param page query uint false "Specify the page number"
+// @Success 200 {object} pagination.Pages{items=[]entity.IOCSample}
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /pe/imphash/{hash}/files/ [get]
+func (r resource) imphashFiles(c echo.Context) error {
+	return r.files(c, ioc.KindImphash)
+}
+
+// @Summary Returns the files sharing a rich header hash
+// @Description Lists the PE files built with the same tools according to
+// @Description their rich header, most recently seen first.
+// @Tags PE
+// @Produce json
+// @Param hash path string true "Rich header hash"
+// @Param per_page query uint false "Number of files per page"
+// @Param page query uint false "Specify the page number"
+// @Success 200 {object} pagination.Pages{items=[]entity.IOCSample}
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /pe/rich-header-hash/{hash}/files/ [get]
+func (r resource) richHeaderHashFiles(c echo.Context) error {
+	return r.files(c, ioc.KindRichHeaderHash)
+}
+
+func (r resource) files(c echo.Context, kind string) error {
+	ctx := c.Request().Context()
+	count, err := r.service.CountFiles(ctx, kind, c.Param("hash"))
+	if err != nil {
+		return err
+	}
+
+	pages := pagination.NewFromRequest(c.Request(), count)
+	files, err := r.service.Files(ctx, kind, c.Param("hash"), pages.Offset(),
+		pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = files
+	return c.JSON(http.StatusOK, pages)
+}
@@ -0,0 +1,108 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"context"
+
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+// Arrays of the PE of a file which are paginated in the database.
+const (
+	arraySections = "sections"
+	arrayImports  = "imports"
+	arrayExports  = "exports"
+)
+
+// Repository encapsulates the logic to access the PE of files from the
+// data source.
+type Repository interface {
+	// Get returns some top level attributes of the PE of a file.
+	Get(ctx context.Context, sha256 string, attrs []string) (entity.PE, error)
+	// List reads a page of an array of the PE of a file into val, a pointer
+	// to a slice which is left untouched when the page is empty.
+	List(ctx context.Context, sha256, array string, offset, limit int,
+		val interface{}) error
+	// Count returns the length of an array of the PE of a file.
+	Count(ctx context.Context, sha256, array string) (int, error)
+}
+
+// repository reads the PE of files from database.
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new PE repository.
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads attributes of the PE of a file from the database, the ones
+// missing from the document are left empty.
+func (r repository) Get(ctx context.Context, sha256 string, attrs []string) (
+	entity.PE, error) {
+
+	paths := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		paths = append(paths, "pe."+attr)
+	}
+
+	var file entity.File
+	_, err := r.db.LookupWithCAS(ctx, file.ID(sha256), paths, &file)
+	if err != nil || file.PE == nil {
+		return entity.PE{}, err
+	}
+	return *file.PE, nil
+}
+
+// List reads a page of an array of the PE of a file from the database.
+func (r repository) List(ctx context.Context, sha256, array string, offset,
+	limit int, val interface{}) error {
+
+	var results interface{}
+	params := make(map[string]interface{}, 3)
+	params["sha256"] = sha256
+	params["offset"] = offset
+	params["limit"] = limit
+
+	query, _ := r.queries(array)
+	err := r.db.Query(ctx, query, params, &results)
+	if err != nil {
+		return err
+	}
+	return dbcontext.Decode(results, val)
+}
+
+// Count counts the items of an array of the PE of a file in the database.
+func (r repository) Count(ctx context.Context, sha256, array string) (
+	int, error) {
+
+	var count int
+	params := make(map[string]interface{}, 1)
+	params["sha256"] = sha256
+
+	_, query := r.queries(array)
+	err := r.db.Count(ctx, query, params, &count)
+	return count, err
+}
+
+// queries returns the queries listing and counting the items of an array.
+func (r repository) queries(array string) (list, count string) {
+	switch array {
+	case arraySections:
+		return r.db.N1QLQuery[dbcontext.PESections],
+			r.db.N1QLQuery[dbcontext.CountPESections]
+	case arrayImports:
+		return r.db.N1QLQuery[dbcontext.PEImports],
+			r.db.N1QLQuery[dbcontext.CountPEImports]
+	default:
+		return r.db.N1QLQuery[dbcontext.PEExports],
+			r.db.N1QLQuery[dbcontext.CountPEExports]
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"strconv"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+)
+
+// resourceTypes names the predefined resource types by ID.
+var resourceTypes = map[uint32]string{
+	1:  "RT_CURSOR",
+	2:  "RT_BITMAP",
+	3:  "RT_ICON",
+	4:  "RT_MENU",
+	5:  "RT_DIALOG",
+	6:  "RT_STRING",
+	7:  "RT_FONTDIR",
+	8:  "RT_FONT",
+	9:  "RT_ACCELERATOR",
+	10: "RT_RCDATA",
+	11: "RT_MESSAGETABLE",
+	12: "RT_GROUP_CURSOR",
+	14: "RT_GROUP_ICON",
+	16: "RT_VERSION",
+	17: "RT_DLGINCLUDE",
+	19: "RT_PLUGPLAY",
+	20: "RT_VXD",
+	21: "RT_ANICURSOR",
+	22: "RT_ANIICON",
+	23: "RT_HTML",
+	24: "RT_MANIFEST",
+}
+
+// Resource represents a resource of a PE file.
+type Resource struct {
+	// Type is either a predefined type like `RT_ICON`, a custom type name
+	// or the `#` prefixed ID of a custom type.
+	Type string `json:"type"`
+	// Name is either the name or the `#` prefixed ID of the resource.
+	Name     string `json:"name"`
+	Lang     uint32 `json:"lang"`
+	SubLang  uint32 `json:"sub_lang"`
+	CodePage uint32 `json:"code_page"`
+	// Offset is the RVA of the resource data.
+	Offset uint32 `json:"offset"`
+	Size   uint32 `json:"size"`
+}
+
+// flatten lists the resources of a resources tree, whose levels are the
+// types, the names and the languages.
+func flatten(root *entity.ResourceDirectory) []Resource {
+	resources := []Resource{}
+	var walk func(dir *entity.ResourceDirectory, path []entity.ResourceEntry)
+	walk = func(dir *entity.ResourceDirectory, path []entity.ResourceEntry) {
+		if dir == nil {
+			return
+		}
+		for _, entry := range dir.Entries {
+			path := append(path[:len(path):len(path)], entry)
+			if data := entry.Data; data != nil {
+				r := Resource{
+					Type:     typeName(path[0]),
+					Lang:     data.Lang,
+					SubLang:  data.SubLang,
+					CodePage: data.CodePage,
+					Offset:   data.OffsetToData,
+					Size:     data.Size,
+				}
+				if len(path) > 1 {
+					r.Name = entryName(path[1])
+				}
+				resources = append(resources, r)
+			}
+			walk(entry.Directory, path)
+		}
+	}
+	walk(root, nil)
+	return resources
+}
+
+// typeName returns the name of the type of the resources of an entry of
+// the first level.
+func typeName(entry entity.ResourceEntry) string {
+	if name, ok := resourceTypes[entry.ID]; ok && entry.Name == "" {
+		return name
+	}
+	return entryName(entry)
+}
+
+func entryName(entry entity.ResourceEntry) string {
+	if entry.Name != "" {
+		return entry.Name
+	}
+	return "#" + strconv.FormatUint(uint64(entry.ID), 10)
+}
@@ -0,0 +1,195 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"context"
+	"strings"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+	e "github.com/saferwall/saferwall-api/internal/errors"
+	"github.com/saferwall/saferwall-api/internal/ioc"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+// Service encapsulates usecase logic for the PE of files.
+type Service interface {
+	// Sections returns the section headers along with the entropy of the
+	// sections, with the specified offset and limit.
+	Sections(ctx context.Context, sha256 string, offset, limit int) (
+		[]entity.Section, error)
+	CountSections(ctx context.Context, sha256 string) (int, error)
+	// Imports returns the imported functions grouped by DLL, with the
+	// specified offset and limit.
+	Imports(ctx context.Context, sha256 string, offset, limit int) (
+		[]entity.Import, error)
+	CountImports(ctx context.Context, sha256 string) (int, error)
+	// Exports returns the exported functions with the specified offset and
+	// limit.
+	Exports(ctx context.Context, sha256 string, offset, limit int) (
+		[]entity.ExportFunction, error)
+	CountExports(ctx context.Context, sha256 string) (int, error)
+	// Resources returns the resources, flattened out of their tree.
+	Resources(ctx context.Context, sha256 string) ([]Resource, error)
+	// RichHeader returns the rich header along with its hash.
+	RichHeader(ctx context.Context, sha256 string) (RichHeader, error)
+	// Signature returns the Authenticode signature.
+	Signature(ctx context.Context, sha256 string) (entity.Signature, error)
+	// Files returns the files sharing a PE hash, `kind` is either
+	// ioc.KindImphash or ioc.KindRichHeaderHash.
+	Files(ctx context.Context, kind, hash string, offset, limit int) (
+		[]entity.IOCSample, error)
+	CountFiles(ctx context.Context, kind, hash string) (int, error)
+}
+
+// RichHeader represents the rich header of a PE file.
+type RichHeader struct {
+	XORKey     uint32          `json:"xor_key"`
+	DansOffset int             `json:"dans_offset"`
+	CompIDs    []entity.CompID `json:"comp_ids"`
+	// Hash is the MD5 of the decoded header, files built with the same
+	// tools share it.
+	Hash string `json:"hash"`
+}
+
+type service struct {
+	repo   Repository
+	logger log.Logger
+	iocSvc ioc.Service
+}
+
+// NewService creates a new PE service.
+func NewService(repo Repository, logger log.Logger, iocSvc ioc.Service) Service {
+	return service{repo, logger, iocSvc}
+}
+
+// Sections returns a page of the section headers of a file.
+func (s service) Sections(ctx context.Context, sha256 string, offset,
+	limit int) ([]entity.Section, error) {
+
+	sections := []entity.Section{}
+	err := s.repo.List(ctx, sha256, arraySections, offset, limit, &sections)
+	return sections, err
+}
+
+// CountSections returns the number of sections of a file.
+func (s service) CountSections(ctx context.Context, sha256 string) (
+	int, error) {
+	return s.repo.Count(ctx, sha256, arraySections)
+}
+
+// Imports returns a page of the imports of a file by DLL.
+func (s service) Imports(ctx context.Context, sha256 string, offset,
+	limit int) ([]entity.Import, error) {
+
+	imports := []entity.Import{}
+	err := s.repo.List(ctx, sha256, arrayImports, offset, limit, &imports)
+	return imports, err
+}
+
+// CountImports returns the number of DLLs a file imports.
+func (s service) CountImports(ctx context.Context, sha256 string) (
+	int, error) {
+	return s.repo.Count(ctx, sha256, arrayImports)
+}
+
+// Exports returns a page of the exported functions of a file.
+func (s service) Exports(ctx context.Context, sha256 string, offset,
+	limit int) ([]entity.ExportFunction, error) {
+
+	exports := []entity.ExportFunction{}
+	err := s.repo.List(ctx, sha256, arrayExports, offset, limit, &exports)
+	return exports, err
+}
+
+// CountExports returns the number of functions a file exports.
+func (s service) CountExports(ctx context.Context, sha256 string) (
+	int, error) {
+	return s.repo.Count(ctx, sha256, arrayExports)
+}
+
+// Resources returns the resources of a file.
+func (s service) Resources(ctx context.Context, sha256 string) (
+	[]Resource, error) {
+
+	pe, err := s.repo.Get(ctx, sha256, []string{"resources"})
+	if err != nil {
+		return nil, err
+	}
+	return flatten(pe.Resources), nil
+}
+
+// RichHeader returns the rich header of a file, it fails when the file has
+// none.
+func (s service) RichHeader(ctx context.Context, sha256 string) (
+	RichHeader, error) {
+
+	pe, err := s.repo.Get(ctx, sha256, []string{"rich_header"})
+	if err != nil {
+		return RichHeader{}, err
+	}
+	rich := pe.RichHeader
+	if rich == nil || len(rich.CompIDs) == 0 && len(rich.Raw) == 0 {
+		return RichHeader{}, e.NotFound("the file has no rich header")
+	}
+	header := RichHeader{
+		XORKey:     rich.XORKey,
+		DansOffset: rich.DansOffset,
+		CompIDs:    rich.CompIDs,
+		Hash:       rich.Hash(),
+	}
+	if header.CompIDs == nil {
+		header.CompIDs = []entity.CompID{}
+	}
+	return header, nil
+}
+
+// Signature returns the signature of a file, it fails when the file is not
+// signed.
+func (s service) Signature(ctx context.Context, sha256 string) (
+	entity.Signature, error) {
+
+	pe, err := s.repo.Get(ctx, sha256, []string{"signature"})
+	if err != nil {
+		return entity.Signature{}, err
+	}
+	if pe.Signature == nil {
+		return entity.Signature{}, e.NotFound("the file is not signed")
+	}
+	return *pe.Signature, nil
+}
+
+// Files returns the files sharing an imphash or a rich header hash, most
+// recently seen first.
+func (s service) Files(ctx context.Context, kind, hash string, offset,
+	limit int) ([]entity.IOCSample, error) {
+
+	hash, err := checkHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	return s.iocSvc.Samples(ctx, hash, kind, offset, limit)
+}
+
+// CountFiles returns the number of files sharing an imphash or a rich
+// header hash.
+func (s service) CountFiles(ctx context.Context, kind, hash string) (
+	int, error) {
+
+	hash, err := checkHash(hash)
+	if err != nil {
+		return 0, err
+	}
+	return s.iocSvc.CountSamples(ctx, hash, kind)
+}
+
+// checkHash normalizes a hash pivoted on.
+func checkHash(hash string) (string, error) {
+	hash = strings.ToLower(strings.TrimSpace(hash))
+	if !ioc.RegMD5.MatchString(hash) {
+		return "", e.BadRequest("invalid hash, an MD5 is expected")
+	}
+	return hash, nil
+}
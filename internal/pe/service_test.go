@@ -0,0 +1,156 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+	e "github.com/saferwall/saferwall-api/internal/errors"
+	"github.com/saferwall/saferwall-api/internal/ioc"
+	"github.com/saferwall/saferwall-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSHA256 = "131f95c51cc819465fa1797f6ccacf9d494aaaff46fa3eac73ae63ffbdfd8267"
+
+// mockRepository serves the PE of a single file.
+type mockRepository struct {
+	pe entity.PE
+}
+
+func (m mockRepository) Get(ctx context.Context, sha256 string,
+	attrs []string) (entity.PE, error) {
+	return m.pe, nil
+}
+
+// array returns the items of an array of the PE.
+func (m mockRepository) array(array string) []interface{} {
+	var items interface{}
+	switch array {
+	case arraySections:
+		items = m.pe.Sections
+	case arrayImports:
+		items = m.pe.Imports
+	case arrayExports:
+		if m.pe.Export != nil {
+			items = m.pe.Export.Functions
+		}
+	}
+	var list []interface{}
+	data, _ := json.Marshal(items)
+	_ = json.Unmarshal(data, &list)
+	return list
+}
+
+func (m mockRepository) List(ctx context.Context, sha256, array string,
+	offset, limit int, val interface{}) error {
+	items := m.array(array)
+	if offset >= len(items) {
+		return nil
+	}
+	items = items[offset:min(offset+limit, len(items))]
+	data, _ := json.Marshal(items)
+	return json.Unmarshal(data, val)
+}
+
+func (m mockRepository) Count(ctx context.Context, sha256,
+	array string) (int, error) {
+	return len(m.array(array)), nil
+}
+
+// mockIOCService records the lookups of the pivots.
+type mockIOCService struct {
+	ioc.Service
+	lookups *[]string
+}
+
+func (m mockIOCService) Samples(ctx context.Context, value, kind string,
+	offset, limit int) ([]entity.IOCSample, error) {
+	*m.lookups = append(*m.lookups, kind+":"+value)
+	return []entity.IOCSample{{SHA256: testSHA256}}, nil
+}
+
+func newTestService(t *testing.T, doc string) Service {
+	var pe entity.PE
+	assert.Nil(t, json.Unmarshal([]byte(doc), &pe))
+	return NewService(mockRepository{pe}, log.New(), nil)
+}
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t, `{
+		"sections": [{"name": ".text", "entropy": 6.5},
+			{"name": ".data", "entropy": 4.5}],
+		"rich_header": {"xor_key": 1, "comp_ids": [
+			{"prod_id": 260, "minor_cv": 30729, "count": 5}]},
+		"resources": {"entries": [
+			{"id": 3, "directory": {"entries": [
+				{"id": 1, "directory": {"entries": [
+					{"id": 1033, "data": {"offset_to_data": 4096,
+						"size": 744, "lang": 9, "sub_lang": 1}}]}}]}},
+			{"name": "CONFIG", "directory": {"entries": [
+				{"name": "MAIN", "directory": {"entries": [
+					{"id": 0, "data": {"size": 12}}]}}]}}
+		]}
+	}`)
+
+	sections, err := s.Sections(ctx, testSHA256, 1, 10)
+	assert.Nil(t, err)
+	assert.Len(t, sections, 1)
+	assert.Equal(t, ".data", sections[0].Name)
+	assert.Equal(t, 4.5, *sections[0].Entropy)
+	count, err := s.CountSections(ctx, testSHA256)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	// Missing parts are empty lists.
+	imports, err := s.Imports(ctx, testSHA256, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []entity.Import{}, imports)
+	exports, err := s.Exports(ctx, testSHA256, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []entity.ExportFunction{}, exports)
+	count, err = s.CountExports(ctx, testSHA256)
+	assert.Nil(t, err)
+	assert.Zero(t, count)
+
+	resources, err := s.Resources(ctx, testSHA256)
+	assert.Nil(t, err)
+	assert.Equal(t, []Resource{
+		{Type: "RT_ICON", Name: "#1", Lang: 9, SubLang: 1, Offset: 4096,
+			Size: 744},
+		{Type: "CONFIG", Name: "MAIN", Size: 12},
+	}, resources)
+
+	rich, err := s.RichHeader(ctx, testSHA256)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), rich.XORKey)
+	assert.Len(t, rich.CompIDs, 1)
+	assert.Regexp(t, "^[a-f0-9]{32}$", rich.Hash)
+
+	_, err = s.Signature(ctx, testSHA256)
+	assert.Equal(t, e.NotFound("the file is not signed"), err)
+	_, err = newTestService(t, `{}`).RichHeader(ctx, testSHA256)
+	assert.Equal(t, e.NotFound("the file has no rich header"), err)
+}
+
+func TestFiles(t *testing.T) {
+	var lookups []string
+	s := NewService(mockRepository{}, log.New(),
+		mockIOCService{lookups: &lookups})
+
+	files, err := s.Files(context.Background(), ioc.KindRichHeaderHash,
+		" A6BE9ACDF2E22974889B7C72407260AD", 0, 10)
+	assert.Nil(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, []string{
+		"rich_header_hash:a6be9acdf2e22974889b7c72407260ad"}, lookups)
+
+	_, err = s.Files(context.Background(), ioc.KindImphash, "kernel32", 0, 10)
+	assert.Equal(t, e.BadRequest("invalid hash, an MD5 is expected"), err)
+}
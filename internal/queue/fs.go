@@ -0,0 +1,79 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/saferwall/saferwall-api/internal/config"
+)
+
+func init() {
+	Register(FS, NewFS)
+}
+
+var errInvalidTopic = errors.New("invalid topic name")
+
+// fsProducer writes every message to its own file under a directory per
+// topic, it is meant for local development. Files are named after the time
+// they were written so that they can be consumed in order.
+type fsProducer struct {
+	root string
+	seq  *uint64
+}
+
+// NewFS creates a new filesystem producer writing under the directory the
+// broker address points to.
+func NewFS(cfg config.BrokerCfg) (Producer, error) {
+	if err := os.MkdirAll(cfg.Address, 0o750); err != nil {
+		return nil, err
+	}
+	return fsProducer{root: cfg.Address, seq: new(uint64)}, nil
+}
+
+// Produce writes a message to a new file of the topic directory. The file
+// is written under a temporary name and synced before being renamed, so
+// consumers never see partial messages.
+func (p fsProducer) Produce(topic string, message []byte) error {
+	if topic == "" || strings.ContainsAny(topic, `/\`) || topic[0] == '.' {
+		return errInvalidTopic
+	}
+	dir := filepath.Join(p.root, topic)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%020d-%06d.msg", time.Now().UnixNano(),
+		atomic.AddUint64(p.seq, 1)%1000000)
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(message); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, name))
+}
+
+// Close does nothing, every message is written as soon as it is produced.
+func (p fsProducer) Close() error {
+	return nil
+}
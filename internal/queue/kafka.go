@@ -0,0 +1,71 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package queue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/saferwall/saferwall-api/internal/config"
+	"github.com/segmentio/kafka-go"
+)
+
+func init() {
+	Register(Kafka, NewKafka)
+}
+
+// Timeout for a message to be acknowledged by the brokers.
+const kafkaTimeout = 10 * time.Second
+
+// kafkaProducer writes messages to Kafka.
+type kafkaProducer struct {
+	writer *kafka.Writer
+}
+
+// NewKafka creates a new Kafka producer. The address is a comma separated
+// list of brokers.
+func NewKafka(cfg config.BrokerCfg) (Producer, error) {
+	var brokers []string
+	for _, addr := range strings.Split(cfg.Address, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			brokers = append(brokers, addr)
+		}
+	}
+	if len(brokers) == 0 {
+		return nil, errors.New("no kafka broker address")
+	}
+
+	// Make sure the cluster is reachable before accepting requests.
+	conn, err := kafka.Dial("tcp", brokers[0])
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.Close(); err != nil {
+		return nil, err
+	}
+
+	return kafkaProducer{&kafka.Writer{
+		Addr:                   kafka.TCP(brokers...),
+		Balancer:               &kafka.LeastBytes{},
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+	}}, nil
+}
+
+// Produce writes a message to a topic and waits for all in-sync replicas to
+// acknowledge it.
+func (p kafkaProducer) Produce(topic string, message []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaTimeout)
+	defer cancel()
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Topic: topic, Value: message})
+}
+
+// Close flushes the pending messages and closes the connections.
+func (p kafkaProducer) Close() error {
+	return p.writer.Close()
+}
@@ -0,0 +1,53 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package queue
+
+import (
+	"sync"
+
+	"github.com/saferwall/saferwall-api/internal/config"
+)
+
+func init() {
+	Register(Memory, func(config.BrokerCfg) (Producer, error) {
+		return NewMemory(), nil
+	})
+}
+
+// MemoryProducer keeps the messages in memory, it is meant for local
+// development and tests.
+type MemoryProducer struct {
+	mu       sync.Mutex
+	messages map[string][][]byte
+}
+
+// NewMemory creates a new in-memory producer.
+func NewMemory() *MemoryProducer {
+	return &MemoryProducer{messages: make(map[string][][]byte)}
+}
+
+// Produce appends a message to a topic.
+func (p *MemoryProducer) Produce(topic string, message []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	msg := make([]byte, len(message))
+	copy(msg, message)
+	p.messages[topic] = append(p.messages[topic], msg)
+	return nil
+}
+
+// Messages removes and returns the messages written to a topic.
+func (p *MemoryProducer) Messages(topic string) [][]byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	messages := p.messages[topic]
+	delete(p.messages, topic)
+	return messages
+}
+
+// Close does nothing, messages are kept until read.
+func (p *MemoryProducer) Close() error {
+	return nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package queue
+
+import (
+	"github.com/nats-io/nats.go"
+	"github.com/saferwall/saferwall-api/internal/config"
+)
+
+func init() {
+	Register(NATS, NewNATS)
+}
+
+// natsProducer publishes messages to NATS JetStream, topics are mapped to
+// subjects. A stream must capture the subjects for messages to be
+// acknowledged.
+type natsProducer struct {
+	conn *nats.Conn
+	js   nats.JetStreamContext
+}
+
+// NewNATS creates a new NATS JetStream producer.
+func NewNATS(cfg config.BrokerCfg) (Producer, error) {
+	conn, err := nats.Connect(cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return natsProducer{conn, js}, nil
+}
+
+// Produce publishes a message to a subject and waits for the stream to
+// acknowledge it.
+func (p natsProducer) Produce(topic string, message []byte) error {
+	_, err := p.js.Publish(topic, message)
+	return err
+}
+
+// Close flushes the pending messages and closes the connection.
+func (p natsProducer) Close() error {
+	err := p.conn.Drain()
+	return err
+}
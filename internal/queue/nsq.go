@@ -0,0 +1,44 @@
+// Copyright 2021 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package queue
+
+import (
+	"github.com/nsqio/go-nsq"
+	"github.com/saferwall/saferwall-api/internal/config"
+)
+
+func init() {
+	Register(NSQ, NewNSQ)
+}
+
+// nsqProducer wraps the NSQ producer object.
+type nsqProducer struct {
+	producer *nsq.Producer
+}
+
+// NewNSQ creates a new NSQ producer connected to nsqd.
+func NewNSQ(cfg config.BrokerCfg) (Producer, error) {
+	p, err := nsq.NewProducer(cfg.Address, nsq.NewConfig())
+	if err != nil {
+		return nil, err
+	}
+	if err = p.Ping(); err != nil {
+		p.Stop()
+		return nil, err
+	}
+	return nsqProducer{p}, nil
+}
+
+// Produce writes a message to a topic. Publish waits for nsqd to
+// acknowledge the message.
+func (p nsqProducer) Produce(topic string, message []byte) error {
+	return p.producer.Publish(topic, message)
+}
+
+// Close stops the producer.
+func (p nsqProducer) Close() error {
+	p.producer.Stop()
+	return nil
+}
@@ -5,35 +5,61 @@
 package queue
 
 import (
-	"github.com/nsqio/go-nsq"
+	"fmt"
+	"sync"
+
+	"github.com/saferwall/saferwall-api/internal/config"
+)
+
+// Kinds of message brokers.
+const (
+	NSQ    = "nsq"
+	NATS   = "nats"
+	Kafka  = "kafka"
+	Memory = "memory"
+	FS     = "fs"
 )
 
-// Producer wraps the NSQ producer object.
-type Producer struct {
-	Producer *nsq.Producer
+// Producer writes messages to a message broker.
+type Producer interface {
+	// Produce writes a message to a topic. It only returns once the broker
+	// acknowledged the message, so a nil error means the message is safe.
+	Produce(topic string, message []byte) error
+	// Close flushes the pending messages and releases the connection.
+	Close() error
 }
 
-// New creates a new NSQ producer.
-func New(address, topic string) (Producer, error) {
+// Factory creates a producer out of the broker config.
+type Factory func(cfg config.BrokerCfg) (Producer, error)
 
-	config := nsq.NewConfig()
-	p, err := nsq.NewProducer(address, config)
-	if err != nil {
-		return Producer{}, err
-	}
-	if p.Ping() != nil {
-		return Producer{}, err
-	}
+var (
+	mu       sync.RWMutex
+	backends = make(map[string]Factory)
+)
 
-	return Producer{p}, nil
+// Register makes a message broker backend available under the given kind.
+func Register(kind string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	backends[kind] = factory
 }
 
-// Produce writes a message to the connection's topic.
-func (p Producer) Produce(topic string, message []byte) error {
+// Kind returns the kind of message broker a config selects, it defaults to
+// NSQ.
+func Kind(cfg config.BrokerCfg) string {
+	if cfg.Kind == "" {
+		return NSQ
+	}
+	return cfg.Kind
+}
 
-	err := p.Producer.Publish(topic, message)
-	if err != nil {
-		return err
+// New creates a producer for the message broker the config selects.
+func New(cfg config.BrokerCfg) (Producer, error) {
+	mu.RLock()
+	factory, ok := backends[Kind(cfg)]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown message broker kind %q", cfg.Kind)
 	}
-	return nil
+	return factory(cfg)
 }
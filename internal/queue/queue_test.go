@@ -0,0 +1,60 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package queue
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/saferwall/saferwall-api/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New(config.BrokerCfg{Kind: "carrier-pigeon"})
+	assert.NotNil(t, err)
+
+	// An unreachable broker must fail the producer creation.
+	p, err := New(config.BrokerCfg{Address: "127.0.0.1:1"})
+	assert.NotNil(t, err)
+	assert.Nil(t, p)
+
+	p, err = New(config.BrokerCfg{Kind: Memory})
+	assert.Nil(t, err)
+	assert.IsType(t, &MemoryProducer{}, p)
+}
+
+func TestMemoryProducer(t *testing.T) {
+	p := NewMemory()
+	msg := []byte("hello")
+	assert.Nil(t, p.Produce("scan", msg))
+	msg[0] = 'j'
+	assert.Nil(t, p.Produce("scan", []byte("world")))
+
+	assert.Equal(t, [][]byte{[]byte("hello"), []byte("world")},
+		p.Messages("scan"))
+	assert.Empty(t, p.Messages("scan"))
+	assert.Nil(t, p.Close())
+}
+
+func TestFSProducer(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewFS(config.BrokerCfg{Address: dir})
+	assert.Nil(t, err)
+
+	assert.Nil(t, p.Produce("scan", []byte("first")))
+	assert.Nil(t, p.Produce("scan", []byte("second")))
+	assert.Equal(t, errInvalidTopic, p.Produce("../scan", []byte("x")))
+
+	entries, err := os.ReadDir(filepath.Join(dir, "scan"))
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	for i, want := range []string{"first", "second"} {
+		data, err := os.ReadFile(filepath.Join(dir, "scan", entries[i].Name()))
+		assert.Nil(t, err)
+		assert.Equal(t, want, string(data))
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package rescan
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func RegisterHandlers(g *echo.Group, service Service, logger log.Logger,
+	requireLogin echo.MiddlewareFunc) {
+
+	res := resource{service, logger}
+
+	g.GET("/rescan/policy/", res.policy, requireLogin)
+	g.PUT("/rescan/policy/", res.updatePolicy, requireLogin)
+}
+
+// @Summary Returns the rescan policy
+// @Description Rules regular users must follow to rescan files.
+// @Tags Rescan
+// @Produce json
+// @Success 200 {object} entity.RescanPolicy
+// @Failure 401 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /rescan/policy/ [get]
+// @Security Bearer
+func (r resource) policy(c echo.Context) error {
+	policy, err := r.service.Policy(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, policy)
+}
+
+// @Summary Update the rescan policy
+// @Description Set who may rescan files, how often, and who may request
+// @Description high priority rescans. Restricted to admins.
+// @Tags Rescan
+// @Accept json
+// @Produce json
+// @Param data body UpdatePolicyRequest true "Rescan policy"
+// @Success 200 {object} entity.RescanPolicy
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 401 {object} errors.ErrorResponse
+// @Failure 403 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /rescan/policy/ [put]
+// @Security Bearer
+func (r resource) updatePolicy(c echo.Context) error {
+	var input UpdatePolicyRequest
+	ctx := c.Request().Context()
+	if err := c.Bind(&input); err != nil {
+		r.logger.With(ctx).Info(err)
+		return err
+	}
+
+	policy, err := r.service.UpdatePolicy(ctx, input)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, policy)
+}
@@ -0,0 +1,80 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package rescan
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+// Key of the document holding the rescan policy.
+const policyKey = "rescan_policy"
+
+// Repository encapsulates the logic to access the rescan policy and quotas
+// from the data source.
+type Repository interface {
+	// Policy returns the rescan policy.
+	Policy(ctx context.Context) (entity.RescanPolicy, error)
+	// SavePolicy creates or replaces the rescan policy.
+	SavePolicy(ctx context.Context, policy entity.RescanPolicy) error
+	// Acquire counts a rescan against the quota of a user for the window
+	// starting at the given time, and returns the number of rescans the
+	// user requested in that window.
+	Acquire(ctx context.Context, username string, window time.Time,
+		length time.Duration) (uint64, error)
+	// Release gives back a rescan counted by Acquire in the window starting
+	// at the given time.
+	Release(ctx context.Context, username string, window time.Time) error
+}
+
+// repository persists the rescan policy and quotas in database.
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new rescan repository.
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Policy reads the rescan policy from the database.
+func (r repository) Policy(ctx context.Context) (entity.RescanPolicy, error) {
+	var policy entity.RescanPolicy
+	err := r.db.Get(ctx, policyKey, &policy)
+	return policy, err
+}
+
+// SavePolicy saves the rescan policy in the database.
+func (r repository) SavePolicy(ctx context.Context,
+	policy entity.RescanPolicy) error {
+	return r.db.Upsert(ctx, policyKey, &policy)
+}
+
+// Acquire increments the rescan counter of a user in the database. Counters
+// expire along with their window.
+func (r repository) Acquire(ctx context.Context, username string,
+	window time.Time, length time.Duration) (uint64, error) {
+
+	return r.db.Counter(ctx, quotaKey(username, window), 1, length)
+}
+
+// Release decrements the rescan counter of a user in the database.
+func (r repository) Release(ctx context.Context, username string,
+	window time.Time) error {
+	return r.db.Uncount(ctx, quotaKey(username, window), 1)
+}
+
+// quotaKey returns the key of the rescan counter of a user for a window.
+func quotaKey(username string, window time.Time) string {
+	return "rescan_quota::" + strings.ToLower(username) + "::" +
+		strconv.FormatInt(window.Unix(), 10)
+}
@@ -0,0 +1,170 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package rescan
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	e "github.com/saferwall/saferwall-api/internal/errors"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+// Priorities of a scan, each one is routed to its own topic.
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+)
+
+// Who may request high priority rescans.
+const (
+	Everyone = "everyone"
+	Admins   = "admins"
+)
+
+// Length of the window rescans are counted in.
+const quotaWindow = time.Hour
+
+var (
+	// DefaultPolicy applies until an admin sets one.
+	DefaultPolicy = entity.RescanPolicy{
+		Type:           "rescan_policy",
+		Enabled:        true,
+		MaxPerHour:     20,
+		HighPriority:   Admins,
+		PendingTimeout: 3600,
+	}
+
+	errRescanDisabled   = e.Forbidden("rescans are currently restricted to admins")
+	errHighPriority     = e.Forbidden("high priority rescans are restricted to admins")
+	errNotAdministrator = e.Forbidden("")
+)
+
+// Service encapsulates usecase logic for the rescan policy.
+type Service interface {
+	Policy(ctx context.Context) (entity.RescanPolicy, error)
+	UpdatePolicy(ctx context.Context, input UpdatePolicyRequest) (
+		entity.RescanPolicy, error)
+	// Authorize checks whether the logged-in user may rescan a file with
+	// the given priority, and returns the policy in effect.
+	Authorize(ctx context.Context, priority string) (entity.RescanPolicy, error)
+	// Consume counts a rescan against the hourly quota of the logged-in
+	// user.
+	Consume(ctx context.Context, policy entity.RescanPolicy) error
+	// Release gives back a rescan counted by Consume, when the rescan could
+	// not be queued.
+	Release(ctx context.Context, policy entity.RescanPolicy) error
+}
+
+type service struct {
+	repo   Repository
+	logger log.Logger
+}
+
+// UpdatePolicyRequest represents a rescan policy update request.
+type UpdatePolicyRequest struct {
+	Enabled        bool   `json:"enabled"`
+	MaxPerHour     int    `json:"max_per_hour" validate:"min=0,max=10000"`
+	HighPriority   string `json:"high_priority" validate:"required,oneof=everyone admins"`
+	PendingTimeout int64  `json:"pending_timeout" validate:"min=60,max=604800"`
+}
+
+// NewService creates a new rescan service.
+func NewService(repo Repository, logger log.Logger) Service {
+	return service{repo, logger}
+}
+
+// Policy returns the rescan policy in effect.
+func (s service) Policy(ctx context.Context) (entity.RescanPolicy, error) {
+	policy, err := s.repo.Policy(ctx)
+	if err == dbcontext.ErrDocumentNotFound {
+		return DefaultPolicy, nil
+	}
+	return policy, err
+}
+
+// UpdatePolicy replaces the rescan policy, it is restricted to admins.
+func (s service) UpdatePolicy(ctx context.Context,
+	req UpdatePolicyRequest) (entity.RescanPolicy, error) {
+
+	user, ok := ctx.Value(entity.UserKey).(entity.User)
+	if !ok || !user.IsAdmin() {
+		return entity.RescanPolicy{}, errNotAdministrator
+	}
+
+	policy := entity.RescanPolicy{
+		Type:           "rescan_policy",
+		Enabled:        req.Enabled,
+		MaxPerHour:     req.MaxPerHour,
+		HighPriority:   req.HighPriority,
+		PendingTimeout: req.PendingTimeout,
+		UpdatedBy:      user.ID(),
+		UpdatedAt:      time.Now().Unix(),
+	}
+	if err := s.repo.SavePolicy(ctx, policy); err != nil {
+		return entity.RescanPolicy{}, err
+	}
+	return policy, nil
+}
+
+// Authorize checks the rescan request of the logged-in user against the
+// policy. Admins are always allowed.
+func (s service) Authorize(ctx context.Context, priority string) (
+	entity.RescanPolicy, error) {
+
+	policy, err := s.Policy(ctx)
+	if err != nil {
+		return entity.RescanPolicy{}, err
+	}
+
+	user, _ := ctx.Value(entity.UserKey).(entity.User)
+	if user.IsAdmin() {
+		return policy, nil
+	}
+	if !policy.Enabled {
+		return policy, errRescanDisabled
+	}
+	if priority == PriorityHigh && policy.HighPriority != Everyone {
+		return policy, errHighPriority
+	}
+	return policy, nil
+}
+
+// Consume counts a rescan against the quota of the logged-in user. Admins
+// have no quota.
+func (s service) Consume(ctx context.Context,
+	policy entity.RescanPolicy) error {
+
+	user, _ := ctx.Value(entity.UserKey).(entity.User)
+	if user.IsAdmin() || policy.MaxPerHour == 0 {
+		return nil
+	}
+
+	window := time.Now().Truncate(quotaWindow)
+	count, err := s.repo.Acquire(ctx, user.ID(), window, quotaWindow)
+	if err != nil {
+		return err
+	}
+	if count > uint64(policy.MaxPerHour) {
+		return e.TooManyRequests(fmt.Sprintf(
+			"you may rescan up to %d files per hour", policy.MaxPerHour))
+	}
+	return nil
+}
+
+// Release undoes Consume for the logged-in user.
+func (s service) Release(ctx context.Context,
+	policy entity.RescanPolicy) error {
+
+	user, _ := ctx.Value(entity.UserKey).(entity.User)
+	if user.IsAdmin() || policy.MaxPerHour == 0 {
+		return nil
+	}
+	return s.repo.Release(ctx, user.ID(), time.Now().Truncate(quotaWindow))
+}
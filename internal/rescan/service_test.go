@@ -0,0 +1,95 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package rescan
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	e "github.com/saferwall/saferwall-api/internal/errors"
+	"github.com/saferwall/saferwall-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockRepository struct {
+	policy *entity.RescanPolicy
+	counts map[string]uint64
+}
+
+func (m *mockRepository) Policy(ctx context.Context) (entity.RescanPolicy, error) {
+	if m.policy == nil {
+		return entity.RescanPolicy{}, dbcontext.ErrDocumentNotFound
+	}
+	return *m.policy, nil
+}
+
+func (m *mockRepository) SavePolicy(ctx context.Context,
+	policy entity.RescanPolicy) error {
+	m.policy = &policy
+	return nil
+}
+
+func (m *mockRepository) Acquire(ctx context.Context, username string,
+	window time.Time, length time.Duration) (uint64, error) {
+	m.counts[username]++
+	return m.counts[username], nil
+}
+
+func (m *mockRepository) Release(ctx context.Context, username string,
+	window time.Time) error {
+	m.counts[username]--
+	return nil
+}
+
+func withUser(username string, admin bool) context.Context {
+	return context.WithValue(context.Background(), entity.UserKey,
+		entity.User{Username: username, Admin: admin})
+}
+
+func TestService(t *testing.T) {
+	repo := &mockRepository{counts: map[string]uint64{}}
+	s := NewService(repo, log.New())
+
+	// The default policy applies until an admin sets one.
+	policy, err := s.Policy(withUser("alice", false))
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultPolicy, policy)
+
+	_, err = s.UpdatePolicy(withUser("alice", false), UpdatePolicyRequest{})
+	assert.Equal(t, http.StatusForbidden, err.(e.ErrorResponse).StatusCode())
+
+	policy, err = s.UpdatePolicy(withUser("admin", true), UpdatePolicyRequest{
+		Enabled: true, MaxPerHour: 2, HighPriority: Admins,
+		PendingTimeout: 600})
+	assert.Nil(t, err)
+	assert.Equal(t, "admin", policy.UpdatedBy)
+
+	ctx := withUser("alice", false)
+	_, err = s.Authorize(ctx, PriorityHigh)
+	assert.Equal(t, errHighPriority, err)
+	policy, err = s.Authorize(ctx, PriorityNormal)
+	assert.Nil(t, err)
+
+	assert.Nil(t, s.Consume(ctx, policy))
+	assert.Nil(t, s.Consume(ctx, policy))
+	// A released rescan does not count against the quota.
+	assert.Nil(t, s.Release(ctx, policy))
+	assert.Nil(t, s.Consume(ctx, policy))
+	err = s.Consume(ctx, policy)
+	assert.Equal(t, http.StatusTooManyRequests,
+		err.(e.ErrorResponse).StatusCode())
+
+	// Admins are not subject to the policy.
+	admin := withUser("admin", true)
+	_, err = s.Authorize(admin, PriorityHigh)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Consume(admin, policy))
+	assert.Nil(t, s.Release(admin, policy))
+	assert.Zero(t, repo.counts["admin"])
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func RegisterHandlers(g *echo.Group, service Service, logger log.Logger,
+	requireLogin, optionalLogin, verifyUser echo.MiddlewareFunc) {
+
+	res := resource{service, logger}
+
+	g.GET("/sandbox/options/", res.options, optionalLogin)
+	g.GET("/sandbox/limits/:username/", res.limits, verifyUser, requireLogin)
+	g.PUT("/sandbox/limits/:username/", res.updateLimits, verifyUser,
+		requireLogin)
+	g.DELETE("/sandbox/limits/:username/", res.deleteLimits, verifyUser,
+		requireLogin)
+}
+
+// @Summary Returns the dynamic analysis options
+// @Description List the OS images, countries and timeout range available
+// @Description to the logged-in user when detonating a file.
+// @Tags Sandbox
+// @Produce json
+// @Success 200 {object} Options
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /sandbox/options/ [get]
+func (r resource) options(c echo.Context) error {
+	opts, err := r.service.Options(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, opts)
+}
+
+// @Summary Returns the sandbox limits of a user
+// @Description Dynamic analysis options granted to a user. Restricted to
+// @Description admins.
+// @Tags Sandbox
+// @Produce json
+// @Param username path string true "Username"
+// @Success 200 {object} entity.SandboxLimits
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 401 {object} errors.ErrorResponse
+// @Failure 403 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /sandbox/limits/{username}/ [get]
+// @Security Bearer
+func (r resource) limits(c echo.Context) error {
+	limits, err := r.service.Limits(c.Request().Context(),
+		c.Param("username"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, limits)
+}
+
+// @Summary Update the sandbox limits of a user
+// @Description Grant longer timeouts or restricted OS images to a user.
+// @Description Restricted to admins.
+// @Tags Sandbox
+// @Accept json
+// @Produce json
+// @Param username path string true "Username"
+// @Param data body UpdateLimitsRequest true "Sandbox limits"
+// @Success 200 {object} entity.SandboxLimits
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 401 {object} errors.ErrorResponse
+// @Failure 403 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /sandbox/limits/{username}/ [put]
+// @Security Bearer
+func (r resource) updateLimits(c echo.Context) error {
+	var input UpdateLimitsRequest
+	ctx := c.Request().Context()
+	if err := c.Bind(&input); err != nil {
+		r.logger.With(ctx).Info(err)
+		return err
+	}
+
+	limits, err := r.service.UpdateLimits(ctx, c.Param("username"), input)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, limits)
+}
+
+// @Summary Reset the sandbox limits of a user
+// @Description Revoke the dynamic analysis options granted to a user.
+// @Description Restricted to admins.
+// @Tags Sandbox
+// @Param username path string true "Username"
+// @Success 200 {object} entity.SandboxLimits
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 401 {object} errors.ErrorResponse
+// @Failure 403 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /sandbox/limits/{username}/ [delete]
+// @Security Bearer
+func (r resource) deleteLimits(c echo.Context) error {
+	limits, err := r.service.DeleteLimits(c.Request().Context(),
+		c.Param("username"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, limits)
+}
@@ -0,0 +1,60 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"context"
+	"strings"
+
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+// Repository encapsulates the logic to access the per-user sandbox limits
+// from the data source.
+type Repository interface {
+	// Limits returns the sandbox limits of a user.
+	Limits(ctx context.Context, username string) (entity.SandboxLimits, error)
+	// SaveLimits creates or replaces the sandbox limits of a user.
+	SaveLimits(ctx context.Context, limits entity.SandboxLimits) error
+	// DeleteLimits removes the sandbox limits of a user.
+	DeleteLimits(ctx context.Context, username string) error
+}
+
+// repository persists the sandbox limits in database.
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new sandbox repository.
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// key returns the document key of the sandbox limits of a user.
+func key(username string) string {
+	return "sandbox_limits::" + strings.ToLower(username)
+}
+
+// Limits reads the sandbox limits of a user from the database.
+func (r repository) Limits(ctx context.Context, username string) (
+	entity.SandboxLimits, error) {
+	var limits entity.SandboxLimits
+	err := r.db.Get(ctx, key(username), &limits)
+	return limits, err
+}
+
+// SaveLimits saves the sandbox limits of a user in the database.
+func (r repository) SaveLimits(ctx context.Context,
+	limits entity.SandboxLimits) error {
+	return r.db.Upsert(ctx, key(limits.Username), &limits)
+}
+
+// DeleteLimits deletes the sandbox limits of a user from the database.
+func (r repository) DeleteLimits(ctx context.Context, username string) error {
+	return r.db.Delete(ctx, key(username))
+}
@@ -0,0 +1,329 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/saferwall/saferwall-api/internal/config"
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	e "github.com/saferwall/saferwall-api/internal/errors"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+// Catalogue used for the settings missing from the config.
+const (
+	defaultOSImage           = "win-10"
+	defaultTimeout           = 30
+	defaultMinTimeout        = 10
+	defaultMaxTimeout        = 300
+	defaultMaxTrustedTimeout = 1800
+)
+
+var (
+	errNotAdministrator = e.Forbidden("")
+)
+
+// Service encapsulates usecase logic for dynamic analysis options.
+type Service interface {
+	// Options returns the dynamic analysis options available to the
+	// logged-in user.
+	Options(ctx context.Context) (Options, error)
+	// Resolve fills the defaults of a detonation request and checks it
+	// against the options available to the logged-in user.
+	Resolve(ctx context.Context, req Request) (Request, error)
+	Limits(ctx context.Context, username string) (entity.SandboxLimits, error)
+	UpdateLimits(ctx context.Context, username string,
+		input UpdateLimitsRequest) (entity.SandboxLimits, error)
+	DeleteLimits(ctx context.Context, username string) (
+		entity.SandboxLimits, error)
+}
+
+type service struct {
+	repo      Repository
+	logger    log.Logger
+	catalogue config.SandboxCfg
+}
+
+// Options represents the dynamic analysis options available to a user.
+type Options struct {
+	OSImages  []OSImage `json:"os_images"`
+	Countries []string  `json:"countries"`
+	Timeout   Timeout   `json:"timeout"`
+}
+
+// OSImage represents an OS image samples can be detonated in.
+type OSImage struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Default     bool   `json:"default"`
+}
+
+// Timeout represents the range of timeouts in seconds a user may request.
+type Timeout struct {
+	Min     int `json:"min"`
+	Max     int `json:"max"`
+	Default int `json:"default"`
+}
+
+// Request represents the options of a detonation request.
+type Request struct {
+	OS      string
+	Country string
+	Timeout int
+}
+
+// UpdateLimitsRequest represents a sandbox limits update request.
+type UpdateLimitsRequest struct {
+	MaxTimeout int      `json:"max_timeout" validate:"min=0"`
+	OSImages   []string `json:"os_images" validate:"max=20,dive,required,max=32"`
+}
+
+// NewService creates a new sandbox service. The settings missing from the
+// catalogue take their default value.
+func NewService(repo Repository, logger log.Logger,
+	catalogue config.SandboxCfg) Service {
+	return service{repo, logger, withDefaults(catalogue)}
+}
+
+// withDefaults fills the settings missing from a catalogue.
+func withDefaults(c config.SandboxCfg) config.SandboxCfg {
+	if len(c.OSImages) == 0 {
+		c.OSImages = []config.OSImageCfg{{Name: defaultOSImage}}
+	}
+	images := make([]config.OSImageCfg, len(c.OSImages))
+	copy(images, c.OSImages)
+	c.OSImages = images
+
+	// Exactly one image available to everyone is the default.
+	def := -1
+	for i, image := range c.OSImages {
+		if image.Default && !image.Restricted && def < 0 {
+			def = i
+		}
+		c.OSImages[i].Default = false
+	}
+	if def < 0 {
+		for i, image := range c.OSImages {
+			if !image.Restricted {
+				def = i
+				break
+			}
+		}
+	}
+	if def >= 0 {
+		c.OSImages[def].Default = true
+	}
+
+	if c.MinTimeout <= 0 {
+		c.MinTimeout = defaultMinTimeout
+	}
+	if c.MaxTimeout <= 0 {
+		c.MaxTimeout = defaultMaxTimeout
+	}
+	if c.MaxTimeout < c.MinTimeout {
+		c.MaxTimeout = c.MinTimeout
+	}
+	if c.MaxTrustedTimeout <= 0 {
+		c.MaxTrustedTimeout = defaultMaxTrustedTimeout
+	}
+	if c.MaxTrustedTimeout < c.MaxTimeout {
+		c.MaxTrustedTimeout = c.MaxTimeout
+	}
+	if c.DefaultTimeout <= 0 {
+		c.DefaultTimeout = defaultTimeout
+	}
+	c.DefaultTimeout = clamp(c.DefaultTimeout, c.MinTimeout, c.MaxTimeout)
+	return c
+}
+
+// Options returns the dynamic analysis options available to the logged-in
+// user. Anonymous users get the options available to everyone.
+func (s service) Options(ctx context.Context) (Options, error) {
+	user, _ := ctx.Value(entity.UserKey).(entity.User)
+
+	var limits entity.SandboxLimits
+	if user.Username != "" && !user.IsAdmin() {
+		var err error
+		limits, err = s.repo.Limits(ctx, user.Username)
+		if err != nil && err != dbcontext.ErrDocumentNotFound {
+			return Options{}, err
+		}
+	}
+	return s.options(user.IsAdmin(), limits), nil
+}
+
+// options returns the part of the catalogue available to a user. Admins
+// have access to everything.
+func (s service) options(admin bool, limits entity.SandboxLimits) Options {
+	granted := make(map[string]bool, len(limits.OSImages))
+	for _, name := range limits.OSImages {
+		granted[name] = true
+	}
+
+	opts := Options{
+		OSImages:  []OSImage{},
+		Countries: append([]string{}, s.catalogue.Countries...),
+		Timeout: Timeout{
+			Min:     s.catalogue.MinTimeout,
+			Max:     s.catalogue.MaxTimeout,
+			Default: s.catalogue.DefaultTimeout,
+		},
+	}
+	for _, image := range s.catalogue.OSImages {
+		if image.Restricted && !admin && !granted[image.Name] {
+			continue
+		}
+		opts.OSImages = append(opts.OSImages, OSImage{
+			Name:        image.Name,
+			Description: image.Description,
+			Default:     image.Default,
+		})
+	}
+
+	if admin {
+		opts.Timeout.Max = s.catalogue.MaxTrustedTimeout
+	} else if limits.MaxTimeout > opts.Timeout.Max {
+		opts.Timeout.Max = clamp(limits.MaxTimeout, opts.Timeout.Max,
+			s.catalogue.MaxTrustedTimeout)
+	}
+	return opts
+}
+
+// Resolve fills the defaults of a detonation request and checks it against
+// the options available to the logged-in user.
+func (s service) Resolve(ctx context.Context, req Request) (Request, error) {
+	opts, err := s.Options(ctx)
+	if err != nil {
+		return Request{}, err
+	}
+
+	if req.OS == "" {
+		for _, image := range opts.OSImages {
+			if image.Default {
+				req.OS = image.Name
+			}
+		}
+	}
+	found := false
+	for _, image := range opts.OSImages {
+		found = found || image.Name == req.OS
+	}
+	if !found {
+		return Request{}, e.BadRequest(
+			fmt.Sprintf("os image %q is not available", req.OS))
+	}
+
+	// An empty country means the traffic is not routed.
+	if req.Country != "" && !slices.Contains(opts.Countries, req.Country) {
+		return Request{}, e.BadRequest(
+			fmt.Sprintf("country %q is not available", req.Country))
+	}
+
+	if req.Timeout == 0 {
+		req.Timeout = opts.Timeout.Default
+	}
+	if req.Timeout < opts.Timeout.Min || req.Timeout > opts.Timeout.Max {
+		return Request{}, e.BadRequest(fmt.Sprintf(
+			"timeout must be between %d and %d seconds", opts.Timeout.Min,
+			opts.Timeout.Max))
+	}
+	return req, nil
+}
+
+// Limits returns the sandbox limits of a user, it is restricted to admins.
+func (s service) Limits(ctx context.Context, username string) (
+	entity.SandboxLimits, error) {
+
+	if !isAdmin(ctx) {
+		return entity.SandboxLimits{}, errNotAdministrator
+	}
+	limits, err := s.repo.Limits(ctx, username)
+	if err == dbcontext.ErrDocumentNotFound {
+		return entity.SandboxLimits{
+			Type:     "sandbox_limits",
+			Username: strings.ToLower(username),
+			OSImages: []string{},
+		}, nil
+	}
+	return limits, err
+}
+
+// UpdateLimits grants dynamic analysis options to a user, it is restricted
+// to admins.
+func (s service) UpdateLimits(ctx context.Context, username string,
+	req UpdateLimitsRequest) (entity.SandboxLimits, error) {
+
+	if !isAdmin(ctx) {
+		return entity.SandboxLimits{}, errNotAdministrator
+	}
+	if req.MaxTimeout > s.catalogue.MaxTrustedTimeout {
+		return entity.SandboxLimits{}, e.BadRequest(fmt.Sprintf(
+			"max timeout can not exceed %d seconds",
+			s.catalogue.MaxTrustedTimeout))
+	}
+	images := []string{}
+	for _, name := range req.OSImages {
+		known := false
+		for _, image := range s.catalogue.OSImages {
+			known = known || image.Name == name
+		}
+		if !known {
+			return entity.SandboxLimits{}, e.BadRequest(
+				fmt.Sprintf("unknown os image %q", name))
+		}
+		if !slices.Contains(images, name) {
+			images = append(images, name)
+		}
+	}
+	user, _ := ctx.Value(entity.UserKey).(entity.User)
+	limits := entity.SandboxLimits{
+		Type:       "sandbox_limits",
+		Username:   strings.ToLower(username),
+		MaxTimeout: req.MaxTimeout,
+		OSImages:   images,
+		UpdatedBy:  user.ID(),
+		UpdatedAt:  time.Now().Unix(),
+	}
+	if err := s.repo.SaveLimits(ctx, limits); err != nil {
+		return entity.SandboxLimits{}, err
+	}
+	return limits, nil
+}
+
+// DeleteLimits revokes the dynamic analysis options granted to a user, it
+// is restricted to admins. It returns the revoked limits.
+func (s service) DeleteLimits(ctx context.Context, username string) (
+	entity.SandboxLimits, error) {
+
+	limits, err := s.Limits(ctx, username)
+	if err != nil || limits.UpdatedAt == 0 {
+		return limits, err
+	}
+	if err = s.repo.DeleteLimits(ctx, username); err != nil {
+		return entity.SandboxLimits{}, err
+	}
+	return limits, nil
+}
+
+func isAdmin(ctx context.Context) bool {
+	user, ok := ctx.Value(entity.UserKey).(entity.User)
+	return ok && user.IsAdmin()
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -0,0 +1,153 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/saferwall/saferwall-api/internal/config"
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	e "github.com/saferwall/saferwall-api/internal/errors"
+	"github.com/saferwall/saferwall-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockRepository struct {
+	limits map[string]entity.SandboxLimits
+}
+
+func (m *mockRepository) Limits(ctx context.Context, username string) (
+	entity.SandboxLimits, error) {
+	limits, ok := m.limits[username]
+	if !ok {
+		return entity.SandboxLimits{}, dbcontext.ErrDocumentNotFound
+	}
+	return limits, nil
+}
+
+func (m *mockRepository) SaveLimits(ctx context.Context,
+	limits entity.SandboxLimits) error {
+	m.limits[limits.Username] = limits
+	return nil
+}
+
+func (m *mockRepository) DeleteLimits(ctx context.Context,
+	username string) error {
+	delete(m.limits, username)
+	return nil
+}
+
+func withUser(username string, admin bool) context.Context {
+	return context.WithValue(context.Background(), entity.UserKey,
+		entity.User{Username: username, Admin: admin})
+}
+
+func statusCode(err error) int {
+	return err.(e.ErrorResponse).StatusCode()
+}
+
+var catalogue = config.SandboxCfg{
+	OSImages: []config.OSImageCfg{
+		{Name: "win-7", Restricted: true, Default: true},
+		{Name: "win-10", Description: "Windows 10 x64"},
+	},
+	Countries:         []string{"fr", "us"},
+	MaxTimeout:        300,
+	MaxTrustedTimeout: 1800,
+}
+
+func TestOptions(t *testing.T) {
+	repo := &mockRepository{limits: map[string]entity.SandboxLimits{}}
+	s := NewService(repo, log.New(), catalogue)
+
+	// Restricted images are never the default.
+	opts, err := s.Options(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, Options{
+		OSImages: []OSImage{
+			{Name: "win-10", Description: "Windows 10 x64", Default: true}},
+		Countries: []string{"fr", "us"},
+		Timeout:   Timeout{Min: 10, Max: 300, Default: 30},
+	}, opts)
+
+	opts, err = s.Options(withUser("admin", true))
+	assert.Nil(t, err)
+	assert.Len(t, opts.OSImages, 2)
+	assert.Equal(t, 1800, opts.Timeout.Max)
+
+	repo.limits["mike"] = entity.SandboxLimits{
+		Username: "mike", MaxTimeout: 600, OSImages: []string{"win-7"}}
+	opts, err = s.Options(withUser("mike", false))
+	assert.Nil(t, err)
+	assert.Len(t, opts.OSImages, 2)
+	assert.Equal(t, 600, opts.Timeout.Max)
+}
+
+func TestResolve(t *testing.T) {
+	repo := &mockRepository{limits: map[string]entity.SandboxLimits{}}
+	s := NewService(repo, log.New(), catalogue)
+	ctx := withUser("alice", false)
+
+	req, err := s.Resolve(ctx, Request{})
+	assert.Nil(t, err)
+	assert.Equal(t, Request{OS: "win-10", Timeout: 30}, req)
+
+	req, err = s.Resolve(ctx, Request{OS: "win-10", Country: "fr",
+		Timeout: 120})
+	assert.Nil(t, err)
+	assert.Equal(t, Request{OS: "win-10", Country: "fr", Timeout: 120}, req)
+
+	_, err = s.Resolve(ctx, Request{OS: "win-7"})
+	assert.Equal(t, http.StatusBadRequest, statusCode(err))
+	_, err = s.Resolve(ctx, Request{Country: "ru"})
+	assert.Equal(t, http.StatusBadRequest, statusCode(err))
+	_, err = s.Resolve(ctx, Request{Timeout: 5})
+	assert.Equal(t, http.StatusBadRequest, statusCode(err))
+	_, err = s.Resolve(ctx, Request{Timeout: 600})
+	assert.Equal(t, http.StatusBadRequest, statusCode(err))
+
+	// Long timeouts are only available to trusted users.
+	_, err = s.Resolve(withUser("admin", true), Request{Timeout: 600})
+	assert.Nil(t, err)
+}
+
+func TestLimits(t *testing.T) {
+	repo := &mockRepository{limits: map[string]entity.SandboxLimits{}}
+	s := NewService(repo, log.New(), catalogue)
+	admin := withUser("admin", true)
+
+	_, err := s.UpdateLimits(withUser("alice", false), "alice",
+		UpdateLimitsRequest{MaxTimeout: 600})
+	assert.Equal(t, http.StatusForbidden, statusCode(err))
+
+	_, err = s.UpdateLimits(admin, "alice",
+		UpdateLimitsRequest{MaxTimeout: 3600})
+	assert.Equal(t, http.StatusBadRequest, statusCode(err))
+	_, err = s.UpdateLimits(admin, "alice",
+		UpdateLimitsRequest{OSImages: []string{"win-xp"}})
+	assert.Equal(t, http.StatusBadRequest, statusCode(err))
+
+	limits, err := s.UpdateLimits(admin, "Alice", UpdateLimitsRequest{
+		MaxTimeout: 600, OSImages: []string{"win-7", "win-7"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", limits.Username)
+	assert.Equal(t, []string{"win-7"}, limits.OSImages)
+	assert.Equal(t, "admin", limits.UpdatedBy)
+
+	_, err = s.Resolve(withUser("alice", false), Request{OS: "win-7",
+		Timeout: 600})
+	assert.Nil(t, err)
+
+	limits, err = s.DeleteLimits(admin, "alice")
+	assert.Nil(t, err)
+	assert.Equal(t, 600, limits.MaxTimeout)
+	limits, err = s.Limits(admin, "alice")
+	assert.Nil(t, err)
+	assert.Zero(t, limits.MaxTimeout)
+	assert.Empty(t, limits.OSImages)
+}
@@ -0,0 +1,163 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package scheduler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/saferwall/saferwall-api/pkg/log"
+	"github.com/saferwall/saferwall-api/pkg/pagination"
+)
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func RegisterHandlers(g *echo.Group, service Service,
+	logger log.Logger, requireLogin echo.MiddlewareFunc,
+	verifyID echo.MiddlewareFunc) {
+
+	res := resource{service, logger}
+
+	g.GET("/schedules/", res.list, requireLogin)
+	g.POST("/schedules/", res.create, requireLogin)
+	g.GET("/schedules/:id/", res.get, verifyID, requireLogin)
+	g.PATCH("/schedules/:id/", res.update, verifyID, requireLogin)
+	g.DELETE("/schedules/:id/", res.delete, verifyID, requireLogin)
+}
+
+// @Summary Retrieves a paginated list of scan schedules
+// @Description List the policies periodically rescanning files. Restricted
+// @Description to admins.
+// @Tags Scheduler
+// @Produce json
+// @Param per_page query uint false "Number of schedules per page"
+// @Param page query uint false "Specify the page number"
+// @Success 200 {object} pagination.Pages{items=[]entity.ScanSchedule}
+// @Failure 401 {object} errors.ErrorResponse
+// @Failure 403 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /schedules/ [get]
+// @Security Bearer
+func (r resource) list(c echo.Context) error {
+	ctx := c.Request().Context()
+	count, err := r.service.Count(ctx)
+	if err != nil {
+		return err
+	}
+
+	pages := pagination.NewFromRequest(c.Request(), count)
+	schedules, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = schedules
+	return c.JSON(http.StatusOK, pages)
+}
+
+// @Summary Create a new scan schedule
+// @Description Periodically rescan the files whose last scan is stale,
+// @Description optionally restricted to a tag or to popular files.
+// @Description Restricted to admins.
+// @Tags Scheduler
+// @Accept json
+// @Produce json
+// @Param data body CreateScheduleRequest true "Schedule body"
+// @Success 201 {object} entity.ScanSchedule
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 401 {object} errors.ErrorResponse
+// @Failure 403 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /schedules/ [post]
+// @Security Bearer
+func (r resource) create(c echo.Context) error {
+	var input CreateScheduleRequest
+	ctx := c.Request().Context()
+	if err := c.Bind(&input); err != nil {
+		r.logger.With(ctx).Info(err)
+		return err
+	}
+
+	schedule, err := r.service.Create(ctx, input)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, schedule)
+}
+
+// @Summary Retrieves a scan schedule
+// @Description Get a scan schedule by ID. Restricted to admins.
+// @Tags Scheduler
+// @Produce json
+// @Param id path string true "Schedule ID"
+// @Success 200 {object} entity.ScanSchedule
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 401 {object} errors.ErrorResponse
+// @Failure 403 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /schedules/{id}/ [get]
+// @Security Bearer
+func (r resource) get(c echo.Context) error {
+	schedule, err := r.service.Get(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, schedule)
+}
+
+// @Summary Update a scan schedule
+// @Description Change the rule, the pace or pause a scan schedule.
+// @Description Restricted to admins.
+// @Tags Scheduler
+// @Accept json
+// @Produce json
+// @Param id path string true "Schedule ID"
+// @Param data body UpdateScheduleRequest true "Schedule body"
+// @Success 200 {object} entity.ScanSchedule
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 401 {object} errors.ErrorResponse
+// @Failure 403 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /schedules/{id}/ [patch]
+// @Security Bearer
+func (r resource) update(c echo.Context) error {
+	var input UpdateScheduleRequest
+	ctx := c.Request().Context()
+	if err := c.Bind(&input); err != nil {
+		r.logger.With(ctx).Info(err)
+		return err
+	}
+
+	schedule, err := r.service.Update(ctx, c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, schedule)
+}
+
+// @Summary Delete a scan schedule
+// @Description Delete a scan schedule by ID. Restricted to admins.
+// @Tags Scheduler
+// @Produce json
+// @Param id path string true "Schedule ID"
+// @Success 200 {object} entity.ScanSchedule
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 401 {object} errors.ErrorResponse
+// @Failure 403 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /schedules/{id}/ [delete]
+// @Security Bearer
+func (r resource) delete(c echo.Context) error {
+	schedule, err := r.service.Delete(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, schedule)
+}
@@ -0,0 +1,35 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package scheduler
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	e "github.com/saferwall/saferwall-api/internal/errors"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+type middleware struct {
+	logger log.Logger
+}
+
+// NewMiddleware creates a new scheduler Middleware.
+func NewMiddleware(logger log.Logger) middleware {
+	return middleware{logger}
+}
+
+// VerifyID validates the schedule ID.
+func (m middleware) VerifyID(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := strings.ToLower(c.Param("id"))
+		if !entity.IsValidID(id) {
+			m.logger.Error("failed to match regex for schedule ID %v", id)
+			return e.BadRequest("invalid ID string")
+		}
+		return next(c)
+	}
+}
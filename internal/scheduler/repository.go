@@ -0,0 +1,150 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package scheduler
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+// Key of the lock document electing the scheduler leader.
+const lockKey = "scheduler_lock"
+
+// Repository encapsulates the logic to access the scan schedules from the
+// data source.
+type Repository interface {
+	// Get returns the schedule with the specified ID.
+	Get(ctx context.Context, id string) (entity.ScanSchedule, error)
+	// Create saves a new schedule in the storage.
+	Create(ctx context.Context, schedule entity.ScanSchedule) error
+	// Update updates the schedule with given ID in the storage.
+	Update(ctx context.Context, schedule entity.ScanSchedule) error
+	// Delete removes the schedule with given ID from the storage.
+	Delete(ctx context.Context, id string) error
+	// Query returns the schedules with the given offset and limit.
+	Query(ctx context.Context, offset, limit int) ([]entity.ScanSchedule, error)
+	// Count returns the number of schedules.
+	Count(ctx context.Context) (int, error)
+	// MarkRun records the outcome of a run of a schedule.
+	MarkRun(ctx context.Context, id string, ts int64, enqueued int) error
+	// StaleFiles returns the files last scanned before a given time which
+	// match the given tag and minimum number of submissions. An empty tag
+	// matches every file.
+	StaleFiles(ctx context.Context, before int64, tag string,
+		minSubmissions, limit int) ([]string, error)
+	// Lock elects the scheduler leader, it returns true when owner holds
+	// the lock.
+	Lock(ctx context.Context, owner string, ttl time.Duration) (bool, error)
+}
+
+// repository persists the scan schedules in database.
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new scheduler repository.
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the schedule with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (
+	entity.ScanSchedule, error) {
+	var schedule entity.ScanSchedule
+	err := r.db.Get(ctx, strings.ToLower(id), &schedule)
+	return schedule, err
+}
+
+// Create saves a new schedule in the database.
+func (r repository) Create(ctx context.Context,
+	schedule entity.ScanSchedule) error {
+	return r.db.Create(ctx, schedule.ID, &schedule)
+}
+
+// Update saves the changes to a schedule in the database.
+func (r repository) Update(ctx context.Context,
+	schedule entity.ScanSchedule) error {
+	_, err := r.db.Update(ctx, schedule.ID, &schedule, 0)
+	return err
+}
+
+// Delete deletes the schedule with the specified ID from the database.
+func (r repository) Delete(ctx context.Context, id string) error {
+	return r.db.Delete(ctx, strings.ToLower(id))
+}
+
+// Query retrieves the schedules from the database.
+func (r repository) Query(ctx context.Context, offset, limit int) (
+	[]entity.ScanSchedule, error) {
+
+	var results interface{}
+	params := make(map[string]interface{}, 1)
+	params["offset"] = offset
+	params["limit"] = limit
+
+	query := r.db.N1QLQuery[dbcontext.ScanSchedules]
+	err := r.db.Query(ctx, query, params, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	schedules := []entity.ScanSchedule{}
+	err = dbcontext.Decode(results, &schedules)
+	return schedules, err
+}
+
+// Count returns the number of schedules in the database.
+func (r repository) Count(ctx context.Context) (int, error) {
+	var count int
+	query := r.db.N1QLQuery[dbcontext.CountScanSchedules]
+	err := r.db.Count(ctx, query, nil, &count)
+	return count, err
+}
+
+// MarkRun updates the last run of a schedule in the database without
+// touching the fields admins may have changed meanwhile.
+func (r repository) MarkRun(ctx context.Context, id string, ts int64,
+	enqueued int) error {
+
+	_, err := r.db.MutateIn(ctx, id, []dbcontext.MutateOp{
+		{Kind: dbcontext.MutateUpsert, Path: "last_run", Value: ts},
+		{Kind: dbcontext.MutateUpsert, Path: "last_enqueued", Value: enqueued},
+	}, 0)
+	return err
+}
+
+// StaleFiles retrieves the files due for a rescan from the database.
+func (r repository) StaleFiles(ctx context.Context, before int64, tag string,
+	minSubmissions, limit int) ([]string, error) {
+
+	var results interface{}
+	params := make(map[string]interface{}, 1)
+	params["before"] = before
+	params["tag"] = tag
+	params["min_submissions"] = minSubmissions
+	params["limit"] = limit
+
+	query := r.db.N1QLQuery[dbcontext.StaleFiles]
+	err := r.db.Query(ctx, query, params, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	err = dbcontext.Decode(results, &files)
+	return files, err
+}
+
+// Lock acquires or renews the scheduler lock in the database.
+func (r repository) Lock(ctx context.Context, owner string,
+	ttl time.Duration) (bool, error) {
+	return r.db.Lock(ctx, lockKey, owner, ttl)
+}
@@ -0,0 +1,185 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/saferwall/saferwall-api/internal/file"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+const (
+	// How often the due schedules are looked for.
+	tickInterval = 30 * time.Second
+	// The leader loses the lock when it does not renew it in time.
+	lockTTL = 2 * time.Minute
+)
+
+// errLostLeadership stops a run when another instance took the lock over.
+var errLostLeadership = errors.New("scheduler lock was taken over")
+
+// Enqueuer queues file rescans.
+type Enqueuer interface {
+	Enqueue(ctx context.Context, sha256 string,
+		input file.FileScanRequest) error
+}
+
+// Scheduler periodically rescans the files matching the scan schedules.
+// Only one API instance, the one holding the scheduler lock, runs the
+// schedules at any time.
+type Scheduler struct {
+	repo     Repository
+	enqueuer Enqueuer
+	logger   log.Logger
+	// owner identifies this instance in the lock document.
+	owner string
+	// delay between two rescans, it bounds the enqueue rate.
+	delay time.Duration
+	// renewed is the time the lock was last acquired or renewed at.
+	renewed time.Time
+}
+
+// New creates a new scheduler enqueuing at most maxRate rescans per minute.
+func New(repo Repository, enqueuer Enqueuer, maxRate int,
+	logger log.Logger) *Scheduler {
+
+	if maxRate <= 0 {
+		maxRate = 60
+	}
+	return &Scheduler{
+		repo:     repo,
+		enqueuer: enqueuer,
+		logger:   logger,
+		owner:    entity.ID(),
+		delay:    time.Minute / time.Duration(maxRate),
+	}
+}
+
+// Run runs the due schedules until the context is canceled.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.tick(ctx)
+		}
+	}
+}
+
+// tick runs the due schedules provided this instance is the leader.
+func (s *Scheduler) tick(ctx context.Context) {
+	s.renewed = time.Time{}
+	leader, err := s.keepLock(ctx)
+	if err != nil {
+		s.logger.Error(err)
+		return
+	}
+	if !leader {
+		return
+	}
+
+	schedules, err := s.repo.Query(ctx, 0, maxSchedules)
+	if err != nil {
+		s.logger.Error(err)
+		return
+	}
+	for _, schedule := range schedules {
+		if !due(schedule, time.Now()) {
+			continue
+		}
+		err = s.run(ctx, schedule)
+		if errors.Is(err, errLostLeadership) {
+			s.logger.Infof("schedule %s stopped: %v", schedule.ID, err)
+			return
+		}
+		if err != nil {
+			s.logger.Errorf("failed to run schedule %s: %v", schedule.ID, err)
+			return
+		}
+	}
+}
+
+// keepLock renews the scheduler lock once half of its TTL elapsed since it
+// was last renewed, it returns false when another instance holds it.
+func (s *Scheduler) keepLock(ctx context.Context) (bool, error) {
+	if time.Since(s.renewed) <= lockTTL/2 {
+		return true, nil
+	}
+	// The TTL runs from before the request, the lock may expire earlier
+	// than it is thought otherwise.
+	start := time.Now()
+	leader, err := s.repo.Lock(ctx, s.owner, lockTTL)
+	if err != nil || !leader {
+		return false, err
+	}
+	s.renewed = start
+	return true, nil
+}
+
+// run rescans the files matching a schedule at a bounded rate. The run is
+// only recorded when it completes while this instance is still the leader.
+func (s *Scheduler) run(ctx context.Context,
+	schedule entity.ScanSchedule) error {
+
+	now := time.Now()
+	files, err := s.repo.StaleFiles(ctx, now.Unix()-schedule.MaxAge,
+		schedule.Tag, schedule.MinSubmissions, schedule.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	limiter := time.NewTicker(s.delay)
+	defer limiter.Stop()
+	enqueued := 0
+
+	for _, sha256 := range files {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-limiter.C:
+		}
+
+		// Keep the lock for as long as the run lasts, and stop as soon as
+		// another instance took over.
+		leader, err := s.keepLock(ctx)
+		if err != nil {
+			return err
+		}
+		if !leader {
+			return errLostLeadership
+		}
+
+		// Scheduled rescans refresh the AV verdicts, the files do not need
+		// to be detonated again.
+		err = s.enqueuer.Enqueue(ctx, sha256, file.FileScanRequest{
+			SkipDetonation: true,
+			Priority:       schedule.Priority,
+		})
+		if errors.Is(err, file.ErrScanPending) {
+			continue
+		}
+		if err != nil {
+			s.logger.Errorf("failed to rescan %s: %v", sha256, err)
+			continue
+		}
+		enqueued++
+	}
+
+	s.logger.Infof("schedule %s rescanned %d files", schedule.ID, enqueued)
+	return s.repo.MarkRun(ctx, schedule.ID, now.Unix(), enqueued)
+}
+
+// due returns true when a schedule must run.
+func due(schedule entity.ScanSchedule, now time.Time) bool {
+	return schedule.Enabled && now.Unix()-schedule.LastRun >= schedule.Interval
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/saferwall/saferwall-api/internal/file"
+	"github.com/saferwall/saferwall-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockRepository grants the lock as many times as leases, and records the
+// schedules marked as run.
+type mockRepository struct {
+	Repository
+	files  []string
+	leases *int
+	runs   *[]string
+}
+
+func (m mockRepository) StaleFiles(ctx context.Context, before int64,
+	tag string, minSubmissions, limit int) ([]string, error) {
+	return m.files, nil
+}
+
+func (m mockRepository) Lock(ctx context.Context, owner string,
+	ttl time.Duration) (bool, error) {
+	*m.leases--
+	return *m.leases >= 0, nil
+}
+
+func (m mockRepository) MarkRun(ctx context.Context, id string, ts int64,
+	enqueued int) error {
+	*m.runs = append(*m.runs, id)
+	return nil
+}
+
+// mockEnqueuer counts the enqueued rescans.
+type mockEnqueuer struct {
+	count *int
+}
+
+func (m mockEnqueuer) Enqueue(ctx context.Context, sha256 string,
+	input file.FileScanRequest) error {
+	*m.count++
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	var runs []string
+	leases, count := 1, 0
+	s := New(mockRepository{files: []string{"a", "b"}, leases: &leases,
+		runs: &runs}, mockEnqueuer{&count}, 60000, log.New())
+	schedule := entity.ScanSchedule{ID: "1"}
+
+	// A lock renewed a while ago, i.e: during a previous schedule, is
+	// renewed before the next rescan.
+	s.renewed = time.Now().Add(-lockTTL)
+	assert.Nil(t, s.run(context.Background(), schedule))
+	assert.Equal(t, 2, count)
+	assert.Equal(t, []string{"1"}, runs)
+	assert.Zero(t, leases)
+
+	// The run is not recorded once another instance took over.
+	s.renewed = time.Now().Add(-lockTTL)
+	assert.Equal(t, errLostLeadership, s.run(context.Background(), schedule))
+	assert.Equal(t, 2, count)
+	assert.Equal(t, []string{"1"}, runs)
+}
@@ -0,0 +1,266 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	e "github.com/saferwall/saferwall-api/internal/errors"
+	"github.com/saferwall/saferwall-api/internal/tag"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+// Rules selecting the files to rescan.
+const (
+	// Every file whose last scan is stale.
+	RuleStale = "stale"
+	// Files analysts tagged with a given tag.
+	RuleTag = "tag"
+	// Files submitted at least a given number of times.
+	RulePopular = "popular"
+)
+
+// Defaults of the optional schedule fields.
+const (
+	defaultMaxAge    = 30 * 24 * 3600
+	defaultInterval  = 24 * 3600
+	defaultBatchSize = 1000
+	defaultPriority  = "low"
+)
+
+// Maximum number of schedules.
+const maxSchedules = 100
+
+var (
+	errNotAdministrator = e.Forbidden("")
+	errTooManySchedules = e.BadRequest("too many scan schedules")
+	errInvalidTag       = e.BadRequest("the tag rule requires a valid tag")
+	errMinSubmissions   = e.BadRequest("the popular rule requires min_submissions")
+)
+
+// Service encapsulates usecase logic for scan schedules. It is restricted
+// to admins.
+type Service interface {
+	Get(ctx context.Context, id string) (entity.ScanSchedule, error)
+	Query(ctx context.Context, offset, limit int) ([]entity.ScanSchedule, error)
+	Count(ctx context.Context) (int, error)
+	Create(ctx context.Context, input CreateScheduleRequest) (
+		entity.ScanSchedule, error)
+	Update(ctx context.Context, id string, input UpdateScheduleRequest) (
+		entity.ScanSchedule, error)
+	Delete(ctx context.Context, id string) (entity.ScanSchedule, error)
+}
+
+type service struct {
+	repo   Repository
+	logger log.Logger
+}
+
+// CreateScheduleRequest represents a scan schedule creation request.
+type CreateScheduleRequest struct {
+	Name           string `json:"name" validate:"required,max=64"`
+	Rule           string `json:"rule" validate:"required,oneof=stale tag popular"`
+	MaxAge         int64  `json:"max_age" validate:"omitempty,min=3600"`
+	Tag            string `json:"tag" validate:"omitempty,max=32"`
+	MinSubmissions int    `json:"min_submissions" validate:"omitempty,min=1"`
+	Interval       int64  `json:"interval" validate:"omitempty,min=3600"`
+	BatchSize      int    `json:"batch_size" validate:"omitempty,min=1,max=10000"`
+	Priority       string `json:"priority" validate:"omitempty,oneof=low normal high"`
+	Enabled        *bool  `json:"enabled"`
+}
+
+// UpdateScheduleRequest represents a scan schedule update request.
+type UpdateScheduleRequest struct {
+	Name           string `json:"name,omitempty" validate:"omitempty,max=64"`
+	Rule           string `json:"rule,omitempty" validate:"omitempty,oneof=stale tag popular"`
+	MaxAge         int64  `json:"max_age,omitempty" validate:"omitempty,min=3600"`
+	Tag            string `json:"tag,omitempty" validate:"omitempty,max=32"`
+	MinSubmissions int    `json:"min_submissions,omitempty" validate:"omitempty,min=1"`
+	Interval       int64  `json:"interval,omitempty" validate:"omitempty,min=3600"`
+	BatchSize      int    `json:"batch_size,omitempty" validate:"omitempty,min=1,max=10000"`
+	Priority       string `json:"priority,omitempty" validate:"omitempty,oneof=low normal high"`
+	Enabled        *bool  `json:"enabled,omitempty"`
+}
+
+// NewService creates a new scheduler service.
+func NewService(repo Repository, logger log.Logger) Service {
+	return service{repo, logger}
+}
+
+// Get returns the schedule with the specified ID.
+func (s service) Get(ctx context.Context, id string) (
+	entity.ScanSchedule, error) {
+
+	if !isAdmin(ctx) {
+		return entity.ScanSchedule{}, errNotAdministrator
+	}
+	schedule, err := s.repo.Get(ctx, id)
+	if err == dbcontext.ErrDocumentNotFound ||
+		(err == nil && schedule.Type != "scan_schedule") {
+		return entity.ScanSchedule{}, e.NotFound("")
+	}
+	return schedule, err
+}
+
+// Query returns the schedules with the specified offset and limit.
+func (s service) Query(ctx context.Context, offset, limit int) (
+	[]entity.ScanSchedule, error) {
+
+	if !isAdmin(ctx) {
+		return nil, errNotAdministrator
+	}
+	return s.repo.Query(ctx, offset, limit)
+}
+
+// Count returns the number of schedules.
+func (s service) Count(ctx context.Context) (int, error) {
+	if !isAdmin(ctx) {
+		return 0, errNotAdministrator
+	}
+	return s.repo.Count(ctx)
+}
+
+// Create creates a new scan schedule.
+func (s service) Create(ctx context.Context, req CreateScheduleRequest) (
+	entity.ScanSchedule, error) {
+
+	if !isAdmin(ctx) {
+		return entity.ScanSchedule{}, errNotAdministrator
+	}
+	count, err := s.repo.Count(ctx)
+	if err != nil {
+		return entity.ScanSchedule{}, err
+	}
+	if count >= maxSchedules {
+		return entity.ScanSchedule{}, errTooManySchedules
+	}
+
+	user, _ := ctx.Value(entity.UserKey).(entity.User)
+	schedule := entity.ScanSchedule{
+		Type:           "scan_schedule",
+		ID:             entity.ID(),
+		Name:           req.Name,
+		Rule:           req.Rule,
+		MaxAge:         req.MaxAge,
+		Tag:            req.Tag,
+		MinSubmissions: req.MinSubmissions,
+		Interval:       req.Interval,
+		BatchSize:      req.BatchSize,
+		Priority:       req.Priority,
+		Enabled:        req.Enabled == nil || *req.Enabled,
+		CreatedBy:      user.ID(),
+		CreatedAt:      time.Now().Unix(),
+	}
+	if err = normalize(&schedule); err != nil {
+		return entity.ScanSchedule{}, err
+	}
+	if err = s.repo.Create(ctx, schedule); err != nil {
+		return entity.ScanSchedule{}, err
+	}
+	return schedule, nil
+}
+
+// Update updates the scan schedule with the specified ID.
+func (s service) Update(ctx context.Context, id string,
+	req UpdateScheduleRequest) (entity.ScanSchedule, error) {
+
+	schedule, err := s.Get(ctx, id)
+	if err != nil {
+		return entity.ScanSchedule{}, err
+	}
+
+	if req.Name != "" {
+		schedule.Name = req.Name
+	}
+	if req.Rule != "" {
+		schedule.Rule = req.Rule
+	}
+	if req.MaxAge != 0 {
+		schedule.MaxAge = req.MaxAge
+	}
+	if req.Tag != "" {
+		schedule.Tag = req.Tag
+	}
+	if req.MinSubmissions != 0 {
+		schedule.MinSubmissions = req.MinSubmissions
+	}
+	if req.Interval != 0 {
+		schedule.Interval = req.Interval
+	}
+	if req.BatchSize != 0 {
+		schedule.BatchSize = req.BatchSize
+	}
+	if req.Priority != "" {
+		schedule.Priority = req.Priority
+	}
+	if req.Enabled != nil {
+		schedule.Enabled = *req.Enabled
+	}
+	if err = normalize(&schedule); err != nil {
+		return entity.ScanSchedule{}, err
+	}
+	if err = s.repo.Update(ctx, schedule); err != nil {
+		return entity.ScanSchedule{}, err
+	}
+	return schedule, nil
+}
+
+// Delete deletes the scan schedule with the specified ID.
+func (s service) Delete(ctx context.Context, id string) (
+	entity.ScanSchedule, error) {
+
+	schedule, err := s.Get(ctx, id)
+	if err != nil {
+		return entity.ScanSchedule{}, err
+	}
+	if err = s.repo.Delete(ctx, id); err != nil {
+		return entity.ScanSchedule{}, err
+	}
+	return schedule, nil
+}
+
+// normalize fills the unset fields of a schedule with their defaults and
+// checks the fields its rule requires.
+func normalize(schedule *entity.ScanSchedule) error {
+	if schedule.MaxAge == 0 {
+		schedule.MaxAge = defaultMaxAge
+	}
+	if schedule.Interval == 0 {
+		schedule.Interval = defaultInterval
+	}
+	if schedule.BatchSize == 0 {
+		schedule.BatchSize = defaultBatchSize
+	}
+	if schedule.Priority == "" {
+		schedule.Priority = defaultPriority
+	}
+
+	switch schedule.Rule {
+	case RuleTag:
+		schedule.Tag = tag.Normalize(schedule.Tag)
+		if !tag.IsValid(schedule.Tag) {
+			return errInvalidTag
+		}
+		schedule.MinSubmissions = 0
+	case RulePopular:
+		if schedule.MinSubmissions < 1 {
+			return errMinSubmissions
+		}
+		schedule.Tag = ""
+	default:
+		schedule.Tag = ""
+		schedule.MinSubmissions = 0
+	}
+	return nil
+}
+
+// isAdmin returns true when the logged-in user is an admin.
+func isAdmin(ctx context.Context) bool {
+	user, ok := ctx.Value(entity.UserKey).(entity.User)
+	return ok && user.IsAdmin()
+}
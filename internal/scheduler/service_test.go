@@ -0,0 +1,48 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	schedule := entity.ScanSchedule{Rule: RuleStale, Tag: "emotet"}
+	assert.Nil(t, normalize(&schedule))
+	assert.Equal(t, int64(defaultMaxAge), schedule.MaxAge)
+	assert.Equal(t, int64(defaultInterval), schedule.Interval)
+	assert.Equal(t, defaultBatchSize, schedule.BatchSize)
+	assert.Equal(t, defaultPriority, schedule.Priority)
+	assert.Empty(t, schedule.Tag)
+
+	schedule = entity.ScanSchedule{Rule: RuleTag, Tag: " Emotet "}
+	assert.Nil(t, normalize(&schedule))
+	assert.Equal(t, "emotet", schedule.Tag)
+	schedule = entity.ScanSchedule{Rule: RuleTag}
+	assert.Equal(t, errInvalidTag, normalize(&schedule))
+
+	schedule = entity.ScanSchedule{Rule: RulePopular}
+	assert.Equal(t, errMinSubmissions, normalize(&schedule))
+	schedule.MinSubmissions = 10
+	assert.Nil(t, normalize(&schedule))
+}
+
+func TestDue(t *testing.T) {
+	now := time.Unix(100000, 0)
+	schedule := entity.ScanSchedule{Enabled: true, Interval: 3600}
+	assert.True(t, due(schedule, now))
+
+	schedule.LastRun = now.Unix() - 60
+	assert.False(t, due(schedule, now))
+	schedule.LastRun = now.Unix() - 3600
+	assert.True(t, due(schedule, now))
+
+	schedule.Enabled = false
+	assert.False(t, due(schedule, now))
+}
@@ -21,15 +21,26 @@ import (
 	"github.com/saferwall/saferwall-api/internal/config"
 	dbcontext "github.com/saferwall/saferwall-api/internal/db"
 	"github.com/saferwall/saferwall-api/internal/errors"
+	"github.com/saferwall/saferwall-api/internal/event"
+	"github.com/saferwall/saferwall-api/internal/export"
 	"github.com/saferwall/saferwall-api/internal/file"
 	"github.com/saferwall/saferwall-api/internal/healthcheck"
+	"github.com/saferwall/saferwall-api/internal/ioc"
 	"github.com/saferwall/saferwall-api/internal/mailer"
+	"github.com/saferwall/saferwall-api/internal/multiav"
+	"github.com/saferwall/saferwall-api/internal/pe"
 	"github.com/saferwall/saferwall-api/internal/queue"
+	"github.com/saferwall/saferwall-api/internal/rescan"
+	"github.com/saferwall/saferwall-api/internal/sandbox"
+	"github.com/saferwall/saferwall-api/internal/scheduler"
 	"github.com/saferwall/saferwall-api/internal/secure/password"
 	"github.com/saferwall/saferwall-api/internal/secure/token"
 	"github.com/saferwall/saferwall-api/internal/storage"
+	"github.com/saferwall/saferwall-api/internal/tag"
 	tpl "github.com/saferwall/saferwall-api/internal/template"
 	"github.com/saferwall/saferwall-api/internal/user"
+	"github.com/saferwall/saferwall-api/internal/watch"
+	"github.com/saferwall/saferwall-api/internal/webhook"
 	"github.com/saferwall/saferwall-api/pkg/log"
 )
 
@@ -49,13 +60,16 @@ var (
 	usernameRegex = regexp.MustCompile(usernameRegexString)
 )
 
-// BuildHandler sets up the HTTP routing and builds an HTTP handler.
+// BuildHandler sets up the HTTP routing and builds an HTTP handler. It also
+// returns the scheduler of the periodic rescans, which the caller runs.
 func BuildHandler(logger log.Logger, db *dbcontext.DB, sec password.Service,
 	cfg *config.Config, version string, trans ut.Translator,
 	updown storage.UploadDownloader, p queue.Producer,
 	smtpMailer mailer.SMTPMailer, arch archive.Archiver,
 	tokenGen token.Service,
-	emailTpl tpl.Service) http.Handler {
+	emailTpl tpl.Service, broker event.Broker,
+	events event.Publisher, watchSvc watch.Service) (http.Handler,
+	*scheduler.Scheduler) {
 
 	// Create `echo` instance.
 	e := echo.New()
@@ -69,6 +83,15 @@ func BuildHandler(logger log.Logger, db *dbcontext.DB, sec password.Service,
 				`"bytes_in":${bytes_in},bytes_out":${bytes_out}}` + "\n",
 		}))
 
+	// Record the request and correlation IDs in the request context.
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			c.SetRequest(req.WithContext(log.WithRequest(req.Context(), req)))
+			return next(c)
+		}
+	})
+
 	// CORS middleware.
 	CORSAllowOrigins := cfg.CORSOrigins
 	if cfg.DisableCORS {
@@ -80,7 +103,8 @@ func BuildHandler(logger log.Logger, db *dbcontext.DB, sec password.Service,
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins: CORSAllowOrigins,
 		AllowMethods: []string{
-			echo.GET, echo.PUT, echo.POST, echo.DELETE, echo.OPTIONS},
+			echo.GET, echo.PUT, echo.POST, echo.PATCH, echo.DELETE, echo.OPTIONS},
+		ExposeHeaders:    []string{"ETag"},
 		AllowCredentials: true,
 	}))
 
@@ -114,23 +138,42 @@ func BuildHandler(logger log.Logger, db *dbcontext.DB, sec password.Service,
 	g := e.Group("/v1")
 
 	// Create the services and register the handlers.
-	actSvc := activity.NewService(activity.NewRepository(db, logger), logger)
+	actSvc := activity.NewService(activity.NewRepository(db, logger), logger,
+		events)
 	userSvc := user.NewService(user.NewRepository(db, logger), logger, tokenGen,
 		sec, cfg.ObjStorage.AvatarsContainerName, updown, actSvc)
+	hookSvc := webhook.NewService(webhook.NewRepository(db, logger), logger)
+	avSvc := multiav.NewService(multiav.NewRepository(db, logger), logger)
+	rescanSvc := rescan.NewService(rescan.NewRepository(db, logger), logger)
+	sandboxSvc := sandbox.NewService(sandbox.NewRepository(db, logger), logger,
+		cfg.Sandbox)
 	authSvc := auth.NewService(cfg.JWTSigningKey, cfg.JWTExpiration, logger,
 		sec, userSvc, tokenGen)
+	behaviorSvc := behavior.NewService(behavior.NewRepository(db, logger), logger,
+		updown, cfg.ObjStorage.ArtifactsContainerName, arch, cfg.SamplesZipPwd)
+	iocSvc := ioc.NewService(ioc.NewRepository(db, logger), logger,
+		behaviorSvc)
 	fileSvc := file.NewService(file.NewRepository(db, logger), logger, updown,
 		p, cfg.Broker.Topic, cfg.ObjStorage.FileContainerName, cfg.SamplesZipPwd,
-		userSvc, actSvc, arch)
+		userSvc, actSvc, arch, events, hookSvc, watchSvc, avSvc, rescanSvc,
+		sandboxSvc, iocSvc, cfg.Broker.PriorityTopics)
 	commentSvc := comment.NewService(comment.NewRepository(db, logger), logger,
-		actSvc, userSvc, fileSvc)
-	behaviorSvc := behavior.NewService(behavior.NewRepository(db, logger), logger)
+		actSvc, userSvc, fileSvc, hookSvc, watchSvc)
+	exportSvc := export.NewService(fileSvc, behaviorSvc, logger)
+	peSvc := pe.NewService(pe.NewRepository(db, logger), logger, iocSvc)
+	schedulerSvc := scheduler.NewService(scheduler.NewRepository(db, logger),
+		logger)
+	tagSvc := tag.NewService(tag.NewRepository(db, logger), logger, actSvc,
+		hookSvc, watchSvc)
 
 	// Create the middlewares.
 	fileMiddleware := file.NewMiddleware(fileSvc, logger)
 	userMiddleware := user.NewMiddleware(userSvc, logger)
 	commentMiddleware := comment.NewMiddleware(commentSvc, logger)
 	behaviorMiddleware := behavior.NewMiddleware(behaviorSvc, logger)
+	tagMiddleware := tag.NewMiddleware(logger)
+	hookMiddleware := webhook.NewMiddleware(logger)
+	schedulerMiddleware := scheduler.NewMiddleware(logger)
 
 	// Register the handlers.
 	healthcheck.RegisterHandlers(e, version)
@@ -140,9 +183,27 @@ func BuildHandler(logger log.Logger, db *dbcontext.DB, sec password.Service,
 	file.RegisterHandlers(g, fileSvc, logger, cfg.MaxFileSize, authHandler, optAuthHandler, fileMiddleware.VerifyHash)
 	activity.RegisterHandlers(g, actSvc, authHandler, logger)
 	comment.RegisterHandlers(g, commentSvc, logger, authHandler, commentMiddleware.VerifyID)
-	behavior.RegisterHandlers(g, behaviorSvc, authHandler, behaviorMiddleware.VerifyID, logger)
+	behavior.RegisterHandlers(g, behaviorSvc, authHandler, behaviorMiddleware.VerifyID,
+		fileMiddleware.VerifyHash, logger)
+	ioc.RegisterHandlers(g, iocSvc, logger)
+	export.RegisterHandlers(g, exportSvc, logger, fileMiddleware.VerifyHash)
+	pe.RegisterHandlers(g, peSvc, logger, fileMiddleware.VerifyHash)
+	tag.RegisterHandlers(g, tagSvc, logger, authHandler, fileMiddleware.VerifyHash, tagMiddleware.VerifyTag)
+	webhook.RegisterHandlers(g, hookSvc, logger, authHandler, hookMiddleware.VerifyID)
+	watch.RegisterHandlers(g, watchSvc, logger, authHandler)
+	multiav.RegisterHandlers(g, avSvc, logger, authHandler, fileMiddleware.VerifyHash)
+	rescan.RegisterHandlers(g, rescanSvc, logger, authHandler)
+	sandbox.RegisterHandlers(g, sandboxSvc, logger, authHandler,
+		optAuthHandler, userMiddleware.VerifyUser)
+	scheduler.RegisterHandlers(g, schedulerSvc, logger, authHandler, schedulerMiddleware.VerifyID)
+
+	event.RegisterHandlers(g, broker, watchSvc, logger, authHandler, fileMiddleware.VerifyHash)
+
+	// Create the scheduler which periodically rescans the stale files.
+	sched := scheduler.New(scheduler.NewRepository(db, logger), fileSvc,
+		cfg.Scheduler.MaxRate, logger)
 
-	return e
+	return e, sched
 }
 
 // CustomValidator holds custom validator.
@@ -66,6 +66,13 @@ func New(cfg config.StorageCfg) (UploadDownloader, error) {
 		if err != nil {
 			return nil, err
 		}
+		// The artifacts container is optional.
+		if cfg.ArtifactsContainerName != "" {
+			err = svc.MakeBucket(ctx, cfg.ArtifactsContainerName, cfg.S3.Region)
+			if err != nil {
+				return nil, err
+			}
+		}
 		return svc, nil
 
 	case "minio":
@@ -82,6 +89,13 @@ func New(cfg config.StorageCfg) (UploadDownloader, error) {
 		if err != nil {
 			return nil, err
 		}
+		// The artifacts container is optional.
+		if cfg.ArtifactsContainerName != "" {
+			err = svc.MakeBucket(ctx, cfg.ArtifactsContainerName, cfg.Minio.Region)
+			if err != nil {
+				return nil, err
+			}
+		}
 		return svc, nil
 	case "local":
 		svc, err := local.New(cfg.Local.RootDir)
@@ -96,6 +110,13 @@ func New(cfg config.StorageCfg) (UploadDownloader, error) {
 		if err != nil {
 			return nil, err
 		}
+		// The artifacts container is optional.
+		if cfg.ArtifactsContainerName != "" {
+			err = svc.MakeBucket(ctx, cfg.ArtifactsContainerName, "")
+			if err != nil {
+				return nil, err
+			}
+		}
 		return svc, nil
 	}
 
@@ -0,0 +1,154 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package tag
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/saferwall/saferwall-api/pkg/log"
+	"github.com/saferwall/saferwall-api/pkg/pagination"
+)
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func RegisterHandlers(g *echo.Group, service Service,
+	logger log.Logger, requireLogin echo.MiddlewareFunc,
+	verifyHash echo.MiddlewareFunc, verifyTag echo.MiddlewareFunc) {
+
+	res := resource{service, logger}
+
+	g.GET("/files/:sha256/tags/", res.list, verifyHash)
+	g.POST("/files/:sha256/tags/", res.create, verifyHash, requireLogin)
+	g.DELETE("/files/:sha256/tags/:tag/", res.delete, verifyHash, verifyTag,
+		requireLogin)
+
+	g.GET("/tags/", res.tags)
+	g.GET("/tags/:tag/files/", res.files, verifyTag)
+}
+
+// @Summary Returns the tags applied to a file
+// @Description List of tags applied by analysts to a given file.
+// @Tags Tag
+// @Produce json
+// @Param sha256 path string true "File SHA256"
+// @Success 200 {object} []entity.UserTag
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /files/{sha256}/tags/ [get]
+func (r resource) list(c echo.Context) error {
+	ctx := c.Request().Context()
+	tags, err := r.service.List(ctx, c.Param("sha256"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, tags)
+}
+
+// @Summary Tag a file
+// @Description Applies a tag to a file on behalf of the logged-in user.
+// @Tags Tag
+// @Accept json
+// @Produce json
+// @Param sha256 path string true "File SHA256"
+// @Param data body CreateTagRequest true "Tag body"
+// @Success 201 {object} []entity.UserTag
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /files/{sha256}/tags/ [post]
+// @Security Bearer
+func (r resource) create(c echo.Context) error {
+	var input CreateTagRequest
+	ctx := c.Request().Context()
+	if err := c.Bind(&input); err != nil {
+		r.logger.With(ctx).Info(err)
+		return err
+	}
+
+	tags, err := r.service.Create(ctx, c.Param("sha256"), input)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, tags)
+}
+
+// @Summary Untag a file
+// @Description Removes a tag from a file. Admins remove the tag for all users.
+// @Tags Tag
+// @Produce json
+// @Param sha256 path string true "File SHA256"
+// @Param tag path string true "Tag"
+// @Success 200 {object} []entity.UserTag
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /files/{sha256}/tags/{tag}/ [delete]
+// @Security Bearer
+func (r resource) delete(c echo.Context) error {
+	ctx := c.Request().Context()
+	tags, err := r.service.Delete(ctx, c.Param("sha256"), c.Param("tag"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, tags)
+}
+
+// @Summary Returns a paginated list of tags
+// @Description List of tags along with the number of files tagged with each.
+// @Tags Tag
+// @Produce json
+// @Param per_page query uint false "Number of tags per page"
+// @Param page query uint false "Specify the page number"
+// @Success 200 {object} pagination.Pages
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /tags/ [get]
+func (r resource) tags(c echo.Context) error {
+	ctx := c.Request().Context()
+	count, err := r.service.Count(ctx)
+	if err != nil {
+		return err
+	}
+
+	pages := pagination.NewFromRequest(c.Request(), count)
+	tags, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = tags
+	return c.JSON(http.StatusOK, pages)
+}
+
+// @Summary Returns a paginated list of files tagged with a tag
+// @Description List of files tagged by analysts with a given tag.
+// @Tags Tag
+// @Produce json
+// @Param tag path string true "Tag"
+// @Param per_page query uint false "Number of files per page"
+// @Param page query uint false "Specify the page number"
+// @Success 200 {object} pagination.Pages
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /tags/{tag}/files/ [get]
+func (r resource) files(c echo.Context) error {
+	ctx := c.Request().Context()
+	count, err := r.service.CountFiles(ctx, c.Param("tag"))
+	if err != nil {
+		return err
+	}
+
+	pages := pagination.NewFromRequest(c.Request(), count)
+	files, err := r.service.Files(ctx, c.Param("tag"), pages.Offset(),
+		pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = files
+	return c.JSON(http.StatusOK, pages)
+}
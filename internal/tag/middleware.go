@@ -0,0 +1,33 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package tag
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+type middleware struct {
+	logger log.Logger
+}
+
+// NewMiddleware creates a new tag Middleware.
+func NewMiddleware(logger log.Logger) middleware {
+	return middleware{logger}
+}
+
+// VerifyTag validates the tag path parameter.
+func (m middleware) VerifyTag(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		tag := Normalize(c.Param("tag"))
+		if !IsValid(tag) {
+			m.logger.Error("failed to match regex for tag %v", tag)
+			return errInvalidTag
+		}
+
+		return next(c)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package tag
+
+import (
+	"context"
+
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+// Repository encapsulates the logic to access analysts' tags from the data
+// source. Tags are stored within the file document they are applied to.
+type Repository interface {
+	// Get returns the tags applied to the file with the specified SHA256
+	// along with the CAS of the file.
+	Get(ctx context.Context, sha256 string) ([]entity.UserTag, uint64, error)
+	// Update replaces the tags applied to the file with the specified SHA256
+	// provided the CAS of the file did not change.
+	Update(ctx context.Context, sha256 string, tags []entity.UserTag,
+		cas uint64) error
+	// Files returns the list of files tagged with the given tag.
+	Files(ctx context.Context, tag string, offset, limit int) (
+		[]interface{}, error)
+	// CountFiles returns the number of files tagged with the given tag.
+	CountFiles(ctx context.Context, tag string) (int, error)
+	// Query returns the list of tags along with the number of files tagged
+	// with each of them.
+	Query(ctx context.Context, offset, limit int) ([]interface{}, error)
+	// Count returns the number of distinct tags.
+	Count(ctx context.Context) (int, error)
+}
+
+// repository persists tags in database.
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new tag repository.
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the tags applied to a file from the database.
+func (r repository) Get(ctx context.Context, sha256 string) (
+	[]entity.UserTag, uint64, error) {
+
+	var file entity.File
+	cas, err := r.db.GetWithCAS(ctx, file.ID(sha256), &file)
+	return file.UserTags, cas, err
+}
+
+// Update saves the tags applied to a file in the database.
+func (r repository) Update(ctx context.Context, sha256 string,
+	tags []entity.UserTag, cas uint64) error {
+
+	_, err := r.db.MutateIn(ctx, entity.File{}.ID(sha256), []dbcontext.MutateOp{
+		{Kind: dbcontext.MutateUpsert, Path: "user_tags", Value: tags},
+	}, cas)
+	return err
+}
+
+// Files retrieves the files tagged with a tag from the database.
+func (r repository) Files(ctx context.Context, tag string, offset,
+	limit int) ([]interface{}, error) {
+
+	var results interface{}
+	params := make(map[string]interface{}, 1)
+	params["offset"] = offset
+	params["limit"] = limit
+	params["tag"] = tag
+
+	query := r.db.N1QLQuery[dbcontext.TagFiles]
+	err := r.db.Query(ctx, query, params, &results)
+	if err != nil {
+		return nil, err
+	}
+	if len(results.([]interface{})) == 0 {
+		return []interface{}{}, nil
+	}
+	return results.([]interface{}), nil
+}
+
+// CountFiles returns the number of files tagged with a tag in the database.
+func (r repository) CountFiles(ctx context.Context, tag string) (int, error) {
+	var count int
+	params := make(map[string]interface{}, 1)
+	params["tag"] = tag
+
+	query := r.db.N1QLQuery[dbcontext.CountTagFiles]
+	err := r.db.Count(ctx, query, params, &count)
+	return count, err
+}
+
+// Query retrieves the tags with the specified offset and limit from the
+// database.
+func (r repository) Query(ctx context.Context, offset, limit int) (
+	[]interface{}, error) {
+
+	var results interface{}
+	params := make(map[string]interface{}, 1)
+	params["offset"] = offset
+	params["limit"] = limit
+
+	query := r.db.N1QLQuery[dbcontext.Tags]
+	err := r.db.Query(ctx, query, params, &results)
+	if err != nil {
+		return nil, err
+	}
+	if len(results.([]interface{})) == 0 {
+		return []interface{}{}, nil
+	}
+	return results.([]interface{}), nil
+}
+
+// Count returns the number of distinct tags in the database.
+func (r repository) Count(ctx context.Context) (int, error) {
+	var count int
+	query := r.db.N1QLQuery[dbcontext.CountTags]
+	err := r.db.Count(ctx, query, nil, &count)
+	return count, err
+}
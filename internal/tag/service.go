@@ -0,0 +1,242 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package tag
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/saferwall/saferwall-api/internal/activity"
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	e "github.com/saferwall/saferwall-api/internal/errors"
+	"github.com/saferwall/saferwall-api/internal/webhook"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+const (
+	// Tags are lowercase and may contain digits, dots, dashes and
+	// underscores, i.e: `ransomware`, `apt-28`, `cobalt_strike`.
+	tagRegexString = "^[a-z0-9][a-z0-9_.-]{0,31}$"
+)
+
+var (
+	tagRegex = regexp.MustCompile(tagRegexString)
+
+	errInvalidTag = e.BadRequest("invalid tag string")
+)
+
+// Service encapsulates usecase logic for analysts' tags.
+type Service interface {
+	List(ctx context.Context, sha256 string) ([]entity.UserTag, error)
+	Create(ctx context.Context, sha256 string, input CreateTagRequest) (
+		[]entity.UserTag, error)
+	Delete(ctx context.Context, sha256, tag string) ([]entity.UserTag, error)
+	Files(ctx context.Context, tag string, offset, limit int) (
+		[]interface{}, error)
+	CountFiles(ctx context.Context, tag string) (int, error)
+	Query(ctx context.Context, offset, limit int) ([]interface{}, error)
+	Count(ctx context.Context) (int, error)
+}
+
+// Watcher lets the watchers of a file or a tag know a tag was applied.
+type Watcher interface {
+	TagApplied(ctx context.Context, sha256, tag, username string)
+}
+
+type service struct {
+	repo     Repository
+	logger   log.Logger
+	actSvc   activity.Service
+	hookSvc  webhook.Service
+	watchSvc Watcher
+}
+
+// CreateTagRequest represents a tag creation request.
+type CreateTagRequest struct {
+	Tag string `json:"tag" validate:"required,max=32"`
+}
+
+// NewService creates a new tag service.
+func NewService(repo Repository, logger log.Logger,
+	actSvc activity.Service, hookSvc webhook.Service,
+	watchSvc Watcher) Service {
+	return service{repo, logger, actSvc, hookSvc, watchSvc}
+}
+
+// Normalize returns the canonical form of a tag.
+func Normalize(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// IsValid checks whether a normalized tag is well formed.
+func IsValid(tag string) bool {
+	return tagRegex.MatchString(tag)
+}
+
+// List returns the tags applied to a file.
+func (s service) List(ctx context.Context, sha256 string) (
+	[]entity.UserTag, error) {
+	tags, _, err := s.repo.Get(ctx, sha256)
+	if err != nil {
+		return nil, err
+	}
+	if tags == nil {
+		return []entity.UserTag{}, nil
+	}
+	return tags, nil
+}
+
+// Create applies a tag to a file on behalf of the logged-in user. Applying
+// the same tag twice is a no-op.
+func (s service) Create(ctx context.Context, sha256 string,
+	req CreateTagRequest) ([]entity.UserTag, error) {
+
+	user, _ := ctx.Value(entity.UserKey).(entity.User)
+	tag := Normalize(req.Tag)
+	if !IsValid(tag) {
+		return nil, errInvalidTag
+	}
+
+	var tags []entity.UserTag
+	var added bool
+	err := dbcontext.RetryOnCASMismatch(ctx, func() error {
+		var cas uint64
+		var err error
+		tags, cas, err = s.repo.Get(ctx, sha256)
+		if err != nil {
+			return err
+		}
+
+		added = false
+		for _, t := range tags {
+			if t.Tag == tag && t.Username == user.ID() {
+				return nil
+			}
+		}
+		tags = append(tags, entity.UserTag{
+			Tag:       tag,
+			Username:  user.ID(),
+			Timestamp: time.Now().Unix(),
+		})
+		added = true
+		return s.repo.Update(ctx, sha256, tags, cas)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the source of the HTTP request from the ctx.
+	source, _ := ctx.Value(entity.SourceKey).(string)
+
+	// Create a new `tag` activity only when the file was not already tagged
+	// by this user.
+	if added && !hasTagsFrom(tags, user.ID(), tag) {
+		if _, err = s.actSvc.Create(ctx, activity.CreateActivityRequest{
+			Kind:     "tag",
+			Username: user.ID(),
+			Target:   sha256,
+			Source:   source,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if added {
+		s.hookSvc.Trigger(ctx, webhook.Event{
+			Name:   webhook.FileTagged,
+			SHA256: sha256,
+			Actor:  user.ID(),
+			Tag:    tag,
+			Data: map[string]string{
+				"sha256": sha256, "tag": tag, "username": user.ID()},
+		})
+		s.watchSvc.TagApplied(ctx, sha256, tag, user.ID())
+	}
+
+	return tags, nil
+}
+
+// Delete removes a tag from a file. Regular users can only remove the tags
+// they applied themselves, while admins remove the tag altogether.
+func (s service) Delete(ctx context.Context, sha256, tag string) (
+	[]entity.UserTag, error) {
+
+	user, _ := ctx.Value(entity.UserKey).(entity.User)
+	tag = Normalize(tag)
+
+	var tags []entity.UserTag
+	var removedFrom map[string]bool
+	err := dbcontext.RetryOnCASMismatch(ctx, func() error {
+		cur, cas, err := s.repo.Get(ctx, sha256)
+		if err != nil {
+			return err
+		}
+
+		tags = make([]entity.UserTag, 0, len(cur))
+		removedFrom = make(map[string]bool)
+		for _, t := range cur {
+			if t.Tag == tag && (t.Username == user.ID() || user.IsAdmin()) {
+				removedFrom[t.Username] = true
+				continue
+			}
+			tags = append(tags, t)
+		}
+		if len(removedFrom) == 0 {
+			return e.NotFound("")
+		}
+		return s.repo.Update(ctx, sha256, tags, cas)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Drop the `tag` activity of every user who no longer has any tag on
+	// this file.
+	for username := range removedFrom {
+		if hasTagsFrom(tags, username, "") {
+			continue
+		}
+		if err = s.actSvc.DeleteWith(ctx, "tag", username, sha256); err != nil {
+			return nil, err
+		}
+	}
+
+	return tags, nil
+}
+
+// Files returns the files tagged with the given tag.
+func (s service) Files(ctx context.Context, tag string, offset, limit int) (
+	[]interface{}, error) {
+	return s.repo.Files(ctx, Normalize(tag), offset, limit)
+}
+
+// CountFiles returns the number of files tagged with the given tag.
+func (s service) CountFiles(ctx context.Context, tag string) (int, error) {
+	return s.repo.CountFiles(ctx, Normalize(tag))
+}
+
+// Query returns the tags along with the number of files carrying them.
+func (s service) Query(ctx context.Context, offset, limit int) (
+	[]interface{}, error) {
+	return s.repo.Query(ctx, offset, limit)
+}
+
+// Count returns the number of distinct tags.
+func (s service) Count(ctx context.Context) (int, error) {
+	return s.repo.Count(ctx)
+}
+
+// hasTagsFrom checks whether the user applied any tag other than `except`.
+func hasTagsFrom(tags []entity.UserTag, username, except string) bool {
+	for _, t := range tags {
+		if t.Username == username && t.Tag != except {
+			return true
+		}
+	}
+	return false
+}
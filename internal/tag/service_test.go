@@ -0,0 +1,30 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package tag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsValid(t *testing.T) {
+	tests := []struct {
+		tag   string
+		valid bool
+	}{
+		{"ransomware", true},
+		{"  Cobalt_Strike ", true},
+		{"apt-28", true},
+		{"-apt", false},
+		{"two words", false},
+		{"", false},
+		{"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.valid, IsValid(Normalize(tt.tag)), tt.tag)
+	}
+}
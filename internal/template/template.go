@@ -19,12 +19,16 @@ const (
 	ConfirmAccount = iota
 	ResetPassword
 	EmailUpdate
+	WatchNotification
+	WatchDigest
 )
 
 var emailTplMap = map[string]EmailTemplate{
 	"account-confirmation": ConfirmAccount,
 	"password-reset":       ResetPassword,
 	"email-update":         EmailUpdate,
+	"watch-notification":   WatchNotification,
+	"watch-digest":         WatchDigest,
 }
 
 type Service struct {
@@ -87,6 +91,10 @@ func New(filePath string) (Service, error) {
 			er.Subject = "saferwall - reset password"
 		case "email-update":
 			er.Subject = "saferwall - confirm new email"
+		case "watch-notification":
+			er.Subject = "saferwall - new activity on your watchlist"
+		case "watch-digest":
+			er.Subject = "saferwall - your watchlist digest"
 		}
 		templates[key] = er
 	}
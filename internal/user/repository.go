@@ -18,16 +18,26 @@ import (
 type Repository interface {
 	// Get returns the user with the specified user ID.
 	Get(ctx context.Context, id string) (entity.User, error)
+	// GetWithCAS returns the user with the specified user ID along with its
+	// CAS.
+	GetWithCAS(ctx context.Context, id string) (entity.User, uint64, error)
 	// Count returns the number of users.
 	Count(ctx context.Context) (int, error)
 	// Query returns the list of users with the given offset and limit.
 	Query(ctx context.Context, offset, limit int) ([]entity.User, error)
 	// Create saves a new user in the storage.
 	Create(ctx context.Context, User entity.User) error
-	// Update updates the user with given ID in the storage.
-	Update(ctx context.Context, User entity.User) error
+	// Update updates the user with given ID in the storage provided its CAS
+	// did not change.
+	Update(ctx context.Context, User entity.User, cas uint64) error
 	// Patch patches a sub entry in the user with given ID in the storage.
 	Patch(ctx context.Context, key, path string, val interface{}) error
+	// MutateIn applies a list of sub document mutations to the user with
+	// given ID provided its CAS did not change.
+	MutateIn(ctx context.Context, key string, ops []dbcontext.MutateOp,
+		cas uint64) error
+	// Increment atomically adds delta to a counter in the user with given ID.
+	Increment(ctx context.Context, key, path string, delta int64) error
 	// Delete removes the user with given ID from the storage.
 	Delete(ctx context.Context, id string) error
 	// Exists checks if a user exists with a given ID.
@@ -67,6 +77,16 @@ func (r repository) Get(ctx context.Context, id string) (entity.User, error) {
 	return user, err
 }
 
+// GetWithCAS reads the user with the specified ID from the database along
+// with its CAS.
+func (r repository) GetWithCAS(ctx context.Context, id string) (
+	entity.User, uint64, error) {
+	var user entity.User
+	key := strings.ToLower(id)
+	cas, err := r.db.GetWithCAS(ctx, key, &user)
+	return user, cas, err
+}
+
 // Create saves a new user record in the database.
 // It returns the ID of the newly inserted user record.
 func (r repository) Create(ctx context.Context, user entity.User) error {
@@ -75,9 +95,11 @@ func (r repository) Create(ctx context.Context, user entity.User) error {
 }
 
 // Update saves the changes to a user in the database.
-func (r repository) Update(ctx context.Context, user entity.User) error {
+func (r repository) Update(ctx context.Context, user entity.User,
+	cas uint64) error {
 	key := user.ID()
-	return r.db.Update(ctx, key, &user)
+	_, err := r.db.Update(ctx, key, &user, cas)
+	return err
 }
 
 // Patch performs a sub doc update to a user in the database.
@@ -86,6 +108,19 @@ func (r repository) Patch(ctx context.Context, key, path string,
 	return r.db.Patch(ctx, key, path, val)
 }
 
+// MutateIn performs a list of sub doc updates to a user in the database.
+func (r repository) MutateIn(ctx context.Context, key string,
+	ops []dbcontext.MutateOp, cas uint64) error {
+	_, err := r.db.MutateIn(ctx, strings.ToLower(key), ops, cas)
+	return err
+}
+
+// Increment atomically updates a counter of a user in the database.
+func (r repository) Increment(ctx context.Context, key, path string,
+	delta int64) error {
+	return r.db.Increment(ctx, strings.ToLower(key), path, delta)
+}
+
 // Delete deletes a user with the specified ID from the database.
 func (r repository) Delete(ctx context.Context, id string) error {
 	key := strings.ToLower(id)
@@ -17,6 +17,7 @@ import (
 	"github.com/h2non/filetype"
 
 	"github.com/saferwall/saferwall-api/internal/activity"
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
 	"github.com/saferwall/saferwall-api/internal/entity"
 	"github.com/saferwall/saferwall-api/internal/secure"
 	"github.com/saferwall/saferwall-api/pkg/log"
@@ -52,6 +53,9 @@ type Service interface {
 	CountSubmissions(ctx context.Context, id string) (int, error)
 	Follow(ctx context.Context, id string) error
 	UnFollow(ctx context.Context, id string) error
+	AddLike(ctx context.Context, id, sha256 string) (bool, error)
+	RemoveLike(ctx context.Context, id, sha256 string) (bool, error)
+	Increment(ctx context.Context, id, path string, delta int64) error
 	GetByEmail(ctx context.Context, id string) (User, error)
 	UpdateAvatar(ctx context.Context, id string, src io.Reader) error
 	UpdatePassword(ctx context.Context, input UpdatePasswordRequest) error
@@ -194,28 +198,36 @@ func (s service) Create(ctx context.Context, req CreateUserRequest) (
 	return s.Get(ctx, req.Username)
 }
 
-// Update updates the user with the specified ID.
+// Update updates the user with the specified ID. The user is replaced only
+// if it was not modified since it was read, otherwise the update is retried.
 func (s service) Update(ctx context.Context, id string, req interface{}) (
 	User, error) {
 
-	user, err := s.Get(ctx, id)
-	if err != nil {
-		return user, err
-	}
+	var user User
 	data, err := json.Marshal(req)
 	if err != nil {
 		return user, err
 	}
-	err = json.Unmarshal(data, &user)
-	if err != nil {
-		return user, err
-	}
 
-	if err := s.repo.Update(ctx, user.User); err != nil {
-		return user, err
-	}
+	err = dbcontext.RetryOnCASMismatch(ctx, func() error {
+		u, cas, err := s.repo.GetWithCAS(ctx, id)
+		if err != nil {
+			return err
+		}
+		user = User{u}
+		err = json.Unmarshal(data, &user)
+		if err != nil {
+			return err
+		}
+		return s.repo.Update(ctx, user.User, cas)
+	})
+	return user, err
+}
 
-	return user, nil
+// Increment atomically adds delta to a user counter like `comments_count`.
+func (s service) Increment(ctx context.Context, id, path string,
+	delta int64) error {
+	return s.repo.Increment(ctx, id, path, delta)
 }
 
 // Patch performs an atomic user sub document update.
@@ -372,6 +384,57 @@ func (s service) CountSubmissions(ctx context.Context, id string) (int, error) {
 	return user.SubmissionsCount, err
 }
 
+// updateSet adds or removes val from the list of strings stored at path in
+// the user document, and adjusts the counter at countPath by one. The list
+// update is guarded by the user's CAS and retried when the user is modified
+// concurrently. It returns true when the list was changed.
+func (s service) updateSet(ctx context.Context, id, path, countPath,
+	val string, add bool, list func(entity.User) []string) (bool, error) {
+
+	var changed bool
+	err := dbcontext.RetryOnCASMismatch(ctx, func() error {
+		user, cas, err := s.repo.GetWithCAS(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		items := list(user)
+		changed = isStringInSlice(val, items) != add
+		if !changed {
+			return nil
+		}
+
+		delta := int64(1)
+		if add {
+			items = append(items, val)
+		} else {
+			items = removeStringFromSlice(items, val)
+			delta = -1
+		}
+
+		return s.repo.MutateIn(ctx, id, []dbcontext.MutateOp{
+			{Kind: dbcontext.MutateUpsert, Path: path, Value: items},
+			{Kind: dbcontext.MutateIncrement, Path: countPath, Value: delta},
+		}, cas)
+	})
+	return changed, err
+}
+
+// AddLike adds a file to the list of files liked by a user. It returns false
+// if the file was already liked.
+func (s service) AddLike(ctx context.Context, id, sha256 string) (bool, error) {
+	return s.updateSet(ctx, id, "likes", "likes_count", sha256, true,
+		func(u entity.User) []string { return u.Likes })
+}
+
+// RemoveLike removes a file from the list of files liked by a user. It returns
+// false if the file was not liked.
+func (s service) RemoveLike(ctx context.Context, id, sha256 string) (
+	bool, error) {
+	return s.updateSet(ctx, id, "likes", "likes_count", sha256, false,
+		func(u entity.User) []string { return u.Likes })
+}
+
 func (s service) Follow(ctx context.Context, id string) error {
 	var err error
 	targetUser, err := s.Get(ctx, id)
@@ -394,10 +457,13 @@ func (s service) Follow(ctx context.Context, id string) error {
 		return errUserSelfFollow
 	}
 
-	if !isStringInSlice(targetUsername, curUser.Following) {
-		curUser.Following = append(curUser.Following, targetUsername)
-		curUser.FollowingCount += 1
-
+	followed, err := s.updateSet(ctx, curUsername, "following",
+		"following_count", targetUsername, true,
+		func(u entity.User) []string { return u.Following })
+	if err != nil {
+		return err
+	}
+	if followed {
 		// add new activity
 		if _, err = s.actSvc.Create(ctx, activity.CreateActivityRequest{
 			Kind:     "follow",
@@ -407,18 +473,11 @@ func (s service) Follow(ctx context.Context, id string) error {
 		}); err != nil {
 			return err
 		}
-		if err = s.repo.Update(ctx, curUser.User); err != nil {
-			return err
-		}
-
-	}
-	if !isStringInSlice(curUsername, targetUser.Followers) {
-		targetUser.Followers = append(targetUser.Followers, curUsername)
-		targetUser.FollowersCount += 1
-		return s.repo.Update(ctx, targetUser.User)
 	}
 
-	return nil
+	_, err = s.updateSet(ctx, targetUsername, "followers", "followers_count",
+		curUsername, true, func(u entity.User) []string { return u.Followers })
+	return err
 }
 
 func (s service) UnFollow(ctx context.Context, id string) error {
@@ -439,31 +498,23 @@ func (s service) UnFollow(ctx context.Context, id string) error {
 		return errUserSelfFollow
 	}
 
-	if isStringInSlice(targetUsername, curUser.Following) {
-		curUser.Following = removeStringFromSlice(
-			curUser.Following, targetUsername)
-		curUser.FollowingCount -= 1
-
+	unfollowed, err := s.updateSet(ctx, curUsername, "following",
+		"following_count", targetUsername, false,
+		func(u entity.User) []string { return u.Following })
+	if err != nil {
+		return err
+	}
+	if unfollowed {
 		// delete corresponding activity.
 		if err = s.actSvc.DeleteWith(ctx, "follow", curUser.Username,
 			targetUser.Username); err != nil {
 			return err
 		}
 	}
-	if isStringInSlice(curUsername, targetUser.Followers) {
-		targetUser.Followers = removeStringFromSlice(
-			targetUser.Followers, curUsername)
-		targetUser.FollowersCount -= 1
-	}
 
-	if err = s.repo.Update(ctx, curUser.User); err != nil {
-		return err
-	}
-	if err = s.repo.Update(ctx, targetUser.User); err != nil {
-		return err
-	}
-
-	return nil
+	_, err = s.updateSet(ctx, targetUsername, "followers", "followers_count",
+		curUsername, false, func(u entity.User) []string { return u.Followers })
+	return err
 }
 
 func (s service) UpdatePassword(ctx context.Context, input UpdatePasswordRequest) error {
@@ -473,17 +524,22 @@ func (s service) UpdatePassword(ctx context.Context, input UpdatePasswordRequest
 		id = user.ID()
 	}
 
-	user, err := s.repo.Get(ctx, id)
-	if err != nil {
-		return err
-	}
+	return dbcontext.RetryOnCASMismatch(ctx, func() error {
+		user, cas, err := s.repo.GetWithCAS(ctx, id)
+		if err != nil {
+			return err
+		}
 
-	if !s.sec.HashMatchesPassword(user.Password, input.OldPassword) {
-		return errWrongPassword
-	}
+		if !s.sec.HashMatchesPassword(user.Password, input.OldPassword) {
+			return errWrongPassword
+		}
 
-	user.Password = s.sec.HashPassword(input.NewPassword)
-	return s.repo.Update(ctx, user)
+		return s.repo.MutateIn(ctx, id, []dbcontext.MutateOp{{
+			Kind:  dbcontext.MutateUpsert,
+			Path:  "password",
+			Value: s.sec.HashPassword(input.NewPassword),
+		}}, cas)
+	})
 }
 
 func (s service) UpdateEmail(ctx context.Context, input UpdateEmailRequest) error {
@@ -507,10 +563,13 @@ func (s service) UpdateEmail(ctx context.Context, input UpdateEmailRequest) erro
 
 func (s service) UpdateAvatar(ctx context.Context, id string, src io.Reader) error {
 
-	user, err := s.repo.Get(ctx, id)
+	exists, err := s.repo.Exists(ctx, id)
 	if err != nil {
 		return err
 	}
+	if !exists {
+		return dbcontext.ErrDocumentNotFound
+	}
 
 	fileContent, err := io.ReadAll(src)
 	if err != nil {
@@ -535,9 +594,7 @@ func (s service) UpdateAvatar(ctx context.Context, id string, src io.Reader) err
 		return err
 	}
 
-	user.HasAvatar = true
-
-	return s.repo.Update(ctx, user)
+	return s.repo.Patch(ctx, id, "has_avatar", true)
 }
 
 // GetByEmail returns the user given its email address.
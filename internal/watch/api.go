@@ -0,0 +1,123 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package watch
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func RegisterHandlers(g *echo.Group, service Service, logger log.Logger,
+	requireLogin echo.MiddlewareFunc) {
+
+	res := resource{service, logger}
+
+	g.GET("/watchlist/", res.get, requireLogin)
+	g.PUT("/watchlist/preferences/", res.preferences, requireLogin)
+	g.POST("/watchlist/:kind/", res.watch, requireLogin)
+	g.DELETE("/watchlist/:kind/:value/", res.unwatch, requireLogin)
+}
+
+// @Summary Retrieves the watchlist of the logged-in user
+// @Description Get the files, tags and users watched by the logged-in user
+// @Description along with the notification preferences.
+// @Tags Watchlist
+// @Produce json
+// @Success 200 {object} entity.Watchlist
+// @Failure 401 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /watchlist/ [get]
+// @Security Bearer
+func (r resource) get(c echo.Context) error {
+	watchlist, err := r.service.Get(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, watchlist)
+}
+
+// @Summary Update the notification preferences
+// @Description Set how often and for which events watchers get notified.
+// @Tags Watchlist
+// @Accept json
+// @Produce json
+// @Param data body PreferencesRequest true "Notification preferences"
+// @Success 200 {object} entity.Watchlist
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 401 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /watchlist/preferences/ [put]
+// @Security Bearer
+func (r resource) preferences(c echo.Context) error {
+	var input PreferencesRequest
+	ctx := c.Request().Context()
+	if err := c.Bind(&input); err != nil {
+		r.logger.With(ctx).Info(err)
+		return err
+	}
+
+	watchlist, err := r.service.UpdatePreferences(ctx, input)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, watchlist)
+}
+
+// @Summary Watch a file, a tag or a user
+// @Description Add an item to the watchlist of the logged-in user.
+// @Tags Watchlist
+// @Accept json
+// @Produce json
+// @Param kind path string true "One of: files, tags, users"
+// @Param data body WatchRequest true "Item to watch"
+// @Success 200 {object} entity.Watchlist
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 401 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /watchlist/{kind}/ [post]
+// @Security Bearer
+func (r resource) watch(c echo.Context) error {
+	var input WatchRequest
+	ctx := c.Request().Context()
+	if err := c.Bind(&input); err != nil {
+		r.logger.With(ctx).Info(err)
+		return err
+	}
+
+	watchlist, err := r.service.Watch(ctx, c.Param("kind"), input)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, watchlist)
+}
+
+// @Summary Stop watching a file, a tag or a user
+// @Description Remove an item from the watchlist of the logged-in user.
+// @Tags Watchlist
+// @Produce json
+// @Param kind path string true "One of: files, tags, users"
+// @Param value path string true "Watched item"
+// @Success 200 {object} entity.Watchlist
+// @Failure 401 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /watchlist/{kind}/{value}/ [delete]
+// @Security Bearer
+func (r resource) unwatch(c echo.Context) error {
+	watchlist, err := r.service.Unwatch(c.Request().Context(),
+		c.Param("kind"), c.Param("value"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, watchlist)
+}
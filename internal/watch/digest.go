@@ -0,0 +1,43 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package watch
+
+import (
+	"context"
+	"time"
+
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+// How often the digests due are looked for.
+const digestInterval = time.Hour
+
+// Digester periodically emails the notification digests.
+type Digester struct {
+	service Service
+	logger  log.Logger
+}
+
+// NewDigester creates a new notification digester.
+func NewDigester(service Service, logger log.Logger) *Digester {
+	return &Digester{service, logger}
+}
+
+// Run sends the digests due until the context is canceled.
+func (d *Digester) Run(ctx context.Context) {
+	ticker := time.NewTicker(digestInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.service.SendDigests(ctx); err != nil {
+				d.logger.Error(err)
+			}
+		}
+	}
+}
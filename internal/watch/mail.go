@@ -0,0 +1,66 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package watch
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+)
+
+// mailData represents the data the watchlist email templates are rendered
+// with.
+type mailData struct {
+	Username       string
+	Notifications  []mailItem
+	PreferencesURL string
+}
+
+// mailItem represents a notification in an email.
+type mailItem struct {
+	Title   string
+	Message string
+	URL     string
+	Date    string
+}
+
+// newMailData builds the template data of a list of notifications.
+func newMailData(username, uiAddress string,
+	notifications []entity.Notification) mailData {
+
+	data := mailData{
+		Username:       username,
+		PreferencesURL: uiAddress + "/settings",
+	}
+	for _, n := range notifications {
+		data.Notifications = append(data.Notifications, mailItem{
+			Title:   title(n),
+			Message: n.Message,
+			URL:     uiAddress + "/file/" + n.SHA256,
+			Date:    time.Unix(n.Timestamp, 0).UTC().Format(time.RFC1123),
+		})
+	}
+	return data
+}
+
+// title returns a one line summary of a notification.
+func title(n entity.Notification) string {
+	file := n.SHA256
+	if len(file) > 12 {
+		file = file[:12] + "…"
+	}
+	switch n.Kind {
+	case KindDetection:
+		return fmt.Sprintf("New detections on %s", file)
+	case KindComment:
+		return fmt.Sprintf("%s commented on %s", n.Actor, file)
+	case KindBehavior:
+		return fmt.Sprintf("Behavior report available for %s", file)
+	case KindTag:
+		return fmt.Sprintf("%s tagged %s as %s", n.Actor, file, n.Tag)
+	}
+	return file
+}
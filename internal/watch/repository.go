@@ -0,0 +1,183 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package watch
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+// Repository encapsulates the logic to access watchlists and pending
+// notifications from the data source.
+type Repository interface {
+	// Get returns the watchlist of a user along with its CAS. The CAS is
+	// zero when the user did not watch anything yet.
+	Get(ctx context.Context, username string) (entity.Watchlist, uint64, error)
+	// Save creates or updates the watchlist of a user provided its CAS did
+	// not change.
+	Save(ctx context.Context, watchlist entity.Watchlist, cas uint64) error
+	// Watchers returns the watchlists interested in an event.
+	Watchers(ctx context.Context, kind, sha256, actor, tag string) (
+		[]entity.Watchlist, error)
+	// CreateNotification saves a notification waiting for the next digest.
+	CreateNotification(ctx context.Context, n entity.Notification) error
+	// Notifications returns the pending notifications of a user.
+	Notifications(ctx context.Context, username string, limit int) (
+		[]entity.Notification, error)
+	// DeleteNotification removes a notification once sent.
+	DeleteNotification(ctx context.Context, id string) error
+	// DigestsDue returns the users due for an email digest, along with the
+	// users notified immediately who have notifications pending since
+	// before `pending`.
+	DigestsDue(ctx context.Context, daily, weekly, pending int64,
+		limit int) ([]string, error)
+	// UserExists returns true when the user exists.
+	UserExists(ctx context.Context, username string) (bool, error)
+	// Recipient returns the username and email of a user.
+	Recipient(ctx context.Context, username string) (entity.User, error)
+}
+
+// repository persists watchlists in database.
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new watchlist repository.
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// key returns the document key of the watchlist of a user.
+func key(username string) string {
+	return "watchlist::" + strings.ToLower(username)
+}
+
+// Get reads the watchlist of a user from the database.
+func (r repository) Get(ctx context.Context, username string) (
+	entity.Watchlist, uint64, error) {
+
+	var watchlist entity.Watchlist
+	cas, err := r.db.GetWithCAS(ctx, key(username), &watchlist)
+	if errors.Is(err, dbcontext.ErrDocumentNotFound) {
+		return entity.Watchlist{}, 0, nil
+	}
+	return watchlist, cas, err
+}
+
+// Save creates or updates the watchlist of a user in the database. A
+// concurrent creation is reported as a CAS mismatch so that it is retried.
+func (r repository) Save(ctx context.Context, watchlist entity.Watchlist,
+	cas uint64) error {
+
+	if cas == 0 {
+		err := r.db.Create(ctx, key(watchlist.Username), &watchlist)
+		if errors.Is(err, dbcontext.ErrDocumentExists) {
+			return dbcontext.ErrCASMismatch
+		}
+		return err
+	}
+	_, err := r.db.Update(ctx, key(watchlist.Username), &watchlist, cas)
+	return err
+}
+
+// Watchers retrieves the watchlists interested in an event from the
+// database.
+func (r repository) Watchers(ctx context.Context, kind, sha256, actor,
+	tag string) ([]entity.Watchlist, error) {
+
+	var results interface{}
+	params := make(map[string]interface{}, 1)
+	params["kind"] = kind
+	params["sha256"] = sha256
+	params["actor"] = actor
+	params["tag"] = tag
+
+	query := r.db.N1QLQuery[dbcontext.Watchers]
+	err := r.db.Query(ctx, query, params, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	var watchlists []entity.Watchlist
+	err = dbcontext.Decode(results, &watchlists)
+	return watchlists, err
+}
+
+// CreateNotification saves a new notification in the database.
+func (r repository) CreateNotification(ctx context.Context,
+	n entity.Notification) error {
+	return r.db.Create(ctx, n.ID, &n)
+}
+
+// Notifications retrieves the pending notifications of a user from the
+// database.
+func (r repository) Notifications(ctx context.Context, username string,
+	limit int) ([]entity.Notification, error) {
+
+	var results interface{}
+	params := make(map[string]interface{}, 1)
+	params["username"] = username
+	params["limit"] = limit
+
+	query := r.db.N1QLQuery[dbcontext.UserNotifications]
+	err := r.db.Query(ctx, query, params, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	var notifications []entity.Notification
+	err = dbcontext.Decode(results, &notifications)
+	return notifications, err
+}
+
+// DeleteNotification deletes a notification from the database.
+func (r repository) DeleteNotification(ctx context.Context, id string) error {
+	return r.db.Delete(ctx, id)
+}
+
+// DigestsDue retrieves the users due for an email digest from the database.
+func (r repository) DigestsDue(ctx context.Context, daily, weekly,
+	pending int64, limit int) ([]string, error) {
+
+	var results interface{}
+	params := make(map[string]interface{}, 1)
+	params["daily"] = daily
+	params["weekly"] = weekly
+	params["pending"] = pending
+	params["limit"] = limit
+
+	query := r.db.N1QLQuery[dbcontext.WatchDigestsDue]
+	err := r.db.Query(ctx, query, params, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	var usernames []string
+	err = dbcontext.Decode(results, &usernames)
+	return usernames, err
+}
+
+// UserExists checks if a user exists in the database.
+func (r repository) UserExists(ctx context.Context, username string) (
+	bool, error) {
+	docExists := false
+	err := r.db.Exists(ctx, entity.User{Username: username}.ID(), &docExists)
+	return docExists, err
+}
+
+// Recipient reads the username and email of a user from the database.
+func (r repository) Recipient(ctx context.Context, username string) (
+	entity.User, error) {
+	var user entity.User
+	err := r.db.Lookup(ctx, entity.User{Username: username}.ID(),
+		[]string{"username", "email"}, &user)
+	return user, err
+}
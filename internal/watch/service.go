@@ -0,0 +1,461 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package watch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	e "github.com/saferwall/saferwall-api/internal/errors"
+	"github.com/saferwall/saferwall-api/internal/tag"
+	tpl "github.com/saferwall/saferwall-api/internal/template"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+// Kinds of events watchers get notified of.
+const (
+	KindDetection = "detection"
+	KindComment   = "comment"
+	KindBehavior  = "behavior"
+	KindTag       = "tag"
+)
+
+// How often watchers get notified.
+const (
+	FrequencyImmediate = "immediate"
+	FrequencyDaily     = "daily"
+	FrequencyWeekly    = "weekly"
+	FrequencyOff       = "off"
+)
+
+// Watchlist item kinds, they match the API path segments.
+const (
+	ItemFiles = "files"
+	ItemTags  = "tags"
+	ItemUsers = "users"
+)
+
+const (
+	// Maximum number of items per list of a watchlist.
+	maxWatchedItems = 1000
+	// Maximum number of notifications in a digest.
+	maxDigestSize = 100
+	// Maximum number of digests sent per run.
+	digestBatchSize = 100
+	// Timeout for sending an immediate notification.
+	sendTimeout = 30 * time.Second
+	// Maximum number of immediate notifications sent concurrently.
+	maxConcurrentSends = 16
+)
+
+var (
+	sha256Regex = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+	// Preferences of the users who did not set any.
+	defaultPreferences = entity.NotificationPreferences{
+		Frequency: FrequencyDaily,
+		Events:    []string{KindDetection, KindComment, KindBehavior, KindTag},
+	}
+
+	errInvalidItemKind  = e.NotFound("")
+	errInvalidItem      = e.BadRequest("invalid watchlist item")
+	errTooManyItems     = e.BadRequest("too many watched items")
+	errItemNotInWatched = e.NotFound("item is not watched")
+)
+
+// Watchlist represents the files, tags and users a user keeps an eye on.
+type Watchlist struct {
+	entity.Watchlist
+}
+
+// Notice describes something which happened to a file.
+type Notice struct {
+	// Kind is one of: "detection", "comment", "behavior", "tag".
+	Kind string
+	// SHA256 of the file.
+	SHA256 string
+	// Actor is the user who caused the event, if any.
+	Actor string
+	// Tag applied to the file, only set for "tag" notices.
+	Tag string
+	// Message describes what happened.
+	Message string
+}
+
+// Mailer represents the mailer interface.
+type Mailer interface {
+	Send(body, subject, from, to string) error
+}
+
+// Service encapsulates usecase logic for watchlists.
+type Service interface {
+	Get(ctx context.Context) (Watchlist, error)
+	Watch(ctx context.Context, kind string, input WatchRequest) (Watchlist, error)
+	Unwatch(ctx context.Context, kind, value string) (Watchlist, error)
+	UpdatePreferences(ctx context.Context, input PreferencesRequest) (
+		Watchlist, error)
+	// Watched returns the users and the files a user watches.
+	Watched(ctx context.Context, username string) (users, files []string,
+		err error)
+	// Notify lets the watchers of a file, a user or a tag know about an
+	// event. It is best effort, errors are only logged.
+	Notify(ctx context.Context, notice Notice)
+	// TagApplied notifies the watchers of a file or a tag that an analyst
+	// applied the tag to the file.
+	TagApplied(ctx context.Context, sha256, tag, username string)
+	// SendDigests emails the pending notifications to the users whose
+	// digest is due.
+	SendDigests(ctx context.Context) error
+}
+
+type service struct {
+	repo      Repository
+	logger    log.Logger
+	mailer    Mailer
+	templater tpl.Service
+	uiAddress string
+	// sends bounds the number of immediate notifications being sent.
+	sends chan struct{}
+}
+
+// WatchRequest represents a request to watch a file, a tag or a user.
+type WatchRequest struct {
+	Value string `json:"value" validate:"required,max=64"`
+}
+
+// PreferencesRequest represents a notification preferences update request.
+type PreferencesRequest struct {
+	Frequency string   `json:"frequency" validate:"required,oneof=immediate daily weekly off"`
+	Events    []string `json:"events" validate:"omitempty,dive,oneof=detection comment behavior tag"`
+}
+
+// NewService creates a new watchlist service.
+func NewService(repo Repository, logger log.Logger, mailer Mailer,
+	templater tpl.Service, uiAddress string) Service {
+	return service{repo, logger, mailer, templater, uiAddress,
+		make(chan struct{}, maxConcurrentSends)}
+}
+
+// Get returns the watchlist of the logged-in user.
+func (s service) Get(ctx context.Context) (Watchlist, error) {
+	user, _ := ctx.Value(entity.UserKey).(entity.User)
+	watchlist, _, err := s.repo.Get(ctx, user.ID())
+	if err != nil {
+		return Watchlist{}, err
+	}
+	return Watchlist{withDefaults(watchlist, user.ID())}, nil
+}
+
+// Watched returns the users and the files in the watchlist of a user.
+func (s service) Watched(ctx context.Context, username string) (
+	[]string, []string, error) {
+	watchlist, _, err := s.repo.Get(ctx, username)
+	if err != nil {
+		return nil, nil, err
+	}
+	return watchlist.Users, watchlist.Files, nil
+}
+
+// Watch adds a file, a tag or a user to the watchlist of the logged-in user.
+func (s service) Watch(ctx context.Context, kind string,
+	req WatchRequest) (Watchlist, error) {
+
+	value, err := s.normalize(ctx, kind, req.Value)
+	if err != nil {
+		return Watchlist{}, err
+	}
+
+	return s.update(ctx, func(w *entity.Watchlist) error {
+		items := list(w, kind)
+		for _, item := range *items {
+			if item == value {
+				return nil
+			}
+		}
+		if len(*items) >= maxWatchedItems {
+			return errTooManyItems
+		}
+		*items = append(*items, value)
+		return nil
+	})
+}
+
+// Unwatch removes a file, a tag or a user from the watchlist of the
+// logged-in user.
+func (s service) Unwatch(ctx context.Context, kind, value string) (
+	Watchlist, error) {
+
+	if list(&entity.Watchlist{}, kind) == nil {
+		return Watchlist{}, errInvalidItemKind
+	}
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	return s.update(ctx, func(w *entity.Watchlist) error {
+		items := list(w, kind)
+		for i, item := range *items {
+			if item == value {
+				*items = append((*items)[:i], (*items)[i+1:]...)
+				return nil
+			}
+		}
+		return errItemNotInWatched
+	})
+}
+
+// UpdatePreferences changes how the logged-in user gets notified.
+func (s service) UpdatePreferences(ctx context.Context,
+	req PreferencesRequest) (Watchlist, error) {
+
+	return s.update(ctx, func(w *entity.Watchlist) error {
+		w.Preferences.Frequency = req.Frequency
+		if req.Events != nil {
+			w.Preferences.Events = req.Events
+		}
+		return nil
+	})
+}
+
+// update applies a change to the watchlist of the logged-in user.
+func (s service) update(ctx context.Context,
+	change func(w *entity.Watchlist) error) (Watchlist, error) {
+
+	user, _ := ctx.Value(entity.UserKey).(entity.User)
+
+	var watchlist entity.Watchlist
+	err := dbcontext.RetryOnCASMismatch(ctx, func() error {
+		cur, cas, err := s.repo.Get(ctx, user.ID())
+		if err != nil {
+			return err
+		}
+		watchlist = withDefaults(cur, user.ID())
+		if err = change(&watchlist); err != nil {
+			return err
+		}
+		return s.repo.Save(ctx, watchlist, cas)
+	})
+	if err != nil {
+		return Watchlist{}, err
+	}
+	return Watchlist{watchlist}, nil
+}
+
+// normalize validates an item to watch and returns its canonical form.
+func (s service) normalize(ctx context.Context, kind, value string) (
+	string, error) {
+
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch kind {
+	case ItemFiles:
+		if !sha256Regex.MatchString(value) {
+			return "", errInvalidItem
+		}
+	case ItemTags:
+		value = tag.Normalize(value)
+		if !tag.IsValid(value) {
+			return "", errInvalidItem
+		}
+	case ItemUsers:
+		exists, err := s.repo.UserExists(ctx, value)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return "", errInvalidItem
+		}
+	default:
+		return "", errInvalidItemKind
+	}
+	return value, nil
+}
+
+// TagApplied notifies the watchers of a file or a tag about a new tag.
+func (s service) TagApplied(ctx context.Context, sha256, tag,
+	username string) {
+	s.Notify(ctx, Notice{
+		Kind:   KindTag,
+		SHA256: sha256,
+		Actor:  username,
+		Tag:    tag,
+	})
+}
+
+// Notify creates a notification for every watcher interested in the notice.
+// Watchers who asked to be notified immediately get an email right away,
+// the others get it in their next digest. The number of emails sent at once
+// is bounded, the notifications above the bound and the ones which failed to
+// be sent are left pending until the next digest run.
+func (s service) Notify(ctx context.Context, notice Notice) {
+	watchers, err := s.repo.Watchers(ctx, notice.Kind,
+		strings.ToLower(notice.SHA256), strings.ToLower(notice.Actor),
+		notice.Tag)
+	if err != nil {
+		s.logger.With(ctx).Error(err)
+		return
+	}
+
+	now := time.Now().Unix()
+	for _, watcher := range watchers {
+		n := entity.Notification{
+			Type:      "notification",
+			ID:        entity.ID(),
+			Username:  watcher.Username,
+			Kind:      notice.Kind,
+			SHA256:    strings.ToLower(notice.SHA256),
+			Actor:     strings.ToLower(notice.Actor),
+			Tag:       notice.Tag,
+			Message:   notice.Message,
+			Timestamp: now,
+		}
+		if err = s.repo.CreateNotification(ctx, n); err != nil {
+			s.logger.With(ctx).Error(err)
+			continue
+		}
+
+		if watcher.Preferences.Frequency == FrequencyImmediate {
+			select {
+			case s.sends <- struct{}{}:
+				go s.sendNow(n)
+			default:
+			}
+		}
+	}
+}
+
+// sendNow emails a notification right away and deletes it once sent, it
+// releases its slot of the concurrent sends once done.
+func (s service) sendNow(n entity.Notification) {
+	defer func() { <-s.sends }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	err := s.send(ctx, n.Username, tpl.WatchNotification,
+		[]entity.Notification{n})
+	if err == nil {
+		err = s.repo.DeleteNotification(ctx, n.ID)
+	}
+	if err != nil {
+		s.logger.Error(err)
+	}
+}
+
+// SendDigests emails the pending notifications to the users whose digest is
+// due, and to the users notified immediately who have notifications left
+// pending. Every user is claimed before sending, so concurrent instances do not
+// send the same digest twice.
+func (s service) SendDigests(ctx context.Context) error {
+	now := time.Now()
+	daily := now.Add(-24 * time.Hour).Unix()
+	weekly := now.Add(-7 * 24 * time.Hour).Unix()
+	// The immediate notifications still pending once they could have been
+	// sent are sent in a digest instead.
+	pending := now.Add(-sendTimeout).Unix()
+
+	usernames, err := s.repo.DigestsDue(ctx, daily, weekly, pending,
+		digestBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, username := range usernames {
+		watchlist, cas, err := s.repo.Get(ctx, username)
+		if err != nil {
+			return err
+		}
+		watchlist.LastDigest = now.Unix()
+		err = s.repo.Save(ctx, watchlist, cas)
+		if errors.Is(err, dbcontext.ErrCASMismatch) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		notifications, err := s.repo.Notifications(ctx, username,
+			maxDigestSize)
+		if err != nil {
+			return err
+		}
+		if len(notifications) == 0 {
+			continue
+		}
+		if err = s.send(ctx, username, tpl.WatchDigest,
+			notifications); err != nil {
+			s.logger.With(ctx).Errorf("failed to send digest to %s: %v",
+				username, err)
+			continue
+		}
+		for _, n := range notifications {
+			if err = s.repo.DeleteNotification(ctx, n.ID); err != nil {
+				s.logger.With(ctx).Error(err)
+			}
+		}
+	}
+	return nil
+}
+
+// send emails a list of notifications to a user.
+func (s service) send(ctx context.Context, username string,
+	template tpl.EmailTemplate, notifications []entity.Notification) error {
+
+	// No email is sent when smtp is not configured.
+	emailTpl, ok := s.templater.EmailRequestTemplate[template]
+	if !ok {
+		return nil
+	}
+
+	user, err := s.repo.Recipient(ctx, username)
+	if err != nil {
+		return err
+	}
+	if user.Email == "" {
+		return nil
+	}
+
+	body := new(bytes.Buffer)
+	data := newMailData(user.Username, s.uiAddress, notifications)
+	if err = emailTpl.Execute(data, body); err != nil {
+		return err
+	}
+	return s.mailer.Send(body.String(), emailTpl.Subject, emailTpl.From,
+		user.Email)
+}
+
+// withDefaults fills the unset fields of a watchlist.
+func withDefaults(w entity.Watchlist, username string) entity.Watchlist {
+	w.Type = "watchlist"
+	w.Username = username
+	if w.Files == nil {
+		w.Files = []string{}
+	}
+	if w.Tags == nil {
+		w.Tags = []string{}
+	}
+	if w.Users == nil {
+		w.Users = []string{}
+	}
+	if w.Preferences.Frequency == "" {
+		w.Preferences = defaultPreferences
+	}
+	return w
+}
+
+// list returns the list of a watchlist matching an item kind.
+func list(w *entity.Watchlist, kind string) *[]string {
+	switch kind {
+	case ItemFiles:
+		return &w.Files
+	case ItemTags:
+		return &w.Tags
+	case ItemUsers:
+		return &w.Users
+	}
+	return nil
+}
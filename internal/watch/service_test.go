@@ -0,0 +1,167 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package watch
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	tpl "github.com/saferwall/saferwall-api/internal/template"
+	"github.com/saferwall/saferwall-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockRepository fails to claim the digest of the users in claimed.
+type mockRepository struct {
+	Repository
+	due     []string
+	claimed map[string]bool
+	read    *[]string
+	// watchers and pending are used by the Notify test.
+	watchers []entity.Watchlist
+	pending  *[]entity.Notification
+}
+
+func (m mockRepository) Watchers(ctx context.Context, kind, sha256, actor,
+	tag string) ([]entity.Watchlist, error) {
+	return m.watchers, nil
+}
+
+func (m mockRepository) CreateNotification(ctx context.Context,
+	n entity.Notification) error {
+	*m.pending = append(*m.pending, n)
+	return nil
+}
+
+func (m mockRepository) DeleteNotification(ctx context.Context,
+	id string) error {
+	for i, n := range *m.pending {
+		if n.ID == id {
+			*m.pending = append((*m.pending)[:i], (*m.pending)[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m mockRepository) DigestsDue(ctx context.Context, daily, weekly,
+	pending int64, limit int) ([]string, error) {
+	return m.due, nil
+}
+
+func (m mockRepository) Recipient(ctx context.Context, username string) (
+	entity.User, error) {
+	return entity.User{Username: username, Email: username + "@example.com"},
+		nil
+}
+
+func (m mockRepository) Get(ctx context.Context, username string) (
+	entity.Watchlist, uint64, error) {
+	return entity.Watchlist{Username: username}, 1, nil
+}
+
+func (m mockRepository) Save(ctx context.Context, watchlist entity.Watchlist,
+	cas uint64) error {
+	if m.claimed[watchlist.Username] {
+		return fmt.Errorf("failed to save watchlist: %w",
+			dbcontext.ErrCASMismatch)
+	}
+	return nil
+}
+
+func (m mockRepository) Notifications(ctx context.Context, username string,
+	limit int) ([]entity.Notification, error) {
+	*m.read = append(*m.read, username)
+	if m.pending == nil {
+		return nil, nil
+	}
+	var notifications []entity.Notification
+	for _, n := range *m.pending {
+		if n.Username == username {
+			notifications = append(notifications, n)
+		}
+	}
+	return notifications, nil
+}
+
+// mockMailer records the recipients of the emails sent.
+type mockMailer struct {
+	to *[]string
+}
+
+func (m mockMailer) Send(body, subject, from, to string) error {
+	*m.to = append(*m.to, to)
+	return nil
+}
+
+func TestWithDefaults(t *testing.T) {
+	w := withDefaults(entity.Watchlist{}, "alice")
+	assert.Equal(t, "alice", w.Username)
+	assert.Equal(t, defaultPreferences, w.Preferences)
+	assert.Empty(t, w.Files)
+	assert.NotNil(t, list(&w, ItemTags))
+	assert.Nil(t, list(&w, "groups"))
+
+	w = withDefaults(entity.Watchlist{Preferences: entity.NotificationPreferences{
+		Frequency: FrequencyOff}}, "alice")
+	assert.Equal(t, FrequencyOff, w.Preferences.Frequency)
+}
+
+func TestNewMailData(t *testing.T) {
+	sha256 := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	data := newMailData("alice", "https://saferwall.com",
+		[]entity.Notification{{Kind: KindTag, SHA256: sha256, Actor: "bob",
+			Tag: "emotet"}})
+	assert.Equal(t, "https://saferwall.com/settings", data.PreferencesURL)
+	assert.Len(t, data.Notifications, 1)
+	assert.Equal(t, "bob tagged e3b0c44298fc… as emotet",
+		data.Notifications[0].Title)
+	assert.Equal(t, "https://saferwall.com/file/"+sha256,
+		data.Notifications[0].URL)
+}
+
+func TestSendDigests(t *testing.T) {
+	// The digest of alice is claimed by another instance, it is skipped.
+	var read []string
+	repo := mockRepository{due: []string{"alice", "bob"},
+		claimed: map[string]bool{"alice": true}, read: &read}
+	s := service{repo: repo, logger: log.New()}
+	assert.Nil(t, s.SendDigests(context.Background()))
+	assert.Equal(t, []string{"bob"}, read)
+}
+
+func TestNotify(t *testing.T) {
+	templater, err := tpl.New("../../templates")
+	assert.Nil(t, err)
+
+	// No email can be sent right away, the immediate notification of alice
+	// is left pending along with the daily one of bob.
+	var pending []entity.Notification
+	var read, sent []string
+	repo := mockRepository{pending: &pending, read: &read,
+		watchers: []entity.Watchlist{
+			{Username: "alice", Preferences: entity.NotificationPreferences{
+				Frequency: FrequencyImmediate}},
+			{Username: "bob", Preferences: entity.NotificationPreferences{
+				Frequency: FrequencyDaily}},
+		}}
+	s := service{repo: repo, logger: log.New(), mailer: mockMailer{&sent},
+		templater: templater, sends: make(chan struct{}, 1)}
+	s.sends <- struct{}{}
+	s.Notify(context.Background(), Notice{Kind: KindComment})
+	assert.Len(t, pending, 2)
+	assert.Empty(t, sent)
+
+	// The next digest run delivers it.
+	repo.due = []string{"alice"}
+	s.repo = repo
+	assert.Nil(t, s.SendDigests(context.Background()))
+	assert.Equal(t, []string{"alice@example.com"}, sent)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "bob", pending[0].Username)
+}
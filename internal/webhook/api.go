@@ -0,0 +1,220 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/saferwall/saferwall-api/internal/errors"
+	"github.com/saferwall/saferwall-api/pkg/log"
+	"github.com/saferwall/saferwall-api/pkg/pagination"
+)
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func RegisterHandlers(g *echo.Group, service Service,
+	logger log.Logger, requireLogin echo.MiddlewareFunc,
+	verifyID echo.MiddlewareFunc) {
+
+	res := resource{service, logger}
+
+	g.GET("/webhooks/", res.list, requireLogin)
+	g.POST("/webhooks/", res.create, requireLogin)
+	g.GET("/webhooks/:id/", res.get, verifyID, requireLogin)
+	g.PATCH("/webhooks/:id/", res.update, verifyID, requireLogin)
+	g.DELETE("/webhooks/:id/", res.delete, verifyID, requireLogin)
+	g.GET("/webhooks/:id/deliveries/", res.deliveries, verifyID, requireLogin)
+	g.POST("/webhooks/:id/deliveries/:delivery/redeliver/", res.redeliver,
+		verifyID, requireLogin)
+}
+
+// @Summary Retrieves a paginated list of webhooks
+// @Description List the webhooks of the logged-in user.
+// @Tags Webhook
+// @Produce json
+// @Param per_page query uint false "Number of webhooks per page"
+// @Param page query uint false "Specify the page number"
+// @Success 200 {object} pagination.Pages{items=[]entity.Webhook}
+// @Failure 401 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /webhooks/ [get]
+// @Security Bearer
+func (r resource) list(c echo.Context) error {
+	ctx := c.Request().Context()
+	count, err := r.service.Count(ctx)
+	if err != nil {
+		return err
+	}
+
+	pages := pagination.NewFromRequest(c.Request(), count)
+	webhooks, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = webhooks
+	return c.JSON(http.StatusOK, pages)
+}
+
+// @Summary Create a new webhook
+// @Description Register an endpoint notified of events. The secret used to
+// @Description sign the deliveries is only returned in this response.
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param data body CreateWebhookRequest true "Webhook body"
+// @Success 201 {object} entity.Webhook
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 401 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /webhooks/ [post]
+// @Security Bearer
+func (r resource) create(c echo.Context) error {
+	var input CreateWebhookRequest
+	ctx := c.Request().Context()
+	if err := c.Bind(&input); err != nil {
+		r.logger.With(ctx).Info(err)
+		return err
+	}
+
+	webhook, err := r.service.Create(ctx, input)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, webhook)
+}
+
+// @Summary Get webhook by ID
+// @Description Retrieves information about a webhook.
+// @Tags Webhook
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} entity.Webhook
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /webhooks/{id}/ [get]
+// @Security Bearer
+func (r resource) get(c echo.Context) error {
+	ctx := c.Request().Context()
+	webhook, err := r.service.Get(ctx, c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, webhook)
+}
+
+// @Summary Update a webhook
+// @Description Change the URL, the events or pause a webhook.
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param data body UpdateWebhookRequest true "New webhook data"
+// @Success 200 {object} entity.Webhook
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /webhooks/{id}/ [patch]
+// @Security Bearer
+func (r resource) update(c echo.Context) error {
+	var input UpdateWebhookRequest
+	ctx := c.Request().Context()
+	if err := c.Bind(&input); err != nil {
+		r.logger.With(ctx).Info(err)
+		return err
+	}
+
+	webhook, err := r.service.Update(ctx, c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, webhook)
+}
+
+// @Summary Deletes a webhook
+// @Description Deletes a webhook by ID.
+// @Tags Webhook
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} entity.Webhook
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /webhooks/{id}/ [delete]
+// @Security Bearer
+func (r resource) delete(c echo.Context) error {
+	ctx := c.Request().Context()
+	webhook, err := r.service.Delete(ctx, c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, webhook)
+}
+
+// @Summary Webhook delivery log
+// @Description Paginated list of the deliveries of a webhook. Use
+// @Description `status=dead` to list the dead-letter deliveries.
+// @Tags Webhook
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param status query string false "Filter by status: pending, succeeded, dead"
+// @Param per_page query uint false "Number of deliveries per page"
+// @Param page query uint false "Specify the page number"
+// @Success 200 {object} pagination.Pages{items=[]entity.WebhookDelivery}
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /webhooks/{id}/deliveries/ [get]
+// @Security Bearer
+func (r resource) deliveries(c echo.Context) error {
+	ctx := c.Request().Context()
+	status := c.QueryParam("status")
+	switch status {
+	case "", StatusPending, StatusSucceeded, StatusDead:
+	default:
+		return errors.BadRequest("invalid status")
+	}
+
+	count, err := r.service.CountDeliveries(ctx, c.Param("id"), status)
+	if err != nil {
+		return err
+	}
+
+	pages := pagination.NewFromRequest(c.Request(), count)
+	deliveries, err := r.service.Deliveries(ctx, c.Param("id"), status,
+		pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = deliveries
+	return c.JSON(http.StatusOK, pages)
+}
+
+// @Summary Redeliver a webhook delivery
+// @Description Queue again a delivery, typically one from the dead-letter list.
+// @Tags Webhook
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param delivery path string true "Delivery ID"
+// @Failure 400 {object} errors.ErrorResponse
+// @Failure 404 {object} errors.ErrorResponse
+// @Failure 409 {object} errors.ErrorResponse
+// @Failure 500 {object} errors.ErrorResponse
+// @Router /webhooks/{id}/deliveries/{delivery}/redeliver/ [post]
+// @Security Bearer
+func (r resource) redeliver(c echo.Context) error {
+	ctx := c.Request().Context()
+	err := r.service.Redeliver(ctx, c.Param("id"), c.Param("delivery"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, struct {
+		Message string `json:"message"`
+		Status  int    `json:"status"`
+	}{"ok", http.StatusOK})
+}
@@ -0,0 +1,313 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/saferwall/saferwall-api/pkg/log"
+	"github.com/saferwall/saferwall-api/pkg/netutil"
+)
+
+const (
+	// Interval at which the due deliveries are polled.
+	pollInterval = 5 * time.Second
+	// Maximum number of deliveries attempted per poll.
+	batchSize = 50
+	// Time a delivery is claimed by a dispatcher, other API instances skip
+	// it meanwhile.
+	leaseDuration = time.Minute
+	// Timeout of a delivery HTTP request.
+	requestTimeout = 10 * time.Second
+	// Maximum number of attempts before a delivery goes to the dead-letter
+	// list.
+	maxAttempts = 8
+	// Delay before the first retry, it doubles after every failed attempt.
+	baseBackoff = 30 * time.Second
+	// Upper bound of the delay between two attempts.
+	maxBackoff = 6 * time.Hour
+)
+
+// Headers sent along with a delivery.
+const (
+	HeaderEvent     = "X-Saferwall-Event"
+	HeaderDelivery  = "X-Saferwall-Delivery"
+	HeaderTimestamp = "X-Saferwall-Timestamp"
+	// HeaderSignature holds `sha256=` followed by the hex encoded
+	// HMAC-SHA256 of `<timestamp>.<body>` keyed with the webhook secret.
+	HeaderSignature = "X-Saferwall-Signature"
+)
+
+var errForbiddenAddress = errors.New("webhook address is not allowed")
+
+// Dispatcher delivers the pending webhook deliveries.
+type Dispatcher struct {
+	repo   Repository
+	logger log.Logger
+	client *http.Client
+}
+
+// NewDispatcher creates a new webhook dispatcher. Its HTTP client refuses
+// to connect to loopback and private addresses so that webhooks cannot be
+// used to reach internal services.
+func NewDispatcher(repo Repository, logger log.Logger) *Dispatcher {
+	dialer := &net.Dialer{
+		Timeout: requestTimeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !netutil.IsPublicIP(ip) {
+				return errForbiddenAddress
+			}
+			return nil
+		},
+	}
+	client := &http.Client{
+		Timeout:   requestTimeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		// Redirects are not followed, a 3xx counts as a failed attempt.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return &Dispatcher{repo, logger, client}
+}
+
+// Run polls and delivers the due deliveries until the context is canceled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.dispatch(ctx)
+		}
+	}
+}
+
+// dispatch fans out the queued events then delivers a batch of due
+// deliveries.
+func (d *Dispatcher) dispatch(ctx context.Context) {
+	ids, err := d.repo.DueEvents(ctx, time.Now().Unix(), batchSize)
+	if err != nil {
+		d.logger.Error(err)
+		return
+	}
+	for _, id := range ids {
+		if err = d.fanOut(ctx, id); err != nil {
+			d.logger.Errorf("failed to fan out %s: %v", id, err)
+		}
+	}
+
+	ids, err = d.repo.DueDeliveries(ctx, time.Now().Unix(), batchSize)
+	if err != nil {
+		d.logger.Error(err)
+		return
+	}
+	for _, id := range ids {
+		if err = d.deliver(ctx, id); err != nil {
+			d.logger.Errorf("failed to deliver %s: %v", id, err)
+		}
+	}
+}
+
+// fanOut creates a pending delivery of an event for every webhook subscribed
+// to it, then removes the event.
+func (d *Dispatcher) fanOut(ctx context.Context, id string) error {
+	event, cas, err := d.repo.GetEvent(ctx, id)
+	if errors.Is(err, dbcontext.ErrDocumentNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if event.ClaimedUntil > now.Unix() {
+		return nil
+	}
+
+	// Claim the event, when another instance got it first the CAS does not
+	// match anymore and the event is skipped.
+	event.ClaimedUntil = now.Add(leaseDuration).Unix()
+	err = d.repo.UpdateEvent(ctx, event, cas)
+	if errors.Is(err, dbcontext.ErrCASMismatch) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	webhooks, err := d.repo.Subscribers(ctx, event)
+	if err != nil {
+		return err
+	}
+	for _, webhook := range webhooks {
+		err = d.repo.CreateDelivery(ctx, entity.WebhookDelivery{
+			Type:        "webhook_delivery",
+			ID:          deliveryID(event.ID, webhook.ID),
+			WebhookID:   webhook.ID,
+			Username:    webhook.Username,
+			Event:       event.Event,
+			Payload:     event.Payload,
+			Status:      StatusPending,
+			NextAttempt: now.Unix(),
+			CreatedAt:   now.Unix(),
+		})
+		// The delivery already exists when a previous fan out of the event
+		// was interrupted.
+		if err != nil && !errors.Is(err, dbcontext.ErrDocumentExists) {
+			return err
+		}
+	}
+	return d.repo.DeleteEvent(ctx, event.ID)
+}
+
+// deliveryID returns the ID of the delivery of an event to a webhook, it is
+// the same across attempts to fan out the event.
+func deliveryID(eventID, webhookID string) string {
+	return uuid.NewSHA1(uuid.NameSpaceURL,
+		[]byte(eventID+"/"+webhookID)).String()
+}
+
+// deliver makes one attempt to deliver a delivery and records its outcome.
+func (d *Dispatcher) deliver(ctx context.Context, id string) error {
+	delivery, cas, err := d.repo.GetDelivery(ctx, id)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if delivery.Status != StatusPending || delivery.NextAttempt > now.Unix() {
+		return nil
+	}
+
+	// Claim the delivery, when another instance got it first the CAS does
+	// not match anymore and the delivery is skipped.
+	delivery.NextAttempt = now.Add(leaseDuration).Unix()
+	cas, err = d.repo.UpdateDelivery(ctx, delivery, cas)
+	if errors.Is(err, dbcontext.ErrCASMismatch) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var code int
+	webhook, err := d.repo.Get(ctx, delivery.WebhookID)
+	switch {
+	case errors.Is(err, dbcontext.ErrDocumentNotFound):
+		err = errors.New("webhook was deleted")
+		delivery.Attempts = maxAttempts
+	case err != nil:
+		return err
+	case !webhook.Active:
+		err = errors.New("webhook is inactive")
+		delivery.Attempts = maxAttempts
+	default:
+		code, err = send(ctx, d.client, webhook, delivery, now)
+		delivery.Attempts++
+	}
+
+	record(&delivery, code, err, now)
+	_, err = d.repo.UpdateDelivery(ctx, delivery, cas)
+	return err
+}
+
+// record updates a delivery with the outcome of an attempt.
+func record(delivery *entity.WebhookDelivery, code int, err error,
+	now time.Time) {
+
+	delivery.ResponseCode = code
+	delivery.UpdatedAt = now.Unix()
+	delivery.NextAttempt = 0
+	delivery.LastError = ""
+
+	switch {
+	case err == nil:
+		delivery.Status = StatusSucceeded
+	case delivery.Attempts >= maxAttempts:
+		delivery.Status = StatusDead
+		delivery.LastError = err.Error()
+	default:
+		delivery.LastError = err.Error()
+		delivery.NextAttempt = now.Add(backoff(delivery.Attempts)).Unix()
+	}
+}
+
+// send posts the payload of a delivery to the webhook URL.
+func send(ctx context.Context, client *http.Client, webhook entity.Webhook,
+	delivery entity.WebhookDelivery, now time.Time) (int, error) {
+
+	body := []byte(delivery.Payload)
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL,
+		bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	ts := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Saferwall-Webhook/1.0")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, "sha256="+Sign(webhook.Secret, ts, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d",
+			resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign computes the signature of a delivery body. Receivers recompute it
+// with their copy of the secret to authenticate the delivery.
+func Sign(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", ts)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff returns the delay before the next attempt.
+func backoff(attempts int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return delay
+}
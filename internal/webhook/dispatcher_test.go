@@ -0,0 +1,104 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSend(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	payload := `{"event":"file.scanned"}`
+
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			ts, _ := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+			assert.Equal(t, payload, string(body))
+			assert.Equal(t, FileScanned, r.Header.Get(HeaderEvent))
+			assert.Equal(t, "1", r.Header.Get(HeaderDelivery))
+			assert.Equal(t, "sha256="+Sign("secret", ts, body),
+				r.Header.Get(HeaderSignature))
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	defer srv.Close()
+
+	code, err := send(context.Background(), srv.Client(),
+		entity.Webhook{URL: srv.URL, Secret: "secret"},
+		entity.WebhookDelivery{ID: "1", Event: FileScanned, Payload: payload},
+		now)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNoContent, code)
+}
+
+func TestSendFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+	defer srv.Close()
+
+	code, err := send(context.Background(), srv.Client(),
+		entity.Webhook{URL: srv.URL}, entity.WebhookDelivery{}, time.Now())
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadGateway, code)
+
+	// The dispatcher client refuses to reach internal addresses.
+	d := NewDispatcher(nil, nil)
+	_, err = send(context.Background(), d.client,
+		entity.Webhook{URL: srv.URL}, entity.WebhookDelivery{}, time.Now())
+	assert.True(t, errors.Is(err, errForbiddenAddress))
+
+	// Nor the shared address space of carrier-grade NATs.
+	_, err = send(context.Background(), d.client,
+		entity.Webhook{URL: "http://100.64.0.1/hook"}, entity.WebhookDelivery{},
+		time.Now())
+	assert.True(t, errors.Is(err, errForbiddenAddress))
+}
+
+func TestRecord(t *testing.T) {
+	now := time.Unix(1000, 0)
+	errFailed := errors.New("failed")
+
+	d := entity.WebhookDelivery{Status: StatusPending, Attempts: 1}
+	record(&d, 500, errFailed, now)
+	assert.Equal(t, StatusPending, d.Status)
+	assert.Equal(t, "failed", d.LastError)
+	assert.Equal(t, now.Add(baseBackoff).Unix(), d.NextAttempt)
+
+	d.Attempts = maxAttempts
+	record(&d, 500, errFailed, now)
+	assert.Equal(t, StatusDead, d.Status)
+	assert.Equal(t, int64(0), d.NextAttempt)
+
+	d = entity.WebhookDelivery{Status: StatusPending, Attempts: 3}
+	record(&d, 200, nil, now)
+	assert.Equal(t, StatusSucceeded, d.Status)
+	assert.Equal(t, "", d.LastError)
+}
+
+func TestDeliveryID(t *testing.T) {
+	event, webhook := entity.ID(), entity.ID()
+	id := deliveryID(event, webhook)
+	assert.True(t, entity.IsValidID(id))
+	assert.Equal(t, id, deliveryID(event, webhook))
+	assert.NotEqual(t, id, deliveryID(event, entity.ID()))
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, baseBackoff, backoff(1))
+	assert.Equal(t, 4*baseBackoff, backoff(3))
+	assert.Equal(t, maxBackoff, backoff(100))
+}
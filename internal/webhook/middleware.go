@@ -0,0 +1,42 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	e "github.com/saferwall/saferwall-api/internal/errors"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+type middleware struct {
+	logger log.Logger
+}
+
+// NewMiddleware creates a new webhook Middleware.
+func NewMiddleware(logger log.Logger) middleware {
+	return middleware{logger}
+}
+
+// VerifyID validates the webhook and the delivery IDs.
+func (m middleware) VerifyID(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		for _, param := range []string{"id", "delivery"} {
+			id := strings.ToLower(c.Param(param))
+			if id == "" && param == "delivery" {
+				continue
+			}
+			if !entity.IsValidID(id) {
+				m.logger.Error("failed to match regex for webhook ID %v", id)
+				return e.BadRequest("invalid ID string")
+			}
+		}
+
+		return next(c)
+	}
+}
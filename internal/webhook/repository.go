@@ -0,0 +1,281 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"context"
+	"strings"
+
+	dbcontext "github.com/saferwall/saferwall-api/internal/db"
+	"github.com/saferwall/saferwall-api/internal/entity"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+// Repository encapsulates the logic to access webhooks and their deliveries
+// from the data source.
+type Repository interface {
+	// Get returns the webhook with the specified webhook ID.
+	Get(ctx context.Context, id string) (entity.Webhook, error)
+	// Create saves a new webhook in the storage.
+	Create(ctx context.Context, webhook entity.Webhook) error
+	// Update updates the webhook with given ID in the storage.
+	Update(ctx context.Context, webhook entity.Webhook) error
+	// Delete removes the webhook with given ID from the storage.
+	Delete(ctx context.Context, id string) error
+	// Query returns the webhooks of a user with the given offset and limit.
+	Query(ctx context.Context, username string, offset, limit int) (
+		[]entity.Webhook, error)
+	// Count returns the number of webhooks of a user.
+	Count(ctx context.Context, username string) (int, error)
+	// Subscribers returns the active webhooks subscribed to an event about
+	// a resource their owner submitted, caused or watches.
+	Subscribers(ctx context.Context, event entity.WebhookEvent) (
+		[]entity.Webhook, error)
+	// GetEvent returns the event with the specified ID along with its CAS.
+	GetEvent(ctx context.Context, id string) (entity.WebhookEvent, uint64,
+		error)
+	// CreateEvent saves a new event waiting to be fanned out.
+	CreateEvent(ctx context.Context, event entity.WebhookEvent) error
+	// UpdateEvent updates an event provided its CAS did not change.
+	UpdateEvent(ctx context.Context, event entity.WebhookEvent,
+		cas uint64) error
+	// DeleteEvent removes an event once fanned out.
+	DeleteEvent(ctx context.Context, id string) error
+	// DueEvents returns the IDs of the events waiting to be fanned out.
+	DueEvents(ctx context.Context, now int64, limit int) ([]string, error)
+	// GetDelivery returns the delivery with the specified ID along with
+	// its CAS.
+	GetDelivery(ctx context.Context, id string) (entity.WebhookDelivery,
+		uint64, error)
+	// CreateDelivery saves a new delivery in the storage.
+	CreateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error
+	// UpdateDelivery updates a delivery provided its CAS did not change. It
+	// returns the new CAS.
+	UpdateDelivery(ctx context.Context, delivery entity.WebhookDelivery,
+		cas uint64) (uint64, error)
+	// Deliveries returns the delivery log of a webhook, optionally filtered
+	// by status.
+	Deliveries(ctx context.Context, webhookID, status string, offset,
+		limit int) ([]interface{}, error)
+	// CountDeliveries returns the number of deliveries of a webhook.
+	CountDeliveries(ctx context.Context, webhookID, status string) (int, error)
+	// DueDeliveries returns the IDs of the pending deliveries due for an
+	// attempt.
+	DueDeliveries(ctx context.Context, now int64, limit int) ([]string, error)
+}
+
+// repository persists webhooks in database.
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new webhook repository.
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the webhook with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Webhook, error) {
+	var webhook entity.Webhook
+	err := r.db.Get(ctx, strings.ToLower(id), &webhook)
+	return webhook, err
+}
+
+// Create saves a new webhook record in the database.
+func (r repository) Create(ctx context.Context, webhook entity.Webhook) error {
+	return r.db.Create(ctx, webhook.ID, &webhook)
+}
+
+// Update saves the changes to a webhook in the database.
+func (r repository) Update(ctx context.Context, webhook entity.Webhook) error {
+	_, err := r.db.Update(ctx, webhook.ID, &webhook, 0)
+	return err
+}
+
+// Delete deletes a webhook with the specified ID from the database.
+func (r repository) Delete(ctx context.Context, id string) error {
+	return r.db.Delete(ctx, strings.ToLower(id))
+}
+
+// Query retrieves the webhooks of a user from the database.
+func (r repository) Query(ctx context.Context, username string, offset,
+	limit int) ([]entity.Webhook, error) {
+
+	var results interface{}
+	params := make(map[string]interface{}, 1)
+	params["username"] = username
+	params["offset"] = offset
+	params["limit"] = limit
+
+	query := r.db.N1QLQuery[dbcontext.Webhooks]
+	err := r.db.Query(ctx, query, params, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := []entity.Webhook{}
+	err = dbcontext.Decode(results, &webhooks)
+	return webhooks, err
+}
+
+// Count returns the number of webhooks of a user in the database.
+func (r repository) Count(ctx context.Context, username string) (int, error) {
+	var count int
+	params := make(map[string]interface{}, 1)
+	params["username"] = username
+
+	query := r.db.N1QLQuery[dbcontext.CountWebhooks]
+	err := r.db.Count(ctx, query, params, &count)
+	return count, err
+}
+
+// Subscribers retrieves the webhooks subscribed to an event from the
+// database.
+func (r repository) Subscribers(ctx context.Context,
+	event entity.WebhookEvent) ([]entity.Webhook, error) {
+
+	var results interface{}
+	params := make(map[string]interface{}, 1)
+	params["event"] = event.Event
+	params["sha256"] = event.SHA256
+	params["actor"] = event.Actor
+	params["tag"] = event.Tag
+
+	query := r.db.N1QLQuery[dbcontext.WebhookSubscribers]
+	err := r.db.Query(ctx, query, params, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	var webhooks []entity.Webhook
+	err = dbcontext.Decode(results, &webhooks)
+	return webhooks, err
+}
+
+// GetEvent reads the event with the specified ID from the database.
+func (r repository) GetEvent(ctx context.Context, id string) (
+	entity.WebhookEvent, uint64, error) {
+	var event entity.WebhookEvent
+	cas, err := r.db.GetWithCAS(ctx, strings.ToLower(id), &event)
+	return event, cas, err
+}
+
+// CreateEvent saves a new event record in the database.
+func (r repository) CreateEvent(ctx context.Context,
+	event entity.WebhookEvent) error {
+	return r.db.Create(ctx, event.ID, &event)
+}
+
+// UpdateEvent saves the changes to an event in the database.
+func (r repository) UpdateEvent(ctx context.Context,
+	event entity.WebhookEvent, cas uint64) error {
+	_, err := r.db.Update(ctx, event.ID, &event, cas)
+	return err
+}
+
+// DeleteEvent deletes an event with the specified ID from the database.
+func (r repository) DeleteEvent(ctx context.Context, id string) error {
+	return r.db.Delete(ctx, strings.ToLower(id))
+}
+
+// DueEvents retrieves the IDs of the events waiting to be fanned out from
+// the database.
+func (r repository) DueEvents(ctx context.Context, now int64,
+	limit int) ([]string, error) {
+
+	var results interface{}
+	params := make(map[string]interface{}, 1)
+	params["now"] = now
+	params["limit"] = limit
+
+	query := r.db.N1QLQuery[dbcontext.WebhookDueEvents]
+	err := r.db.Query(ctx, query, params, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	err = dbcontext.Decode(results, &ids)
+	return ids, err
+}
+
+// GetDelivery reads the delivery with the specified ID from the database.
+func (r repository) GetDelivery(ctx context.Context, id string) (
+	entity.WebhookDelivery, uint64, error) {
+	var delivery entity.WebhookDelivery
+	cas, err := r.db.GetWithCAS(ctx, strings.ToLower(id), &delivery)
+	return delivery, cas, err
+}
+
+// CreateDelivery saves a new delivery record in the database.
+func (r repository) CreateDelivery(ctx context.Context,
+	delivery entity.WebhookDelivery) error {
+	return r.db.Create(ctx, delivery.ID, &delivery)
+}
+
+// UpdateDelivery saves the changes to a delivery in the database.
+func (r repository) UpdateDelivery(ctx context.Context,
+	delivery entity.WebhookDelivery, cas uint64) (uint64, error) {
+	return r.db.Update(ctx, delivery.ID, &delivery, cas)
+}
+
+// Deliveries retrieves the delivery log of a webhook from the database.
+func (r repository) Deliveries(ctx context.Context, webhookID, status string,
+	offset, limit int) ([]interface{}, error) {
+
+	var results interface{}
+	params := make(map[string]interface{}, 1)
+	params["webhook_id"] = webhookID
+	params["status"] = status
+	params["offset"] = offset
+	params["limit"] = limit
+
+	query := r.db.N1QLQuery[dbcontext.WebhookDeliveries]
+	err := r.db.Query(ctx, query, params, &results)
+	if err != nil {
+		return nil, err
+	}
+	if len(results.([]interface{})) == 0 {
+		return []interface{}{}, nil
+	}
+	return results.([]interface{}), nil
+}
+
+// CountDeliveries returns the number of deliveries of a webhook in the
+// database.
+func (r repository) CountDeliveries(ctx context.Context, webhookID,
+	status string) (int, error) {
+
+	var count int
+	params := make(map[string]interface{}, 1)
+	params["webhook_id"] = webhookID
+	params["status"] = status
+
+	query := r.db.N1QLQuery[dbcontext.CountWebhookDeliveries]
+	err := r.db.Count(ctx, query, params, &count)
+	return count, err
+}
+
+// DueDeliveries retrieves the IDs of the deliveries due for an attempt from
+// the database.
+func (r repository) DueDeliveries(ctx context.Context, now int64,
+	limit int) ([]string, error) {
+
+	var results interface{}
+	params := make(map[string]interface{}, 1)
+	params["now"] = now
+	params["limit"] = limit
+
+	query := r.db.N1QLQuery[dbcontext.WebhookDueDeliveries]
+	err := r.db.Query(ctx, query, params, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	err = dbcontext.Decode(results, &ids)
+	return ids, err
+}
@@ -0,0 +1,311 @@
+// Copyright 2022 Saferwall. All rights reserved.
+// Use of this source code is governed by Apache v2 license
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/saferwall/saferwall-api/internal/entity"
+	e "github.com/saferwall/saferwall-api/internal/errors"
+	"github.com/saferwall/saferwall-api/pkg/log"
+)
+
+// Event types webhooks can subscribe to.
+const (
+	FileScanned       = "file.scanned"
+	BehaviorCompleted = "behavior.completed"
+	CommentCreated    = "comment.created"
+	FileTagged        = "file.tagged"
+)
+
+// Status of a webhook delivery.
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	// StatusDead marks the deliveries which exhausted their retries, they
+	// make the dead-letter list of a webhook.
+	StatusDead = "dead"
+)
+
+// Maximum number of webhooks a user can register.
+const maxWebhooksPerUser = 16
+
+var errTooManyWebhooks = e.BadRequest("too many webhooks")
+
+// Webhook represents an endpoint notified of events.
+type Webhook struct {
+	entity.Webhook
+}
+
+// Payload represents the body posted to a webhook URL.
+type Payload struct {
+	Event     string      `json:"event"`
+	Timestamp int64       `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// Event describes something which happened to a file. It is delivered to
+// the webhooks whose owner submitted the file, caused the event or watches
+// the file, the actor or the tag.
+type Event struct {
+	// Name of the event, i.e: `file.scanned`.
+	Name string
+	// SHA256 of the file.
+	SHA256 string
+	// Actor is the user who caused the event, if any.
+	Actor string
+	// Tag applied to the file, only set for `file.tagged` events.
+	Tag string
+	// Data is the payload data posted to the webhooks.
+	Data interface{}
+}
+
+// Service encapsulates usecase logic for webhooks.
+type Service interface {
+	Get(ctx context.Context, id string) (Webhook, error)
+	Query(ctx context.Context, offset, limit int) ([]Webhook, error)
+	Count(ctx context.Context) (int, error)
+	Create(ctx context.Context, input CreateWebhookRequest) (Webhook, error)
+	Update(ctx context.Context, id string, input UpdateWebhookRequest) (
+		Webhook, error)
+	Delete(ctx context.Context, id string) (Webhook, error)
+	Deliveries(ctx context.Context, id, status string, offset, limit int) (
+		[]interface{}, error)
+	CountDeliveries(ctx context.Context, id, status string) (int, error)
+	Redeliver(ctx context.Context, id, deliveryID string) error
+	// Trigger queues an event for delivery to the subscribed webhooks.
+	Trigger(ctx context.Context, ev Event)
+}
+
+type service struct {
+	repo   Repository
+	logger log.Logger
+}
+
+// CreateWebhookRequest represents a webhook creation request.
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" validate:"required,url,startswith=http,max=2048"`
+	Events []string `json:"events" validate:"required,min=1,dive,oneof=file.scanned behavior.completed comment.created file.tagged"`
+}
+
+// UpdateWebhookRequest represents a webhook update request.
+type UpdateWebhookRequest struct {
+	URL    string   `json:"url,omitempty" validate:"omitempty,url,startswith=http,max=2048"`
+	Events []string `json:"events,omitempty" validate:"omitempty,min=1,dive,oneof=file.scanned behavior.completed comment.created file.tagged"`
+	Active *bool    `json:"active,omitempty"`
+}
+
+// NewService creates a new webhook service.
+func NewService(repo Repository, logger log.Logger) Service {
+	return service{repo, logger}
+}
+
+// Get returns the webhook with the specified ID. The secret is only
+// returned when the webhook is created.
+func (s service) Get(ctx context.Context, id string) (Webhook, error) {
+	webhook, err := s.owned(ctx, id)
+	if err != nil {
+		return Webhook{}, err
+	}
+	webhook.Secret = ""
+	return Webhook{webhook}, nil
+}
+
+// Query returns the webhooks of the logged-in user.
+func (s service) Query(ctx context.Context, offset, limit int) (
+	[]Webhook, error) {
+
+	user, _ := ctx.Value(entity.UserKey).(entity.User)
+	items, err := s.repo.Query(ctx, user.ID(), offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	webhooks := make([]Webhook, 0, len(items))
+	for _, item := range items {
+		item.Secret = ""
+		webhooks = append(webhooks, Webhook{item})
+	}
+	return webhooks, nil
+}
+
+// Count returns the number of webhooks of the logged-in user.
+func (s service) Count(ctx context.Context) (int, error) {
+	user, _ := ctx.Value(entity.UserKey).(entity.User)
+	return s.repo.Count(ctx, user.ID())
+}
+
+// Create registers a new webhook for the logged-in user.
+func (s service) Create(ctx context.Context, req CreateWebhookRequest) (
+	Webhook, error) {
+
+	user, _ := ctx.Value(entity.UserKey).(entity.User)
+	count, err := s.repo.Count(ctx, user.ID())
+	if err != nil {
+		return Webhook{}, err
+	}
+	if count >= maxWebhooksPerUser {
+		return Webhook{}, errTooManyWebhooks
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	webhook := entity.Webhook{
+		Type:      "webhook",
+		ID:        entity.ID(),
+		Username:  user.ID(),
+		URL:       req.URL,
+		Events:    req.Events,
+		Secret:    secret,
+		Active:    true,
+		CreatedAt: time.Now().Unix(),
+	}
+	if err = s.repo.Create(ctx, webhook); err != nil {
+		return Webhook{}, err
+	}
+	return Webhook{webhook}, nil
+}
+
+// Update updates the webhook with the specified ID.
+func (s service) Update(ctx context.Context, id string,
+	req UpdateWebhookRequest) (Webhook, error) {
+
+	webhook, err := s.owned(ctx, id)
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	if req.URL != "" {
+		webhook.URL = req.URL
+	}
+	if len(req.Events) > 0 {
+		webhook.Events = req.Events
+	}
+	if req.Active != nil {
+		webhook.Active = *req.Active
+	}
+	if err = s.repo.Update(ctx, webhook); err != nil {
+		return Webhook{}, err
+	}
+
+	webhook.Secret = ""
+	return Webhook{webhook}, nil
+}
+
+// Delete deletes the webhook with the specified ID.
+func (s service) Delete(ctx context.Context, id string) (Webhook, error) {
+	webhook, err := s.owned(ctx, id)
+	if err != nil {
+		return Webhook{}, err
+	}
+	if err = s.repo.Delete(ctx, id); err != nil {
+		return Webhook{}, err
+	}
+	webhook.Secret = ""
+	return Webhook{webhook}, nil
+}
+
+// Deliveries returns the delivery log of a webhook.
+func (s service) Deliveries(ctx context.Context, id, status string,
+	offset, limit int) ([]interface{}, error) {
+	if _, err := s.owned(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.Deliveries(ctx, id, status, offset, limit)
+}
+
+// CountDeliveries returns the number of deliveries of a webhook.
+func (s service) CountDeliveries(ctx context.Context, id, status string) (
+	int, error) {
+	if _, err := s.owned(ctx, id); err != nil {
+		return 0, err
+	}
+	return s.repo.CountDeliveries(ctx, id, status)
+}
+
+// Redeliver queues again a delivery of a webhook, typically one from the
+// dead-letter list.
+func (s service) Redeliver(ctx context.Context, id, deliveryID string) error {
+	if _, err := s.owned(ctx, id); err != nil {
+		return err
+	}
+
+	delivery, cas, err := s.repo.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return err
+	}
+	if delivery.WebhookID != id {
+		return e.NotFound("")
+	}
+	if delivery.Status == StatusPending {
+		return e.Conflict("delivery is already pending")
+	}
+
+	delivery.Status = StatusPending
+	delivery.Attempts = 0
+	delivery.NextAttempt = time.Now().Unix()
+	delivery.LastError = ""
+	_, err = s.repo.UpdateDelivery(ctx, delivery, cas)
+	return err
+}
+
+// Trigger queues an event, the dispatcher later fans it out to the
+// subscribed webhooks so that the request which triggered it does not wait
+// for the subscribers lookup. Webhooks are best effort, errors are only
+// logged so that they never fail the request.
+func (s service) Trigger(ctx context.Context, ev Event) {
+	now := time.Now().Unix()
+	payload, err := json.Marshal(Payload{Event: ev.Name, Timestamp: now,
+		Data: ev.Data})
+	if err != nil {
+		s.logger.With(ctx).Error(err)
+		return
+	}
+
+	err = s.repo.CreateEvent(ctx, entity.WebhookEvent{
+		Type:      "webhook_event",
+		ID:        entity.ID(),
+		Event:     ev.Name,
+		SHA256:    strings.ToLower(ev.SHA256),
+		Actor:     strings.ToLower(ev.Actor),
+		Tag:       ev.Tag,
+		Payload:   string(payload),
+		CreatedAt: now,
+	})
+	if err != nil {
+		s.logger.With(ctx).Error(err)
+	}
+}
+
+// owned returns the webhook with the specified ID provided it belongs to
+// the logged-in user.
+func (s service) owned(ctx context.Context, id string) (entity.Webhook, error) {
+	webhook, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return entity.Webhook{}, err
+	}
+	user, _ := ctx.Value(entity.UserKey).(entity.User)
+	if webhook.Type != "webhook" ||
+		(webhook.Username != user.ID() && !user.IsAdmin()) {
+		return entity.Webhook{}, e.NotFound("")
+	}
+	return webhook, nil
+}
+
+// newSecret generates a random secret used to sign the deliveries.
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -108,3 +108,15 @@ func getCorrelationID(req *http.Request) string {
 func getRequestID(req *http.Request) string {
 	return req.Header.Get("X-Request-ID")
 }
+
+// RequestID returns the request ID recorded in the context, if any.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// CorrelationID returns the correlation ID recorded in the context, if any.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey).(string)
+	return id
+}
@@ -32,6 +32,15 @@ func TestWithRequest(t *testing.T) {
 	assert.Equal(t, "123", ctx.Value(correlationIDKey).(string))
 }
 
+func TestRequestIDs(t *testing.T) {
+	assert.Empty(t, RequestID(context.Background()))
+	assert.Empty(t, CorrelationID(context.Background()))
+
+	ctx := WithRequest(context.Background(), buildRequest("abc", "123"))
+	assert.Equal(t, "abc", RequestID(ctx))
+	assert.Equal(t, "123", CorrelationID(ctx))
+}
+
 func Test_getCorrelationID(t *testing.T) {
 	req, _ := http.NewRequest("GET", "http://example.com",
 	 bytes.NewBufferString(""))
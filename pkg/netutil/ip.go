@@ -0,0 +1,16 @@
+// Package netutil provides helpers to classify network addresses.
+package netutil
+
+import "net"
+
+// cgnat is the shared address space of carrier-grade NATs, RFC 6598.
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0).To4(),
+	Mask: net.CIDRMask(10, 32)}
+
+// IsPublicIP checks whether an IP address is routable on the internet. The
+// private and shared address spaces are left out, they are commonly used by
+// internal networks, VPNs and cloud providers.
+func IsPublicIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !ip.IsLoopback() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsUnspecified() && !cgnat.Contains(ip)
+}
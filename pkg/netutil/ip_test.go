@@ -0,0 +1,29 @@
+package netutil
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	for _, ip := range []string{"1.1.1.1", "93.184.216.34", "100.128.0.1",
+		"2606:2800:220:1::248"} {
+		assert.True(t, IsPublicIP(net.ParseIP(ip)), ip)
+	}
+	for _, ip := range []string{
+		// Private and unique local.
+		"10.1.2.3", "172.16.0.1", "192.168.56.101", "fd00::1",
+		// Loopback.
+		"127.0.0.1", "::1",
+		// Link-local.
+		"169.254.169.254", "fe80::1",
+		// Carrier-grade NAT.
+		"100.64.0.1", "100.127.255.254",
+		// Unspecified, broadcast and multicast.
+		"0.0.0.0", "::", "255.255.255.255", "224.0.0.251", "ff02::1",
+	} {
+		assert.False(t, IsPublicIP(net.ParseIP(ip)), ip)
+	}
+}
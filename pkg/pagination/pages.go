@@ -88,6 +88,13 @@ func (p *Pages) Limit() int {
 	return p.PerPage
 }
 
+// Bounds returns the bounds of the items of the page within a list of n
+// items, for lists paginated in memory.
+func (p *Pages) Bounds(n int) (start, end int) {
+	start = min(p.Offset(), n)
+	return start, min(start+p.Limit(), n)
+}
+
 // BuildLinkHeader returns an HTTP header containing the links about the pagination.
 func (p *Pages) BuildLinkHeader(baseURL string, defaultPerPage int) string {
 	links := p.BuildLinks(baseURL, defaultPerPage)
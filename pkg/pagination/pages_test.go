@@ -99,4 +99,16 @@ func TestNewFromRequest(t *testing.T) {
 	assert.Equal(t, 20, p.PerPage)
 	assert.Equal(t, 100, p.TotalCount)
 	assert.Equal(t, 5, p.PageCount)
-}
\ No newline at end of file
+}
+
+func TestPages_Bounds(t *testing.T) {
+	start, end := New(2, 20, 50).Bounds(50)
+	assert.Equal(t, 20, start)
+	assert.Equal(t, 40, end)
+	start, end = New(3, 20, 50).Bounds(50)
+	assert.Equal(t, 40, start)
+	assert.Equal(t, 50, end)
+	start, end = New(1, 20, 0).Bounds(0)
+	assert.Zero(t, start)
+	assert.Zero(t, end)
+}